@@ -0,0 +1,41 @@
+package broadcast
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServeAdminUI(t *testing.T) {
+	response := testApiRequest(http.HandlerFunc(serveAdminUI), "GET", "/admin/", "")
+
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Wrong Content-Type :\n got: %v\nwant: %v", contentType, "text/html; charset=utf-8")
+	}
+	for _, reference := range []string{"/api/v1", "/notifications", "/soundmeter.ws"} {
+		if !strings.Contains(response.Body.String(), reference) {
+			t.Errorf("Admin page should use %s", reference)
+		}
+	}
+}
+
+func TestServeAdminUI_errors(t *testing.T) {
+	conditions := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"POST", "/admin/", 405},
+		{"GET", "/admin/dummy.js", 404},
+	}
+
+	for _, condition := range conditions {
+		response := testApiRequest(http.HandlerFunc(serveAdminUI), condition.method, condition.path, "")
+		if response.Code != condition.code {
+			t.Errorf("Wrong response code for %s %s :\n got: %v\nwant: %v", condition.method, condition.path, response.Code, condition.code)
+		}
+	}
+}
@@ -23,6 +23,11 @@ type AlsaInput struct {
 	buffer       []byte
 
 	decoder *InterleavedAudioCoder
+
+	// Invoked when the device can't be read
+	ErrorHandler func(err error)
+
+	loops runLoops
 }
 
 func (input *AlsaInput) Init() (err error) {
@@ -84,6 +89,9 @@ func (input *AlsaInput) Read() (err error) {
 
 	if err != nil {
 		Log.Printf("Read error : %v\n", err)
+		if input.ErrorHandler != nil {
+			input.ErrorHandler(err)
+		}
 		return err
 	}
 	if readBytes != input.bufferLength {
@@ -116,11 +124,26 @@ func (input *AlsaInput) ChannelCount() int {
 }
 
 func (input *AlsaInput) Run() {
-	for {
+	if !input.loops.Start() {
+		return
+	}
+	defer input.loops.Done()
+
+	for !input.loops.Stopped() {
 		input.Read()
 	}
 }
 
+// Stops the Run loop and closes the device. No audio is sent to the
+// AudioHandler once Stop returns.
+func (input *AlsaInput) Stop() error {
+	input.loops.Stop()
+	input.loops.Wait()
+
+	input.handle.Close()
+	return nil
+}
+
 type AlsaInputConfig struct {
 	Device         string
 	SampleRate     int
@@ -152,3 +175,16 @@ func (config *AlsaInputConfig) Apply(alsaInput *AlsaInput) {
 		alsaInput.remixer = NewRemixer(config.Remix)
 	}
 }
+
+func (config *AlsaInputConfig) Validate(errors *ConfigErrors) {
+	if config.SampleRate <= 0 {
+		errors.Add("SampleRate", "must be positive")
+	}
+	if config.Channels <= 0 {
+		errors.Add("Channels", "must be positive")
+	}
+	if config.BufferDuration < 0 {
+		errors.Add("BufferDuration", "can't be negative")
+	}
+	validateSampleFormat(errors, "SampleFormat", config.SampleFormat)
+}
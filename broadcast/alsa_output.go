@@ -111,3 +111,13 @@ func (config *AlsaOutputConfig) Apply(alsaOutput *AlsaOutput) {
 	alsaOutput.SampleFormat = ParseSampleFormat(config.SampleFormat)
 	alsaOutput.Channels = config.ChannelCount
 }
+
+func (config *AlsaOutputConfig) Validate(errors *ConfigErrors) {
+	if config.SampleRate <= 0 {
+		errors.Add("SampleRate", "must be positive")
+	}
+	if config.ChannelCount <= 0 {
+		errors.Add("ChannelCount", "must be positive")
+	}
+	validateSampleFormat(errors, "SampleFormat", config.SampleFormat)
+}
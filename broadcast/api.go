@@ -0,0 +1,144 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Returned by ConfigManager.SaveConfig when the command has no config file
+var ErrNoConfigFile = errors.New("No config file")
+
+// An ApiError is the JSON body of the API error responses. Errors
+// contains the invalid fields (when the request is invalid).
+type ApiError struct {
+	Message string
+	Errors  ConfigErrors `json:",omitempty"`
+}
+
+func writeApiJSON(response http.ResponseWriter, status int, value interface{}) {
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		writeApiError(response, 500, err.Error())
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	response.Write(jsonBytes)
+}
+
+func writeApiError(response http.ResponseWriter, status int, message string) {
+	writeApiJSON(response, status, ApiError{Message: message})
+}
+
+// Writes a 400 error with the invalid fields of ConfigErrors or a 500 error
+func writeApiFailure(response http.ResponseWriter, err error) {
+	switch err := err.(type) {
+	case ConfigErrors:
+		writeApiJSON(response, 400, ApiError{Message: "Invalid request", Errors: err})
+	default:
+		writeApiError(response, 500, err.Error())
+	}
+}
+
+// Decodes and validates the given JSON request body. Unknown keys are refused.
+func decodeApiRequest(body []byte, value interface{}) error {
+	if len(body) == 0 {
+		return ConfigErrors{{Message: "empty request body"}}
+	}
+
+	err := DecodeConfig(body, value)
+	if err != nil {
+		return err
+	}
+	return ValidateConfig(value)
+}
+
+// Matches the (quoted) parameters of route paths, like "{id}"
+var apiParameterPattern = regexp.MustCompile(`\\\{[a-z]+\\\}`)
+
+type apiHandler func(response http.ResponseWriter, request *http.Request, parameters []string, body []byte)
+
+type apiRoute struct {
+	pattern  *regexp.Regexp
+	handlers map[string]apiHandler
+}
+
+// An apiRouter dispatches requests according to their path and method.
+// Several routes can match the same path (like "/streams/start" and
+// "/streams/{id}") with different methods. Unknown paths are refused with
+// 404 and unsupported methods with 405.
+type apiRouter struct {
+	prefix string
+	routes []*apiRoute
+}
+
+// Registers the handler of the given method. The path pattern can contain
+// parameters (like "/streams/{id}").
+func (router *apiRouter) Handle(method string, path string, handler apiHandler) {
+	expression := "^" + apiParameterPattern.ReplaceAllString(regexp.QuoteMeta(router.prefix+path), "([^/]+)") + "$"
+
+	for _, route := range router.routes {
+		if route.pattern.String() == expression {
+			route.handlers[method] = handler
+			return
+		}
+	}
+
+	router.routes = append(router.routes, &apiRoute{
+		pattern:  regexp.MustCompile(expression),
+		handlers: map[string]apiHandler{method: handler},
+	})
+}
+
+func (router *apiRouter) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	// Methods of the routes which match the path
+	allowedMethods := map[string]bool{}
+
+	for _, route := range router.routes {
+		match := route.pattern.FindStringSubmatch(request.URL.Path)
+		if match == nil {
+			continue
+		}
+
+		handler, ok := route.handlers[request.Method]
+		if !ok {
+			for method := range route.handlers {
+				allowedMethods[method] = true
+			}
+			continue
+		}
+
+		var body []byte
+		if request.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(request.Body)
+			if err != nil {
+				writeApiError(response, 400, err.Error())
+				return
+			}
+		}
+
+		handler(response, request, match[1:], body)
+		return
+	}
+
+	if len(allowedMethods) > 0 {
+		methods := []string{}
+		for method := range allowedMethods {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		response.Header().Set("Allow", strings.Join(methods, ", "))
+		writeApiError(response, 405, "Method not allowed")
+		return
+	}
+
+	writeApiError(response, 404, "Not found")
+}
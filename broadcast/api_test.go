@@ -0,0 +1,146 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testApiRouter() *apiRouter {
+	router := &apiRouter{prefix: "/api/test"}
+	router.Handle("GET", "/items", func(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+		writeApiJSON(response, 200, []string{"first", "second"})
+	})
+	router.Handle("POST", "/items", func(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+		writeApiJSON(response, 201, string(body))
+	})
+	router.Handle("GET", "/items/{id}", func(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+		writeApiJSON(response, 200, parameters)
+	})
+	return router
+}
+
+func testApiRequest(handler http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, "http://localhost:9000"+path, strings.NewReader(body))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	return response
+}
+
+func testApiErrorResponse(t *testing.T, response *httptest.ResponseRecorder) ApiError {
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Wrong error Content-Type :\n got: %v\nwant: %v", contentType, "application/json")
+	}
+
+	apiError := ApiError{}
+	if err := json.Unmarshal(response.Body.Bytes(), &apiError); err != nil {
+		t.Errorf("Error body should be an ApiError :\n got: %s (%v)", response.Body.String(), err)
+	}
+	return apiError
+}
+
+func TestApiRouter_ServeHTTP(t *testing.T) {
+	router := testApiRouter()
+
+	conditions := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/api/test/items", 200, `["first","second"]`},
+		{"POST", "/api/test/items", 201, `"dummy"`},
+		{"GET", "/api/test/items/42", 200, `["42"]`},
+		{"GET", "/api/test/items/", 404, `{"Message":"Not found"}`},
+		{"GET", "/api/test/items/42/dummy", 404, `{"Message":"Not found"}`},
+		{"GET", "/api/test/other", 404, `{"Message":"Not found"}`},
+		{"DELETE", "/api/test/items", 405, `{"Message":"Method not allowed"}`},
+	}
+
+	for _, condition := range conditions {
+		response := testApiRequest(router, condition.method, condition.path, "dummy")
+
+		if response.Code != condition.code {
+			t.Errorf("Wrong response code for %s %s :\n got: %v\nwant: %v", condition.method, condition.path, response.Code, condition.code)
+		}
+		if body := response.Body.String(); body != condition.body {
+			t.Errorf("Wrong response body for %s %s :\n got: %v\nwant: %v", condition.method, condition.path, body, condition.body)
+		}
+	}
+}
+
+func TestApiRouter_ServeHTTP_allow(t *testing.T) {
+	response := testApiRequest(testApiRouter(), "PUT", "/api/test/items", "")
+
+	if allow := response.Header().Get("Allow"); allow != "GET, POST" {
+		t.Errorf("Wrong Allow header :\n got: %v\nwant: %v", allow, "GET, POST")
+	}
+}
+
+func TestApiRouter_ServeHTTP_sharedPath(t *testing.T) {
+	router := testApiRouter()
+	router.Handle("POST", "/items/start", func(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+		writeApiJSON(response, 200, "started")
+	})
+
+	if response := testApiRequest(router, "POST", "/api/test/items/start", ""); response.Body.String() != `"started"` {
+		t.Errorf("Wrong response for POST :\n got: %v\nwant: %v", response.Body.String(), `"started"`)
+	}
+	if response := testApiRequest(router, "GET", "/api/test/items/start", ""); response.Body.String() != `["start"]` {
+		t.Errorf("Wrong response for GET :\n got: %v\nwant: %v", response.Body.String(), `["start"]`)
+	}
+
+	response := testApiRequest(router, "DELETE", "/api/test/items/start", "")
+	if allow := response.Header().Get("Allow"); response.Code != 405 || allow != "GET, POST" {
+		t.Errorf("Wrong response for DELETE :\n got: %v (%s)\nwant: %v (%s)", response.Code, allow, 405, "GET, POST")
+	}
+}
+
+func TestWriteApiFailure(t *testing.T) {
+	response := httptest.NewRecorder()
+	writeApiFailure(response, ConfigErrors{{Field: "Target", Message: "can't be empty"}})
+
+	if response.Code != 400 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 400)
+	}
+	expectedError := ApiError{Message: "Invalid request", Errors: ConfigErrors{{Field: "Target", Message: "can't be empty"}}}
+	if apiError := testApiErrorResponse(t, response); !reflect.DeepEqual(apiError, expectedError) {
+		t.Errorf("Wrong error :\n got: %v\nwant: %v", apiError, expectedError)
+	}
+
+	response = httptest.NewRecorder()
+	writeApiFailure(response, errors.New("dummy"))
+
+	if response.Code != 500 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 500)
+	}
+	if apiError := testApiErrorResponse(t, response); apiError.Message != "dummy" {
+		t.Errorf("Wrong error message :\n got: %v\nwant: %v", apiError.Message, "dummy")
+	}
+}
+
+func TestDecodeApiRequest(t *testing.T) {
+	conditions := []struct {
+		body   string
+		errors bool
+	}{
+		{`{"Amplification": 3}`, false},
+		{``, true},
+		{`{"Amplification": `, true},
+		{`{"Amplification": "dummy"}`, true},
+		{`{"Dummy": 3}`, true},
+	}
+
+	for _, condition := range conditions {
+		config := ProcessingConfig{}
+		err := decodeApiRequest([]byte(condition.body), &config)
+
+		if _, ok := err.(ConfigErrors); ok != condition.errors {
+			t.Errorf("Wrong decode result for '%s' :\n got: %v\nwant ConfigErrors: %v", condition.body, err, condition.errors)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package broadcast
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ApiV1Controller serves the /api/v1 routes (described by ApiV1OpenAPI).
+//
+// Errors are returned as ApiError with 400 (invalid request), 404 (unknown
+// resource or path), 405 (unsupported method) and 409 (conflict) codes.
+// The routes of nil components are not found.
+type ApiV1Controller struct {
+	Streams    *HttpStreamOutputs
+	Processing *Processing
+	Config     ConfigManager
+	SoundMeter *SoundMeterAudioHandler
+	Notifier   *Notifier
+
+	router     *apiRouter
+	routerOnce sync.Once
+}
+
+const ApiV1Prefix = "/api/v1"
+
+func NewApiV1Controller() *ApiV1Controller {
+	return &ApiV1Controller{}
+}
+
+func (controller *ApiV1Controller) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	// The routes depend on the components set after the construction
+	controller.routerOnce.Do(func() {
+		controller.router = controller.newRouter()
+	})
+	controller.router.ServeHTTP(response, request)
+}
+
+func (controller *ApiV1Controller) newRouter() *apiRouter {
+	router := &apiRouter{prefix: ApiV1Prefix}
+
+	if controller.Streams != nil {
+		router.Handle("GET", "/streams", controller.indexStreams)
+		router.Handle("POST", "/streams", controller.createStream)
+		router.Handle("PUT", "/streams", controller.reconcileStreams)
+		router.Handle("GET", "/streams/{id}", controller.showStream)
+		router.Handle("PUT", "/streams/{id}", controller.updateStream)
+		router.Handle("DELETE", "/streams/{id}", controller.deleteStream)
+		router.Handle("POST", "/streams/{id}/{action}", controller.performStreamAction)
+		for _, action := range StreamActions {
+			router.Handle("POST", "/streams/"+action, controller.performStreamsAction)
+		}
+	}
+
+	if controller.Processing != nil {
+		router.Handle("GET", "/processing", controller.showProcessing)
+		router.Handle("PUT", "/processing", controller.updateProcessing)
+	}
+
+	if controller.Config != nil {
+		router.Handle("GET", "/config", controller.showConfig)
+		router.Handle("POST", "/config/save", controller.saveConfig)
+		router.Handle("GET", "/config/history", controller.configHistory)
+		router.Handle("GET", "/config/history/{version}", controller.showConfigVersion)
+		router.Handle("POST", "/config/rollback/{version}", controller.rollbackConfig)
+	}
+
+	router.Handle("GET", "/events", controller.indexEvents)
+
+	if controller.SoundMeter != nil {
+		router.Handle("GET", "/soundmeter", controller.showSoundMeter)
+	}
+
+	if controller.Notifier != nil {
+		router.Handle("GET", "/notifications", controller.notifications)
+	}
+
+	return router
+}
+
+// Returns the stream status, without Icecast/Shoutcast password for non admin users
+func (controller *ApiV1Controller) streamStatus(request *http.Request, stream *BufferedHttpStreamOutput) BufferedHttpStreamOutputStatus {
+	status := stream.Status()
+	if HttpRequestUser(request).Role != HttpRoleAdmin {
+		status.Target = MaskURLPassword(status.Target)
+	}
+	return status
+}
+
+// Returns the stream with the given identifier (or writes a 404 error)
+func (controller *ApiV1Controller) stream(response http.ResponseWriter, identifier string) *BufferedHttpStreamOutput {
+	stream := controller.Streams.Stream(identifier)
+	if stream == nil {
+		writeApiError(response, 404, fmt.Sprintf("Stream not found: '%s'", identifier))
+	}
+	return stream
+}
+
+func (controller *ApiV1Controller) indexStreams(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	statuses := []BufferedHttpStreamOutputStatus{}
+	for _, stream := range controller.Streams.streamList() {
+		statuses = append(statuses, controller.streamStatus(request, stream))
+	}
+	writeApiJSON(response, 200, statuses)
+}
+
+func (controller *ApiV1Controller) createStream(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	config := NewBufferedHttpStreamOutputConfig()
+	if err := decodeApiRequest(body, &config); err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+	if config.Empty() {
+		writeApiFailure(response, ConfigErrors{{Field: "Target", Message: "can't be empty"}})
+		return
+	}
+
+	stream, err := controller.Streams.CreateNew(&config)
+	if err == ErrStreamExists {
+		writeApiError(response, 409, fmt.Sprintf("Stream already exists: '%s'", config.Identifier))
+		return
+	}
+	if err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+
+	if err := stream.Init(); err != nil {
+		controller.Streams.Destroy(stream.Identifier)
+		writeApiError(response, 500, fmt.Sprintf("Can't initialize stream: %v", err))
+		return
+	}
+	stream.Start()
+
+	writeApiJSON(response, 201, stream.Config())
+}
+
+func (controller *ApiV1Controller) reconcileStreams(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	config := controller.Streams.Config()
+	config.Streams = []BufferedHttpStreamOutputConfig{}
+
+	// Streams are decoded one by one to use the default values
+	definitions := []rawConfig{}
+	if err := decodeApiRequest(body, &definitions); err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+
+	identifiers := make(map[string]bool)
+	for index, definition := range definitions {
+		streamConfig := NewBufferedHttpStreamOutputConfig()
+		if err := DecodeConfig(definition, &streamConfig); err != nil {
+			writeApiFailure(response, prefixConfigErrors(err, fmt.Sprintf("Streams[%d]", index)))
+			return
+		}
+
+		identifier := streamConfig.Identifier
+		if identifier == "" {
+			identifier = defaultStreamIdentifier(streamConfig.Target)
+		}
+		if identifiers[identifier] {
+			writeApiError(response, 409, fmt.Sprintf("Duplicated stream identifier: '%s'", identifier))
+			return
+		}
+		identifiers[identifier] = true
+
+		config.Streams = append(config.Streams, streamConfig)
+	}
+
+	if err := ValidateConfig(&config); err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+
+	writeApiJSON(response, 200, controller.Streams.Reconcile(&config))
+}
+
+func (controller *ApiV1Controller) showStream(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	if stream := controller.stream(response, parameters[0]); stream != nil {
+		writeApiJSON(response, 200, controller.streamStatus(request, stream))
+	}
+}
+
+func (controller *ApiV1Controller) updateStream(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	stream := controller.stream(response, parameters[0])
+	if stream == nil {
+		return
+	}
+
+	config := stream.Config()
+	if err := decodeApiRequest(body, &config); err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+	if config.Empty() {
+		writeApiFailure(response, ConfigErrors{{Field: "Target", Message: "can't be empty"}})
+		return
+	}
+	if config.Identifier != stream.Identifier {
+		writeApiError(response, 409, fmt.Sprintf("Stream identifier can't be changed: '%s'", stream.Identifier))
+		return
+	}
+
+	controller.Streams.Update(stream, &config)
+	writeApiJSON(response, 200, stream.Config())
+}
+
+func (controller *ApiV1Controller) deleteStream(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	stream := controller.Streams.Destroy(parameters[0])
+	if stream == nil {
+		writeApiError(response, 404, fmt.Sprintf("Stream not found: '%s'", parameters[0]))
+		return
+	}
+	stream.Stop()
+
+	writeApiJSON(response, 200, stream.Config())
+}
+
+func (controller *ApiV1Controller) performStreamAction(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	stream := controller.stream(response, parameters[0])
+	if stream == nil {
+		return
+	}
+	if !validStreamAction(parameters[1]) {
+		writeApiError(response, 404, fmt.Sprintf("Unknown stream action: '%s'", parameters[1]))
+		return
+	}
+
+	err := stream.Perform(parameters[1])
+	if err == ErrStreamDisabled || err == ErrStreamNotStarted {
+		writeApiError(response, 409, err.Error())
+		return
+	}
+	if err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+
+	writeApiJSON(response, 200, controller.streamStatus(request, stream))
+}
+
+// Performs the action of the path ("/streams/<action>") on all streams
+func (controller *ApiV1Controller) performStreamsAction(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	action := request.URL.Path[strings.LastIndex(request.URL.Path, "/")+1:]
+	if err := controller.Streams.Perform(action); err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+
+	controller.indexStreams(response, request, parameters, body)
+}
+
+func (controller *ApiV1Controller) showProcessing(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	writeApiJSON(response, 200, controller.Processing.Config())
+}
+
+func (controller *ApiV1Controller) updateProcessing(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	config := *controller.Processing.Config()
+	if err := decodeApiRequest(body, &config); err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+
+	controller.Processing.Setup(&config)
+	writeApiJSON(response, 200, config)
+}
+
+func (controller *ApiV1Controller) showConfig(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	writeApiJSON(response, 200, rawConfig(controller.Config.ConfigToJSON()))
+}
+
+func (controller *ApiV1Controller) saveConfig(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	err := controller.Config.SaveConfig()
+	if err == ErrNoConfigFile {
+		writeApiError(response, 409, "Config can't be saved without config file")
+		return
+	}
+	if err != nil {
+		writeApiError(response, 500, fmt.Sprintf("Can't save config: %v", err))
+		return
+	}
+
+	controller.showConfig(response, request, parameters, body)
+}
+
+// Returns the config history (or writes a 404 error)
+func (controller *ApiV1Controller) history(response http.ResponseWriter) *ConfigHistory {
+	history := controller.Config.ConfigHistory()
+	if history == nil {
+		writeApiError(response, 404, "No config history")
+	}
+	return history
+}
+
+func (controller *ApiV1Controller) configHistory(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	history := controller.history(response)
+	if history == nil {
+		return
+	}
+
+	versions, err := history.Versions()
+	if err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+	writeApiJSON(response, 200, versions)
+}
+
+// Returns the content of the given version (or writes a 400 or 404 error)
+func (controller *ApiV1Controller) configVersion(response http.ResponseWriter, parameter string) []byte {
+	version, err := strconv.Atoi(parameter)
+	if err != nil {
+		writeApiError(response, 400, fmt.Sprintf("Invalid config version: '%s'", parameter))
+		return nil
+	}
+
+	history := controller.history(response)
+	if history == nil {
+		return nil
+	}
+
+	data, err := history.Load(version)
+	if err != nil {
+		writeApiFailure(response, err)
+		return nil
+	}
+	if data == nil {
+		writeApiError(response, 404, fmt.Sprintf("Config version %d not found", version))
+	}
+	return data
+}
+
+func (controller *ApiV1Controller) showConfigVersion(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	if data := controller.configVersion(response, parameters[0]); data != nil {
+		writeApiJSON(response, 200, rawConfig(data))
+	}
+}
+
+func (controller *ApiV1Controller) rollbackConfig(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	data := controller.configVersion(response, parameters[0])
+	if data == nil {
+		return
+	}
+
+	Log.Printf("Rollback config to version %s", parameters[0])
+
+	if err := controller.Config.ApplyConfig(data); err != nil {
+		writeApiFailure(response, err)
+		return
+	}
+
+	controller.saveConfig(response, request, parameters, body)
+}
+
+func (controller *ApiV1Controller) indexEvents(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	events := EventLog.Events()
+	if events == nil {
+		events = []*Event{}
+	}
+	writeApiJSON(response, 200, events)
+}
+
+func (controller *ApiV1Controller) showSoundMeter(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	writeApiJSON(response, 200, controller.SoundMeter)
+}
+
+// Pushes the notifications as server-sent events (see NotificationController)
+func (controller *ApiV1Controller) notifications(response http.ResponseWriter, request *http.Request, parameters []string, body []byte) {
+	filter, err := notificationFilter(request)
+	if err != nil {
+		writeApiError(response, 400, err.Error())
+		return
+	}
+	if _, ok := response.(http.Flusher); !ok {
+		writeApiError(response, 500, "Streaming not supported")
+		return
+	}
+
+	receiver := controller.Notifier.Subscribe(filter)
+	defer receiver.Close()
+
+	serveNotificationEvents(response, request, receiver)
+}
+
+// A rawConfig is a JSON value written as is
+type rawConfig []byte
+
+func (config rawConfig) MarshalJSON() ([]byte, error) {
+	return config, nil
+}
+
+func (config *rawConfig) UnmarshalJSON(data []byte) error {
+	*config = append((*config)[0:0], data...)
+	return nil
+}
+
+// Prefixes the fields of ConfigErrors (like "Streams[0].Target")
+func prefixConfigErrors(err error, prefix string) error {
+	configErrors, ok := err.(ConfigErrors)
+	if !ok {
+		return err
+	}
+
+	prefixed := ConfigErrors{}
+	for _, configError := range configErrors {
+		prefixed.Add(joinConfigField(prefix, configError.Field), "%s", configError.Message)
+	}
+	return prefixed
+}
@@ -0,0 +1,62 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestApiV1OpenAPI(t *testing.T) {
+	description := struct {
+		Paths map[string]map[string]interface{}
+	}{}
+	if err := json.Unmarshal([]byte(ApiV1OpenAPI), &description); err != nil {
+		t.Fatalf("OpenAPI description should be valid JSON : %v", err)
+	}
+
+	router := testApiV1Controller().newRouter()
+	for _, route := range router.routes {
+		// "^/api/v1/streams/([^/]+)$" is described as "/streams/{parameter}"
+		path := strings.TrimPrefix(strings.TrimSuffix(route.pattern.String(), "$"), "^"+ApiV1Prefix)
+		path = strings.Replace(path, "([^/]+)", "{", -1)
+
+		found := false
+		for describedPath, methods := range description.Paths {
+			if apiParameterDescription.ReplaceAllString(describedPath, "{") != path {
+				continue
+			}
+			found = true
+			for method := range route.handlers {
+				if _, ok := methods[strings.ToLower(method)]; !ok {
+					t.Errorf("OpenAPI description should contain %s %s", method, describedPath)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("OpenAPI description should contain %s", path)
+		}
+	}
+}
+
+var apiParameterDescription = regexp.MustCompile(`\{[a-z]+\}`)
+
+func TestServeApiV1OpenAPI(t *testing.T) {
+	response := testApiRequest(http.HandlerFunc(serveApiV1OpenAPI), "GET", "/api/v1/openapi.json", "")
+
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Wrong Content-Type :\n got: %v\nwant: %v", contentType, "application/json")
+	}
+	if !json.Valid(response.Body.Bytes()) {
+		t.Errorf("Response should be the OpenAPI description")
+	}
+
+	response = testApiRequest(http.HandlerFunc(serveApiV1OpenAPI), "POST", "/api/v1/openapi.json", "")
+	if response.Code != 405 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 405)
+	}
+}
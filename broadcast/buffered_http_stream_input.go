@@ -39,6 +39,10 @@ func (input *BufferedHttpStreamInput) Run() {
 	input.http.Run()
 }
 
+func (input *BufferedHttpStreamInput) Stop() error {
+	return input.http.Stop()
+}
+
 func (input *BufferedHttpStreamInput) Read() *Audio {
 	return input.buffer.Read()
 }
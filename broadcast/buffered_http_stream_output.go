@@ -1,11 +1,13 @@
 package broadcast
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"hash/crc32"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,7 +17,10 @@ type BufferedHttpStreamOutput struct {
 	output *HttpStreamOutput
 	buffer AudioBuffer
 
-	started bool
+	// Restarts the output after a crash
+	supervisor Supervisor
+	// Start and Stop can be invoked by several API requests
+	mutex sync.Mutex
 
 	unfillAudioBuffer *UnfillAudioBuffer
 	memoryAudioBuffer *MemoryAudioBuffer
@@ -46,7 +51,11 @@ func NewBufferedHttpStreamOutput() *BufferedHttpStreamOutput {
 }
 
 func (output *BufferedHttpStreamOutput) defaultIdentifier() string {
-	return strconv.FormatInt(int64(crc32.ChecksumIEEE([]byte(output.output.Target))), 16)
+	return defaultStreamIdentifier(output.output.Target)
+}
+
+func defaultStreamIdentifier(target string) string {
+	return strconv.FormatInt(int64(crc32.ChecksumIEEE([]byte(target))), 16)
 }
 
 func (output *BufferedHttpStreamOutput) metrics() *LocalMetrics {
@@ -63,22 +72,108 @@ func (output *BufferedHttpStreamOutput) eventLog() *LocalEventLog {
 	return output.EventLog
 }
 
+// The name of the supervised output (used by the Restarts metric)
+func (output *BufferedHttpStreamOutput) supervisedName() string {
+	return fmt.Sprintf("stream-%s", output.Identifier)
+}
+
+// Runs the output under supervision (restarted after a crash)
 func (output *BufferedHttpStreamOutput) Start() {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
 	if output.output.disabled {
 		Log.Debugf("Stream is disabled, doesn't start")
 		return
 	}
+	if output.OperationalStatus() == "started" {
+		Log.Debugf("Stream is already started")
+		return
+	}
+
+	// The supervisor runs the output (instead of HttpStreamOutput.Start)
+	output.output.prepare()
+	output.supervisor.Start(output.supervisedName(), output.output)
+}
+
+func (output *BufferedHttpStreamOutput) Stop() error {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	if output.OperationalStatus() != "started" {
+		return nil
+	}
+	return output.supervisor.Stop(output.supervisedName())
+}
+
+// The actions which can be performed on a stream (see Perform)
+var StreamActions = []string{"start", "stop", "enable", "disable", "reconnect"}
+
+var (
+	ErrStreamDisabled   = errors.New("Stream is disabled")
+	ErrStreamNotStarted = errors.New("Stream isn't started")
+	ErrStreamExists     = errors.New("Stream already exists")
+)
+
+// Performs one of the StreamActions. Enable and disable change the stream
+// config (and the saved config), start, stop and reconnect don't.
+func (output *BufferedHttpStreamOutput) Perform(action string) error {
+	switch action {
+	case "start":
+		if output.AdminStatus() == "disabled" {
+			return ErrStreamDisabled
+		}
+		output.Start()
+	case "stop":
+		output.Stop()
+	case "enable":
+		output.Enable()
+	case "disable":
+		output.Disable()
+	case "reconnect":
+		if output.OperationalStatus() != "started" {
+			return ErrStreamNotStarted
+		}
+		output.output.Reconnect()
+	default:
+		return fmt.Errorf("Unknown stream action: '%s'", action)
+	}
+	return nil
+}
+
+// Enables and starts the stream
+func (output *BufferedHttpStreamOutput) Enable() {
+	if !output.config.Disabled {
+		return
+	}
 
-	output.output.Start()
-	output.started = true
+	config := output.Config()
+	config.Disabled = false
+	output.Setup(&config)
+
+	output.eventLog().NewEvent("Enabled")
+	output.Start()
 }
 
-func (output *BufferedHttpStreamOutput) Stop() {
-	output.started = false
-	output.output.Stop()
+// Stops and disables the stream
+func (output *BufferedHttpStreamOutput) Disable() {
+	if output.config.Disabled {
+		return
+	}
+
+	config := output.Config()
+	config.Disabled = true
+	output.Setup(&config)
+
+	output.eventLog().NewEvent("Disabled")
+	output.Stop()
 }
 
 func (output *BufferedHttpStreamOutput) Setup(config *BufferedHttpStreamOutputConfig) {
+	// The caller can modify its config after the Setup
+	configCopy := *config
+	config = &configCopy
+
 	config.HttpStreamOutputConfig.Apply(output.output)
 	if config.Identifier != "" {
 		output.Identifier = config.Identifier
@@ -90,6 +185,43 @@ func (output *BufferedHttpStreamOutput) Setup(config *BufferedHttpStreamOutputCo
 	output.setDefaultIdentifier()
 }
 
+// Applies the given config to the running stream. The stream is restarted
+// only when its connection or encoding changes. Returns true if the stream
+// has been restarted.
+func (output *BufferedHttpStreamOutput) Update(config *BufferedHttpStreamOutputConfig) bool {
+	restart := output.config == nil || output.config.RequiresRestart(config)
+	output.eventLog().NewEvent("Config changed")
+
+	if restart {
+		output.Stop()
+		output.Setup(config)
+		output.Start()
+		return true
+	}
+
+	wasDisabled := output.config.Disabled
+	output.Setup(config)
+
+	// The stream can be enabled or disabled without restart
+	if config.Disabled && !wasDisabled {
+		output.Stop()
+	}
+	if !config.Disabled && wasDisabled {
+		output.Start()
+	}
+
+	return false
+}
+
+// Returns true when the buffered audio has been sent. Disconnected and
+// time shifted streams are considered as drained.
+func (output *BufferedHttpStreamOutput) Drained() bool {
+	if !output.output.IsConnected() || output.TimeShift() > 0 {
+		return true
+	}
+	return output.buffer.SampleCount() == 0
+}
+
 func (output *BufferedHttpStreamOutput) Config() BufferedHttpStreamOutputConfig {
 	return *output.config
 }
@@ -110,6 +242,57 @@ func (output *BufferedHttpStreamOutput) Status() BufferedHttpStreamOutputStatus
 	return status
 }
 
+// Returns the efficiency of the last complete time window (false before
+// the first one)
+func (output *BufferedHttpStreamOutput) LastEfficiency() (float64, bool) {
+	efficiencies := output.efficiencyMeter.History().Efficiencies
+	if len(efficiencies) == 0 {
+		return 0, false
+	}
+	return efficiencies[len(efficiencies)-1], true
+}
+
+// Returns the fill of the stream buffer (between 0 and 1)
+func (output *BufferedHttpStreamOutput) BufferFill() float64 {
+	if output.unfillAudioBuffer.MaxSampleCount == 0 {
+		return 0
+	}
+	return float64(output.buffer.SampleCount()) / float64(output.unfillAudioBuffer.MaxSampleCount)
+}
+
+func (output *BufferedHttpStreamOutput) PrometheusSamples() []PrometheusSample {
+	labels := map[string]string{"stream": output.Identifier}
+
+	var connected float64
+	if output.output.IsConnected() {
+		connected = 1
+	}
+
+	return []PrometheusSample{
+		{Name: prometheusMetricName("buffer_fill"), Type: "gauge", Labels: labels, Value: output.BufferFill()},
+		{Name: prometheusMetricName("connected"), Type: "gauge", Labels: labels, Value: connected},
+	}
+}
+
+// Returns the status of the supervised output (restarts, last error, ...)
+func (output *BufferedHttpStreamOutput) ComponentStatus() ComponentStatus {
+	status := ComponentStatus{State: ComponentStopped}
+	for _, supervised := range output.supervisor.ComponentStatuses() {
+		status = supervised
+	}
+
+	switch {
+	case output.AdminStatus() == "disabled":
+		status.State = ComponentDisabled
+	case output.OperationalStatus() == "stopped":
+		status.State = ComponentStopped
+	}
+
+	status.Name = output.Identifier
+	status.Healthy = healthyComponentState(status.State)
+	return status
+}
+
 func (output *BufferedHttpStreamOutput) AdminStatus() string {
 	return output.output.AdminStatus()
 }
@@ -139,6 +322,7 @@ func (output *BufferedHttpStreamOutput) Init() error {
 	output.efficiencyMeter.Metrics = output.metrics()
 
 	output.output.EventLog = output.eventLog()
+	output.supervisor.EventLog = output.eventLog()
 	output.efficiencyMeter.Handler = func(efficiency float64) {
 		if output.output.IsConnected() {
 			output.eventLog().NewEvent("Bad network performance")
@@ -159,7 +343,7 @@ func (output *BufferedHttpStreamOutput) Read() (audio *Audio) {
 	audio = output.buffer.Read()
 	for audio == nil {
 		time.Sleep(100 * time.Millisecond)
-		if !output.started {
+		if output.OperationalStatus() != "started" {
 			return nil
 		}
 
@@ -175,8 +359,12 @@ func (output *BufferedHttpStreamOutput) AudioOut(audio *Audio) {
 	output.efficiencyMeter.Input(int64(audio.SampleCount()))
 }
 
-func (output *BufferedHttpStreamOutput) Run() {
-	output.output.Run()
+// Returns the delay of the stream audio (0 for live)
+func (output *BufferedHttpStreamOutput) TimeShift() time.Duration {
+	if output.config == nil {
+		return 0
+	}
+	return output.config.TimeShift
 }
 
 func (output *BufferedHttpStreamOutput) SetChannelCount(channelCount int) {
@@ -191,6 +379,7 @@ type BufferedHttpStreamOutputConfig struct {
 	HttpStreamOutputConfig
 	Identifier     string
 	BufferDuration time.Duration
+	TimeShift      time.Duration `json:",omitempty"`
 }
 
 type BufferedHttpStreamOutputStatus struct {
@@ -217,12 +406,39 @@ func (config *BufferedHttpStreamOutputConfig) Flags(flags *flag.FlagSet, prefix
 	defaultConfig := NewBufferedHttpStreamOutputConfig()
 	flags.StringVar(&config.Identifier, strings.Join([]string{prefix, "id"}, "-"), "", "The identifier of this stream")
 	flags.DurationVar(&config.BufferDuration, strings.Join([]string{prefix, "buffer-duration"}, "-"), defaultConfig.BufferDuration, "The maximum duration of saved sound")
+	flags.DurationVar(&config.TimeShift, strings.Join([]string{prefix, "time-shift"}, "-"), 0, "The delay of the stream audio (for example 3h, 0 for live)")
 }
 
 func (config *BufferedHttpStreamOutputConfig) Apply(bufferedHttpStreamOutput *BufferedHttpStreamOutput) {
 	bufferedHttpStreamOutput.Setup(config)
 }
 
+// Empty streams are ignored
+func (config *BufferedHttpStreamOutputConfig) Validate(errors *ConfigErrors) {
+	if config.Empty() {
+		return
+	}
+
+	config.HttpStreamOutputConfig.Validate(errors)
+	if config.BufferDuration < 0 {
+		errors.Add("BufferDuration", "can't be negative")
+	}
+	if config.TimeShift < 0 {
+		errors.Add("TimeShift", "can't be negative")
+	}
+}
+
+// Returns true if the given config changes the connection or the encoding
+// of the stream. Description, BufferDuration and Disabled can be changed live.
+func (config *BufferedHttpStreamOutputConfig) RequiresRestart(other *BufferedHttpStreamOutputConfig) bool {
+	return config.Target != other.Target ||
+		config.Format != other.Format ||
+		config.ServerType != other.ServerType ||
+		config.CAFile != other.CAFile ||
+		config.InsecureSkipVerify != other.InsecureSkipVerify ||
+		config.TimeShift != other.TimeShift
+}
+
 func (config *BufferedHttpStreamOutputConfig) Empty() bool {
 	return config.Target == ""
 }
@@ -1,7 +1,12 @@
 package broadcast
 
 import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestBufferedHttpStreamOutput_defaultIdentifier(t *testing.T) {
@@ -11,3 +16,224 @@ func TestBufferedHttpStreamOutput_defaultIdentifier(t *testing.T) {
 		t.Errorf("Wrong default identifier :\n got: %v\nwant: %v", output.defaultIdentifier(), "42336522")
 	}
 }
+
+func TestBufferedHttpStreamOutput_Update(t *testing.T) {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Target = "http://localhost/live.mp3"
+	config.Disabled = true
+
+	output := NewBufferedHttpStreamOutput()
+	output.Setup(&config)
+
+	updatedConfig := config
+	updatedConfig.Description.Name = "Live"
+	updatedConfig.BufferDuration = 2 * time.Second
+
+	if output.Update(&updatedConfig) {
+		t.Errorf("Description and buffer duration should be changed without restart")
+	}
+	if output.output.Description == nil || output.output.Description.Name != "Live" {
+		t.Errorf("Description should be changed :\n got: %v", output.output.Description)
+	}
+	if output.unfillAudioBuffer.MaxSampleCount != 88200 {
+		t.Errorf("Buffer duration should be changed :\n got: %v\nwant: %v", output.unfillAudioBuffer.MaxSampleCount, 88200)
+	}
+
+	updatedConfig.Format = "mp3:cbr(b=64)"
+	if !output.Update(&updatedConfig) {
+		t.Errorf("Format change should restart the stream")
+	}
+}
+
+func TestBufferedHttpStreamOutputConfig_RequiresRestart(t *testing.T) {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Target = "https://localhost/live.mp3"
+
+	conditions := []struct {
+		change  func(config *BufferedHttpStreamOutputConfig)
+		restart bool
+	}{
+		{func(config *BufferedHttpStreamOutputConfig) { config.Target = "https://localhost/other.mp3" }, true},
+		{func(config *BufferedHttpStreamOutputConfig) { config.Format = "ogg/vorbis" }, true},
+		{func(config *BufferedHttpStreamOutputConfig) { config.ServerType = "shoutcast" }, true},
+		{func(config *BufferedHttpStreamOutputConfig) { config.CAFile = "/etc/ssl/certs/icecast.pem" }, true},
+		{func(config *BufferedHttpStreamOutputConfig) { config.InsecureSkipVerify = true }, true},
+		{func(config *BufferedHttpStreamOutputConfig) { config.TimeShift = time.Hour }, true},
+		{func(config *BufferedHttpStreamOutputConfig) { config.Description.Name = "Live" }, false},
+		{func(config *BufferedHttpStreamOutputConfig) { config.BufferDuration = time.Minute }, false},
+		{func(config *BufferedHttpStreamOutputConfig) { config.Disabled = true }, false},
+	}
+
+	for index, condition := range conditions {
+		otherConfig := config
+		condition.change(&otherConfig)
+
+		if restart := config.RequiresRestart(&otherConfig); restart != condition.restart {
+			t.Errorf("Wrong restart for change %d :\n got: %v\nwant: %v", index, restart, condition.restart)
+		}
+	}
+}
+
+func TestBufferedHttpStreamOutput_Perform(t *testing.T) {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Target = "http://localhost/live.mp3"
+	config.Disabled = true
+
+	output := NewBufferedHttpStreamOutput()
+	output.Setup(&config)
+
+	if err := output.Perform("start"); err != ErrStreamDisabled {
+		t.Errorf("Disabled stream should not be started :\n got: %v\nwant: %v", err, ErrStreamDisabled)
+	}
+	if err := output.Perform("reconnect"); err != ErrStreamNotStarted {
+		t.Errorf("Stopped stream should not be reconnected :\n got: %v\nwant: %v", err, ErrStreamNotStarted)
+	}
+	if err := output.Perform("dummy"); err == nil {
+		t.Errorf("Unknown action should be refused")
+	}
+
+	// Considered as started (without run) to avoid the connection
+	output.output.Start()
+
+	if err := output.Perform("enable"); err != nil {
+		t.Fatal(err)
+	}
+	if output.Config().Disabled || output.AdminStatus() != "enabled" {
+		t.Errorf("Stream should be enabled in its config :\n got: %v", output.Config().Disabled)
+	}
+
+	if err := output.Perform("reconnect"); err != nil {
+		t.Errorf("Started stream should be reconnected :\n got: %v", err)
+	}
+	if atomic.LoadInt32(&output.output.reconnect) != 1 {
+		t.Errorf("Stream connection should be closed by its run loop")
+	}
+
+	output.output.Stop()
+	if err := output.Perform("disable"); err != nil {
+		t.Fatal(err)
+	}
+	if !output.Config().Disabled || output.AdminStatus() != "disabled" {
+		t.Errorf("Stream should be disabled in its config :\n got: %v", output.Config().Disabled)
+	}
+}
+
+func TestBufferedHttpStreamOutput_ComponentStatus(t *testing.T) {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Identifier = "live"
+	config.Target = "http://localhost/live.mp3"
+	config.Disabled = true
+
+	output := NewBufferedHttpStreamOutput()
+	output.Setup(&config)
+
+	status := output.ComponentStatus()
+	if status.Name != "live" || status.State != ComponentDisabled || !status.Healthy {
+		t.Errorf("Disabled stream should be healthy :\n got: %v", status)
+	}
+
+	config.Disabled = false
+	output.Setup(&config)
+
+	status = output.ComponentStatus()
+	if status.State != ComponentStopped || status.Healthy {
+		t.Errorf("Stopped stream should not be healthy :\n got: %v", status)
+	}
+}
+
+type crashedHttpStreamDialer struct{}
+
+func (dialer *crashedHttpStreamDialer) Connect(output *HttpStreamOutput) (net.Conn, error) {
+	panic("dialer crashed")
+}
+
+func TestBufferedHttpStreamOutput_Start_restart(t *testing.T) {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Identifier = "live"
+	config.Target = "http://localhost/live.mp3"
+
+	output := NewBufferedHttpStreamOutput()
+	output.Setup(&config)
+	output.Init()
+	output.output.dialer = &crashedHttpStreamDialer{}
+	output.supervisor.MinBackoff = 10 * time.Millisecond
+
+	output.Start()
+
+	deadline := time.Now().Add(time.Second)
+	for output.ComponentStatus().Restarts < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := output.ComponentStatus()
+	if status.Name != "live" || status.Restarts < 2 || status.LastError != "panic: dialer crashed" {
+		t.Errorf("Crashed stream should be restarted by its supervisor :\n got: %v", status)
+	}
+
+	if err := output.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if status := output.ComponentStatus(); status.State != ComponentStopped || output.OperationalStatus() != "stopped" {
+		t.Errorf("Stream should be stopped :\n got: %v", status)
+	}
+}
+
+type countedHttpStreamDialer struct {
+	connections int32
+}
+
+func (dialer *countedHttpStreamDialer) Connect(output *HttpStreamOutput) (net.Conn, error) {
+	atomic.AddInt32(&dialer.connections, 1)
+	return nil, errors.New("dummy")
+}
+
+func TestBufferedHttpStreamOutput_Start_concurrent(t *testing.T) {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Identifier = "live"
+	config.Target = "http://localhost/live.mp3"
+
+	output := NewBufferedHttpStreamOutput()
+	output.Setup(&config)
+	output.Init()
+	dialer := &countedHttpStreamDialer{}
+	output.output.dialer = dialer
+
+	var starts sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		starts.Add(1)
+		go func() {
+			defer starts.Done()
+			output.Perform("start")
+		}()
+	}
+	starts.Wait()
+
+	// The run loop waits after its first connection error
+	time.Sleep(100 * time.Millisecond)
+	if connections := atomic.LoadInt32(&dialer.connections); connections != 1 {
+		t.Errorf("Stream should be run once :\n got: %v\nwant: %v", connections, 1)
+	}
+
+	if err := output.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBufferedHttpStreamOutput_PrometheusSamples(t *testing.T) {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Identifier = "live"
+	config.Target = "http://localhost/live.mp3"
+
+	output := NewBufferedHttpStreamOutput()
+	output.Setup(&config)
+
+	samples := output.PrometheusSamples()
+	if len(samples) != 2 {
+		t.Fatalf("Wrong sample count :\n got: %v\nwant: %v", len(samples), 2)
+	}
+	for _, sample := range samples {
+		if sample.Labels["stream"] != "live" || sample.Value != 0 {
+			t.Errorf("Wrong sample for an empty and disconnected stream :\n got: %v", sample)
+		}
+	}
+}
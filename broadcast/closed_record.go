@@ -0,0 +1,41 @@
+package broadcast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+)
+
+// Describes a file closed by TimedFileOutput
+type ClosedRecord struct {
+	Path               string
+	Start              time.Time
+	End                time.Time
+	SampleCount        int64
+	MissingSampleCount int64
+	Format             string
+	Checksum           string `json:",omitempty"`
+}
+
+// A TimedFileHandler is notified when TimedFileOutput closes a file.
+// FileClosed is invoked in the audio goroutine and shouldn't block.
+type TimedFileHandler interface {
+	FileClosed(record *ClosedRecord)
+}
+
+// Returns the hexadecimal SHA-256 checksum of the given file
+func FileChecksum(fileName string) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
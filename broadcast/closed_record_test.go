@@ -0,0 +1,33 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileChecksum(t *testing.T) {
+	file, err := ioutil.TempFile("", "closedrecord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("go-broadcast")
+	file.Close()
+
+	checksum, err := FileChecksum(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedChecksum := "150b58fa7661ddfa2cf6b3ef13afbcf196ea008f4f3f9b9a1221e089d5248eea"
+	if checksum != expectedChecksum {
+		t.Errorf("Wrong checksum :\n got: %v\nwant: %v", checksum, expectedChecksum)
+	}
+}
+
+func TestFileChecksum_missingFile(t *testing.T) {
+	if _, err := FileChecksum("/dummy/file.wav"); err == nil {
+		t.Errorf("Should return an error with a missing file")
+	}
+}
@@ -6,22 +6,44 @@ import (
 	"fmt"
 	"os"
 	"projects.tryphon.eu/go-broadcast/broadcast"
+	"sync"
+	"time"
 )
 
 type HttpSource struct {
 	alsaInput         *broadcast.AlsaInput
+	input             broadcast.SoundInput
+	inputName         string
 	httpStreamOutputs *broadcast.HttpStreamOutputs
 	httpServer        *broadcast.HttpServer
 	processing        *broadcast.Processing
-
-	config *HttpSourceConfig
+	delayLine         *broadcast.DelayLine
+	toneInjector      *broadcast.ToneInjector
+	supervisor        *broadcast.Supervisor
+	notifier          *broadcast.Notifier
+
+	config        *HttpSourceConfig
+	configHistory *broadcast.ConfigHistory
+	reloader      *broadcast.ConfigReloader
+	// Shared with the reloader which replaces the config
+	configMutex sync.Mutex
 }
 
 func (command *HttpSource) Config() HttpSourceConfig {
-	command.config.Http = command.httpStreamOutputs.Config()
+	command.configMutex.Lock()
+	defer command.configMutex.Unlock()
+
+	command.refreshConfig()
 	return *command.config
 }
 
+// Updates the config from the running components (changed by the HTTP API)
+func (command *HttpSource) refreshConfig() {
+	command.config.Http = command.httpStreamOutputs.Config()
+	command.config.Delay = *command.delayLine.Config()
+	command.config.Processing = *command.processing.Config()
+}
+
 func (command *HttpSource) ConfigToJSON() []byte {
 	jsonBytes, _ := json.Marshal(command.Config())
 	return jsonBytes
@@ -29,7 +51,25 @@ func (command *HttpSource) ConfigToJSON() []byte {
 
 func (command *HttpSource) SaveConfig() error {
 	config := command.Config()
-	return broadcast.SaveConfig(config.File, config)
+	if config.File == "" {
+		return broadcast.ErrNoConfigFile
+	}
+
+	err := broadcast.SaveConfig(config.File, config)
+	if err != nil || command.configHistory == nil {
+		return err
+	}
+
+	_, err = command.configHistory.Add(config.ToJSON(), time.Now())
+	return err
+}
+
+func (command *HttpSource) ConfigHistory() *broadcast.ConfigHistory {
+	return command.configHistory
+}
+
+func (command *HttpSource) ApplyConfig(data []byte) error {
+	return command.reloader.Apply(data)
 }
 
 func (command *HttpSource) checkError(err error) {
@@ -44,6 +84,11 @@ func (command *HttpSource) Setup(config *HttpSourceConfig) {
 	config.BaseApply(command.httpServer)
 
 	config.Alsa.Apply(command.alsaInput)
+	command.inputName, command.input = config.Generator.Input(command.alsaInput)
+	command.toneInjector.SampleRate = command.alsaInput.SampleRate
+	command.delayLine.SampleRate = command.alsaInput.SampleRate
+	config.Delay.Apply(command.delayLine)
+	command.processing.Setup(&config.Processing)
 
 	command.httpStreamOutputs.SetChannelCount(command.alsaInput.Channels)
 	command.httpStreamOutputs.SetSampleRate(command.alsaInput.SampleRate)
@@ -80,34 +125,70 @@ func (command *HttpSource) Main(arguments []string) {
 		Output: command.httpStreamOutputs,
 	}
 
-	command.processing = &broadcast.Processing{
+	command.toneInjector = &broadcast.ToneInjector{
 		Output: soundMeterAudioHandler,
 	}
 
-	command.alsaInput.SetAudioHandler(&broadcast.ResizeAudio{
-		Output:      command.processing,
-		SampleCount: 1024,
-	})
+	command.processing = &broadcast.Processing{
+		Output: command.toneInjector,
+	}
+
+	// The delayed program is processed and metered
+	command.delayLine = &broadcast.DelayLine{
+		Output: command.processing,
+	}
 
 	command.httpServer = &broadcast.HttpServer{
 		SoundMeterAudioHandler: soundMeterAudioHandler,
+		PrometheusCollectors:   []broadcast.PrometheusCollector{command.httpStreamOutputs},
 	}
 
+	command.supervisor = &broadcast.Supervisor{}
+	command.httpServer.Register("/status.json", broadcast.NewStatusController(command.supervisor))
+
 	httpStreamOutputsController := broadcast.NewHttpStreamOutputsController(command.httpStreamOutputs)
 	command.httpServer.Register("/streams.json", httpStreamOutputsController)
 	command.httpServer.Register("/streams/", httpStreamOutputsController)
 	command.httpServer.Register("/events.json", httpStreamOutputsController)
 
 	configController := broadcast.NewConfigController(command)
-	command.httpServer.Register("/config.json", configController)
-	command.httpServer.Register("/config/", configController)
+	command.httpServer.RegisterAdmin("/config.json", configController)
+	command.httpServer.RegisterAdmin("/config/", configController)
 
 	processingController := broadcast.NewProcessingController(command.processing)
 	command.httpServer.Register("/processing.json", processingController)
 
+	toneInjectorController := broadcast.NewToneInjectorController(command.toneInjector)
+	command.httpServer.Register("/tone.json", toneInjectorController)
+
+	delayLineController := broadcast.NewDelayLineController(command.delayLine)
+	command.httpServer.Register("/delay.json", delayLineController)
+	command.httpServer.Register("/delay/", delayLineController)
+
+	command.notifier = &broadcast.Notifier{Streams: command.httpStreamOutputs}
+	notificationController := broadcast.NewNotificationController(command.notifier)
+	command.httpServer.Register("/notifications.sse", notificationController)
+	command.httpServer.Register("/notifications.ws", notificationController)
+
+	apiController := &broadcast.ApiV1Controller{
+		Streams:    command.httpStreamOutputs,
+		Processing: command.processing,
+		Config:     command,
+		SoundMeter: soundMeterAudioHandler,
+		Notifier:   command.notifier,
+	}
+	command.httpServer.Register(broadcast.ApiV1Prefix+"/", apiController)
+	command.httpServer.RegisterAdmin(broadcast.ApiV1Prefix+"/config", apiController)
+	command.httpServer.RegisterAdmin(broadcast.ApiV1Prefix+"/config/", apiController)
+
 	command.Setup(&config)
 
-	err = command.alsaInput.Init()
+	command.input.SetAudioHandler(&broadcast.ResizeAudio{
+		Output:      command.delayLine,
+		SampleCount: 1024,
+	})
+
+	err = command.input.Init()
 	command.checkError(err)
 
 	err = command.httpStreamOutputs.Init()
@@ -116,25 +197,93 @@ func (command *HttpSource) Main(arguments []string) {
 	err = command.httpServer.Init()
 	command.checkError(err)
 
-	go command.httpStreamOutputs.Run()
+	if config.File != "" {
+		command.configHistory = &broadcast.ConfigHistory{Directory: config.File + ".history"}
+
+		// The startup config is the first version which can be restored
+		_, err = command.configHistory.Add(config.ToJSON(), time.Now())
+		if err != nil {
+			broadcast.Log.Printf("Can't store config version : %v", err)
+		}
+	}
+
+	command.setupReloader(&config)
+	if config.File != "" {
+		go command.reloader.Run()
+	}
+
+	command.httpStreamOutputs.Start()
+	go command.notifier.Run()
+	command.supervisor.Watch("streams", command.httpStreamOutputs)
+	command.supervisor.Start(command.inputName, command.input)
+
+	command.checkError(command.shutdown(&config).Wait())
+}
+
+func (command *HttpSource) setupReloader(config *HttpSourceConfig) {
+	reloader := &broadcast.ConfigReloader{
+		File:    config.File,
+		Config:  config,
+		Mutex:   &command.configMutex,
+		Refresh: command.refreshConfig,
+	}
+	config.BaseHandle(reloader)
+	reloader.Handle("Processing", func() error {
+		command.processing.Setup(&config.Processing)
+		return nil
+	})
+	reloader.Handle("Http", func() error {
+		command.httpStreamOutputs.Reconcile(&config.Http)
+		return nil
+	})
+	reloader.Handle("Delay", func() error {
+		command.delayLine.Setup(&config.Delay)
+		return nil
+	})
+	command.reloader = reloader
+}
+
+// Returns the shutdown sequence : the input is stopped, the streams send
+// their buffered audio and close their encoders, the last notifications are
+// sent
+func (command *HttpSource) shutdown(config *HttpSourceConfig) *broadcast.Shutdown {
+	shutdown := &broadcast.Shutdown{}
+	config.Shutdown.Apply(shutdown)
+
+	shutdown.Add("input", func() error {
+		return command.supervisor.Stop(command.inputName)
+	})
+	shutdown.Add("streams", func() error {
+		command.httpStreamOutputs.Drain(config.Shutdown.Timeout / 2)
+		command.httpStreamOutputs.Close()
+		return nil
+	})
+	if command.notifier != nil {
+		shutdown.Add("notifier", command.notifier.Stop)
+	}
+	shutdown.Add("profilers", broadcast.StopProfilers)
 
-	command.alsaInput.Run()
+	return shutdown
 }
 
 type HttpSourceConfig struct {
 	broadcast.CommandConfig
 
 	Alsa       broadcast.AlsaInputConfig
+	Generator  broadcast.GeneratorInputConfig
 	Http       broadcast.HttpStreamOutputsConfig
 	Processing broadcast.ProcessingConfig
+	Delay      broadcast.DelayConfig
 }
 
 func (config *HttpSourceConfig) Flags(flags *flag.FlagSet) {
 	config.BaseFlags(flags)
 
 	config.Alsa.Flags(flags, "alsa")
+	config.Generator.Flags(flags, "generator")
 	config.Http.Flags(flags, "stream")
 	config.Processing.Flags(flags, "processing")
+	config.Delay.Flags(flags, "delay")
 }
 
 func (config *HttpSourceConfig) Apply(command *HttpSource) {
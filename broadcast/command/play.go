@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"projects.tryphon.eu/go-broadcast/broadcast"
+	"sync"
 )
 
 type Play struct {
@@ -15,8 +16,12 @@ type Play struct {
 	httpStreamInput *broadcast.BufferedHttpStreamInput
 	httpServer      broadcast.HttpServer
 	processing      broadcast.Processing
+	supervisor      broadcast.Supervisor
 
 	config *PlayConfig
+
+	stopping bool
+	running  sync.WaitGroup
 }
 
 func (command *Play) Main(arguments []string) {
@@ -40,7 +45,17 @@ func (command *Play) Main(arguments []string) {
 	command.Setup(config)
 	command.checkError(command.Init())
 
-	command.Run()
+	go command.Run()
+
+	shutdown := &broadcast.Shutdown{}
+	config.Shutdown.Apply(shutdown)
+	shutdown.Add("http input", func() error {
+		return command.supervisor.Stop("http-input")
+	})
+	shutdown.Add("alsa output", command.Stop)
+	shutdown.Add("profilers", broadcast.StopProfilers)
+
+	command.checkError(shutdown.Wait())
 }
 
 func (command *Play) Init() error {
@@ -50,6 +65,7 @@ func (command *Play) Init() error {
 
 	command.processing.SetAudioHandler(soundMeterAudioHandler)
 	command.httpServer.SoundMeterAudioHandler = soundMeterAudioHandler
+	command.httpServer.Register("/status.json", broadcast.NewStatusController(&command.supervisor))
 
 	// if fixedRateTolerance > 0 && fixedRateTolerance < 1 {
 	// 	fixedRateOutput := broadcast.FixedRateAudioHandler{
@@ -98,10 +114,13 @@ func (command *Play) Setup(config *PlayConfig) {
 }
 
 func (command *Play) Run() {
-	go command.httpStreamInput.Run()
+	command.running.Add(1)
+	defer command.running.Done()
+
+	command.supervisor.Start("http-input", command.httpStreamInput)
 
 	var blankDuration uint32
-	for {
+	for !command.stopping {
 		audio := command.httpStreamInput.Read()
 		if audio == nil {
 			audio = broadcast.NewAudio(1024, command.alsaOutput.Channels)
@@ -116,6 +135,13 @@ func (command *Play) Run() {
 	}
 }
 
+// Stops the Run loop
+func (command *Play) Stop() error {
+	command.stopping = true
+	command.running.Wait()
+	return nil
+}
+
 type PlayConfig struct {
 	broadcast.CommandConfig
 
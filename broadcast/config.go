@@ -1,45 +1,304 @@
 package broadcast
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 type CommandConfig struct {
 	File string `json:"-"`
+	// Unknown keys of the config file are ignored instead of refused
+	IgnoreUnknownFields bool `json:"-"`
 
 	HttpServer HttpServerConfig
 	Log        LogConfig
 	Metrics    MetricsConfig
 	Profiler   ProfilerConfig
+	Shutdown   ShutdownConfig
 }
 
+// Loads the given config file (if it exists) and validates the config.
+//
+// Unknown keys and invalid values are rejected with ConfigErrors. When the
+// config ignores unknown keys (see LenientConfig), they're only logged.
 func LoadConfig(file string, config interface{}) error {
-	if file == "" {
-		return nil
+	if file != "" {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			Log.Printf("Config file not found: %s", file)
+		} else {
+			Log.Printf("Read config file: %s", file)
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			unknownFields, err := decodeConfigFile(data, config)
+			if err != nil {
+				return err
+			}
+			for _, field := range unknownFields {
+				Log.Printf("Ignore unknown config field: %s", field)
+			}
+		}
 	}
 
-	if _, err := os.Stat(file); os.IsNotExist(err) {
-		Log.Printf("Config file not found: %s", file)
-		return nil
+	return ValidateConfig(config)
+}
+
+// A LenientConfig can ignore the unknown keys of its config file (obsolete
+// settings kept for an older version, ...)
+type LenientConfig interface {
+	IgnoresUnknownFields() bool
+}
+
+func (config *CommandConfig) IgnoresUnknownFields() bool {
+	return config.IgnoreUnknownFields
+}
+
+// Decodes a config file content. Unknown keys are refused, unless the config
+// ignores them : their names are returned.
+func decodeConfigFile(data []byte, config interface{}) ([]string, error) {
+	if lenient, ok := config.(LenientConfig); ok && lenient.IgnoresUnknownFields() {
+		return DecodeConfigFile(data, config)
 	}
+	return nil, DecodeConfig(data, config)
+}
 
-	Log.Printf("Read config file: %s", file)
-	data, err := ioutil.ReadFile(file)
+// Decodes the given JSON config file. Unknown keys are ignored, their names
+// are returned (like "Http.Streams[0].Quality").
+func DecodeConfigFile(data []byte, config interface{}) ([]string, error) {
+	err := json.Unmarshal(data, config)
 	if err != nil {
-		return err
+		return nil, decodeConfigError(err)
+	}
+
+	var value interface{}
+	json.Unmarshal(data, &value)
+
+	unknownFields := []string{}
+	collectUnknownConfigFields(value, reflect.TypeOf(config), "", &unknownFields)
+	sort.Strings(unknownFields)
+
+	return unknownFields, nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func collectUnknownConfigFields(value interface{}, configType reflect.Type, prefix string, unknownFields *[]string) {
+	for configType.Kind() == reflect.Ptr {
+		configType = configType.Elem()
 	}
-	err = json.Unmarshal(data, config)
+	if reflect.PtrTo(configType).Implements(jsonUnmarshalerType) {
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if configType.Kind() != reflect.Struct {
+			return
+		}
+		for key, fieldValue := range value {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+
+			fieldType, ok := configFieldType(configType, key)
+			if !ok {
+				*unknownFields = append(*unknownFields, name)
+				continue
+			}
+			collectUnknownConfigFields(fieldValue, fieldType, name, unknownFields)
+		}
+	case []interface{}:
+		if configType.Kind() != reflect.Slice && configType.Kind() != reflect.Array {
+			return
+		}
+		for index, item := range value {
+			collectUnknownConfigFields(item, configType.Elem(), fmt.Sprintf("%s[%d]", prefix, index), unknownFields)
+		}
+	}
+}
+
+// Returns the type of the struct field decoded from the given JSON key (like
+// encoding/json, fields of embedded structs included)
+func configFieldType(structType reflect.Type, key string) (reflect.Type, bool) {
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if embeddedType, ok := configFieldType(fieldType, key); ok {
+				return embeddedType, true
+			}
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// Decodes the given JSON config. Unknown keys are rejected.
+func DecodeConfig(data []byte, config interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(config)
 	if err != nil {
-		return err
+		return decodeConfigError(err)
+	}
+	return nil
+}
+
+var (
+	unknownConfigFieldPattern = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+	configFieldIndexPattern   = regexp.MustCompile(`\.([0-9]+)`)
+)
+
+func decodeConfigError(err error) error {
+	switch err := err.(type) {
+	case *json.UnmarshalTypeError:
+		// "Streams.0.Format" is reported as "Streams[0].Format"
+		field := configFieldIndexPattern.ReplaceAllString(err.Field, "[$1]")
+		return ConfigErrors{{Field: field, Message: fmt.Sprintf("invalid value (%s expected)", err.Type)}}
+	case *json.SyntaxError:
+		return ConfigErrors{{Message: fmt.Sprintf("invalid JSON at offset %d (%v)", err.Offset, err)}}
+	}
+	if err == io.ErrUnexpectedEOF {
+		return ConfigErrors{{Message: "invalid JSON (unexpected end of file)"}}
+	}
+
+	if match := unknownConfigFieldPattern.FindStringSubmatch(err.Error()); match != nil {
+		return ConfigErrors{{Field: match[1], Message: "unknown field"}}
+	}
+	return ConfigErrors{{Message: err.Error()}}
+}
+
+type ConfigError struct {
+	Field   string
+	Message string
+}
+
+func (err ConfigError) Error() string {
+	if err.Field == "" {
+		return err.Message
+	}
+	return fmt.Sprintf("%s: %s", err.Field, err.Message)
+}
+
+type ConfigErrors []ConfigError
+
+func (errors ConfigErrors) Error() string {
+	messages := make([]string, len(errors))
+	for index, err := range errors {
+		messages[index] = err.Error()
 	}
+	return fmt.Sprintf("Invalid config: %s", strings.Join(messages, ", "))
+}
 
+func (errors *ConfigErrors) Add(field string, format string, arguments ...interface{}) {
+	*errors = append(*errors, ConfigError{Field: field, Message: fmt.Sprintf(format, arguments...)})
+}
+
+// A ConfigValidator checks the values of a config section. Fields are
+// named relatively to the section.
+type ConfigValidator interface {
+	Validate(errors *ConfigErrors)
+}
+
+// Validates all the sections of the given config. Returns ConfigErrors
+// with the complete field names (like "Http.Streams[0].Target").
+func ValidateConfig(config interface{}) error {
+	errors := ConfigErrors{}
+	validateConfigValue(reflect.ValueOf(config), "", true, &errors)
+
+	if len(errors) > 0 {
+		return errors
+	}
 	return nil
 }
 
+func validateConfigValue(value reflect.Value, prefix string, validate bool, errors *ConfigErrors) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			validateConfigValue(value.Elem(), prefix, validate, errors)
+		}
+	case reflect.Slice:
+		for index := 0; index < value.Len(); index++ {
+			validateConfigValue(value.Index(index), fmt.Sprintf("%s[%d]", prefix, index), true, errors)
+		}
+	case reflect.Struct:
+		if validate && value.CanAddr() {
+			if validator, ok := value.Addr().Interface().(ConfigValidator); ok {
+				sectionErrors := ConfigErrors{}
+				validator.Validate(&sectionErrors)
+				for _, err := range sectionErrors {
+					errors.Add(joinConfigField(prefix, err.Field), "%s", err.Message)
+				}
+			}
+		}
+
+		for index := 0; index < value.NumField(); index++ {
+			field := value.Type().Field(index)
+			if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+				continue
+			}
+
+			// Embedded sections are validated by the enclosing one
+			if field.Anonymous {
+				validateConfigValue(value.Field(index), prefix, false, errors)
+			} else {
+				validateConfigValue(value.Field(index), joinConfigField(prefix, field.Name), true, errors)
+			}
+		}
+	}
+}
+
+func joinConfigField(prefix string, field string) string {
+	if prefix == "" {
+		return field
+	}
+	if field == "" {
+		return prefix
+	}
+	return prefix + "." + field
+}
+
+func validateSampleFormat(errors *ConfigErrors, field string, name string) {
+	if name != "" && name != "auto" && ParseSampleFormat(name) == nil {
+		errors.Add(field, "unknown sample format '%s'", name)
+	}
+}
+
 func SaveConfig(file string, config interface{}) error {
 	if file == "" {
 		return nil
@@ -51,21 +310,24 @@ func SaveConfig(file string, config interface{}) error {
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(file, jsonBytes, 0640)
+
+	// The config file is never partially written
+	err = ioutil.WriteFile(file+".tmp", jsonBytes, 0640)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return os.Rename(file+".tmp", file)
 }
 
 func (config *CommandConfig) BaseFlags(flags *flag.FlagSet) {
 	flags.StringVar(&config.File, "config", "", "The config file to be loaded on startup")
+	flags.BoolVar(&config.IgnoreUnknownFields, "config-ignore-unknown", false, "Ignore the unknown keys of the config file instead of refusing it")
 
 	config.HttpServer.Flags(flags, "http")
 	config.Log.Flags(flags, "log")
 	config.Metrics.Flags(flags, "metrics")
 	config.Profiler.Flags(flags, "profiler")
+	config.Shutdown.Flags(flags, "shutdown")
 }
 
 func (config *CommandConfig) BaseApply(httpServer *HttpServer) {
@@ -75,17 +337,27 @@ func (config *CommandConfig) BaseApply(httpServer *HttpServer) {
 	config.Profiler.Apply()
 }
 
+// Registers the reload handlers of the base sections
+func (config *CommandConfig) BaseHandle(reloader *ConfigReloader) {
+	reloader.Handle("Log", func() error {
+		config.Log.Apply()
+		return nil
+	})
+}
+
 type UDPClientConfig struct {
 	CommandConfig
 
-	Alsa AlsaInputConfig
-	Udp  UDPOutputConfig
+	Alsa      AlsaInputConfig
+	Generator GeneratorInputConfig
+	Udp       UDPOutputConfig
 }
 
 func (config *UDPClientConfig) Flags(flags *flag.FlagSet) {
 	config.BaseFlags(flags)
 
 	config.Alsa.Flags(flags, "alsa")
+	config.Generator.Flags(flags, "generator")
 	config.Udp.Flags(flags, "udp")
 }
 
@@ -135,8 +407,13 @@ func (config *LogConfig) Apply() {
 type BackupConfig struct {
 	CommandConfig
 
-	Alsa  AlsaInputConfig
-	Files TimedFileOutputConfig
+	Alsa      AlsaInputConfig
+	Files     TimedFileOutputConfig
+	Record    RecordModeConfig
+	Retention RecordRetentionConfig
+	Webhook   WebhookConfig
+	Upload    UploaderConfig
+	Manifest  RecordSignerConfig
 }
 
 func (config *BackupConfig) Flags(flags *flag.FlagSet) {
@@ -144,14 +421,215 @@ func (config *BackupConfig) Flags(flags *flag.FlagSet) {
 
 	config.Alsa.Flags(flags, "alsa")
 	config.Files.Flags(flags, "files")
+	config.Record.Flags(flags, "record")
+	config.Retention.Flags(flags, "retention")
+	config.Webhook.Flags(flags, "webhook")
+	config.Upload.Flags(flags, "upload")
+	config.Manifest.Flags(flags, "manifest")
 }
 
-func (config *BackupConfig) Apply(alsaInput *AlsaInput, timedFileOutput *TimedFileOutput, httpServer *HttpServer) {
+func (config *BackupConfig) Apply(alsaInput *AlsaInput, timedFileOutput *TimedFileOutput, retention *RecordRetention, webhook *Webhook, uploader *Uploader, signer *RecordSigner, httpServer *HttpServer) error {
 	config.BaseApply(httpServer)
+	config.Retention.Apply(retention, config.Files.Root)
+	retention.CurrentFile = timedFileOutput.CurrentPath
+	config.Webhook.Apply(webhook, config.Files.Root)
+
+	err := config.Upload.Apply(uploader, config.Files.Root)
+	if err != nil {
+		return err
+	}
+
+	err = config.Manifest.Apply(signer, config.Files.Root)
+	if err != nil {
+		return err
+	}
 
 	config.Alsa.Apply(alsaInput)
-	config.Files.Apply(timedFileOutput)
+	err = config.Files.Apply(timedFileOutput)
+	if err != nil {
+		return err
+	}
 
 	timedFileOutput.SetSampleRate(alsaInput.SampleRate)
 	timedFileOutput.SetChannelCount(alsaInput.ChannelCount())
+
+	if signer.IsEnabled() {
+		timedFileOutput.FileHandlers = append(timedFileOutput.FileHandlers, signer)
+	}
+	if webhook.IsEnabled() {
+		timedFileOutput.FileHandlers = append(timedFileOutput.FileHandlers, webhook)
+	}
+	if uploader.IsEnabled() {
+		timedFileOutput.FileHandlers = append(timedFileOutput.FileHandlers, uploader)
+	}
+
+	return nil
+}
+
+type HttpClientConfig struct {
+	File string `json:"-"`
+
+	Log        LogConfig
+	HttpServer HttpServerConfig
+	Input      HttpClientInputConfig
+	Buffer     HttpClientBufferConfig
+	Alsa       AlsaOutputConfig
+	Shutdown   ShutdownConfig
+
+	// 0 is no tolerance, 1 is no fixed sample rate
+	SampleRateTolerance float64
+	StatusLoop          time.Duration
+}
+
+func (config *HttpClientConfig) Flags(flags *flag.FlagSet) {
+	flags.StringVar(&config.File, "config", "", "The config file to be loaded on startup")
+
+	flags.BoolVar(&config.Log.Debug, "debug", false, "Enable debug messages")
+	flags.BoolVar(&config.Log.Syslog, "syslog", false, "Redirect messages to syslog")
+	flags.StringVar(&config.HttpServer.Bind, "http-server", "", "Http server binding")
+
+	config.Input.Flags(flags, "http")
+	config.Buffer.Flags(flags)
+	config.Alsa.Flags(flags, "alsa")
+	config.Shutdown.Flags(flags, "shutdown")
+
+	flags.Float64Var(&config.SampleRateTolerance, "sample-rate-tolerance", 1, "Tolerance on sample format (0 is no tolerance, 1 is no fixed sample format)")
+	flags.DurationVar(&config.StatusLoop, "status-loop", 0, "Duration between two status dump (0 to disable)")
+}
+
+func (config *HttpClientConfig) Validate(errors *ConfigErrors) {
+	if config.SampleRateTolerance < 0 || config.SampleRateTolerance > 1 {
+		errors.Add("SampleRateTolerance", "must be between 0 and 1")
+	}
+	if config.StatusLoop < 0 {
+		errors.Add("StatusLoop", "can't be negative")
+	}
+}
+
+type HttpClientInputConfig struct {
+	Url         string
+	ReadTimeout time.Duration
+	WaitOnError time.Duration
+	Username    string
+	Password    string
+}
+
+func (config *HttpClientInputConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.DurationVar(&config.ReadTimeout, strings.Join([]string{prefix, "read-timeout"}, "-"), 10*time.Second, "Read timeout before creating a new http connection")
+	flags.DurationVar(&config.WaitOnError, strings.Join([]string{prefix, "wait-on-error"}, "-"), 5*time.Second, "Delay after http error")
+	flags.StringVar(&config.Username, strings.Join([]string{prefix, "username"}, "-"), "", "Username used for http authentification")
+	flags.StringVar(&config.Password, strings.Join([]string{prefix, "password"}, "-"), "", "Password used for http authentification")
+}
+
+func (config *HttpClientInputConfig) Validate(errors *ConfigErrors) {
+	if config.Url != "" {
+		if inputURL, err := url.Parse(config.Url); err != nil || (inputURL.Scheme != "http" && inputURL.Scheme != "https") {
+			errors.Add("Url", "invalid http URL '%s'", config.Url)
+		}
+	}
+	if config.ReadTimeout <= 0 {
+		errors.Add("ReadTimeout", "must be positive")
+	}
+	if config.WaitOnError < 0 {
+		errors.Add("WaitOnError", "can't be negative")
+	}
+}
+
+func (config *HttpClientInputConfig) Apply(httpInput *HttpInput) {
+	httpInput.Url = config.Url
+	httpInput.ReadTimeout = config.ReadTimeout
+	httpInput.WaitOnError = config.WaitOnError
+	httpInput.Username = config.Username
+	httpInput.Password = config.Password
+}
+
+// Durations (in seconds) of the httpclient audio buffers
+type HttpClientBufferConfig struct {
+	LowAdjustLimit      float64
+	LowAdjustThreshold  float64
+	LowRefill           float64
+	HighAdjustThreshold float64
+	HighAdjustLimit     float64
+	HighMax             float64
+	HighUnfill          float64
+}
+
+func (config *HttpClientBufferConfig) Flags(flags *flag.FlagSet) {
+	flags.Float64Var(&config.LowAdjustLimit, "low-adjust-limit", 0, "Limit of low adjust buffer (in seconds)")
+	flags.Float64Var(&config.LowAdjustThreshold, "low-adjust-threshold", 3, "Limit of low adjust buffer (in seconds)")
+	flags.Float64Var(&config.LowRefill, "low-refill", 3, "Duration to refill when buffer is empty (in seconds)")
+
+	flags.Float64Var(&config.HighAdjustThreshold, "high-adjust-threshold", 7, "Limit of high adjust buffer (in seconds)")
+	flags.Float64Var(&config.HighAdjustLimit, "high-adjust-limit", 10, "Limit of high adjust buffer (in seconds)")
+	flags.Float64Var(&config.HighMax, "high-max", 10, "Max duration of buffer (in seconds)")
+	flags.Float64Var(&config.HighUnfill, "high-unfill", 3, "Duration to unfill when buffer is full (in seconds)")
+}
+
+func (config *HttpClientBufferConfig) Validate(errors *ConfigErrors) {
+	durations := []struct {
+		field string
+		value float64
+	}{
+		{"LowAdjustLimit", config.LowAdjustLimit},
+		{"LowAdjustThreshold", config.LowAdjustThreshold},
+		{"LowRefill", config.LowRefill},
+		{"HighAdjustThreshold", config.HighAdjustThreshold},
+		{"HighAdjustLimit", config.HighAdjustLimit},
+		{"HighMax", config.HighMax},
+		{"HighUnfill", config.HighUnfill},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			errors.Add(duration.field, "can't be negative")
+		}
+	}
+}
+
+type LoopbackConfig struct {
+	File string `json:"-"`
+
+	Log      LogConfig
+	Input    LoopbackDeviceConfig
+	Output   LoopbackDeviceConfig
+	Shutdown ShutdownConfig
+
+	BufferDuration time.Duration
+	SampleRate     int
+}
+
+func (config *LoopbackConfig) Flags(flags *flag.FlagSet) {
+	flags.StringVar(&config.File, "config", "", "The config file to be loaded on startup")
+
+	flags.BoolVar(&config.Log.Debug, "debug", false, "Enable debug messages")
+	flags.BoolVar(&config.Log.Syslog, "syslog", false, "Redirect messages to syslog")
+
+	config.Input.Flags(flags, "input", "capture")
+	config.Output.Flags(flags, "output", "play")
+	config.Shutdown.Flags(flags, "shutdown")
+
+	flags.DurationVar(&config.BufferDuration, "buffer-duration", 250*time.Millisecond, "Buffer duration")
+	flags.IntVar(&config.SampleRate, "sample-rate", 44100, "Sample rate")
+}
+
+func (config *LoopbackConfig) Validate(errors *ConfigErrors) {
+	if config.BufferDuration <= 0 {
+		errors.Add("BufferDuration", "must be positive")
+	}
+	if config.SampleRate <= 0 {
+		errors.Add("SampleRate", "must be positive")
+	}
+}
+
+type LoopbackDeviceConfig struct {
+	Device       string
+	SampleFormat string
+}
+
+func (config *LoopbackDeviceConfig) Flags(flags *flag.FlagSet, prefix string, usage string) {
+	flags.StringVar(&config.Device, strings.Join([]string{prefix, "device"}, "-"), "default", fmt.Sprintf("The alsa device used to %s sound", usage))
+	flags.StringVar(&config.SampleFormat, strings.Join([]string{prefix, "sample-format"}, "-"), "auto", fmt.Sprintf("The sample format used to %s sound (s16le, s32le, s32be)", usage))
+}
+
+func (config *LoopbackDeviceConfig) Validate(errors *ConfigErrors) {
+	validateSampleFormat(errors, "SampleFormat", config.SampleFormat)
 }
@@ -1,12 +1,21 @@
 package broadcast
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
 )
 
 type ConfigManager interface {
 	ConfigToJSON() []byte
 	SaveConfig() error
+
+	// Returns nil when the config isn't saved in a file
+	ConfigHistory() *ConfigHistory
+	// Applies the given JSON config to the running command
+	ApplyConfig(data []byte) error
 }
 
 type ConfigController struct {
@@ -17,6 +26,11 @@ func NewConfigController(manager ConfigManager) *ConfigController {
 	return &ConfigController{manager}
 }
 
+var (
+	configVersionPathPattern  = regexp.MustCompile("^/config/history/([0-9]+).json$")
+	configRollbackPathPattern = regexp.MustCompile("^/config/rollback/([0-9]+)$")
+)
+
 func (controller *ConfigController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
 	// Log.Debugf("ConfigController request: %s", request)
 
@@ -27,6 +41,18 @@ func (controller *ConfigController) ServeHTTP(response http.ResponseWriter, requ
 		controller.Show(response)
 	case path == "/config/save.json" && request.Method == "POST":
 		controller.Save(response)
+	case path == "/config/history.json" && request.Method == "GET":
+		controller.History(response)
+	case configVersionPathPattern.MatchString(path) && request.Method == "GET":
+		version, _ := strconv.Atoi(configVersionPathPattern.FindStringSubmatch(path)[1])
+		controller.ShowVersion(response, version)
+	case path == "/config/diff.json" && request.Method == "GET":
+		controller.Diff(response, request)
+	case configRollbackPathPattern.MatchString(path) && request.Method == "POST":
+		version, _ := strconv.Atoi(configRollbackPathPattern.FindStringSubmatch(path)[1])
+		controller.Rollback(response, version)
+	default:
+		http.Error(response, "Method not allowed", 405)
 	}
 }
 
@@ -36,6 +62,123 @@ func (controller *ConfigController) Show(response http.ResponseWriter) {
 }
 
 func (controller *ConfigController) Save(response http.ResponseWriter) {
+	err := controller.manager.SaveConfig()
+	if err == ErrNoConfigFile {
+		http.Error(response, "Config can't be saved without config file", 409)
+		return
+	}
+	if err != nil {
+		http.Error(response, fmt.Sprintf("Can't save config: %v", err), 500)
+		return
+	}
+	controller.Show(response)
+}
+
+func (controller *ConfigController) history(response http.ResponseWriter) *ConfigHistory {
+	history := controller.manager.ConfigHistory()
+	if history == nil {
+		http.Error(response, "No config history", 404)
+	}
+	return history
+}
+
+func (controller *ConfigController) History(response http.ResponseWriter) {
+	history := controller.history(response)
+	if history == nil {
+		return
+	}
+
+	versions, err := history.Versions()
+	if err != nil {
+		controller.fatal(response, err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	jsonBytes, _ := json.Marshal(versions)
+	response.Write(jsonBytes)
+}
+
+// Returns the content of the given version (or writes a 404 error)
+func (controller *ConfigController) loadVersion(response http.ResponseWriter, version int) []byte {
+	history := controller.history(response)
+	if history == nil {
+		return nil
+	}
+
+	data, err := history.Load(version)
+	if err != nil {
+		controller.fatal(response, err)
+		return nil
+	}
+	if data == nil {
+		http.Error(response, fmt.Sprintf("Config version %d not found", version), 404)
+	}
+	return data
+}
+
+func (controller *ConfigController) ShowVersion(response http.ResponseWriter, version int) {
+	data := controller.loadVersion(response, version)
+	if data == nil {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
+
+// Compares the version 'from' with the version 'to' (or the current config)
+func (controller *ConfigController) Diff(response http.ResponseWriter, request *http.Request) {
+	fromVersion, err := strconv.Atoi(request.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(response, "Invalid 'from' version", 400)
+		return
+	}
+	from := controller.loadVersion(response, fromVersion)
+	if from == nil {
+		return
+	}
+
+	to := controller.manager.ConfigToJSON()
+	if toParameter := request.URL.Query().Get("to"); toParameter != "" {
+		toVersion, err := strconv.Atoi(toParameter)
+		if err != nil {
+			http.Error(response, "Invalid 'to' version", 400)
+			return
+		}
+		if to = controller.loadVersion(response, toVersion); to == nil {
+			return
+		}
+	}
+
+	differences, err := DiffConfig(from, to)
+	if err != nil {
+		controller.fatal(response, err)
+		return
+	}
+
 	response.Header().Set("Content-Type", "application/json")
-	controller.manager.SaveConfig()
+	jsonBytes, _ := json.Marshal(differences)
+	response.Write(jsonBytes)
+}
+
+func (controller *ConfigController) Rollback(response http.ResponseWriter, version int) {
+	data := controller.loadVersion(response, version)
+	if data == nil {
+		return
+	}
+
+	Log.Printf("Rollback config to version %d", version)
+
+	err := controller.manager.ApplyConfig(data)
+	if err != nil {
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	controller.Save(response)
+}
+
+func (controller *ConfigController) fatal(response http.ResponseWriter, err error) {
+	http.Error(response, fmt.Sprintf("Unknown error: %v", err), 500)
 }
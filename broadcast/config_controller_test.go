@@ -0,0 +1,218 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testConfigManager struct {
+	config    string
+	history   *ConfigHistory
+	saves     int
+	saveError error
+}
+
+func (manager *testConfigManager) ConfigToJSON() []byte {
+	return []byte(manager.config)
+}
+
+func (manager *testConfigManager) SaveConfig() error {
+	if manager.saveError != nil {
+		return manager.saveError
+	}
+	manager.saves++
+	if manager.history != nil {
+		manager.history.Add([]byte(manager.config), time.Now())
+	}
+	return nil
+}
+
+func (manager *testConfigManager) ConfigHistory() *ConfigHistory {
+	return manager.history
+}
+
+func (manager *testConfigManager) ApplyConfig(data []byte) error {
+	if !json.Valid(data) {
+		return errors.New("Invalid config")
+	}
+	manager.config = string(data)
+	return nil
+}
+
+func testConfigControllerRequest(controller *ConfigController, method string, path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+	return response
+}
+
+func TestConfigController_Save(t *testing.T) {
+	manager := &testConfigManager{config: `{"Log": {}}`}
+	controller := NewConfigController(manager)
+
+	response := testConfigControllerRequest(controller, "POST", "/config/save.json")
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+	if manager.saves != 1 {
+		t.Errorf("Config should be saved")
+	}
+	if response.Body.String() != manager.config {
+		t.Errorf("Wrong response :\n got: %v\nwant: %v", response.Body.String(), manager.config)
+	}
+}
+
+func TestConfigController_Save_failure(t *testing.T) {
+	conditions := []struct {
+		err  error
+		code int
+	}{
+		{ErrNoConfigFile, 409},
+		{errors.New("permission denied"), 500},
+	}
+
+	for _, condition := range conditions {
+		manager := &testConfigManager{config: `{"Log": {}}`, saveError: condition.err}
+		controller := NewConfigController(manager)
+
+		response := testConfigControllerRequest(controller, "POST", "/config/save.json")
+		if response.Code != condition.code {
+			t.Errorf("Wrong response code for %v :\n got: %v\nwant: %v", condition.err, response.Code, condition.code)
+		}
+	}
+}
+
+func TestConfigController_History(t *testing.T) {
+	manager := &testConfigManager{config: `{"Log": {}}`, history: testConfigHistory(t)}
+	defer os.RemoveAll(manager.history.Directory)
+	controller := NewConfigController(manager)
+
+	manager.SaveConfig()
+
+	response := testConfigControllerRequest(controller, "GET", "/config/history.json")
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+
+	var versions []ConfigVersion
+	if err := json.Unmarshal(response.Body.Bytes(), &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Version != 1 {
+		t.Errorf("Wrong versions :\n got: %v", versions)
+	}
+
+	response = testConfigControllerRequest(controller, "GET", "/config/history/1.json")
+	if response.Body.String() != `{"Log": {}}` {
+		t.Errorf("Wrong version content :\n got: %v\nwant: %v", response.Body.String(), `{"Log": {}}`)
+	}
+}
+
+func TestConfigController_History_noHistory(t *testing.T) {
+	controller := NewConfigController(&testConfigManager{config: `{}`})
+
+	response := testConfigControllerRequest(controller, "GET", "/config/history.json")
+	if response.Code != 404 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 404)
+	}
+}
+
+func TestConfigController_Diff(t *testing.T) {
+	manager := &testConfigManager{config: `{"Log": {"Debug": false}}`, history: testConfigHistory(t)}
+	defer os.RemoveAll(manager.history.Directory)
+	controller := NewConfigController(manager)
+
+	manager.SaveConfig()
+	manager.config = `{"Log": {"Debug": true}}`
+
+	response := testConfigControllerRequest(controller, "GET", "/config/diff.json?from=1")
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+
+	var differences []ConfigDifference
+	if err := json.Unmarshal(response.Body.Bytes(), &differences); err != nil {
+		t.Fatal(err)
+	}
+	expectedDifferences := []ConfigDifference{{Field: "Log.Debug", From: false, To: true}}
+	if !reflect.DeepEqual(differences, expectedDifferences) {
+		t.Errorf("Wrong differences :\n got: %v\nwant: %v", differences, expectedDifferences)
+	}
+
+	conditions := []struct {
+		path string
+		code int
+	}{
+		{"/config/diff.json", 400},
+		{"/config/diff.json?from=1&to=dummy", 400},
+		{"/config/diff.json?from=42", 404},
+		{"/config/diff.json?from=1&to=1", 200},
+	}
+
+	for _, condition := range conditions {
+		response := testConfigControllerRequest(controller, "GET", condition.path)
+		if response.Code != condition.code {
+			t.Errorf("Wrong response code for %s :\n got: %v\nwant: %v", condition.path, response.Code, condition.code)
+		}
+	}
+}
+
+func TestConfigController_Rollback(t *testing.T) {
+	manager := &testConfigManager{config: `{"Log": {"Debug": false}}`, history: testConfigHistory(t)}
+	defer os.RemoveAll(manager.history.Directory)
+	controller := NewConfigController(manager)
+
+	manager.SaveConfig()
+	manager.config = `{"Log": {"Debug": true}}`
+	manager.SaveConfig()
+
+	response := testConfigControllerRequest(controller, "POST", "/config/rollback/1")
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+	if manager.config != `{"Log": {"Debug": false}}` {
+		t.Errorf("Old config should be applied :\n got: %v\nwant: %v", manager.config, `{"Log": {"Debug": false}}`)
+	}
+
+	versions, _ := manager.history.Versions()
+	if len(versions) != 3 {
+		t.Errorf("Rollback should be saved as a new version :\n got: %v", versions)
+	}
+
+	response = testConfigControllerRequest(controller, "POST", "/config/rollback/42")
+	if response.Code != 404 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 404)
+	}
+}
+
+func TestConfigController_Rollback_invalid(t *testing.T) {
+	manager := &testConfigManager{config: `{`, history: testConfigHistory(t)}
+	defer os.RemoveAll(manager.history.Directory)
+	controller := NewConfigController(manager)
+
+	manager.SaveConfig()
+	manager.config = `{}`
+
+	response := testConfigControllerRequest(controller, "POST", "/config/rollback/1")
+	if response.Code != 400 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 400)
+	}
+	if manager.config != `{}` {
+		t.Errorf("Current config should be kept :\n got: %v", manager.config)
+	}
+}
+
+func TestConfigController_ServeHTTP_methodNotAllowed(t *testing.T) {
+	controller := NewConfigController(&testConfigManager{})
+
+	response := testConfigControllerRequest(controller, "DELETE", "/config.json")
+	if response.Code != 405 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 405)
+	}
+}
@@ -0,0 +1,193 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const configVersionTimeFormat = "20060102-150405"
+
+var configVersionPattern = regexp.MustCompile(`^([0-9]+)-([0-9]{8}-[0-9]{6})\.json$`)
+
+// A ConfigHistory keeps the saved versions of a config in Directory. The
+// oldest versions are removed beyond Limit (20 by default).
+type ConfigHistory struct {
+	Directory string
+	Limit     int
+}
+
+type ConfigVersion struct {
+	Version   int
+	Timestamp time.Time
+}
+
+func (version *ConfigVersion) fileName() string {
+	return fmt.Sprintf("%d-%s.json", version.Version, version.Timestamp.UTC().Format(configVersionTimeFormat))
+}
+
+func (history *ConfigHistory) limit() int {
+	if history.Limit == 0 {
+		history.Limit = 20
+	}
+	return history.Limit
+}
+
+// Returns the stored versions, oldest first
+func (history *ConfigHistory) Versions() ([]ConfigVersion, error) {
+	versions := []ConfigVersion{}
+
+	files, err := ioutil.ReadDir(history.Directory)
+	if os.IsNotExist(err) {
+		return versions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		match := configVersionPattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+
+		number, _ := strconv.Atoi(match[1])
+		timestamp, err := time.Parse(configVersionTimeFormat, match[2])
+		if err != nil {
+			continue
+		}
+		versions = append(versions, ConfigVersion{Version: number, Timestamp: timestamp})
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+func (history *ConfigHistory) version(number int) (*ConfigVersion, error) {
+	versions, err := history.Versions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range versions {
+		if version.Version == number {
+			return &version, nil
+		}
+	}
+	return nil, nil
+}
+
+// Returns the content of the given version (nil if the version doesn't exist)
+func (history *ConfigHistory) Load(number int) ([]byte, error) {
+	version, err := history.version(number)
+	if version == nil || err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path.Join(history.Directory, version.fileName()))
+}
+
+// Stores the given config as a new version. Nothing is stored if the config
+// is identical to the last version. Returns the last version.
+func (history *ConfigHistory) Add(data []byte, now time.Time) (*ConfigVersion, error) {
+	versions, err := history.Versions()
+	if err != nil {
+		return nil, err
+	}
+
+	version := &ConfigVersion{Version: 1, Timestamp: now.UTC().Truncate(time.Second)}
+	if len(versions) > 0 {
+		lastVersion := versions[len(versions)-1]
+
+		lastData, err := history.Load(lastVersion.Version)
+		if err == nil && bytes.Equal(lastData, data) {
+			return &lastVersion, nil
+		}
+		version.Version = lastVersion.Version + 1
+	}
+
+	err = os.MkdirAll(history.Directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := path.Join(history.Directory, version.fileName())
+	err = ioutil.WriteFile(fileName+".tmp", data, 0640)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(fileName+".tmp", fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	versions = append(versions, *version)
+	for len(versions) > history.limit() {
+		Log.Debugf("Remove config version %d", versions[0].Version)
+		os.Remove(path.Join(history.Directory, versions[0].fileName()))
+		versions = versions[1:]
+	}
+
+	return version, nil
+}
+
+// A value which differs between two configs
+type ConfigDifference struct {
+	Field string
+	From  interface{}
+	To    interface{}
+}
+
+// Returns the differences between two JSON configs, sorted by field
+// (like "Http.Streams[0].Target")
+func DiffConfig(from []byte, to []byte) ([]ConfigDifference, error) {
+	var fromValue, toValue interface{}
+	if err := json.Unmarshal(from, &fromValue); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &toValue); err != nil {
+		return nil, err
+	}
+
+	fromFields := make(map[string]interface{})
+	flattenConfigValue(fromValue, "", fromFields)
+	toFields := make(map[string]interface{})
+	flattenConfigValue(toValue, "", toFields)
+
+	differences := []ConfigDifference{}
+	for field, value := range toFields {
+		if fromValue, ok := fromFields[field]; !ok || !reflect.DeepEqual(fromValue, value) {
+			differences = append(differences, ConfigDifference{Field: field, From: fromValue, To: value})
+		}
+	}
+	for field, value := range fromFields {
+		if _, ok := toFields[field]; !ok {
+			differences = append(differences, ConfigDifference{Field: field, From: value})
+		}
+	}
+
+	sort.Slice(differences, func(i, j int) bool { return differences[i].Field < differences[j].Field })
+	return differences, nil
+}
+
+func flattenConfigValue(value interface{}, prefix string, fields map[string]interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			flattenConfigValue(child, joinConfigField(prefix, key), fields)
+		}
+	case []interface{}:
+		for index, child := range value {
+			flattenConfigValue(child, fmt.Sprintf("%s[%d]", prefix, index), fields)
+		}
+	default:
+		fields[prefix] = value
+	}
+}
@@ -0,0 +1,125 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testConfigHistory(t *testing.T) *ConfigHistory {
+	directory, err := ioutil.TempDir("", "config-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ConfigHistory{Directory: directory}
+}
+
+func TestConfigHistory_Add(t *testing.T) {
+	history := testConfigHistory(t)
+	defer os.RemoveAll(history.Directory)
+
+	now := time.Date(2016, 10, 19, 12, 30, 0, 0, time.UTC)
+
+	version, err := history.Add([]byte(`{"Log": {"Debug": false}}`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedVersion := &ConfigVersion{Version: 1, Timestamp: now}
+	if !reflect.DeepEqual(version, expectedVersion) {
+		t.Errorf("Wrong version :\n got: %v\nwant: %v", version, expectedVersion)
+	}
+
+	version, _ = history.Add([]byte(`{"Log": {"Debug": true}}`), now.Add(time.Minute))
+	if version.Version != 2 {
+		t.Errorf("Wrong version :\n got: %v\nwant: %v", version.Version, 2)
+	}
+
+	data, err := history.Load(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"Log": {"Debug": false}}` {
+		t.Errorf("Wrong version content :\n got: %v\nwant: %v", string(data), `{"Log": {"Debug": false}}`)
+	}
+}
+
+func TestConfigHistory_Add_unchanged(t *testing.T) {
+	history := testConfigHistory(t)
+	defer os.RemoveAll(history.Directory)
+
+	history.Add([]byte(`{}`), time.Now())
+	version, _ := history.Add([]byte(`{}`), time.Now())
+
+	if version.Version != 1 {
+		t.Errorf("Unchanged config should not create a version :\n got: %v\nwant: %v", version.Version, 1)
+	}
+}
+
+func TestConfigHistory_Add_limit(t *testing.T) {
+	history := testConfigHistory(t)
+	defer os.RemoveAll(history.Directory)
+	history.Limit = 2
+
+	now := time.Now()
+	for index, content := range []string{`{"Step": 1}`, `{"Step": 2}`, `{"Step": 3}`} {
+		history.Add([]byte(content), now.Add(time.Duration(index)*time.Second))
+	}
+
+	versions, err := history.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 3 {
+		t.Errorf("Oldest versions should be removed :\n got: %v", versions)
+	}
+}
+
+func TestConfigHistory_Versions_noDirectory(t *testing.T) {
+	history := &ConfigHistory{Directory: "/dummy/config.json.history"}
+
+	versions, err := history.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("Wrong versions :\n got: %v", versions)
+	}
+}
+
+func TestConfigHistory_Load_unknown(t *testing.T) {
+	history := testConfigHistory(t)
+	defer os.RemoveAll(history.Directory)
+
+	data, err := history.Load(42)
+	if data != nil || err != nil {
+		t.Errorf("Unknown version should return nil :\n got: %v, %v", data, err)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	from := []byte(`{"Log": {"Debug": false}, "Http": {"Streams": [{"Target": "http://a"}, {"Target": "http://b"}]}}`)
+	to := []byte(`{"Log": {"Debug": true}, "Http": {"Streams": [{"Target": "http://a"}]}, "Delay": {"Duration": 1}}`)
+
+	differences, err := DiffConfig(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedDifferences := []ConfigDifference{
+		{Field: "Delay.Duration", To: float64(1)},
+		{Field: "Http.Streams[1].Target", From: "http://b"},
+		{Field: "Log.Debug", From: false, To: true},
+	}
+	if !reflect.DeepEqual(differences, expectedDifferences) {
+		t.Errorf("Wrong differences :\n got: %v\nwant: %v", differences, expectedDifferences)
+	}
+}
+
+func TestDiffConfig_invalid(t *testing.T) {
+	_, err := DiffConfig([]byte(`{}`), []byte(`{`))
+	if err == nil {
+		t.Errorf("Invalid JSON should be refused")
+	}
+}
@@ -0,0 +1,223 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// A ConfigReloader reloads the config file on SIGHUP (or applies a given
+// config).
+//
+// The new config is validated before replacing the current one (Config
+// must be a pointer). Each changed section (top-level key of the JSON
+// config) is applied by its handler and logged as an Event. Sections
+// without handler are only used after a restart. Unknown keys are refused
+// (like in LoadConfig), or logged as Events when the config ignores them.
+//
+// The Config is replaced while Mutex is locked. The other users of the
+// Config (HTTP handlers, ...) must lock the same Mutex.
+//
+// The running components can be changed without the reloader (by the HTTP
+// API, ...). Refresh is invoked (with Mutex locked) to update the Config
+// before comparing it with the new one.
+type ConfigReloader struct {
+	File    string
+	Config  interface{}
+	Mutex   sync.Locker
+	Refresh func()
+
+	EventLog *LocalEventLog
+
+	handlers map[string]func() error
+	mutex    sync.Mutex
+}
+
+func (reloader *ConfigReloader) locker() sync.Locker {
+	if reloader.Mutex == nil {
+		reloader.Mutex = &reloader.mutex
+	}
+	return reloader.Mutex
+}
+
+func (reloader *ConfigReloader) eventLog() *LocalEventLog {
+	if reloader.EventLog == nil {
+		reloader.EventLog = &LocalEventLog{Source: "config"}
+	}
+	return reloader.EventLog
+}
+
+// Registers the handler which applies the given section when it changes
+func (reloader *ConfigReloader) Handle(section string, handler func() error) {
+	if reloader.handlers == nil {
+		reloader.handlers = make(map[string]func() error)
+	}
+	reloader.handlers[section] = handler
+}
+
+func (reloader *ConfigReloader) Reload() error {
+	if reloader.File == "" {
+		return errors.New("No config file to reload")
+	}
+
+	Log.Printf("Reload config file: %s", reloader.File)
+
+	data, err := ioutil.ReadFile(reloader.File)
+	if err == nil {
+		err = reloader.apply(data)
+	}
+	if err != nil {
+		reloader.eventLog().NewEvent(fmt.Sprintf("Can't reload config: %v", err))
+	}
+	return err
+}
+
+// Applies the given JSON config like a reloaded file
+func (reloader *ConfigReloader) Apply(data []byte) error {
+	err := reloader.apply(data)
+	if err != nil {
+		reloader.eventLog().NewEvent(fmt.Sprintf("Can't apply config: %v", err))
+	}
+	return err
+}
+
+func (reloader *ConfigReloader) apply(data []byte) error {
+	reloader.locker().Lock()
+	defer reloader.locker().Unlock()
+
+	config := copyConfig(reloader.Config)
+	unknownFields, err := decodeConfigFile(data, config)
+	if err != nil {
+		return err
+	}
+	for _, field := range unknownFields {
+		reloader.eventLog().NewEvent(fmt.Sprintf("Ignore unknown config field: %s", field))
+	}
+
+	err = ValidateConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if reloader.Refresh != nil {
+		reloader.Refresh()
+	}
+
+	changedSections, err := changedConfigSections(reloader.Config, config)
+	if err != nil {
+		return err
+	}
+
+	reflect.ValueOf(reloader.Config).Elem().Set(reflect.ValueOf(config).Elem())
+
+	if len(changedSections) == 0 {
+		Log.Printf("Config is unchanged")
+	}
+
+	for _, section := range changedSections {
+		handler, ok := reloader.handlers[section]
+		if !ok {
+			reloader.eventLog().NewEvent(fmt.Sprintf("Config %s changed (restart required)", section))
+			continue
+		}
+
+		err := handler()
+		if err != nil {
+			reloader.eventLog().NewEvent(fmt.Sprintf("Can't apply config %s: %v", section, err))
+		} else {
+			reloader.eventLog().NewEvent(fmt.Sprintf("Config %s changed", section))
+		}
+	}
+
+	return nil
+}
+
+// Reloads the config file on each SIGHUP
+func (reloader *ConfigReloader) Run() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		reloader.Reload()
+	}
+}
+
+// Returns a deep copy of the given config pointer
+func copyConfig(config interface{}) interface{} {
+	configCopy := reflect.New(reflect.TypeOf(config).Elem())
+	copyConfigValue(configCopy.Elem(), reflect.ValueOf(config).Elem())
+	return configCopy.Interface()
+}
+
+func copyConfigValue(target reflect.Value, source reflect.Value) {
+	switch source.Kind() {
+	case reflect.Struct:
+		for index := 0; index < source.NumField(); index++ {
+			if target.Field(index).CanSet() {
+				copyConfigValue(target.Field(index), source.Field(index))
+			}
+		}
+	case reflect.Slice:
+		if source.IsNil() {
+			return
+		}
+		target.Set(reflect.MakeSlice(source.Type(), source.Len(), source.Len()))
+		for index := 0; index < source.Len(); index++ {
+			copyConfigValue(target.Index(index), source.Index(index))
+		}
+	case reflect.Ptr:
+		if source.IsNil() {
+			return
+		}
+		target.Set(reflect.New(source.Type().Elem()))
+		copyConfigValue(target.Elem(), source.Elem())
+	default:
+		target.Set(source)
+	}
+}
+
+func configSections(config interface{}) (map[string]json.RawMessage, error) {
+	jsonBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make(map[string]json.RawMessage)
+	err = json.Unmarshal(jsonBytes, &sections)
+	return sections, err
+}
+
+// Returns the names (sorted) of the sections which differ between the two configs
+func changedConfigSections(previous interface{}, current interface{}) ([]string, error) {
+	previousSections, err := configSections(previous)
+	if err != nil {
+		return nil, err
+	}
+	currentSections, err := configSections(current)
+	if err != nil {
+		return nil, err
+	}
+
+	changedSections := []string{}
+	for section, value := range currentSections {
+		if !bytes.Equal(previousSections[section], value) {
+			changedSections = append(changedSections, section)
+		}
+	}
+	for section := range previousSections {
+		if _, ok := currentSections[section]; !ok {
+			changedSections = append(changedSections, section)
+		}
+	}
+
+	sort.Strings(changedSections)
+	return changedSections, nil
+}
@@ -0,0 +1,201 @@
+package broadcast
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testConfigReloader(config *BackupConfig) *ConfigReloader {
+	return &ConfigReloader{
+		File:     config.File,
+		Config:   config,
+		EventLog: &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "config"},
+	}
+}
+
+func configReloaderEventMessages(reloader *ConfigReloader) []string {
+	messages := []string{}
+	for _, event := range reloader.EventLog.Parent.Events() {
+		messages = append(messages, event.Message)
+	}
+	return messages
+}
+
+func TestConfigReloader_Reload(t *testing.T) {
+	config := testBackupConfig()
+	config.File = testConfigFile(t, `{"Files": {"Root": "/srv/records"}}`)
+	defer os.Remove(config.File)
+
+	LoadConfig(config.File, &config)
+
+	reloader := testConfigReloader(&config)
+
+	var appliedMaxAge time.Duration
+	reloader.Handle("Retention", func() error {
+		appliedMaxAge = config.Retention.MaxAge
+		return nil
+	})
+
+	ioutil.WriteFile(config.File, []byte(`{"Files": {"Root": "/srv/records"}, "Retention": {"MaxAge": 3600000000000}, "Webhook": {"URL": "http://localhost/"}}`), 0644)
+
+	err := reloader.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if appliedMaxAge != time.Hour {
+		t.Errorf("Retention handler should be invoked with the new config :\n got: %v\nwant: %v", appliedMaxAge, time.Hour)
+	}
+	if config.File == "" {
+		t.Errorf("Config file should be kept")
+	}
+
+	expectedMessages := []string{"Config Retention changed", "Config Webhook changed (restart required)"}
+	if messages := configReloaderEventMessages(reloader); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("Wrong events :\n got: %v\nwant: %v", messages, expectedMessages)
+	}
+}
+
+func TestConfigReloader_Reload_invalid(t *testing.T) {
+	config := testBackupConfig()
+	config.File = testConfigFile(t, `{"Files": {"Root": "/srv/records"}}`)
+	defer os.Remove(config.File)
+
+	LoadConfig(config.File, &config)
+
+	reloader := testConfigReloader(&config)
+	ioutil.WriteFile(config.File, []byte(`{"Files": {"Root": "/srv/other", "Duration": -1}}`), 0644)
+
+	err := reloader.Reload()
+	if err == nil {
+		t.Errorf("Invalid config should be refused")
+	}
+	if config.Files.Root != "/srv/records" {
+		t.Errorf("Current config should be kept :\n got: %v\nwant: %v", config.Files.Root, "/srv/records")
+	}
+
+	expectedMessages := []string{"Can't reload config: Invalid config: Files.Duration: must be positive"}
+	if messages := configReloaderEventMessages(reloader); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("Wrong events :\n got: %v\nwant: %v", messages, expectedMessages)
+	}
+}
+
+func TestConfigReloader_Apply(t *testing.T) {
+	config := testBackupConfig()
+	reloader := testConfigReloader(&config)
+
+	err := reloader.Apply([]byte(`{"Files": {"Root": "/srv/other"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Files.Root != "/srv/other" {
+		t.Errorf("Config should be applied :\n got: %v\nwant: %v", config.Files.Root, "/srv/other")
+	}
+
+	err = reloader.Apply([]byte(`{"Files": {"Duration": -1}}`))
+	if err == nil {
+		t.Errorf("Invalid config should be refused")
+	}
+
+	expectedMessages := []string{"Config Files changed (restart required)", "Can't apply config: Invalid config: Files.Duration: must be positive"}
+	if messages := configReloaderEventMessages(reloader); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("Wrong events :\n got: %v\nwant: %v", messages, expectedMessages)
+	}
+}
+
+func TestConfigReloader_Apply_unknownFields(t *testing.T) {
+	config := testBackupConfig()
+	reloader := testConfigReloader(&config)
+
+	err := reloader.Apply([]byte(`{"Files": {"Root": "/srv/other", "Obsolete": 1}}`))
+	if _, ok := err.(ConfigErrors); !ok {
+		t.Errorf("Unknown fields should be refused :\n got: %v", err)
+	}
+	if config.Files.Root == "/srv/other" {
+		t.Errorf("Refused config should not be applied")
+	}
+}
+
+func TestConfigReloader_Apply_ignoreUnknownFields(t *testing.T) {
+	config := testBackupConfig()
+	config.IgnoreUnknownFields = true
+	reloader := testConfigReloader(&config)
+
+	err := reloader.Apply([]byte(`{"Files": {"Root": "/srv/other", "Obsolete": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Files.Root != "/srv/other" {
+		t.Errorf("Config should be applied :\n got: %v\nwant: %v", config.Files.Root, "/srv/other")
+	}
+
+	expectedMessages := []string{"Ignore unknown config field: Files.Obsolete", "Config Files changed (restart required)"}
+	if messages := configReloaderEventMessages(reloader); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("Wrong events :\n got: %v\nwant: %v", messages, expectedMessages)
+	}
+}
+
+func TestConfigReloader_Apply_mutex(t *testing.T) {
+	config := testBackupConfig()
+	reloader := testConfigReloader(&config)
+
+	mutex := &sync.Mutex{}
+	reloader.Mutex = mutex
+
+	mutex.Lock()
+	applied := make(chan error)
+	go func() {
+		applied <- reloader.Apply([]byte(`{"Files": {"Root": "/srv/other"}}`))
+	}()
+
+	select {
+	case <-applied:
+		t.Fatal("Config shouldn't be replaced while the mutex is locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	mutex.Unlock()
+
+	if err := <-applied; err != nil {
+		t.Fatal(err)
+	}
+	if config.Files.Root != "/srv/other" {
+		t.Errorf("Config should be applied :\n got: %v\nwant: %v", config.Files.Root, "/srv/other")
+	}
+}
+
+func TestConfigReloader_Apply_refresh(t *testing.T) {
+	config := testBackupConfig()
+	reloader := testConfigReloader(&config)
+
+	root := config.Files.Root
+	// The running component uses another root
+	reloader.Refresh = func() {
+		config.Files.Root = "/srv/other"
+	}
+
+	err := reloader.Apply([]byte(fmt.Sprintf(`{"Files": {"Root": "%s"}}`, root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedMessages := []string{"Config Files changed (restart required)"}
+	if messages := configReloaderEventMessages(reloader); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("Wrong events :\n got: %v\nwant: %v", messages, expectedMessages)
+	}
+}
+
+func TestCopyConfig(t *testing.T) {
+	config := &HttpStreamOutputsConfig{Streams: []BufferedHttpStreamOutputConfig{{Identifier: "1"}}}
+
+	configCopy := copyConfig(config).(*HttpStreamOutputsConfig)
+	configCopy.Streams[0].Identifier = "2"
+
+	if config.Streams[0].Identifier != "1" {
+		t.Errorf("Copy should not share slices with the original config")
+	}
+}
@@ -2,9 +2,12 @@ package broadcast
 
 import (
 	"flag"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommandConfig_Flags(t *testing.T) {
@@ -28,6 +31,22 @@ func TestCommandConfig_Flags(t *testing.T) {
 	if config.Profiler.Memory != "memory-output" {
 		t.Errorf("Wrong config Memory :\n got: %v\nwant: %v", config.Profiler.Memory, "memory-output")
 	}
+
+	flags.Parse(strings.Split("-shutdown-timeout=30s", " "))
+	if config.Shutdown.Timeout != 30*time.Second {
+		t.Errorf("Wrong shutdown timeout :\n got: %v\nwant: %v", config.Shutdown.Timeout, 30*time.Second)
+	}
+
+	flags.Parse(strings.Split("-metrics-statsd-address=localhost:8125 -metrics-statsd-tags=host=studio -metrics-influxdb-url=udp://localhost:8089 -metrics-graphite-interval=1m", " "))
+	if config.Metrics.StatsD.Address != "localhost:8125" || config.Metrics.StatsD.Tags["host"] != "studio" {
+		t.Errorf("Wrong StatsD config :\n got: %v", config.Metrics.StatsD)
+	}
+	if config.Metrics.InfluxDB.URL != "udp://localhost:8089" || config.Metrics.InfluxDB.Prefix != "gobroadcast" {
+		t.Errorf("Wrong InfluxDB config :\n got: %v", config.Metrics.InfluxDB)
+	}
+	if config.Metrics.Graphite.Interval != time.Minute {
+		t.Errorf("Wrong Graphite interval :\n got: %v\nwant: %v", config.Metrics.Graphite.Interval, time.Minute)
+	}
 }
 
 func TestAlsaOutputConfig_Flags(t *testing.T) {
@@ -201,3 +220,217 @@ func TestHttpStreamOutput_Apply(t *testing.T) {
 		t.Errorf("HttpStreamOutput Format should be config Format :\n got: %v\nwant: %v", httpStreamOutput.Format, expectedFormat)
 	}
 }
+
+func testConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	file.WriteString(content)
+	return file.Name()
+}
+
+func testBackupConfig() BackupConfig {
+	config := BackupConfig{}
+	config.Flags(flag.NewFlagSet("test", flag.ContinueOnError))
+	return config
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := testConfigFile(t, `{"Files": {"Root": "/srv/records", "Format": "flac"}, "Log": {"Debug": true}}`)
+	defer os.Remove(file)
+
+	config := testBackupConfig()
+	err := LoadConfig(file, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Files.Root != "/srv/records" || config.Files.Format != "flac" || !config.Log.Debug {
+		t.Errorf("Wrong loaded config :\n got: %v", config)
+	}
+	if config.Files.Duration != 5*time.Minute {
+		t.Errorf("Values missing in file should be kept :\n got: %v\nwant: %v", config.Files.Duration, 5*time.Minute)
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	file := testConfigFile(t, `{}`)
+	defer os.Remove(file)
+
+	config := testBackupConfig()
+	config.Files.Root = "/srv/records"
+
+	err := SaveConfig(file, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(file + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Temporary file should be renamed")
+	}
+
+	loadedConfig := testBackupConfig()
+	err = LoadConfig(file, &loadedConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedConfig.Files.Root != "/srv/records" {
+		t.Errorf("Wrong saved config :\n got: %v\nwant: %v", loadedConfig.Files.Root, "/srv/records")
+	}
+}
+
+func TestLoadConfig_errors(t *testing.T) {
+	conditions := []struct {
+		content string
+		field   string
+	}{
+		{`{"Files": {"Rot": "/srv/records"}}`, "Rot"},
+		{`{"Files": {"Duration": "5m"}}`, "Files.Duration"},
+		{`{"Files": {"Format": "dummy"}}`, "Files.Format"},
+		{`{"Alsa": {"SampleRate": 0}}`, "Alsa.SampleRate"},
+		{`{"Record": {"Mode": "schedule", "Schedule": "mon 25:00-26:00"}}`, "Record.Schedule"},
+		{`{"Files": `, ""},
+	}
+
+	for _, condition := range conditions {
+		file := testConfigFile(t, condition.content)
+		defer os.Remove(file)
+
+		config := testBackupConfig()
+		err := LoadConfig(file, &config)
+
+		errors, ok := err.(ConfigErrors)
+		if !ok || len(errors) != 1 {
+			t.Errorf("Config %s should be refused with one error :\n got: %v", condition.content, err)
+			continue
+		}
+		if errors[0].Field != condition.field {
+			t.Errorf("Wrong field in error for %s :\n got: %v\nwant: %v", condition.content, errors[0].Field, condition.field)
+		}
+	}
+}
+
+func TestLoadConfig_unknownFields(t *testing.T) {
+	file := testConfigFile(t, `{"Files": {"Rot": "/srv/other", "Root": "/srv/records"}, "Dummy": true}`)
+	defer os.Remove(file)
+
+	config := testBackupConfig()
+	config.IgnoreUnknownFields = true
+	err := LoadConfig(file, &config)
+	if err != nil {
+		t.Fatalf("Unknown fields should be ignored when requested :\n got: %v", err)
+	}
+	if config.Files.Root != "/srv/records" {
+		t.Errorf("Known fields should be loaded :\n got: %v", config.Files.Root)
+	}
+}
+
+func TestDecodeConfigFile(t *testing.T) {
+	config := HttpStreamOutputsConfig{}
+	data := `{"Streams": [{"Target": "http://localhost/live.mp3", "Quality": 5}, {"Identifier": "ogg", "BufferDuration": 1, "dummy": {}}], "Other": 1}`
+
+	unknownFields, err := DecodeConfigFile([]byte(data), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFields := []string{"Other", "Streams[0].Quality", "Streams[1].dummy"}
+	if !reflect.DeepEqual(unknownFields, expectedFields) {
+		t.Errorf("Wrong unknown fields :\n got: %v\nwant: %v", unknownFields, expectedFields)
+	}
+	if len(config.Streams) != 2 || config.Streams[0].Target != "http://localhost/live.mp3" || config.Streams[1].Identifier != "ogg" {
+		t.Errorf("Wrong decoded config :\n got: %v", config)
+	}
+
+	// API requests are decoded strictly
+	if err := DecodeConfig([]byte(data), &config); err == nil {
+		t.Errorf("Unknown fields should be refused by DecodeConfig")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	config := HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "http://stream-in.tryphon.eu:8000/test.ogg"}},
+			{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "ftp://stream-in.tryphon.eu/test.ogg", ServerType: "dummy"}},
+			{},
+		},
+	}
+
+	err := ValidateConfig(&config)
+	expectedErrors := ConfigErrors{
+		{Field: "Streams[1].Target", Message: "invalid http URL 'ftp://stream-in.tryphon.eu/test.ogg'"},
+		{Field: "Streams[1].ServerType", Message: "unknown server type 'dummy' (icecast2 or shoutcast)"},
+	}
+	if !reflect.DeepEqual(err, expectedErrors) {
+		t.Errorf("Wrong errors :\n got: %v\nwant: %v", err, expectedErrors)
+	}
+}
+
+func TestConfigErrors_Error(t *testing.T) {
+	errors := ConfigErrors{}
+	errors.Add("Alsa.SampleRate", "must be positive")
+	errors.Add("", "invalid JSON")
+
+	expectedMessage := "Invalid config: Alsa.SampleRate: must be positive, invalid JSON"
+	if errors.Error() != expectedMessage {
+		t.Errorf("Wrong message :\n got: %v\nwant: %v", errors.Error(), expectedMessage)
+	}
+}
+
+func TestHttpClientConfig_Flags(t *testing.T) {
+	config := HttpClientConfig{}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	config.Flags(flags)
+
+	flags.Parse(strings.Split("-debug -http-username=source -high-max=20 -alsa-device=test", " "))
+	if !config.Log.Debug {
+		t.Errorf("Log debug should be enabled :\n got: %v\nwant: %v", config.Log.Debug, true)
+	}
+	if config.Input.Username != "source" {
+		t.Errorf("Input Username should be 'http-username' flag value :\n got: %v\nwant: %v", config.Input.Username, "source")
+	}
+	if config.Buffer.HighMax != 20 {
+		t.Errorf("Buffer HighMax should be 'high-max' flag value :\n got: %v\nwant: %v", config.Buffer.HighMax, 20)
+	}
+	if config.Alsa.Device != "test" {
+		t.Errorf("Alsa Device should be 'alsa-device' flag value :\n got: %v\nwant: %v", config.Alsa.Device, "test")
+	}
+}
+
+func TestLoopbackConfig_Flags(t *testing.T) {
+	config := LoopbackConfig{}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	config.Flags(flags)
+
+	flags.Parse(strings.Split("-input-device=hw:0 -output-sample-format=s16le -sample-rate=48000", " "))
+	if config.Input.Device != "hw:0" {
+		t.Errorf("Input Device should be 'input-device' flag value :\n got: %v\nwant: %v", config.Input.Device, "hw:0")
+	}
+	if config.Output.SampleFormat != "s16le" {
+		t.Errorf("Output SampleFormat should be 'output-sample-format' flag value :\n got: %v\nwant: %v", config.Output.SampleFormat, "s16le")
+	}
+	if config.SampleRate != 48000 {
+		t.Errorf("SampleRate should be 'sample-rate' flag value :\n got: %v\nwant: %v", config.SampleRate, 48000)
+	}
+}
+
+func TestHttpServerConfig_Apply_auth(t *testing.T) {
+	config := HttpServerConfig{
+		Auth: HttpAuthConfig{
+			Tokens: []HttpTokenConfig{{Name: "monitoring", Hash: HashHttpToken("token"), Role: HttpRoleReader}},
+		},
+	}
+	httpServer := &HttpServer{}
+
+	config.Apply(httpServer)
+
+	if !httpServer.Auth.Enabled() || httpServer.Auth.Tokens[0].Name != "monitoring" {
+		t.Errorf("HttpServer Auth should be config Auth :\n got: %v", httpServer.Auth)
+	}
+}
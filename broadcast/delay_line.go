@@ -0,0 +1,442 @@
+package broadcast
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The tempo changes, the pitch is preserved (WSOLA)
+	DelayRebuildStretch = "stretch"
+	// The audio is resampled, the pitch changes with the tempo
+	DelayRebuildVarispeed = "varispeed"
+	DelayRebuildSilence   = "silence"
+)
+
+const (
+	// The length of the segments overlapped by the stretch
+	delayStretchSegment = 20 * time.Millisecond
+	// The maximum shift of a segment to find the best overlap
+	delayStretchTolerance = 5 * time.Millisecond
+)
+
+// A DelayLine delays the program by a configurable duration (profanity
+// delay). The last seconds can be dumped before being aired. The delay is
+// then rebuilt by slowing down the audio (stretch or varispeed) or by
+// inserting silence.
+type DelayLine struct {
+	Output     AudioHandler
+	SampleRate int
+
+	EventLog *LocalEventLog
+
+	config  *DelayConfig
+	enabled bool
+
+	samples  [][]float32
+	position float64
+	// The stretched samples not sent yet
+	stretched [][]float32
+
+	mutex sync.Mutex
+}
+
+type DelayLineStatus struct {
+	Enabled bool
+	// The configured delay
+	Delay time.Duration
+	// The current delay, lower than Delay after a dump
+	CurrentDelay time.Duration
+	Rebuilding   bool
+}
+
+func (line *DelayLine) SetAudioHandler(audioHandler AudioHandler) {
+	line.Output = audioHandler
+}
+
+func (line *DelayLine) eventLog() *LocalEventLog {
+	if line.EventLog == nil {
+		line.EventLog = &LocalEventLog{Source: "delay"}
+	}
+	return line.EventLog
+}
+
+func (line *DelayLine) Setup(config *DelayConfig) {
+	line.mutex.Lock()
+	defer line.mutex.Unlock()
+
+	line.config = config
+	line.enabled = config.Delay > 0
+}
+
+func (line *DelayLine) Config() *DelayConfig {
+	if line.config != nil {
+		return line.config
+	} else {
+		return NewDelayConfig()
+	}
+}
+
+func (line *DelayLine) durationToSamples(duration time.Duration) int {
+	return int(duration.Seconds() * float64(line.SampleRate))
+}
+
+func (line *DelayLine) samplesToDuration(sampleCount int) time.Duration {
+	if line.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(sampleCount) * time.Second / time.Duration(line.SampleRate)
+}
+
+// Returns the count of samples not read yet
+func (line *DelayLine) unreadSampleCount() int {
+	if len(line.samples) == 0 {
+		return 0
+	}
+	return len(line.samples[0]) - int(math.Ceil(line.position))
+}
+
+func (line *DelayLine) stretchedSampleCount() int {
+	if len(line.stretched) == 0 {
+		return 0
+	}
+	return len(line.stretched[0])
+}
+
+func (line *DelayLine) bufferedSampleCount() int {
+	return line.unreadSampleCount() + line.stretchedSampleCount()
+}
+
+func (line *DelayLine) targetSampleCount() int {
+	if !line.enabled {
+		return 0
+	}
+	return line.durationToSamples(line.Config().Delay)
+}
+
+// Drops the last seconds of the delayed program (Config().Dump)
+func (line *DelayLine) Dump() time.Duration {
+	line.mutex.Lock()
+	defer line.mutex.Unlock()
+
+	dumpedSampleCount := line.durationToSamples(line.Config().Dump)
+	if unread := line.unreadSampleCount(); dumpedSampleCount > unread {
+		dumpedSampleCount = unread
+	}
+
+	for channel := range line.samples {
+		line.samples[channel] = line.samples[channel][:len(line.samples[channel])-dumpedSampleCount]
+	}
+
+	dumped := line.samplesToDuration(dumpedSampleCount)
+	line.eventLog().NewEvent(fmt.Sprintf("Dump %v of program", dumped))
+
+	return dumped
+}
+
+// Enters the delay, rebuilt progressively
+func (line *DelayLine) Enter() {
+	line.mutex.Lock()
+	defer line.mutex.Unlock()
+
+	if !line.enabled {
+		line.enabled = true
+		line.eventLog().NewEvent(fmt.Sprintf("Enter delay (%v)", line.Config().Delay))
+	}
+}
+
+// Exits the delay, the program is sped up until the live audio is reached
+func (line *DelayLine) Exit() {
+	line.mutex.Lock()
+	defer line.mutex.Unlock()
+
+	if line.enabled {
+		line.enabled = false
+		line.eventLog().NewEvent("Exit delay")
+	}
+}
+
+func (line *DelayLine) Status() DelayLineStatus {
+	line.mutex.Lock()
+	defer line.mutex.Unlock()
+
+	currentSampleCount := line.bufferedSampleCount()
+	targetSampleCount := line.targetSampleCount()
+
+	return DelayLineStatus{
+		Enabled:      line.enabled,
+		Delay:        line.Config().Delay,
+		CurrentDelay: line.samplesToDuration(currentSampleCount),
+		Rebuilding:   line.enabled && currentSampleCount < targetSampleCount,
+	}
+}
+
+func (line *DelayLine) AudioOut(audio *Audio) {
+	line.mutex.Lock()
+	output := line.process(audio)
+	line.mutex.Unlock()
+
+	if line.Output != nil {
+		line.Output.AudioOut(output)
+	}
+}
+
+// Returns the same sample count than the given audio
+func (line *DelayLine) process(audio *Audio) *Audio {
+	if len(line.samples) == 0 && !line.enabled {
+		return audio
+	}
+
+	if len(line.samples) != audio.ChannelCount() {
+		line.samples = make([][]float32, audio.ChannelCount())
+		line.position = 0
+		line.stretched = nil
+	}
+	for channel := 0; channel < audio.ChannelCount(); channel++ {
+		line.samples[channel] = append(line.samples[channel], audio.Samples(channel)...)
+	}
+
+	excessSampleCount := float64(len(line.samples[0])) - line.position + float64(line.stretchedSampleCount()) - float64(line.targetSampleCount())
+
+	output := NewAudio(audio.SampleCount(), audio.ChannelCount())
+	output.SetTimestamp(audio.Timestamp())
+
+	// The samples already stretched are sent first
+	offset := line.sendStretched(output, 0)
+	excessSampleCount -= float64(offset)
+	sampleCount := output.SampleCount() - offset
+
+	config := line.Config()
+	rate := config.stretchRate()
+	consumed := math.Min(math.Max(excessSampleCount, float64(sampleCount)*(1-rate)), float64(sampleCount)*(1+rate))
+	consumed = math.Min(consumed, float64(len(line.samples[0]))-line.position)
+
+	switch {
+	case sampleCount == 0:
+	case config.rebuild() == DelayRebuildSilence && excessSampleCount < float64(sampleCount):
+		// The missing samples are replaced by silence
+		silenceSampleCount := sampleCount - int(math.Max(excessSampleCount, 0))
+		line.consume(output, offset+silenceSampleCount, float64(sampleCount-silenceSampleCount), 1)
+	case config.rebuild() == DelayRebuildStretch && math.Abs(consumed-float64(sampleCount)) > float64(line.durationToSamples(delayStretchSegment)):
+		line.stretch(output, offset, consumed/float64(sampleCount))
+	default:
+		// The varispeed mode resamples the audio, like the corrections
+		// smaller than a stretch segment
+		line.consume(output, offset, consumed, consumed/float64(sampleCount))
+	}
+
+	// The delay line is empty again after an exit
+	if !line.enabled && line.bufferedSampleCount() <= 0 {
+		line.samples = nil
+		line.position = 0
+		line.stretched = nil
+	}
+
+	return output
+}
+
+// Fills the output from the given offset by reading the buffered samples
+// with the given step (linear interpolation)
+func (line *DelayLine) consume(output *Audio, offset int, consumed float64, step float64) {
+	for channel, samples := range line.samples {
+		outputSamples := output.Samples(channel)
+
+		for index := offset; index < output.SampleCount(); index++ {
+			position := line.position + float64(index-offset)*step
+			sampleIndex := int(position)
+			if sampleIndex >= len(samples) {
+				break
+			}
+
+			sample := samples[sampleIndex]
+			if fraction := float32(position - float64(sampleIndex)); fraction > 0 && sampleIndex+1 < len(samples) {
+				sample += (samples[sampleIndex+1] - sample) * fraction
+			}
+			outputSamples[index] = sample
+		}
+	}
+
+	line.position += consumed
+	line.drop()
+}
+
+// Fills the output from the given offset with the buffered samples read at
+// the given speed, without changing the pitch. Segments of the buffered
+// samples are overlapped, each one shifted to best match the previous one
+// (WSOLA).
+func (line *DelayLine) stretch(output *Audio, offset int, speed float64) {
+	segmentLength := line.durationToSamples(delayStretchSegment)
+	tolerance := line.durationToSamples(delayStretchTolerance)
+
+	for line.stretchedSampleCount() < output.SampleCount()-offset {
+		if !line.stretchSegment(segmentLength, tolerance, speed) {
+			break
+		}
+	}
+
+	offset = line.sendStretched(output, offset)
+	if offset < output.SampleCount() {
+		// Not enough buffered samples to overlap a segment
+		sampleCount := float64(output.SampleCount() - offset)
+		consumed := math.Min(sampleCount*speed, float64(len(line.samples[0]))-line.position)
+		line.consume(output, offset, consumed, consumed/sampleCount)
+		return
+	}
+
+	line.drop()
+}
+
+// Appends a segment to the stretched samples. The buffered samples from the
+// current position (the continuation of the previous segment) are faded out
+// while the best matching segment, around the position moved by the speed,
+// is faded in. Returns false when the buffered samples are too short.
+func (line *DelayLine) stretchSegment(segmentLength int, tolerance int, speed float64) bool {
+	current := int(line.position)
+	bufferLength := len(line.samples[0])
+	if segmentLength <= 0 || current+segmentLength > bufferLength {
+		return false
+	}
+
+	target := current + int(math.Floor(float64(segmentLength)*(speed-1)+0.5))
+	// Without the previous samples (at start), the segment can't be repeated
+	first, last := target-tolerance, target+tolerance
+	if first < 0 {
+		first = 0
+	}
+	if last < first {
+		last = first
+	}
+	if last > bufferLength-segmentLength {
+		last = bufferLength - segmentLength
+	}
+	if first > last {
+		return false
+	}
+
+	best, bestCorrelation := first, math.Inf(-1)
+	for candidate := first; candidate <= last; candidate++ {
+		var product, energy float64
+		for _, samples := range line.samples {
+			for index := 0; index < segmentLength; index++ {
+				sample := float64(samples[candidate+index])
+				product += float64(samples[current+index]) * sample
+				energy += sample * sample
+			}
+		}
+
+		correlation := product / math.Sqrt(energy+1e-9)
+		if correlation > bestCorrelation {
+			best, bestCorrelation = candidate, correlation
+		}
+	}
+
+	if line.stretched == nil {
+		line.stretched = make([][]float32, len(line.samples))
+	}
+	for channel, samples := range line.samples {
+		for index := 0; index < segmentLength; index++ {
+			fadeIn := float32(0.5 - 0.5*math.Cos(math.Pi*(float64(index)+0.5)/float64(segmentLength)))
+			sample := samples[current+index]*(1-fadeIn) + samples[best+index]*fadeIn
+			line.stretched[channel] = append(line.stretched[channel], sample)
+		}
+	}
+
+	line.position = float64(best + segmentLength)
+	return true
+}
+
+// Copies the stretched samples in the output from the given offset.
+// Returns the offset after the copied samples.
+func (line *DelayLine) sendStretched(output *Audio, offset int) int {
+	sampleCount := line.stretchedSampleCount()
+	if available := output.SampleCount() - offset; sampleCount > available {
+		sampleCount = available
+	}
+	if sampleCount <= 0 {
+		return offset
+	}
+
+	for channel := range line.stretched {
+		copy(output.Samples(channel)[offset:], line.stretched[channel][:sampleCount])
+		line.stretched[channel] = line.stretched[channel][sampleCount:]
+	}
+	return offset + sampleCount
+}
+
+// Drops the read samples. The last ones are kept to be overlapped by the
+// stretch.
+func (line *DelayLine) drop() {
+	droppedSampleCount := int(line.position) - 2*line.durationToSamples(delayStretchSegment)
+	if droppedSampleCount <= 0 {
+		return
+	}
+
+	for channel := range line.samples {
+		line.samples[channel] = line.samples[channel][droppedSampleCount:]
+	}
+	line.position -= float64(droppedSampleCount)
+}
+
+type DelayConfig struct {
+	Delay time.Duration
+	// The duration dropped by a dump
+	Dump        time.Duration
+	Rebuild     string
+	StretchRate float64
+}
+
+// The rebuild mode, stretch by default
+func (config *DelayConfig) rebuild() string {
+	if config.Rebuild == "" {
+		return DelayRebuildStretch
+	}
+	return config.Rebuild
+}
+
+// The speed change, 0.05 by default
+func (config *DelayConfig) stretchRate() float64 {
+	if config.StretchRate == 0 {
+		return 0.05
+	}
+	return config.StretchRate
+}
+
+func NewDelayConfig() *DelayConfig {
+	return &DelayConfig{
+		Dump:        10 * time.Second,
+		Rebuild:     DelayRebuildStretch,
+		StretchRate: 0.05,
+	}
+}
+
+func (config *DelayConfig) Validate(errors *ConfigErrors) {
+	if config.Delay < 0 {
+		errors.Add("Delay", "can't be negative")
+	}
+	if config.Dump < 0 {
+		errors.Add("Dump", "can't be negative")
+	}
+	switch config.rebuild() {
+	case DelayRebuildStretch, DelayRebuildVarispeed, DelayRebuildSilence:
+	default:
+		errors.Add("Rebuild", "unknown rebuild mode '%s' (stretch, varispeed or silence)", config.Rebuild)
+	}
+	if config.stretchRate() <= 0 || config.stretchRate() >= 1 {
+		errors.Add("StretchRate", "must be between 0 and 1")
+	}
+}
+
+func (config *DelayConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.DurationVar(&config.Delay, strings.Join([]string{prefix, "duration"}, "-"), 0, "The program delay (0 to disable)")
+	flags.DurationVar(&config.Dump, strings.Join([]string{prefix, "dump"}, "-"), 10*time.Second, "The duration dropped by a dump")
+	flags.StringVar(&config.Rebuild, strings.Join([]string{prefix, "rebuild"}, "-"), DelayRebuildStretch, "The delay rebuild mode (stretch, varispeed or silence)")
+	flags.Float64Var(&config.StretchRate, strings.Join([]string{prefix, "stretch-rate"}, "-"), 0.05, "The speed change used to rebuild or exit the delay")
+}
+
+func (config *DelayConfig) Apply(line *DelayLine) {
+	line.Setup(config)
+}
@@ -0,0 +1,82 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+type DelayLineController struct {
+	line *DelayLine
+}
+
+func NewDelayLineController(line *DelayLine) (controller *DelayLineController) {
+	return &DelayLineController{line: line}
+}
+
+func (controller *DelayLineController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		if err != nil {
+			controller.fatal(response, err)
+			return
+		}
+	}
+
+	switch {
+	case request.URL.Path == "/delay.json" && request.Method == "GET":
+		controller.Show(response)
+	case request.URL.Path == "/delay.json" && request.Method == "PUT":
+		controller.Update(response, body)
+	case request.URL.Path == "/delay/dump" && request.Method == "POST":
+		controller.line.Dump()
+		controller.Show(response)
+	case request.URL.Path == "/delay/exit" && request.Method == "POST":
+		controller.line.Exit()
+		controller.Show(response)
+	case request.URL.Path == "/delay/enter" && request.Method == "POST":
+		controller.line.Enter()
+		controller.Show(response)
+	default:
+		http.Error(response, "Method not allowed", 405)
+	}
+}
+
+func (controller *DelayLineController) Show(response http.ResponseWriter) {
+	response.Header().Set("Content-Type", "application/json")
+
+	jsonBytes, err := json.Marshal(controller.line.Status())
+	if err == nil {
+		response.Write(jsonBytes)
+	} else {
+		controller.fatal(response, err)
+	}
+}
+
+func (controller *DelayLineController) Update(response http.ResponseWriter, body []byte) {
+	Log.Debugf("Update delay %s", string(body))
+
+	config := *controller.line.Config()
+
+	err := json.Unmarshal(body, &config)
+	if err != nil {
+		http.Error(response, fmt.Sprintf("Invalid delay: %v", err), 400)
+		return
+	}
+
+	err = ValidateConfig(&config)
+	if err != nil {
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	controller.line.Setup(&config)
+	controller.Show(response)
+}
+
+func (controller *DelayLineController) fatal(response http.ResponseWriter, err error) {
+	http.Error(response, fmt.Sprintf("Unknown error: %v", err), 500)
+}
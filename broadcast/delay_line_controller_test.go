@@ -0,0 +1,83 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelayLineController_Update(t *testing.T) {
+	line := &DelayLine{SampleRate: 1000}
+	controller := NewDelayLineController(line)
+
+	request, _ := http.NewRequest("PUT", "http://localhost:9000/delay.json", strings.NewReader(`{"Delay":5000000000}`))
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+
+	var status DelayLineStatus
+	json.Unmarshal(response.Body.Bytes(), &status)
+	if !status.Enabled || status.Delay != 5*time.Second {
+		t.Errorf("Wrong delay status :\n got: %v", status)
+	}
+
+	if line.Config().Dump != 10*time.Second {
+		t.Errorf("Default dump duration should be kept :\n got: %v\nwant: %v", line.Config().Dump, 10*time.Second)
+	}
+}
+
+func TestDelayLineController_Update_invalid(t *testing.T) {
+	line := &DelayLine{SampleRate: 1000}
+	controller := NewDelayLineController(line)
+
+	for _, body := range []string{`{"Delay":`, `{"Delay":-1}`, `{"Rebuild":"dummy"}`} {
+		request, _ := http.NewRequest("PUT", "http://localhost:9000/delay.json", strings.NewReader(body))
+		response := httptest.NewRecorder()
+		controller.ServeHTTP(response, request)
+
+		if response.Code != 400 {
+			t.Errorf("Wrong response code for %s :\n got: %v\nwant: %v", body, response.Code, 400)
+		}
+	}
+
+	if line.Config().Delay != 0 || line.Config().Rebuild != DelayRebuildStretch {
+		t.Errorf("Invalid config should be ignored :\n got: %v", line.Config())
+	}
+}
+
+func TestDelayLineController_actions(t *testing.T) {
+	line := &DelayLine{
+		SampleRate: 1000,
+		EventLog:   &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "delay"},
+	}
+	line.Setup(&DelayConfig{Delay: time.Second, Dump: time.Second})
+	controller := NewDelayLineController(line)
+
+	for _, action := range []string{"dump", "exit", "enter"} {
+		request, _ := http.NewRequest("POST", "http://localhost:9000/delay/"+action, nil)
+		response := httptest.NewRecorder()
+		controller.ServeHTTP(response, request)
+
+		if response.Code != 200 {
+			t.Errorf("Wrong response code for %s :\n got: %v\nwant: %v", action, response.Code, 200)
+		}
+	}
+
+	if events := line.eventLog().Events(); len(events) != 3 {
+		t.Errorf("Each action should be logged :\n got: %v", events)
+	}
+
+	request, _ := http.NewRequest("GET", "http://localhost:9000/delay/dump", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 405 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 405)
+	}
+}
@@ -0,0 +1,234 @@
+package broadcast
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func testDelayLine(config *DelayConfig) (*DelayLine, *[]float32) {
+	output := []float32{}
+
+	line := &DelayLine{
+		SampleRate: 1000,
+		EventLog:   &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "delay"},
+		Output: AudioHandlerFunc(func(audio *Audio) {
+			output = append(output, audio.Samples(0)...)
+		}),
+	}
+	line.Setup(config)
+
+	return line, &output
+}
+
+// Sends count blocks of 100 samples, each sample is its position
+func sendDelayLineAudio(line *DelayLine, start int, count int) int {
+	for block := 0; block < count; block++ {
+		audio := NewAudio(100, 1)
+		audio.Process(func(_ int, samplePosition int, _ float32) float32 {
+			return float32(start + samplePosition)
+		})
+		line.AudioOut(audio)
+		start += 100
+	}
+	return start
+}
+
+func TestDelayLine_AudioOut_disabled(t *testing.T) {
+	line, output := testDelayLine(NewDelayConfig())
+
+	sendDelayLineAudio(line, 1, 2)
+
+	if len(*output) != 200 || (*output)[0] != 1 {
+		t.Errorf("Audio should be unchanged without delay :\n got: %v", (*output)[:10])
+	}
+}
+
+func TestDelayLine_AudioOut_silence(t *testing.T) {
+	config := NewDelayConfig()
+	config.Delay = 250 * time.Millisecond
+	config.Rebuild = DelayRebuildSilence
+
+	line, output := testDelayLine(config)
+	sendDelayLineAudio(line, 1, 5)
+
+	if len(*output) != 500 {
+		t.Fatalf("Wrong output sample count :\n got: %v\nwant: %v", len(*output), 500)
+	}
+	if (*output)[249] != 0 || (*output)[250] != 1 || (*output)[499] != 250 {
+		t.Errorf("Audio should be delayed by 250 samples :\n got: %v %v %v", (*output)[249], (*output)[250], (*output)[499])
+	}
+
+	status := line.Status()
+	if status.CurrentDelay != config.Delay || status.Rebuilding {
+		t.Errorf("Wrong delay status :\n got: %v", status)
+	}
+}
+
+func TestDelayLine_AudioOut_varispeed(t *testing.T) {
+	config := NewDelayConfig()
+	config.Delay = 100 * time.Millisecond
+	config.Rebuild = DelayRebuildVarispeed
+	config.StretchRate = 0.5
+
+	line, output := testDelayLine(config)
+	sendDelayLineAudio(line, 0, 1)
+
+	// The first block is slowed down
+	if (*output)[1] != 0.5 || (*output)[99] != 49.5 {
+		t.Errorf("Audio should be resampled :\n got: %v %v", (*output)[1], (*output)[99])
+	}
+	if status := line.Status(); !status.Rebuilding || status.CurrentDelay != 50*time.Millisecond {
+		t.Errorf("Wrong delay status :\n got: %v", status)
+	}
+
+	sendDelayLineAudio(line, 100, 2)
+
+	if status := line.Status(); status.Rebuilding || status.CurrentDelay != config.Delay {
+		t.Errorf("Delay should be rebuilt :\n got: %v", status)
+	}
+	if (*output)[299] != 199 {
+		t.Errorf("Audio should be delayed by 100 samples :\n got: %v", (*output)[299])
+	}
+}
+
+// Returns the count of upward zero crossings
+func delayLineZeroCrossings(samples []float32) int {
+	var count int
+	for index := 1; index < len(samples); index++ {
+		if samples[index-1] < 0 && samples[index] >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDelayLine_AudioOut_stretch(t *testing.T) {
+	config := NewDelayConfig()
+	config.Delay = 200 * time.Millisecond
+	config.StretchRate = 0.5
+
+	line, output := testDelayLine(config)
+
+	// 100Hz sine, a period is 10 samples
+	var position int
+	sendSine := func(count int) {
+		for block := 0; block < count; block++ {
+			audio := NewAudio(100, 1)
+			audio.Process(func(_ int, _ int, _ float32) float32 {
+				position++
+				return float32(math.Sin(2 * math.Pi * float64(position) / 10))
+			})
+			line.AudioOut(audio)
+		}
+	}
+
+	sendSine(2)
+	if status := line.Status(); !status.Rebuilding || status.CurrentDelay < 50*time.Millisecond {
+		t.Errorf("Delay should be rebuilding :\n got: %v", status)
+	}
+
+	// The tempo is slowed down, not the pitch
+	if crossings := delayLineZeroCrossings((*output)[20:200]); crossings != 18 {
+		t.Errorf("Pitch should be preserved :\n got: %v crossings\nwant: %v", crossings, 18)
+	}
+	for index, sample := range (*output)[20:200] {
+		if math.Abs(float64(sample)) > 1.01 {
+			t.Fatalf("Wrong stretched sample at %d :\n got: %v", index+20, sample)
+		}
+	}
+
+	sendSine(6)
+	if status := line.Status(); status.Rebuilding || status.CurrentDelay != config.Delay {
+		t.Errorf("Delay should be rebuilt :\n got: %v", status)
+	}
+
+	line.Exit()
+	sendSine(6)
+	if status := line.Status(); status.CurrentDelay != 0 {
+		t.Errorf("Delay should be exited :\n got: %v", status)
+	}
+}
+
+func TestDelayLine_Dump(t *testing.T) {
+	config := NewDelayConfig()
+	config.Delay = 300 * time.Millisecond
+	config.Dump = 200 * time.Millisecond
+	config.Rebuild = DelayRebuildSilence
+
+	line, output := testDelayLine(config)
+	next := sendDelayLineAudio(line, 1, 5)
+
+	dumped := line.Dump()
+	if dumped != config.Dump {
+		t.Errorf("Wrong dumped duration :\n got: %v\nwant: %v", dumped, config.Dump)
+	}
+	if status := line.Status(); status.CurrentDelay != 100*time.Millisecond || !status.Rebuilding {
+		t.Errorf("Wrong delay status after dump :\n got: %v", status)
+	}
+
+	sendDelayLineAudio(line, next, 3)
+
+	// Samples 301 to 500 are dropped, then silence rebuilds the delay
+	if (*output)[499] != 200 || (*output)[500] != 0 || (*output)[799] != 300 {
+		t.Errorf("Wrong output after dump :\n got: %v %v %v", (*output)[499], (*output)[500], (*output)[799])
+	}
+
+	events := line.eventLog().Events()
+	if len(events) != 1 || events[0].Message != "Dump 200ms of program" {
+		t.Errorf("Wrong delay events :\n got: %v", events)
+	}
+}
+
+func TestDelayLine_Exit(t *testing.T) {
+	config := NewDelayConfig()
+	config.Delay = 100 * time.Millisecond
+	config.Rebuild = DelayRebuildSilence
+	config.StretchRate = 1
+
+	line, output := testDelayLine(config)
+	next := sendDelayLineAudio(line, 1, 2)
+
+	line.Exit()
+	next = sendDelayLineAudio(line, next, 1)
+
+	if status := line.Status(); status.Enabled || status.CurrentDelay != 0 {
+		t.Errorf("Delay should be exited :\n got: %v", status)
+	}
+
+	sendDelayLineAudio(line, next, 1)
+	if (*output)[300] != 301 {
+		t.Errorf("Audio should be live after exit :\n got: %v", (*output)[300])
+	}
+
+	line.Enter()
+
+	events := line.eventLog().Events()
+	if len(events) != 2 || events[0].Message != "Exit delay" || events[1].Message != "Enter delay (100ms)" {
+		t.Errorf("Wrong delay events :\n got: %v", events)
+	}
+}
+
+func TestDelayConfig_Validate(t *testing.T) {
+	config := NewDelayConfig()
+	config.Delay = 5 * time.Second
+
+	errors := ConfigErrors{}
+	config.Validate(&errors)
+	if len(errors) != 0 {
+		t.Errorf("Default config should be valid :\n got: %v", errors)
+	}
+
+	// An empty config uses the default values
+	(&DelayConfig{}).Validate(&errors)
+	if len(errors) != 0 {
+		t.Errorf("Empty config should be valid :\n got: %v", errors)
+	}
+
+	config.Rebuild = "dummy"
+	config.StretchRate = 2
+	config.Validate(&errors)
+	if len(errors) != 2 || errors[0].Field != "Rebuild" || errors[1].Field != "StretchRate" {
+		t.Errorf("Rebuild and StretchRate should be invalid :\n got: %v", errors)
+	}
+}
@@ -0,0 +1,73 @@
+package broadcast
+
+import (
+	"fmt"
+	"os"
+)
+
+// An EncodedFile writes audio into a file with one of the StreamEncoder
+// implementations (mp3, ogg/vorbis, ...)
+type EncodedFile struct {
+	path    string
+	file    *os.File
+	encoder StreamEncoder
+}
+
+func CreateEncodedFile(path string, format AudioFormat) (*EncodedFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := NewStreamEncoder(format, file)
+	if encoder == nil {
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("Unsupported encoding: '%s'", format.Encoding)
+	}
+
+	err = encoder.Init()
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &EncodedFile{path: path, file: file, encoder: encoder}, nil
+}
+
+func (file *EncodedFile) Path() string {
+	return file.path
+}
+
+func (file *EncodedFile) Write(audio *Audio) error {
+	file.encoder.AudioOut(audio)
+	return nil
+}
+
+// Encoded streams can be read without trailer, only the written data is flushed
+func (file *EncodedFile) Sync() error {
+	if file.file == nil {
+		return nil
+	}
+	return file.file.Sync()
+}
+
+func (file *EncodedFile) Close() error {
+	if file.file == nil {
+		return nil
+	}
+
+	if flushable, ok := file.encoder.(Flushable); ok {
+		flushable.Flush()
+	}
+	file.encoder.Close()
+
+	err := file.file.Close()
+	file.file = nil
+	return err
+}
+
+func (file *EncodedFile) IsClosed() bool {
+	return file.file == nil
+}
@@ -0,0 +1,58 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEncodedFile_Write(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "encodedfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fileName := tempDir + "/test.mp3"
+	file, err := CreateEncodedFile(fileName, ParseAudioFormat("mp3:vbr(q=5):2:44100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := 0; index < 10; index++ {
+		file.Write(NewAudio(1024, 2))
+	}
+
+	err = file.Close()
+	if err != nil {
+		t.Errorf("Should not return an error : %v", err)
+	}
+	if !file.IsClosed() {
+		t.Errorf("The file should be closed")
+	}
+
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Size() == 0 {
+		t.Errorf("Encoded file should not be empty")
+	}
+}
+
+func TestCreateEncodedFile_unsupported(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "encodedfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fileName := tempDir + "/test.dummy"
+	_, err = CreateEncodedFile(fileName, AudioFormat{Encoding: "dummy"})
+	if err == nil {
+		t.Errorf("Should return an error")
+	}
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("File should be removed")
+	}
+}
@@ -1,10 +1,13 @@
 package broadcast
 
 import (
+	"sync"
 	"time"
 )
 
 type Event struct {
+	// Sequence number assigned by the MemoryEventLog
+	ID         int64 `json:",omitempty"`
 	Timestamp  time.Time
 	Message    string
 	Source     string `json:",omitempty"`
@@ -30,11 +33,22 @@ type EventCollection interface {
 	Events() []*Event
 }
 
+// An ObservableEventLog invokes its observers after each Append
+type ObservableEventLog interface {
+	Observe(observer func(event *Event))
+}
+
 var EventLog EventCollection = &LoggerEventLog{Parent: NewMemoryEventLog(256)}
 
+// MemoryEventLog stores the last events. An appended event which already
+// has an ID is a repetition (see LocalEventLog) : it replaces the stored
+// event and gets a new ID.
 type MemoryEventLog struct {
-	events []*Event
-	size   int
+	events    []*Event
+	size      int
+	lastID    int64
+	observers []func(event *Event)
+	lock      sync.Mutex
 }
 
 func NewMemoryEventLog(size int) *MemoryEventLog {
@@ -49,12 +63,45 @@ func (log *MemoryEventLog) Create(message string) *Event {
 }
 
 func (log *MemoryEventLog) Append(event *Event) {
+	log.lock.Lock()
+
+	if event.ID != 0 {
+		log.remove(event.ID)
+	}
+
+	log.lastID++
+	event.ID = log.lastID
+
 	tail := log.events
 	if len(log.events) >= log.size {
 		tail = log.events[1:]
 	}
 
 	log.events = append(tail, event)
+	observers := log.observers
+
+	log.lock.Unlock()
+
+	// The observers can read the log
+	for _, observer := range observers {
+		observer(event)
+	}
+}
+
+func (log *MemoryEventLog) remove(id int64) {
+	for index, event := range log.events {
+		if event.ID == id {
+			log.events = append(log.events[:index:index], log.events[index+1:]...)
+			return
+		}
+	}
+}
+
+func (log *MemoryEventLog) Observe(observer func(event *Event)) {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	log.observers = append(log.observers, observer)
 }
 
 func (log *MemoryEventLog) NewEvent(message string) *Event {
@@ -64,13 +111,17 @@ func (log *MemoryEventLog) NewEvent(message string) *Event {
 }
 
 func (log *MemoryEventLog) Events() []*Event {
-	return log.events
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	return append([]*Event{}, log.events...)
 }
 
 type LocalEventLog struct {
 	Parent    EventCollection
 	Source    string
 	lastEvent *Event
+	mutex     sync.Mutex
 }
 
 func (log *LocalEventLog) parent() EventCollection {
@@ -93,13 +144,22 @@ func (log *LocalEventLog) Create(message string) *Event {
 }
 
 func (log *LocalEventLog) Append(event *Event) {
+	// Events are appended by the component goroutines
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
 	if event.Source == log.Source {
 		if log.lastEvent != nil && event.Equal(log.lastEvent) {
-			log.lastEvent.Occurrence += 1
-		} else {
-			log.parent().Append(event)
-			log.lastEvent = event
+			// The repeated event is appended again (with a new ID) to be
+			// notified. The stored event isn't modified (it can be read).
+			repeatedEvent := *log.lastEvent
+			repeatedEvent.Occurrence += 1
+			repeatedEvent.Timestamp = event.Timestamp
+			event = &repeatedEvent
 		}
+
+		log.parent().Append(event)
+		log.lastEvent = event
 	}
 }
 
@@ -126,9 +186,12 @@ func (log *LoggerEventLog) Create(message string) *Event {
 }
 
 func (log *LoggerEventLog) Append(event *Event) {
-	if event.Source != "" {
+	// The repetitions (with an ID) aren't logged again
+	switch {
+	case event.ID != 0:
+	case event.Source != "":
 		Log.Printf("%s > %s", event.Source, event.Message)
-	} else {
+	default:
 		Log.Printf(event.Message)
 	}
 
@@ -138,3 +201,9 @@ func (log *LoggerEventLog) Append(event *Event) {
 func (log *LoggerEventLog) Events() []*Event {
 	return log.Parent.Events()
 }
+
+func (log *LoggerEventLog) Observe(observer func(event *Event)) {
+	if observable, ok := log.Parent.(ObservableEventLog); ok {
+		observable.Observe(observer)
+	}
+}
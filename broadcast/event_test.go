@@ -66,3 +66,39 @@ func TestLocalEventLog_Events(t *testing.T) {
 		t.Errorf("Events() should only return local events :\n got: %v", localEventLog.Events())
 	}
 }
+
+func TestMemoryEventLog_Append_id(t *testing.T) {
+	log := NewMemoryEventLog(2)
+
+	for i := 1; i <= 3; i++ {
+		if event := log.NewEvent(fmt.Sprintf("Event %d", i)); event.ID != int64(i) {
+			t.Errorf("Wrong event ID :\n got: %v\nwant: %v", event.ID, i)
+		}
+	}
+
+	if firstID := log.Events()[0].ID; firstID != 2 {
+		t.Errorf("IDs should not be reused when log is full :\n got: %v\nwant: %v", firstID, 2)
+	}
+}
+
+func TestLocalEventLog_Append_repeated(t *testing.T) {
+	parent := NewMemoryEventLog(10)
+	localEventLog := LocalEventLog{
+		Parent: parent,
+		Source: "test",
+	}
+
+	firstEvent := localEventLog.NewEvent("Can't connect")
+	localEventLog.NewEvent("Can't connect")
+
+	events := parent.Events()
+	if len(events) != 1 {
+		t.Fatalf("Repeated event should replace the previous one :\n got: %v", events)
+	}
+	if events[0].Occurrence != 2 || events[0].ID <= firstEvent.ID {
+		t.Errorf("Repeated event should be appended with a new ID :\n got: %v\nwant: Occurrence 2, ID > %d", events[0], firstEvent.ID)
+	}
+	if firstEvent.Occurrence != 1 {
+		t.Errorf("Previous event should not be modified :\n got: %v", firstEvent.Occurrence)
+	}
+}
@@ -0,0 +1,308 @@
+package broadcast
+
+import (
+	"flag"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GeneratorSine     = "sine"
+	GeneratorSweep    = "sweep"
+	GeneratorWhite    = "white"
+	GeneratorPink     = "pink"
+	GeneratorEBUIdent = "ebu-ident"
+)
+
+type Generator struct {
+	Waveform      string
+	Frequency     float64
+	EndFrequency  float64
+	SweepDuration time.Duration
+	Level         float64
+
+	SampleRate   int
+	ChannelCount int
+
+	position int64
+	phase    float64
+	random   *rand.Rand
+	pink     [7]float64
+}
+
+func (generator *Generator) sampleRate() int {
+	if generator.SampleRate == 0 {
+		generator.SampleRate = DefaultSampleRate
+	}
+	return generator.SampleRate
+}
+
+func (generator *Generator) channelCount() int {
+	if generator.ChannelCount == 0 {
+		generator.ChannelCount = 2
+	}
+	return generator.ChannelCount
+}
+
+func (generator *Generator) frequency() float64 {
+	if generator.Frequency == 0 {
+		generator.Frequency = 1000
+	}
+	return generator.Frequency
+}
+
+func (generator *Generator) amplitude() float32 {
+	return float32(dBFSToAmplitude(generator.Level))
+}
+
+func (generator *Generator) randomSource() *rand.Rand {
+	if generator.random == nil {
+		generator.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return generator.random
+}
+
+// Returns the frequency at the current position of a logarithmic sweep
+// between Frequency and EndFrequency. The sweep restarts every SweepDuration.
+func (generator *Generator) sweepFrequency() float64 {
+	startFrequency := generator.frequency()
+	endFrequency := generator.EndFrequency
+	if endFrequency == 0 {
+		endFrequency = 20000
+	}
+	sweepDuration := generator.SweepDuration
+	if sweepDuration == 0 {
+		sweepDuration = 10 * time.Second
+	}
+
+	sweepSampleCount := int64(sweepDuration.Seconds() * float64(generator.sampleRate()))
+	progress := float64(generator.position%sweepSampleCount) / float64(sweepSampleCount)
+
+	return startFrequency * math.Pow(endFrequency/startFrequency, progress)
+}
+
+func (generator *Generator) nextPhase(frequency float64) float64 {
+	phase := generator.phase
+	generator.phase = math.Mod(generator.phase+2*math.Pi*frequency/float64(generator.sampleRate()), 2*math.Pi)
+	return phase
+}
+
+// Pink noise is obtained by filtering white noise (Paul Kellet's method)
+func (generator *Generator) pinkNoise() float64 {
+	white := generator.randomSource().Float64()*2 - 1
+	b := &generator.pink
+
+	b[0] = 0.99886*b[0] + white*0.0555179
+	b[1] = 0.99332*b[1] + white*0.0750759
+	b[2] = 0.96900*b[2] + white*0.1538520
+	b[3] = 0.86650*b[3] + white*0.3104856
+	b[4] = 0.55000*b[4] + white*0.5329522
+	b[5] = -0.7616*b[5] - white*0.0168980
+	pink := b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + white*0.5362
+	b[6] = white * 0.115926
+
+	return pink * 0.11
+}
+
+// The EBU stereo identification interrupts the left channel
+// during 250ms every 3 seconds
+func (generator *Generator) ebuIdentInterrupted() bool {
+	cycleSampleCount := int64(3 * generator.sampleRate())
+	interruptionSampleCount := int64(generator.sampleRate() / 4)
+	return generator.position%cycleSampleCount < interruptionSampleCount
+}
+
+func (generator *Generator) Generate(sampleCount int) *Audio {
+	audio := NewAudio(sampleCount, generator.channelCount())
+	amplitude := generator.amplitude()
+
+	for samplePosition := 0; samplePosition < sampleCount; samplePosition++ {
+		var sample float32
+		interruptLeft := false
+
+		switch generator.Waveform {
+		case GeneratorSweep:
+			sample = float32(math.Sin(generator.nextPhase(generator.sweepFrequency())))
+		case GeneratorWhite:
+			sample = float32(generator.randomSource().Float64()*2 - 1)
+		case GeneratorPink:
+			sample = float32(generator.pinkNoise())
+		case GeneratorEBUIdent:
+			sample = float32(math.Sin(generator.nextPhase(generator.frequency())))
+			interruptLeft = generator.ebuIdentInterrupted()
+		default:
+			sample = float32(math.Sin(generator.nextPhase(generator.frequency())))
+		}
+
+		sample *= amplitude
+
+		for channel := 0; channel < audio.ChannelCount(); channel++ {
+			if channel == 0 && interruptLeft {
+				continue
+			}
+			audio.SetSample(channel, samplePosition, sample)
+		}
+
+		generator.position += 1
+	}
+
+	return audio
+}
+
+// A GeneratorInput sends the generated signal to its AudioHandler at the
+// generator sample rate. It replaces the alsa input when the commands are
+// started with the -generator flag.
+type GeneratorInput struct {
+	Generator         Generator
+	BufferSampleCount int
+
+	audioHandler AudioHandler
+
+	stopping chan bool
+	stopOnce sync.Once
+}
+
+func (input *GeneratorInput) Init() error {
+	if input.BufferSampleCount == 0 {
+		input.BufferSampleCount = 1024
+	}
+	input.stopping = make(chan bool)
+	return nil
+}
+
+func (input *GeneratorInput) SetAudioHandler(audioHandler AudioHandler) {
+	input.audioHandler = audioHandler
+}
+
+func (input *GeneratorInput) SampleRate() int {
+	return input.Generator.sampleRate()
+}
+
+func (input *GeneratorInput) ChannelCount() int {
+	return input.Generator.channelCount()
+}
+
+func (input *GeneratorInput) Read() *Audio {
+	return input.Generator.Generate(input.BufferSampleCount)
+}
+
+func (input *GeneratorInput) Run() {
+	bufferDuration := time.Duration(float64(input.BufferSampleCount) / float64(input.SampleRate()) * float64(time.Second))
+	nextRead := time.Now()
+
+	for {
+		audio := input.Read()
+		if input.audioHandler != nil {
+			input.audioHandler.AudioOut(audio)
+		}
+
+		nextRead = nextRead.Add(bufferDuration)
+		select {
+		case <-input.stopping:
+			return
+		case <-time.After(nextRead.Sub(time.Now())):
+		}
+	}
+}
+
+// Stops the Run loop. No audio is sent to the AudioHandler once Run returns.
+func (input *GeneratorInput) Stop() error {
+	input.stopOnce.Do(func() {
+		close(input.stopping)
+	})
+	return nil
+}
+
+type GeneratorConfig struct {
+	Waveform      string
+	Frequency     float64
+	EndFrequency  float64       `json:",omitempty"`
+	SweepDuration time.Duration `json:",omitempty"`
+	Level         float64
+}
+
+func NewGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		Waveform:  GeneratorSine,
+		Frequency: 1000,
+		Level:     -18,
+	}
+}
+
+func (config *GeneratorConfig) Flags(flags *flag.FlagSet, prefix string) {
+	defaultConfig := NewGeneratorConfig()
+
+	flags.StringVar(&config.Waveform, strings.Join([]string{prefix, "waveform"}, "-"), defaultConfig.Waveform, "The generated signal (sine, sweep, white, pink or ebu-ident)")
+	flags.Float64Var(&config.Frequency, strings.Join([]string{prefix, "frequency"}, "-"), defaultConfig.Frequency, "The tone frequency (or the sweep start frequency) in Hz")
+	flags.Float64Var(&config.EndFrequency, strings.Join([]string{prefix, "end-frequency"}, "-"), 20000, "The sweep end frequency in Hz")
+	flags.DurationVar(&config.SweepDuration, strings.Join([]string{prefix, "sweep-duration"}, "-"), 10*time.Second, "The duration of a sweep")
+	flags.Float64Var(&config.Level, strings.Join([]string{prefix, "level"}, "-"), defaultConfig.Level, "The signal level in dBFS")
+}
+
+func (config *GeneratorConfig) Validate(errors *ConfigErrors) {
+	switch config.Waveform {
+	case GeneratorSine, GeneratorSweep, GeneratorWhite, GeneratorPink, GeneratorEBUIdent:
+	default:
+		errors.Add("Waveform", "unknown waveform '%s'", config.Waveform)
+	}
+	if config.Frequency <= 0 {
+		errors.Add("Frequency", "must be positive")
+	}
+	if config.EndFrequency < 0 {
+		errors.Add("EndFrequency", "can't be negative")
+	}
+	if config.SweepDuration < 0 {
+		errors.Add("SweepDuration", "can't be negative")
+	}
+	if config.Level > 0 {
+		errors.Add("Level", "can't be greater than 0 dBFS")
+	}
+}
+
+func (config *GeneratorConfig) Apply(generator *Generator) {
+	generator.Waveform = config.Waveform
+	generator.Frequency = config.Frequency
+	generator.EndFrequency = config.EndFrequency
+	generator.SweepDuration = config.SweepDuration
+	generator.Level = config.Level
+}
+
+// Selects the test signal generator as command input (instead of the alsa
+// device). The generator uses the alsa sample rate and channel count.
+type GeneratorInputConfig struct {
+	GeneratorConfig
+	Enabled bool
+}
+
+func (config *GeneratorInputConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.BoolVar(&config.Enabled, prefix, false, "Use the test signal generator as input instead of the alsa device")
+	config.GeneratorConfig.Flags(flags, prefix)
+}
+
+// The generator settings are only checked when it's enabled
+func (config *GeneratorInputConfig) Validate(errors *ConfigErrors) {
+	if config.Enabled {
+		config.GeneratorConfig.Validate(errors)
+	}
+}
+
+func (config *GeneratorInputConfig) Apply(input *GeneratorInput, sampleRate int, channelCount int) {
+	config.GeneratorConfig.Apply(&input.Generator)
+	input.Generator.SampleRate = sampleRate
+	input.Generator.ChannelCount = channelCount
+}
+
+// Returns the input to be used by the command : the given alsa input or
+// a GeneratorInput when the generator is enabled
+func (config *GeneratorInputConfig) Input(alsaInput *AlsaInput) (name string, input SoundInput) {
+	if !config.Enabled {
+		return "alsa-input", alsaInput
+	}
+
+	generatorInput := &GeneratorInput{}
+	config.Apply(generatorInput, alsaInput.SampleRate, alsaInput.ChannelCount())
+	return "generator-input", generatorInput
+}
@@ -0,0 +1,163 @@
+package broadcast
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func peakLevel(samples []float32) float64 {
+	var peak float64
+	for _, sample := range samples {
+		if value := math.Abs(float64(sample)); value > peak {
+			peak = value
+		}
+	}
+	return peak
+}
+
+func TestGenerator_Generate_sine(t *testing.T) {
+	generator := Generator{Waveform: GeneratorSine, Frequency: 1000, Level: -18, SampleRate: 48000}
+	audio := generator.Generate(4800)
+
+	if audio.SampleCount() != 4800 {
+		t.Errorf("Wrong sample count :\n got: %v\nwant: %v", audio.SampleCount(), 4800)
+	}
+	if audio.ChannelCount() != 2 {
+		t.Errorf("Wrong default channel count :\n got: %v\nwant: %v", audio.ChannelCount(), 2)
+	}
+
+	expectedPeak := dBFSToAmplitude(-18)
+	for channel := 0; channel < audio.ChannelCount(); channel++ {
+		if peak := peakLevel(audio.Samples(channel)); math.Abs(peak-expectedPeak) > expectedPeak/100 {
+			t.Errorf("Wrong peak level on channel %d :\n got: %v\nwant: %v", channel, peak, expectedPeak)
+		}
+	}
+
+	// 48 samples by period at 1kHz
+	if sample := audio.Sample(0, 12); math.Abs(float64(sample)-expectedPeak) > expectedPeak/100 {
+		t.Errorf("Wrong sample at quarter period :\n got: %v\nwant: %v", sample, expectedPeak)
+	}
+}
+
+func TestGenerator_Generate_noise(t *testing.T) {
+	for _, waveform := range []string{GeneratorWhite, GeneratorPink} {
+		generator := Generator{Waveform: waveform}
+		audio := generator.Generate(44100)
+
+		peak := peakLevel(audio.Samples(0))
+		if peak == 0 || peak > 1 {
+			t.Errorf("Wrong %s noise peak level : %v", waveform, peak)
+		}
+	}
+}
+
+func TestGenerator_Generate_ebuIdent(t *testing.T) {
+	generator := Generator{Waveform: GeneratorEBUIdent, SampleRate: 48000}
+
+	// First 250ms : left channel is interrupted
+	audio := generator.Generate(12000)
+	if peak := peakLevel(audio.Samples(0)); peak != 0 {
+		t.Errorf("Left channel should be interrupted :\n got: %v\nwant: %v", peak, 0)
+	}
+	if peak := peakLevel(audio.Samples(1)); peak == 0 {
+		t.Errorf("Right channel should not be interrupted")
+	}
+
+	audio = generator.Generate(12000)
+	if peak := peakLevel(audio.Samples(0)); peak == 0 {
+		t.Errorf("Left channel should not be interrupted after 250ms")
+	}
+}
+
+func TestGenerator_sweepFrequency(t *testing.T) {
+	generator := Generator{Frequency: 20, EndFrequency: 20000, SweepDuration: time.Second, SampleRate: 1000}
+
+	if frequency := generator.sweepFrequency(); frequency != 20 {
+		t.Errorf("Wrong sweep start frequency :\n got: %v\nwant: %v", frequency, 20)
+	}
+
+	generator.position = 500
+	if frequency := generator.sweepFrequency(); math.Abs(frequency-632.45) > 0.1 {
+		t.Errorf("Wrong sweep middle frequency :\n got: %v\nwant: %v", frequency, 632.45)
+	}
+
+	generator.position = 1000
+	if frequency := generator.sweepFrequency(); frequency != 20 {
+		t.Errorf("Sweep should restart :\n got: %v\nwant: %v", frequency, 20)
+	}
+}
+
+func TestGeneratorConfig_Apply(t *testing.T) {
+	config := GeneratorConfig{Waveform: GeneratorSweep, Frequency: 20, EndFrequency: 20000, SweepDuration: time.Minute, Level: -9}
+	generator := &Generator{}
+
+	config.Apply(generator)
+
+	if generator.Waveform != config.Waveform {
+		t.Errorf("Wrong Waveform :\n got: %v\nwant: %v", generator.Waveform, config.Waveform)
+	}
+	if generator.SweepDuration != config.SweepDuration {
+		t.Errorf("Wrong SweepDuration :\n got: %v\nwant: %v", generator.SweepDuration, config.SweepDuration)
+	}
+	if generator.Level != config.Level {
+		t.Errorf("Wrong Level :\n got: %v\nwant: %v", generator.Level, config.Level)
+	}
+}
+
+func TestGeneratorInput_Stop(t *testing.T) {
+	input := &GeneratorInput{Generator: Generator{SampleRate: 48000}}
+	input.Init()
+
+	stopped := make(chan bool)
+	go func() {
+		input.Run()
+		close(stopped)
+	}()
+
+	input.Stop()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Run should return once stopped")
+	}
+
+	// Stop can be invoked several times
+	input.Stop()
+}
+
+func TestGeneratorConfig_Validate(t *testing.T) {
+	config := NewGeneratorConfig()
+	errors := ConfigErrors{}
+	config.Validate(&errors)
+	if len(errors) != 0 {
+		t.Errorf("Default config should be valid :\n got: %v", errors)
+	}
+
+	config = GeneratorConfig{Waveform: "square", Frequency: 0, Level: 3}
+	errors = ConfigErrors{}
+	config.Validate(&errors)
+	if len(errors) != 3 || errors[0].Field != "Waveform" || errors[1].Field != "Frequency" || errors[2].Field != "Level" {
+		t.Errorf("Wrong errors :\n got: %v", errors)
+	}
+}
+
+func TestGeneratorInputConfig_Input(t *testing.T) {
+	alsaInput := &AlsaInput{SampleRate: 48000, Channels: 2}
+	config := GeneratorInputConfig{GeneratorConfig: NewGeneratorConfig()}
+
+	if name, input := config.Input(alsaInput); name != "alsa-input" || input != SoundInput(alsaInput) {
+		t.Errorf("Alsa input should be used by default :\n got: %v %v", name, input)
+	}
+
+	config.Enabled = true
+	name, input := config.Input(alsaInput)
+	generatorInput, ok := input.(*GeneratorInput)
+	if name != "generator-input" || !ok {
+		t.Fatalf("Generator input should be used :\n got: %v %v", name, input)
+	}
+	if generatorInput.SampleRate() != 48000 {
+		t.Errorf("Wrong generator sample rate :\n got: %v\nwant: %v", generatorInput.SampleRate(), 48000)
+	}
+}
@@ -0,0 +1,129 @@
+package broadcast
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+// A GraphiteExporter sends the metrics of Registry (metrics.DefaultRegistry
+// by default) to a Graphite server with the plaintext protocol (over TCP).
+//
+// Gauges are sent as "<prefix>.<name>", counters and histograms as
+// "<prefix>.<name>.<field>" (count, min, max, mean, p95, ...). Tags use the
+// Graphite 1.1 format ("<name>;host=studio").
+type GraphiteExporter struct {
+	Address  string
+	Prefix   string
+	Tags     MetricsTags
+	Interval time.Duration
+	Registry metrics.Registry
+	Timeout  time.Duration
+}
+
+func (exporter *GraphiteExporter) registry() metrics.Registry {
+	if exporter.Registry == nil {
+		exporter.Registry = metrics.DefaultRegistry
+	}
+	return exporter.Registry
+}
+
+func (exporter *GraphiteExporter) interval() time.Duration {
+	if exporter.Interval == 0 {
+		exporter.Interval = 10 * time.Second
+	}
+	return exporter.Interval
+}
+
+func (exporter *GraphiteExporter) timeout() time.Duration {
+	if exporter.Timeout == 0 {
+		exporter.Timeout = 5 * time.Second
+	}
+	return exporter.Timeout
+}
+
+func (exporter *GraphiteExporter) Run() {
+	runMetricsExporter(fmt.Sprintf("Graphite %s", exporter.Address), exporter.interval(), exporter.Export)
+}
+
+// Returns the Graphite lines of the current metrics
+func (exporter *GraphiteExporter) Lines(now time.Time) []string {
+	tags := ""
+	for _, key := range exporter.Tags.keys() {
+		tags += fmt.Sprintf(";%s=%s", key, exporter.Tags[key])
+	}
+
+	lines := []string{}
+	for _, metric := range exportedMetrics(exporter.registry()) {
+		name := exportedMetricName(exporter.Prefix, metric.Name)
+
+		for _, field := range metric.Fields {
+			fieldName := name
+			if metric.Type != "gauge" {
+				fieldName = strings.Join([]string{name, field.Name}, ".")
+			}
+			lines = append(lines, fmt.Sprintf("%s%s %s %d", fieldName, tags, formatExportedValue(field.Value), now.Unix()))
+		}
+	}
+	return lines
+}
+
+// Sends the current metrics
+func (exporter *GraphiteExporter) Export() error {
+	connection, err := net.DialTimeout("tcp", exporter.Address, exporter.timeout())
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	var buffer bytes.Buffer
+	for _, line := range exporter.Lines(time.Now()) {
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+	}
+
+	connection.SetWriteDeadline(time.Now().Add(exporter.timeout()))
+	_, err = connection.Write(buffer.Bytes())
+	return err
+}
+
+type MetricsGraphiteConfig struct {
+	Address  string        `json:",omitempty"`
+	Prefix   string        `json:",omitempty"`
+	Tags     MetricsTags   `json:",omitempty"`
+	Interval time.Duration `json:",omitempty"`
+}
+
+func (config *MetricsGraphiteConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.StringVar(&config.Address, strings.Join([]string{prefix, "address"}, "-"), "", "The Graphite server address (host:port)")
+	flags.StringVar(&config.Prefix, strings.Join([]string{prefix, "prefix"}, "-"), "gobroadcast", "The prefix of Graphite metric names")
+	flags.Var(&config.Tags, strings.Join([]string{prefix, "tags"}, "-"), "The Graphite tags (like host=studio,site=paris)")
+	flags.DurationVar(&config.Interval, strings.Join([]string{prefix, "interval"}, "-"), 10*time.Second, "The interval between two Graphite exports")
+}
+
+func (config *MetricsGraphiteConfig) Apply() {
+	if config.Address != "" {
+		exporter := &GraphiteExporter{
+			Address:  config.Address,
+			Prefix:   config.Prefix,
+			Tags:     config.Tags,
+			Interval: config.Interval,
+		}
+		go exporter.Run()
+	}
+}
+
+func (config *MetricsGraphiteConfig) Validate(errors *ConfigErrors) {
+	if config.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Address); err != nil {
+			errors.Add("Address", "invalid address '%s' (host:port expected)", config.Address)
+		}
+	}
+	validateMetricsExporterInterval(errors, config.Interval)
+	validateMetricsTags(errors, config.Tags)
+}
@@ -0,0 +1,69 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphiteExporter_Lines(t *testing.T) {
+	exporter := &GraphiteExporter{Prefix: "gobroadcast", Tags: MetricsTags{"host": "studio"}, Registry: testExporterRegistry()}
+
+	expectedLines := []string{
+		"gobroadcast.http.Samples.count;host=studio 1024 1500000000",
+		"gobroadcast.upload.Queue;host=studio 3 1500000000",
+	}
+	if lines := exporter.Lines(time.Unix(1500000000, 0)); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("Wrong lines :\n got: %v\nwant: %v", lines, expectedLines)
+	}
+}
+
+func TestGraphiteExporter_Export(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer connection.Close()
+
+		data, _ := ioutil.ReadAll(connection)
+		received <- string(data)
+	}()
+
+	exporter := &GraphiteExporter{Address: listener.Addr().String(), Registry: testExporterRegistry()}
+	if err := exporter.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(<-received), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "http.Samples.count 1024 ") || !strings.HasPrefix(lines[1], "upload.Queue 3 ") {
+		t.Errorf("Wrong lines :\n got: %v", lines)
+	}
+}
+
+func TestMetricsGraphiteConfig_Validate(t *testing.T) {
+	config := MetricsGraphiteConfig{Address: "localhost:2003", Interval: 10 * time.Second}
+
+	errors := ConfigErrors{}
+	config.Validate(&errors)
+	if len(errors) != 0 {
+		t.Errorf("Valid config should be accepted :\n got: %v", errors)
+	}
+
+	config.Address = "localhost"
+	config.Validate(&errors)
+	if len(errors) != 1 || errors[0].Field != "Address" {
+		t.Errorf("Invalid address should be rejected :\n got: %v", errors)
+	}
+}
@@ -0,0 +1,459 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Can use the GET (and HEAD) routes
+	HttpRoleReader = "reader"
+	// Can use all routes and methods
+	HttpRoleAdmin = "admin"
+)
+
+const (
+	httpPasswordHashPrefix     = "pbkdf2-sha256"
+	httpPasswordHashIterations = 10000
+	httpTokenHashPrefix        = "sha256"
+)
+
+// An HttpUser is authenticated by HTTP basic authentication (with its
+// Name and password) or by an API token ("Authorization: Bearer <token>").
+type HttpUser struct {
+	Name string
+	Role string
+}
+
+// HttpAuth authenticates the requests of the HTTP server and checks that
+// the user role allows the route and method.
+//
+// When no user and no token are defined, the authentication is disabled :
+// requests are accepted with the admin role.
+//
+// Each change (request with a method other than GET or HEAD) is recorded
+// as an audit Event ("<user> <method> <path> (<status>)"). The identifier
+// of the changed resource and the changed fields are added when the change
+// succeeds (see httpAuditDetails). Field values aren't recorded.
+type HttpAuth struct {
+	Users  []HttpUserConfig
+	Tokens []HttpTokenConfig
+
+	EventLog *LocalEventLog
+}
+
+type httpUserContextKey struct{}
+
+func (auth *HttpAuth) eventLog() *LocalEventLog {
+	if auth.EventLog == nil {
+		auth.EventLog = &LocalEventLog{Source: "audit"}
+	}
+	return auth.EventLog
+}
+
+func (auth *HttpAuth) Enabled() bool {
+	return len(auth.Users) > 0 || len(auth.Tokens) > 0
+}
+
+// Returns the user authenticated by the request (or nil)
+func (auth *HttpAuth) Authenticate(request *http.Request) *HttpUser {
+	if !auth.Enabled() {
+		return &HttpUser{Name: "anonymous", Role: HttpRoleAdmin}
+	}
+
+	if name, password, ok := request.BasicAuth(); ok {
+		for _, user := range auth.Users {
+			if user.Name == name && CheckHttpPassword(user.Password, password) {
+				return &HttpUser{Name: user.Name, Role: user.Role}
+			}
+		}
+		return nil
+	}
+
+	if authorization := request.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		tokenHash := HashHttpToken(strings.TrimPrefix(authorization, "Bearer "))
+		for _, token := range auth.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(tokenHash)) == 1 {
+				return &HttpUser{Name: token.Name, Role: token.Role}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns true if the user role allows the request. Reader can only
+// use GET and HEAD methods, when the route isn't reserved to admin.
+func (user *HttpUser) Allows(request *http.Request, adminOnly bool) bool {
+	if user.Role == HttpRoleAdmin {
+		return true
+	}
+	return user.Role == HttpRoleReader && !adminOnly && httpSafeMethod(request.Method)
+}
+
+func httpSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD"
+}
+
+// Returns a Handler which authenticates requests before invoking the given one.
+// When adminOnly is true, all methods require the admin role.
+func (auth *HttpAuth) Handler(handler http.Handler, adminOnly bool) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		user := auth.Authenticate(request)
+		if user == nil {
+			if name, _, ok := request.BasicAuth(); ok {
+				auth.eventLog().NewEvent(fmt.Sprintf("Authentication failed for %s from %s", name, httpRemoteHost(request)))
+			}
+			response.Header().Set("WWW-Authenticate", `Basic realm="go-broadcast"`)
+			http.Error(response, "Unauthorized", 401)
+			return
+		}
+
+		if !user.Allows(request, adminOnly) {
+			http.Error(response, "Forbidden", 403)
+			return
+		}
+
+		request = request.WithContext(context.WithValue(request.Context(), httpUserContextKey{}, user))
+
+		if httpSafeMethod(request.Method) {
+			handler.ServeHTTP(response, request)
+			return
+		}
+
+		var body []byte
+		if request.Body != nil {
+			body, _ = ioutil.ReadAll(request.Body)
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		previous := httpAuditResource(handler, request)
+
+		recorder := &httpStatusRecorder{ResponseWriter: response, status: 200}
+		handler.ServeHTTP(recorder, request)
+
+		message := fmt.Sprintf("%s %s %s (%d)", user.Name, request.Method, request.URL.Path, recorder.status)
+		if recorder.status < 400 {
+			if details := httpAuditDetails(previous, body, recorder.body.Bytes()); details != "" {
+				message = fmt.Sprintf("%s : %s", message, details)
+			}
+		}
+		auth.eventLog().NewEvent(message)
+	})
+}
+
+// Returns the JSON resource changed by the request (read with a GET
+// request on the same path), before the change. Only the ".json" paths are
+// read (the SSE and websocket routes never end).
+func httpAuditResource(handler http.Handler, request *http.Request) []byte {
+	if !strings.HasSuffix(request.URL.Path, ".json") {
+		return nil
+	}
+
+	getRequest := request.Clone(request.Context())
+	getRequest.Method = "GET"
+	getRequest.Body = http.NoBody
+	getRequest.ContentLength = 0
+
+	recorder := &httpBufferRecorder{header: make(http.Header), status: 200}
+	handler.ServeHTTP(recorder, getRequest)
+	if recorder.status != 200 {
+		return nil
+	}
+	return recorder.body.Bytes()
+}
+
+// Describes a change with the identifier of the resource and the changed
+// fields. The fields are the fields of the new resource which differ from
+// the previous one (the GET representation can contain other fields) or,
+// for a new resource, the fields of the request body.
+func httpAuditDetails(previous []byte, body []byte, current []byte) string {
+	var previousValue, currentValue, bodyValue interface{}
+	json.Unmarshal(previous, &previousValue)
+	json.Unmarshal(current, &currentValue)
+	json.Unmarshal(body, &bodyValue)
+
+	identifier := httpAuditIdentifier(currentValue)
+	if identifier == "" {
+		identifier = httpAuditIdentifier(previousValue)
+	}
+
+	fields := []string{}
+	if reflect.TypeOf(previousValue) == reflect.TypeOf(currentValue) && previousValue != nil &&
+		httpAuditIdentifier(previousValue) == httpAuditIdentifier(currentValue) {
+		previousFields := make(map[string]interface{})
+		flattenConfigValue(previousValue, "", previousFields)
+		currentFields := make(map[string]interface{})
+		flattenConfigValue(currentValue, "", currentFields)
+
+		for field, value := range currentFields {
+			if previousValue, ok := previousFields[field]; !ok || !reflect.DeepEqual(previousValue, value) {
+				fields = append(fields, field)
+			}
+		}
+	} else if bodyValue != nil {
+		bodyFields := make(map[string]interface{})
+		flattenConfigValue(bodyValue, "", bodyFields)
+		for field := range bodyFields {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	details := []string{}
+	if identifier != "" {
+		details = append(details, fmt.Sprintf("resource %s", identifier))
+	}
+	if len(fields) > 0 {
+		details = append(details, fmt.Sprintf("changed %s", strings.Join(fields, ", ")))
+	}
+	return strings.Join(details, "; ")
+}
+
+// Returns the Identifier of a JSON resource (streams, ...)
+func httpAuditIdentifier(value interface{}) string {
+	if resource, ok := value.(map[string]interface{}); ok {
+		if identifier, ok := resource["Identifier"].(string); ok {
+			return identifier
+		}
+	}
+	return ""
+}
+
+// Returns the user of a request authenticated by HttpAuth. Without
+// authentication, the request is considered as made by an admin.
+func HttpRequestUser(request *http.Request) *HttpUser {
+	if user, ok := request.Context().Value(httpUserContextKey{}).(*HttpUser); ok {
+		return user
+	}
+	return &HttpUser{Name: "anonymous", Role: HttpRoleAdmin}
+}
+
+func httpRemoteHost(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// Records the status and the body of a response (for the audit Events)
+type httpStatusRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *httpStatusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *httpStatusRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+// Stores a response which isn't sent (see httpAuditResource)
+type httpBufferRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *httpBufferRecorder) Header() http.Header {
+	return recorder.header
+}
+
+func (recorder *httpBufferRecorder) WriteHeader(status int) {
+	recorder.status = status
+}
+
+func (recorder *httpBufferRecorder) Write(data []byte) (int, error) {
+	return recorder.body.Write(data)
+}
+
+// Replaces the password of the given URL by "*****"
+func MaskURLPassword(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := parsedURL.User.Password(); !hasPassword {
+		return rawURL
+	}
+
+	// url.UserPassword would escape the stars
+	parsedURL.User = url.User(parsedURL.User.Username())
+	return strings.Replace(parsedURL.String(), "@", ":*****@", 1)
+}
+
+// Returns a "pbkdf2-sha256$<iterations>$<salt>$<key>" hash of the given password
+func HashHttpPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashHttpPassword(password, salt, httpPasswordHashIterations), nil
+}
+
+func hashHttpPassword(password string, salt []byte, iterations int) string {
+	key := pbkdf2([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	return strings.Join([]string{
+		httpPasswordHashPrefix,
+		strconv.Itoa(iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$")
+}
+
+// Returns the salt and iterations of a password hash (or an error)
+func parseHttpPasswordHash(passwordHash string) ([]byte, int, error) {
+	parts := strings.Split(passwordHash, "$")
+	if len(parts) != 4 || parts[0] != httpPasswordHashPrefix {
+		return nil, 0, fmt.Errorf("%s hash expected", httpPasswordHashPrefix)
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return nil, 0, fmt.Errorf("invalid iterations '%s'", parts[1])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid salt '%s'", parts[2])
+	}
+	if _, err := base64.RawStdEncoding.DecodeString(parts[3]); err != nil {
+		return nil, 0, fmt.Errorf("invalid key '%s'", parts[3])
+	}
+
+	return salt, iterations, nil
+}
+
+func CheckHttpPassword(passwordHash string, password string) bool {
+	salt, iterations, err := parseHttpPasswordHash(passwordHash)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashHttpPassword(password, salt, iterations)), []byte(passwordHash)) == 1
+}
+
+// Returns a new random API token
+func NewHttpToken() (string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// Returns a "sha256$<hex>" hash of the given token
+func HashHttpToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return strings.Join([]string{httpTokenHashPrefix, hex.EncodeToString(sum[:])}, "$")
+}
+
+// PBKDF2 key derivation (RFC 2898)
+func pbkdf2(password, salt []byte, iterations, keyLength int, newHash func() hash.Hash) []byte {
+	prf := hmac.New(newHash, password)
+	hashLength := prf.Size()
+	blockCount := (keyLength + hashLength - 1) / hashLength
+
+	key := make([]byte, 0, blockCount*hashLength)
+	for block := 1; block <= blockCount; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for iteration := 1; iteration < iterations; iteration++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for index := range t {
+				t[index] ^= u[index]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength]
+}
+
+type HttpAuthConfig struct {
+	Users  []HttpUserConfig  `json:",omitempty"`
+	Tokens []HttpTokenConfig `json:",omitempty"`
+}
+
+type HttpUserConfig struct {
+	Name string
+	// The password hash (see "go-broadcast password")
+	Password string
+	Role     string
+}
+
+type HttpTokenConfig struct {
+	Name string
+	// The token hash (see "go-broadcast token")
+	Hash string
+	Role string
+}
+
+func (config *HttpAuthConfig) Apply(auth *HttpAuth) {
+	auth.Users = config.Users
+	auth.Tokens = config.Tokens
+}
+
+func (config *HttpAuthConfig) Validate(errors *ConfigErrors) {
+	names := make(map[string]bool)
+	checkName := func(field string, name string) {
+		switch {
+		case name == "":
+			errors.Add(field, "can't be empty")
+		case names[name]:
+			errors.Add(field, "duplicated name '%s'", name)
+		}
+		names[name] = true
+	}
+
+	for index, user := range config.Users {
+		field := fmt.Sprintf("Users[%d]", index)
+		checkName(field+".Name", user.Name)
+		if _, _, err := parseHttpPasswordHash(user.Password); err != nil {
+			errors.Add(field+".Password", "%v", err)
+		}
+		validateHttpRole(errors, field+".Role", user.Role)
+	}
+
+	for index, token := range config.Tokens {
+		field := fmt.Sprintf("Tokens[%d]", index)
+		checkName(field+".Name", token.Name)
+		if parts := strings.Split(token.Hash, "$"); len(parts) != 2 || parts[0] != httpTokenHashPrefix || len(parts[1]) != 2*sha256.Size {
+			errors.Add(field+".Hash", "%s hash expected", httpTokenHashPrefix)
+		}
+		validateHttpRole(errors, field+".Role", token.Role)
+	}
+}
+
+func validateHttpRole(errors *ConfigErrors, field string, role string) {
+	if role != HttpRoleReader && role != HttpRoleAdmin {
+		errors.Add(field, "unknown role '%s' (%s or %s expected)", role, HttpRoleReader, HttpRoleAdmin)
+	}
+}
@@ -26,6 +26,8 @@ type HttpInput struct {
 
 	ReadTimeout time.Duration
 	WaitOnError time.Duration
+
+	loops runLoops
 }
 
 func (input *HttpInput) dialTimeout(network, addr string) (net.Conn, error) {
@@ -171,16 +173,35 @@ func (input *HttpInput) SetAudioHandler(audioHandler AudioHandler) {
 }
 
 func (input *HttpInput) Run() {
-	for {
+	if !input.loops.Start() {
+		return
+	}
+	defer input.loops.Done()
+
+	for !input.loops.Stopped() {
 		err := input.Read()
 
-		if err != nil {
+		if err != nil && !input.loops.Stopped() {
 			Log.Printf("HTTP Error : %s", err.Error())
-			time.Sleep(input.GetWaitOnError())
+			select {
+			case <-input.loops.Stopping():
+			case <-time.After(input.GetWaitOnError()):
+			}
 		}
 	}
 }
 
+// Stops the Run loop (after the current read) and closes the HTTP stream
+func (input *HttpInput) Stop() error {
+	input.loops.Stop()
+	input.loops.Wait()
+
+	if input.reader != nil {
+		input.Reset()
+	}
+	return nil
+}
+
 func (input *HttpInput) GetWaitOnError() time.Duration {
 	if input.WaitOnError == 0 {
 		input.WaitOnError = 5 * time.Second
@@ -2,36 +2,112 @@ package broadcast
 
 import (
 	"code.google.com/p/go.net/websocket"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	metrics "github.com/tryphon/go-metrics"
+	"net"
 	"net/http"
 	"strings"
 )
 
 type HttpServer struct {
-	Bind                   string
+	Bind string
+
+	// Enables HTTPS when defined
+	CertFile string
+	KeyFile  string
+	// Requires client certificates signed by these CAs when defined
+	ClientCAFile string
+
 	SoundMeterAudioHandler *SoundMeterAudioHandler
+
+	// Additional samples exposed by /metrics
+	PrometheusCollectors []PrometheusCollector
+
+	// Authentication and roles (disabled by default)
+	Auth *HttpAuth
+}
+
+func (server *HttpServer) auth() *HttpAuth {
+	if server.Auth == nil {
+		server.Auth = &HttpAuth{}
+	}
+	return server.Auth
 }
 
 func (server *HttpServer) Init() error {
 	if server.Bind != "" {
-		http.HandleFunc("/metrics.json", server.metricsJSON)
+		if server.auth().Enabled() {
+			Log.Printf("Enable http authentication")
+		}
+
+		server.Register("/metrics.json", http.HandlerFunc(server.metricsJSON))
+		server.Register("/metrics", server.prometheusHandler())
+		server.Register(ApiV1Prefix+"/openapi.json", http.HandlerFunc(serveApiV1OpenAPI))
+		server.Register(AdminUIPath, http.HandlerFunc(serveAdminUI))
 
 		if server.SoundMeterAudioHandler != nil {
 			Log.Printf("Enable soundmeter http/websocket API")
 
-			http.HandleFunc("/soundmeter.json", server.soundMeterJSON)
-			http.Handle("/soundmeter.ws", websocket.Handler(server.soundMeterWebSocket))
+			server.Register("/soundmeter.json", http.HandlerFunc(server.soundMeterJSON))
+			server.Register("/soundmeter.ws", websocket.Handler(server.soundMeterWebSocket))
 		}
 
-		go http.ListenAndServe(server.Bind, nil)
+		if server.CertFile != "" {
+			tlsConfig, err := server.TLSConfig()
+			if err != nil {
+				return err
+			}
+
+			Log.Printf("Enable https on %s", server.Bind)
+			httpServer := &http.Server{Addr: server.Bind, TLSConfig: tlsConfig}
+			go httpServer.ListenAndServeTLS("", "")
+		} else {
+			go http.ListenAndServe(server.Bind, nil)
+		}
 	}
 	return nil
 }
 
+// Returns the TLS config of the server (certificate and client CAs)
+func (server *HttpServer) TLSConfig() (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(server.CertFile, server.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{certificate}}
+
+	if server.ClientCAFile != "" {
+		pool, err := LoadCertPool(server.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// Registers the given handler. Readers can use its GET routes, other
+// methods require the admin role.
 func (server *HttpServer) Register(pattern string, handler http.Handler) {
-	http.Handle(pattern, handler)
+	http.Handle(pattern, server.auth().Handler(handler, false))
+}
+
+// Registers the given handler for admin users only
+func (server *HttpServer) RegisterAdmin(pattern string, handler http.Handler) {
+	http.Handle(pattern, server.auth().Handler(handler, true))
+}
+
+func (server *HttpServer) prometheusHandler() *PrometheusHandler {
+	handler := &PrometheusHandler{Collectors: server.PrometheusCollectors}
+	if server.SoundMeterAudioHandler != nil {
+		handler.Collectors = append(handler.Collectors, server.SoundMeterAudioHandler)
+	}
+	return handler
 }
 
 func (server *HttpServer) metricsJSON(response http.ResponseWriter, request *http.Request) {
@@ -79,13 +155,40 @@ func (server *HttpServer) soundMeterWebSocket(webSocket *websocket.Conn) {
 }
 
 type HttpServerConfig struct {
-	Bind string
+	Bind         string
+	CertFile     string `json:",omitempty"`
+	KeyFile      string `json:",omitempty"`
+	ClientCAFile string `json:",omitempty"`
+	Auth         HttpAuthConfig
 }
 
 func (config *HttpServerConfig) Flags(flags *flag.FlagSet, prefix string) {
 	flags.StringVar(&config.Bind, strings.Join([]string{prefix, "bind"}, "-"), "", "'[address]:port' where the HTTP server is bind")
+	flags.StringVar(&config.CertFile, strings.Join([]string{prefix, "cert-file"}, "-"), "", "The certificate file (PEM) to enable https")
+	flags.StringVar(&config.KeyFile, strings.Join([]string{prefix, "key-file"}, "-"), "", "The private key file (PEM) of the https certificate")
+	flags.StringVar(&config.ClientCAFile, strings.Join([]string{prefix, "client-ca-file"}, "-"), "", "The CA bundle used to require and verify client certificates")
 }
 
 func (config *HttpServerConfig) Apply(httpServer *HttpServer) {
 	httpServer.Bind = config.Bind
+	httpServer.CertFile = config.CertFile
+	httpServer.KeyFile = config.KeyFile
+	httpServer.ClientCAFile = config.ClientCAFile
+	config.Auth.Apply(httpServer.auth())
+}
+
+func (config *HttpServerConfig) Validate(errors *ConfigErrors) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		errors.Add("KeyFile", "CertFile and KeyFile must be defined together")
+	}
+	if config.ClientCAFile != "" && config.CertFile == "" {
+		errors.Add("ClientCAFile", "requires CertFile")
+	}
+
+	if config.Bind == "" {
+		return
+	}
+	if _, _, err := net.SplitHostPort(config.Bind); err != nil {
+		errors.Add("Bind", "invalid [address]:port '%s'", config.Bind)
+	}
 }
@@ -0,0 +1,62 @@
+package broadcast
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHttpServer_TLSConfig(t *testing.T) {
+	certFile, keyFile := testCertificateFiles(t)
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	server := &HttpServer{CertFile: certFile, KeyFile: keyFile}
+	config, err := server.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 1 || config.ClientAuth != tls.NoClientCert {
+		t.Errorf("Wrong TLS config :\n got: %v", config)
+	}
+
+	server.ClientCAFile = certFile
+	config, err = server.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientCAs == nil || config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Client certificates should be required :\n got: %v", config.ClientAuth)
+	}
+
+	server.KeyFile = certFile
+	if _, err := server.TLSConfig(); err == nil {
+		t.Errorf("Invalid key file should be refused")
+	}
+}
+
+func TestHttpServerConfig_Validate(t *testing.T) {
+	conditions := []struct {
+		config        HttpServerConfig
+		expectedField string
+	}{
+		{HttpServerConfig{Bind: ":9000"}, ""},
+		{HttpServerConfig{Bind: ":9000", CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}, ""},
+		{HttpServerConfig{Bind: ":9000", CertFile: "cert.pem"}, "KeyFile"},
+		{HttpServerConfig{Bind: ":9000", ClientCAFile: "ca.pem"}, "ClientCAFile"},
+		{HttpServerConfig{Bind: "9000"}, "Bind"},
+	}
+
+	for _, condition := range conditions {
+		errors := ConfigErrors{}
+		condition.config.Validate(&errors)
+
+		field := ""
+		if len(errors) > 0 {
+			field = errors[0].Field
+		}
+		if field != condition.expectedField {
+			t.Errorf("Wrong error for %v :\n got: %v\nwant: %v", condition.config, errors, condition.expectedField)
+		}
+	}
+}
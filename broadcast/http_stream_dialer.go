@@ -1,18 +1,52 @@
 package broadcast
 
 import (
+	"bufio"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	shoutcast "github.com/tryphon/go-shoutcast"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
 type HttpStreamDialer interface {
 	Connect(output *HttpStreamOutput) (net.Conn, error)
 }
 
+// Opens a TLS connection to the given address and verifies the server
+// certificate according to the output TLS settings
+func dialTLS(output *HttpStreamOutput, network, addr string) (*tls.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config, err := output.TLSConfig(host)
+	if err != nil {
+		return nil, err
+	}
+
+	rawConnection, err := net.DialTimeout(network, addr, output.GetWriteTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	connection := tls.Client(rawConnection, config)
+	connection.SetDeadline(time.Now().Add(output.GetWriteTimeout()))
+	if err := connection.Handshake(); err != nil {
+		rawConnection.Close()
+		return nil, err
+	}
+	connection.SetDeadline(time.Time{})
+
+	return connection, nil
+}
+
+// Connects Icecast2 servers with http:// and https:// targets
 type Icecast2Dialer struct {
 }
 
@@ -29,7 +63,17 @@ func (dialer *Icecast2Dialer) Connect(output *HttpStreamOutput) (net.Conn, error
 		return newConnection, nil
 	}
 
-	transport := http.Transport{Dial: dialTimeout}
+	dialTLSTimeout := func(network, addr string) (net.Conn, error) {
+		newConnection, err := dialTLS(output, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		connection = newConnection
+		return newConnection, nil
+	}
+
+	transport := http.Transport{Dial: dialTimeout, DialTLS: dialTLSTimeout}
 	client := http.Client{Transport: &transport}
 
 	request, err := http.NewRequest("SOURCE", output.Target, nil)
@@ -63,6 +107,8 @@ func (dialer *Icecast2Dialer) Connect(output *HttpStreamOutput) (net.Conn, error
 	return connection, nil
 }
 
+// Connects Shoutcast servers. With https:// targets, the Shoutcast
+// source protocol is used over TLS.
 type ShoutcastDialer struct {
 }
 
@@ -99,5 +145,56 @@ func (dialer *ShoutcastDialer) Connect(output *HttpStreamOutput) (net.Conn, erro
 	if err != nil {
 		return nil, err
 	}
+
+	if strings.HasPrefix(output.Target, "https://") {
+		return dialer.connectTLS(output, client)
+	}
 	return client.Connect()
 }
+
+// Sends the password and the headers over a TLS connection
+func (dialer *ShoutcastDialer) connectTLS(output *HttpStreamOutput, client *shoutcast.Client) (net.Conn, error) {
+	connection, err := dialTLS(output, "tcp", client.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	connection.SetDeadline(time.Now().Add(client.Timeout))
+
+	err = dialer.handshake(connection, client)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	connection.SetDeadline(time.Time{})
+	return connection, nil
+}
+
+func (dialer *ShoutcastDialer) handshake(connection net.Conn, client *shoutcast.Client) error {
+	if _, err := fmt.Fprintf(connection, "%s\r\n", client.Password); err != nil {
+		return err
+	}
+
+	response, err := bufio.NewReader(connection).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(response, "OK") {
+		return fmt.Errorf("Server Error : %s", strings.TrimSpace(response))
+	}
+
+	names := []string{}
+	for name := range client.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(connection, "%s:%s\r\n", name, client.Headers[name]); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprint(connection, "\r\n")
+	return err
+}
@@ -0,0 +1,136 @@
+package broadcast
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIcecast2Dialer_Connect_https(t *testing.T) {
+	certFile, keyFile := testCertificateFiles(t)
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	listener := testTLSListener(t, certFile, keyFile)
+	defer listener.Close()
+
+	requests := make(chan *http.Request, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+
+		request, err := http.ReadRequest(bufio.NewReader(connection))
+		if err != nil {
+			return
+		}
+		requests <- request
+		connection.Write([]byte("HTTP/1.0 200 OK\r\n\r\n"))
+	}()
+
+	output := &HttpStreamOutput{
+		Target: "https://source:secret@" + listener.Addr().String() + "/live.mp3",
+		Format: ParseAudioFormat("mp3"),
+		CAFile: certFile,
+	}
+
+	connection, err := (&Icecast2Dialer{}).Connect(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+
+	request := <-requests
+	if request.Method != "SOURCE" || request.URL.Path != "/live.mp3" {
+		t.Errorf("Wrong request :\n got: %v %v\nwant: %v %v", request.Method, request.URL.Path, "SOURCE", "/live.mp3")
+	}
+}
+
+func TestHttpStreamOutput_createConnection_invalidCertificate(t *testing.T) {
+	certFile, keyFile := testCertificateFiles(t)
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	listener := testTLSListener(t, certFile, keyFile)
+	defer listener.Close()
+
+	go func() {
+		connection, err := listener.Accept()
+		if err == nil {
+			bufio.NewReader(connection).ReadString('\n')
+			connection.Close()
+		}
+	}()
+
+	output := &HttpStreamOutput{
+		Target:   "https://source:secret@" + listener.Addr().String() + "/live.mp3",
+		Format:   ParseAudioFormat("mp3"),
+		EventLog: &LocalEventLog{Parent: NewMemoryEventLog(10)},
+	}
+	output.Init()
+
+	if err := output.createConnection(); err == nil {
+		t.Fatalf("Unknown certificate authority should be refused")
+	}
+
+	events := output.EventLog.Parent.Events()
+	if len(events) != 1 || !strings.HasPrefix(events[0].Message, "Invalid certificate : x509:") {
+		t.Errorf("Certificate error should be reported as event :\n got: %v", events)
+	}
+}
+
+func TestShoutcastDialer_Connect_https(t *testing.T) {
+	certFile, keyFile := testCertificateFiles(t)
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	listener := testTLSListener(t, certFile, keyFile)
+	defer listener.Close()
+
+	handshake := make(chan []string, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+
+		reader := bufio.NewReader(connection)
+		password, _ := reader.ReadString('\n')
+		connection.Write([]byte("OK2\r\nicy-caps:11\r\n\r\n"))
+
+		lines := []string{strings.TrimSpace(password)}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+			lines = append(lines, strings.TrimSpace(line))
+		}
+		handshake <- lines
+	}()
+
+	output := &HttpStreamOutput{
+		Target:      "https://source:secret@" + listener.Addr().String() + "/",
+		Format:      ParseAudioFormat("mp3"),
+		Description: &StreamDescription{Name: "Test"},
+		CAFile:      certFile,
+	}
+
+	connection, err := (&ShoutcastDialer{}).Connect(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+
+	lines := <-handshake
+	if lines[0] != "secret" {
+		t.Errorf("Wrong password :\n got: %v\nwant: %v", lines[0], "secret")
+	}
+	if !reflect.DeepEqual(lines[1:2], []string{"content-type:audio/mpeg"}) {
+		t.Errorf("Wrong headers :\n got: %v", lines[1:])
+	}
+}
@@ -1,22 +1,21 @@
 package broadcast
 
 import (
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"net"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type HttpStreamOutputStatus int
-
-const (
-	HttpStreamOutputStopped HttpStreamOutputStatus = 0 + iota
-	HttpStreamOutputStarted
-	HttpStreamOutputStopping
-)
-
+// HttpStreamOutput is a Component : Start runs the stream until Stop. When
+// it's supervised (see BufferedHttpStreamOutput), the Supervisor invokes Run
+// and restarts it after a crash.
 type HttpStreamOutput struct {
 	Target     string
 	Format     AudioFormat
@@ -26,14 +25,21 @@ type HttpStreamOutput struct {
 
 	Description *StreamDescription
 
+	// CA bundle used to verify the certificate of https:// targets
+	CAFile             string
+	InsecureSkipVerify bool
+
 	encoder StreamEncoder
 
 	dialer         HttpStreamDialer
 	connection     net.Conn
 	connectedSince time.Time
 
-	status   HttpStreamOutputStatus
+	loops    *runLoops
+	mutex    sync.Mutex
 	disabled bool
+	// 1 when a reconnection is requested (modified by the API goroutines)
+	reconnect int32
 
 	Metrics  *LocalMetrics
 	EventLog *LocalEventLog
@@ -90,7 +96,11 @@ func (output *HttpStreamOutput) createConnection() (err error) {
 	output.metrics().Counter("http.AttemptedConnections").Inc(1)
 	output.connection, err = output.dialer.Connect(output)
 	if err != nil {
-		output.eventLog().NewEvent(fmt.Sprintf("Can't connect : %s", err))
+		if certificateErr := CertificateError(err); certificateErr != nil {
+			output.eventLog().NewEvent(fmt.Sprintf("Invalid certificate : %s", certificateErr))
+		} else {
+			output.eventLog().NewEvent(fmt.Sprintf("Can't connect : %s", err))
+		}
 		return err
 	}
 
@@ -111,27 +121,68 @@ func (output *HttpStreamOutput) createConnection() (err error) {
 	return nil
 }
 
+// Runs the stream in a goroutine until Stop
 func (output *HttpStreamOutput) Start() {
 	if output.disabled {
 		Log.Debugf("Stream is disabled, doesn't start")
 		return
 	}
 
+	if output.prepare() {
+		go output.Run()
+	}
+}
+
+// Prepares a new run of the stream, without running it. Once stopped, a
+// stream must be prepared before being run again. Returns false if the
+// stream is already started.
+func (output *HttpStreamOutput) prepare() bool {
+	output.mutex.Lock()
+	if output.loops != nil && !output.loops.Stopped() {
+		output.mutex.Unlock()
+		return false
+	}
+	output.loops = &runLoops{}
+	output.mutex.Unlock()
+
 	output.eventLog().NewEvent("Start")
-	go output.Run()
+	return true
 }
 
-func (output *HttpStreamOutput) Stop() {
-	if output.status != HttpStreamOutputStarted {
-		return
+func (output *HttpStreamOutput) runLoops() *runLoops {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	if output.loops == nil {
+		output.loops = &runLoops{}
 	}
+	return output.loops
+}
 
-	output.eventLog().NewEvent("Stop")
-	output.status = HttpStreamOutputStopping
+func (output *HttpStreamOutput) started() bool {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	return output.loops != nil && !output.loops.Stopped()
+}
 
-	for output.status != HttpStreamOutputStopped {
-		time.Sleep(100 * time.Millisecond)
+// Stops the Run loop and waits its end
+func (output *HttpStreamOutput) Stop() error {
+	if !output.started() {
+		return nil
 	}
+
+	loops := output.runLoops()
+	loops.Stop()
+	output.eventLog().NewEvent("Stop")
+
+	loops.Wait()
+	return nil
+}
+
+// Closes the current connection. The stream connects again in its run loop.
+func (output *HttpStreamOutput) Reconnect() {
+	atomic.StoreInt32(&output.reconnect, 1)
 }
 
 func (output *HttpStreamOutput) AdminStatus() string {
@@ -143,7 +194,7 @@ func (output *HttpStreamOutput) AdminStatus() string {
 }
 
 func (output *HttpStreamOutput) OperationalStatus() string {
-	if output.status == HttpStreamOutputStarted {
+	if output.started() {
 		return "started"
 	} else {
 		return "stopped"
@@ -162,27 +213,46 @@ func (output *HttpStreamOutput) ConnectionStatus() string {
 	}
 }
 
+// Reports the stream as connecting until it's connected
+func (output *HttpStreamOutput) Status() ComponentStatus {
+	if output.IsConnected() {
+		return ComponentStatus{State: ComponentRunning}
+	}
+	return ComponentStatus{State: ComponentConnecting}
+}
+
+// Sends the audio until Stop. A panic (in the encoder, ...) ends the Run.
 func (output *HttpStreamOutput) Run() {
-	output.status = HttpStreamOutputStarted
+	loops := output.runLoops()
+	if !loops.Start() {
+		return
+	}
+	defer loops.Done()
+
 	output.eventLog().NewEvent("Started")
 
 	defer func() {
-		if err := recover(); err != nil {
-			Log.Printf("Exception occured in HttpOutputStream : %s", err)
-		}
-
 		output.Reset()
 		output.eventLog().NewEvent("Stopped")
-		output.status = HttpStreamOutputStopped
 	}()
 
-	for output.status == HttpStreamOutputStarted {
+	for !loops.Stopped() {
+		if atomic.CompareAndSwapInt32(&output.reconnect, 1, 0) {
+			if output.connection != nil {
+				output.eventLog().NewEvent("Reconnect")
+				output.Reset()
+			}
+		}
+
 		if output.connection == nil {
 			err := output.createConnection()
 
 			if err != nil {
 				Log.Printf("Connection Error : %s", err.Error())
-				time.Sleep(output.GetWaitOnError())
+				select {
+				case <-loops.Stopping():
+				case <-time.After(output.GetWaitOnError()):
+				}
 			}
 		}
 
@@ -198,6 +268,11 @@ func (output *HttpStreamOutput) Run() {
 	}
 }
 
+// Returns the TLS config used to connect the given host
+func (output *HttpStreamOutput) TLSConfig(host string) (*tls.Config, error) {
+	return NewTLSClientConfig(host, output.CAFile, output.InsecureSkipVerify)
+}
+
 func (output *HttpStreamOutput) GetWriteTimeout() time.Duration {
 	return 30 * time.Second
 }
@@ -237,11 +312,13 @@ func (output *HttpStreamOutput) SampleRate() int {
 }
 
 type HttpStreamOutputConfig struct {
-	Target      string
-	Format      string
-	Description StreamDescription
-	ServerType  string
-	Disabled    bool
+	Target             string
+	Format             string
+	Description        StreamDescription
+	ServerType         string
+	Disabled           bool
+	CAFile             string `json:",omitempty"`
+	InsecureSkipVerify bool   `json:",omitempty"`
 }
 
 func NewHttpStreamOutputConfig() HttpStreamOutputConfig {
@@ -259,12 +336,16 @@ func (config *HttpStreamOutputConfig) Flags(flags *flag.FlagSet, prefix string)
 	flags.StringVar(&config.Format, strings.Join([]string{prefix, "format"}, "-"), defaultConfig.Format, "The stream format")
 	flags.StringVar(&config.ServerType, strings.Join([]string{prefix, "servertype"}, "-"), defaultConfig.ServerType, "The type of stream server (icecast2 or shoutcast)")
 	flags.BoolVar(&config.Disabled, strings.Join([]string{prefix, "disabled"}, "-"), false, "Disable the stream (not started)")
+	flags.StringVar(&config.CAFile, strings.Join([]string{prefix, "ca-file"}, "-"), "", "The CA bundle used to verify the certificate of https targets")
+	flags.BoolVar(&config.InsecureSkipVerify, strings.Join([]string{prefix, "insecure-skip-verify"}, "-"), false, "Don't verify the certificate of https targets")
 }
 
 func (config *HttpStreamOutputConfig) Apply(httpStreamOutput *HttpStreamOutput) {
 	httpStreamOutput.Target = config.Target
 	httpStreamOutput.Format = ParseAudioFormat(config.Format)
 	httpStreamOutput.ServerType = config.ServerType
+	httpStreamOutput.CAFile = config.CAFile
+	httpStreamOutput.InsecureSkipVerify = config.InsecureSkipVerify
 	if !config.Description.IsEmpty() {
 		httpStreamOutput.Description = &config.Description
 	} else {
@@ -280,3 +361,19 @@ func (config *HttpStreamOutputConfig) Apply(httpStreamOutput *HttpStreamOutput)
 
 	httpStreamOutput.disabled = config.Disabled
 }
+
+func (config *HttpStreamOutputConfig) Validate(errors *ConfigErrors) {
+	if targetURL, err := url.Parse(config.Target); err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") {
+		errors.Add("Target", "invalid http URL '%s'", config.Target)
+	}
+	switch config.ServerType {
+	case "", "icecast2", "shoutcast":
+	default:
+		errors.Add("ServerType", "unknown server type '%s' (icecast2 or shoutcast)", config.ServerType)
+	}
+	if config.CAFile != "" {
+		if _, err := LoadCertPool(config.CAFile); err != nil {
+			errors.Add("CAFile", "%v", err)
+		}
+	}
+}
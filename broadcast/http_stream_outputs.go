@@ -3,8 +3,12 @@ package broadcast
 import (
 	"flag"
 	"fmt"
-	"hash/crc32"
+	"path"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type HttpStreamOutputs struct {
@@ -12,7 +16,15 @@ type HttpStreamOutputs struct {
 	channelCount int
 	sampleRate   int
 
+	// Time shifts shared by the streams with the same delay
+	timeShifts map[time.Duration]*TimeShift
+
 	config *HttpStreamOutputsConfig
+
+	// Protects the streams and the time shifts, used by the audio goroutine
+	mutex sync.RWMutex
+	// Serializes the Reconcile invocations (concurrent API requests)
+	reconcileMutex sync.Mutex
 }
 
 func NewHttpStreamOutputs() *HttpStreamOutputs {
@@ -22,56 +34,214 @@ func NewHttpStreamOutputs() *HttpStreamOutputs {
 }
 
 func (output *HttpStreamOutputs) AudioOut(audio *Audio) {
+	output.mutex.RLock()
+	defer output.mutex.RUnlock()
+
 	for _, stream := range output.streams {
-		stream.AudioOut(audio)
+		if stream.TimeShift() == 0 {
+			stream.AudioOut(audio)
+		}
+	}
+
+	for _, timeShift := range output.timeShifts {
+		timeShift.AudioOut(audio)
 	}
 }
 
-func (output *HttpStreamOutputs) Init() error {
-	Log.Debugf("Initialize %d stream(s)", len(output.streams))
+// Creates the time shifts used by the streams and closes the unused ones.
+// Invoked when the streams are created, updated or destroyed.
+func (output *HttpStreamOutputs) updateTimeShifts() {
+	output.mutex.Lock()
+
+	delays := make(map[time.Duration]bool)
 	for _, stream := range output.streams {
+		if stream.TimeShift() > 0 {
+			delays[stream.TimeShift()] = true
+		}
+	}
+
+	unused := []*TimeShift{}
+	for delay, timeShift := range output.timeShifts {
+		if !delays[delay] {
+			unused = append(unused, timeShift)
+			delete(output.timeShifts, delay)
+		}
+	}
+
+	for delay := range delays {
+		if _, ok := output.timeShifts[delay]; !ok {
+			output.createTimeShift(delay)
+		}
+	}
+
+	output.mutex.Unlock()
+
+	// The queued audio is sent to the streams while closing
+	for _, timeShift := range unused {
+		timeShift.Close()
+	}
+}
+
+func (output *HttpStreamOutputs) createTimeShift(delay time.Duration) {
+	if output.config == nil || output.config.TimeShiftDirectory == "" {
+		Log.Printf("Can't time shift %v : no time shift directory", delay)
+		return
+	}
+
+	if output.timeShifts == nil {
+		output.timeShifts = make(map[time.Duration]*TimeShift)
+	}
+
+	timeShift := &TimeShift{
+		Directory:  path.Join(output.config.TimeShiftDirectory, delay.String()),
+		Delay:      delay,
+		SampleRate: output.sampleRate,
+		Output: AudioHandlerFunc(func(audio *Audio) {
+			output.mutex.RLock()
+			defer output.mutex.RUnlock()
+
+			for _, stream := range output.streams {
+				if stream.TimeShift() == delay {
+					stream.AudioOut(audio)
+				}
+			}
+		}),
+	}
+
+	err := timeShift.Init()
+	if err != nil {
+		Log.Printf("Can't create time shift directory : %v", err)
+	}
+	timeShift.Start()
+
+	Log.Printf("Time shift %v in %s", delay, timeShift.Directory)
+	output.timeShifts[delay] = timeShift
+}
+
+func (output *HttpStreamOutputs) Init() error {
+	streams := output.streamList()
+	Log.Debugf("Initialize %d stream(s)", len(streams))
+	for _, stream := range streams {
 		stream.Init()
 	}
 	return nil
 }
 
 func (output *HttpStreamOutputs) Start() {
-	for _, stream := range output.streams {
+	for _, stream := range output.streamList() {
 		Log.Debugf("Start Stream %s", stream.output.Target)
 		stream.Start()
 	}
 }
 
 func (output *HttpStreamOutputs) Stop() {
-	for _, stream := range output.streams {
+	for _, stream := range output.streamList() {
 		Log.Debugf("Stop Stream %s", stream.output.Target)
 		stream.Stop()
 	}
 }
 
-func (output *HttpStreamOutputs) Run() {
-	for _, stream := range output.streams {
-		Log.Debugf("Run Stream %s", stream.output.Target)
-		go stream.Run()
+// Performs the action on each stream. Disabled streams aren't started and
+// stopped streams aren't reconnected.
+func (output *HttpStreamOutputs) Perform(action string) error {
+	for _, stream := range output.streamList() {
+		err := stream.Perform(action)
+		if err != nil && err != ErrStreamDisabled && err != ErrStreamNotStarted {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waits until the connected streams have sent their buffered audio
+// (during timeout at most)
+func (output *HttpStreamOutputs) Drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	for _, stream := range output.streamList() {
+		for !stream.Drained() && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+// Stops the streams (their encoders are closed) and the time shifts
+func (output *HttpStreamOutputs) Close() {
+	var stopped sync.WaitGroup
+	for _, stream := range output.streamList() {
+		stopped.Add(1)
+		go func(stream *BufferedHttpStreamOutput) {
+			defer stopped.Done()
+
+			Log.Debugf("Stop Stream %s", stream.output.Target)
+			stream.Stop()
+		}(stream)
+	}
+	stopped.Wait()
+
+	output.mutex.Lock()
+	timeShifts := output.timeShifts
+	output.timeShifts = nil
+	output.mutex.Unlock()
+
+	for _, timeShift := range timeShifts {
+		timeShift.Close()
 	}
 }
 
+// Creates a stream with the given config. An identifier already used is
+// changed (with an index suffix).
 func (output *HttpStreamOutputs) Create(config *BufferedHttpStreamOutputConfig) *BufferedHttpStreamOutput {
+	stream, _ := output.create(config, true)
+	return stream
+}
+
+// Creates a stream with the Identifier of the given config (or the default
+// identifier of its Target). Returns ErrStreamExists if the identifier is
+// already used.
+func (output *HttpStreamOutputs) CreateNew(config *BufferedHttpStreamOutputConfig) (*BufferedHttpStreamOutput, error) {
+	return output.create(config, false)
+}
+
+func (output *HttpStreamOutputs) create(config *BufferedHttpStreamOutputConfig, rename bool) (*BufferedHttpStreamOutput, error) {
 	stream := NewBufferedHttpStreamOutput()
 	if config == nil {
 		config = &BufferedHttpStreamOutputConfig{}
 	}
 
-	output.uniqStreamIdentifier(config)
+	// The identifier is checked and the stream added atomically (concurrent
+	// API requests)
+	output.mutex.Lock()
+	if !output.uniqStreamIdentifier(config, rename) {
+		output.mutex.Unlock()
+		return nil, ErrStreamExists
+	}
 	stream.Setup(config)
-
+	// The identifier is used by the event source
+	stream.setDefaultIdentifier()
 	output.streams = append(output.streams, stream)
-	return stream
+	output.mutex.Unlock()
+
+	stream.eventLog().NewEvent("Created")
+
+	output.updateTimeShifts()
+	return stream, nil
+}
+
+// Updates the given stream (see BufferedHttpStreamOutput.Update) and its
+// time shift. Returns true if the stream is restarted.
+func (output *HttpStreamOutputs) Update(stream *BufferedHttpStreamOutput, config *BufferedHttpStreamOutputConfig) bool {
+	restarted := stream.Update(config)
+	output.updateTimeShifts()
+	return restarted
 }
 
-func (output *HttpStreamOutputs) uniqStreamIdentifier(config *BufferedHttpStreamOutputConfig) {
+// Uses the default identifier when the config has none. An identifier
+// already used is changed when rename is true, otherwise false is returned.
+// Invoked with the stream list locked.
+func (output *HttpStreamOutputs) uniqStreamIdentifier(config *BufferedHttpStreamOutputConfig, rename bool) bool {
 	if config.Identifier == "" && config.Target != "" {
-		config.Identifier = strconv.FormatInt(int64(crc32.ChecksumIEEE([]byte(config.Target))), 16)
+		config.Identifier = defaultStreamIdentifier(config.Target)
 	}
 
 	validate := func(identifier string) bool {
@@ -89,6 +259,10 @@ func (output *HttpStreamOutputs) uniqStreamIdentifier(config *BufferedHttpStream
 	}
 
 	if !validate(config.Identifier) {
+		if !rename && config.Identifier != "" {
+			return false
+		}
+
 		generator := IdentifierGenerator{
 			Prefix:   config.Identifier,
 			Validate: validate,
@@ -96,6 +270,7 @@ func (output *HttpStreamOutputs) uniqStreamIdentifier(config *BufferedHttpStream
 		config.Identifier = generator.Generate()
 		Log.Debugf("Change stream identifier : %s", config.Identifier)
 	}
+	return true
 }
 
 type IdentifierValidator func(identifier string) bool
@@ -135,11 +310,19 @@ func (output *HttpStreamOutputs) SetSampleRate(sampleRate int) {
 }
 
 func (output *HttpStreamOutputs) Config() HttpStreamOutputsConfig {
-	output.config.Streams = make([]BufferedHttpStreamOutputConfig, 0)
+	output.mutex.RLock()
+	defer output.mutex.RUnlock()
+
+	config := HttpStreamOutputsConfig{}
+	if output.config != nil {
+		config = *output.config
+	}
+
+	config.Streams = make([]BufferedHttpStreamOutputConfig, 0)
 	for _, stream := range output.streams {
-		output.config.Streams = append(output.config.Streams, stream.Config())
+		config.Streams = append(config.Streams, stream.Config())
 	}
-	return *output.config
+	return config
 }
 
 func (output *HttpStreamOutputs) Status() HttpStreamOutputsStatus {
@@ -147,24 +330,128 @@ func (output *HttpStreamOutputs) Status() HttpStreamOutputsStatus {
 		Streams: make([]BufferedHttpStreamOutputStatus, 0),
 		Events:  EventLog.Events(),
 	}
-	for _, stream := range output.streams {
+	for _, stream := range output.streamList() {
 		status.Streams = append(status.Streams, stream.Status())
 	}
 	return status
 }
 
+// Returns the buffer fill (between 0 and 1) and the connection status of each stream
+func (output *HttpStreamOutputs) PrometheusSamples() []PrometheusSample {
+	samples := []PrometheusSample{}
+	for _, stream := range output.streamList() {
+		samples = append(samples, stream.PrometheusSamples()...)
+	}
+	return samples
+}
+
+// Reports each stream as a component
+func (output *HttpStreamOutputs) ComponentStatuses() []ComponentStatus {
+	statuses := []ComponentStatus{}
+	for _, stream := range output.streamList() {
+		statuses = append(statuses, stream.ComponentStatus())
+	}
+	return statuses
+}
+
 func (output *HttpStreamOutputs) Setup(config *HttpStreamOutputsConfig) {
 	config.Compact()
+	output.config = config
 	for index, _ := range config.Streams {
 		streamConfig := config.Streams[index]
 		if !streamConfig.Empty() {
 			output.Create(&streamConfig)
 		}
 	}
-	output.config = config
+}
+
+// Changes made by Reconcile (stream identifiers)
+type HttpStreamOutputsChanges struct {
+	Created   []string
+	Updated   []string
+	Restarted []string
+	Destroyed []string
+}
+
+func (changes *HttpStreamOutputsChanges) IsEmpty() bool {
+	return len(changes.Created) == 0 && len(changes.Updated) == 0 && len(changes.Restarted) == 0 && len(changes.Destroyed) == 0
+}
+
+// Applies the given config to the running streams, matched by Identifier
+// (or by Target when the Identifier is missing).
+//
+// New streams are created and started, missing ones are stopped and
+// destroyed. Changed streams are updated and only restarted when their
+// connection or encoding changes. Unchanged streams aren't affected.
+func (output *HttpStreamOutputs) Reconcile(config *HttpStreamOutputsConfig) HttpStreamOutputsChanges {
+	output.reconcileMutex.Lock()
+	defer output.reconcileMutex.Unlock()
+
+	changes := HttpStreamOutputsChanges{}
+	config.Compact()
+
+	output.mutex.Lock()
+	if output.config == nil {
+		output.config = &HttpStreamOutputsConfig{}
+	}
+	output.config.TimeShiftDirectory = config.TimeShiftDirectory
+	output.mutex.Unlock()
+
+	identifiers := make(map[string]bool)
+	for index := range config.Streams {
+		streamConfig := config.Streams[index]
+		if streamConfig.Identifier == "" {
+			streamConfig.Identifier = defaultStreamIdentifier(streamConfig.Target)
+		}
+		identifiers[streamConfig.Identifier] = true
+
+		stream := output.Stream(streamConfig.Identifier)
+		switch {
+		case stream == nil:
+			// The stream can be created meanwhile by another API request
+			stream, err := output.CreateNew(&streamConfig)
+			if err != nil {
+				Log.Printf("Can't create stream %s : %v", streamConfig.Identifier, err)
+				continue
+			}
+			stream.Init()
+			stream.Start()
+			changes.Created = append(changes.Created, stream.Identifier)
+		case reflect.DeepEqual(stream.Config(), streamConfig):
+			continue
+		case output.Update(stream, &streamConfig):
+			changes.Restarted = append(changes.Restarted, stream.Identifier)
+		default:
+			changes.Updated = append(changes.Updated, stream.Identifier)
+		}
+	}
+
+	for _, stream := range output.streamList() {
+		if !identifiers[stream.Identifier] {
+			output.Destroy(stream.Identifier)
+			stream.Stop()
+			changes.Destroyed = append(changes.Destroyed, stream.Identifier)
+		}
+	}
+
+	if !changes.IsEmpty() {
+		Log.Printf("Streams reconciled : %d created, %d updated, %d restarted, %d destroyed", len(changes.Created), len(changes.Updated), len(changes.Restarted), len(changes.Destroyed))
+	}
+	return changes
+}
+
+// Returns a copy of the stream list (modified by the HTTP API)
+func (output *HttpStreamOutputs) streamList() []*BufferedHttpStreamOutput {
+	output.mutex.RLock()
+	defer output.mutex.RUnlock()
+
+	return append([]*BufferedHttpStreamOutput{}, output.streams...)
 }
 
 func (output *HttpStreamOutputs) Stream(identifier string) *BufferedHttpStreamOutput {
+	output.mutex.RLock()
+	defer output.mutex.RUnlock()
+
 	for _, stream := range output.streams {
 		if stream.Identifier == identifier {
 			return stream
@@ -174,6 +461,18 @@ func (output *HttpStreamOutputs) Stream(identifier string) *BufferedHttpStreamOu
 }
 
 func (output *HttpStreamOutputs) Destroy(identifier string) *BufferedHttpStreamOutput {
+	stream := output.remove(identifier)
+	if stream != nil {
+		stream.eventLog().NewEvent("Destroyed")
+		output.updateTimeShifts()
+	}
+	return stream
+}
+
+func (output *HttpStreamOutputs) remove(identifier string) *BufferedHttpStreamOutput {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
 	for index, stream := range output.streams {
 		if stream.Identifier == identifier {
 			output.streams[index], output.streams = output.streams[len(output.streams)-1], output.streams[:len(output.streams)-1]
@@ -185,6 +484,9 @@ func (output *HttpStreamOutputs) Destroy(identifier string) *BufferedHttpStreamO
 
 type HttpStreamOutputsConfig struct {
 	Streams []BufferedHttpStreamOutputConfig
+
+	// Stores the audio of time shifted streams
+	TimeShiftDirectory string `json:",omitempty"`
 }
 
 type HttpStreamOutputsStatus struct {
@@ -203,6 +505,33 @@ func (config *HttpStreamOutputsConfig) Empty() bool {
 	return true
 }
 
+func (config *HttpStreamOutputsConfig) Validate(errors *ConfigErrors) {
+	var timeShifted bool
+	identifiers := make(map[string]bool)
+	for index, streamConfig := range config.Streams {
+		if streamConfig.Empty() {
+			continue
+		}
+
+		identifier := streamConfig.Identifier
+		if identifier == "" {
+			identifier = defaultStreamIdentifier(streamConfig.Target)
+		}
+		if identifiers[identifier] {
+			errors.Add(fmt.Sprintf("Streams[%d].Identifier", index), "duplicate identifier '%s'", identifier)
+		}
+		identifiers[identifier] = true
+
+		if streamConfig.TimeShift > 0 {
+			timeShifted = true
+		}
+	}
+
+	if timeShifted && config.TimeShiftDirectory == "" {
+		errors.Add("TimeShiftDirectory", "is required by the time shifted streams")
+	}
+}
+
 func (config *HttpStreamOutputsConfig) Compact() {
 	notEmptyStreams := []BufferedHttpStreamOutputConfig{}
 	for _, streamConfig := range config.Streams {
@@ -219,6 +548,8 @@ func (config *HttpStreamOutputsConfig) Flags(flags *flag.FlagSet, prefix string)
 	for index, _ := range config.Streams {
 		config.Streams[index].Flags(flags, fmt.Sprintf("%s-%d", prefix, index+1))
 	}
+
+	flags.StringVar(&config.TimeShiftDirectory, strings.Join([]string{prefix, "time-shift-directory"}, "-"), "", "The directory which stores the audio of time shifted streams")
 }
 
 func (config *HttpStreamOutputsConfig) Apply(httpStreamOutputs *HttpStreamOutputs) {
@@ -12,6 +12,11 @@ type HttpStreamOutputsController struct {
 	outputs *HttpStreamOutputs
 }
 
+var (
+	streamActionPathPattern  = regexp.MustCompile("^/streams/([0-9a-zA-Z-]+)/([a-z]+)$")
+	streamsActionPathPattern = regexp.MustCompile("^/streams/([a-z]+)$")
+)
+
 func NewHttpStreamOutputsController(outputs *HttpStreamOutputs) (controller *HttpStreamOutputsController) {
 	return &HttpStreamOutputsController{outputs: outputs}
 }
@@ -33,26 +38,60 @@ func (controller *HttpStreamOutputsController) ServeHTTP(response http.ResponseW
 	}
 
 	switch {
+	case streamActionPathPattern.MatchString(path):
+		match := streamActionPathPattern.FindStringSubmatch(path)
+		if !validStreamAction(match[2]) {
+			http.NotFound(response, request)
+			return
+		}
+		if request.Method != "POST" {
+			controller.methodNotAllowed(response, "POST")
+			return
+		}
+		controller.Perform(response, request, match[1], match[2])
+	case streamsActionPathPattern.MatchString(path):
+		action := streamsActionPathPattern.FindStringSubmatch(path)[1]
+		if !validStreamAction(action) {
+			http.NotFound(response, request)
+			return
+		}
+		if request.Method != "POST" {
+			controller.methodNotAllowed(response, "POST")
+			return
+		}
+		controller.PerformAll(response, request, action)
 	case resourcePathPattern.MatchString(path):
 		identifier := resourcePathPattern.FindStringSubmatch(path)[1]
 
 		switch {
 		case request.Method == "GET":
-			controller.Show(response, identifier)
+			controller.Show(response, request, identifier)
 		case request.Method == "DELETE":
 			controller.Delete(response, identifier)
 		case request.Method == "PUT":
 			controller.Update(response, identifier, body)
+		default:
+			controller.methodNotAllowed(response, "GET, PUT, DELETE")
 		}
 	case path == "/streams.json":
 		switch {
 		case request.Method == "GET":
-			controller.Index(response)
+			controller.Index(response, request)
 		case request.Method == "POST":
 			controller.Create(response, body)
+		case request.Method == "PUT":
+			controller.Reconcile(response, body)
+		default:
+			controller.methodNotAllowed(response, "GET, POST, PUT")
+		}
+	case path == "/events.json":
+		if request.Method != "GET" {
+			controller.methodNotAllowed(response, "GET")
+			return
 		}
-	case path == "/events.json" && request.Method == "GET":
 		controller.IndexEvents(response)
+	default:
+		http.NotFound(response, request)
 	}
 }
 
@@ -64,9 +103,22 @@ func (controller *HttpStreamOutputsController) Status() HttpStreamOutputsStatus
 	return controller.outputs.Status()
 }
 
-func (controller *HttpStreamOutputsController) Index(response http.ResponseWriter) {
+// Hides the Icecast/Shoutcast passwords from non admin users
+func (controller *HttpStreamOutputsController) maskStatus(request *http.Request, status *BufferedHttpStreamOutputStatus) {
+	if HttpRequestUser(request).Role != HttpRoleAdmin {
+		status.Target = MaskURLPassword(status.Target)
+	}
+}
+
+func (controller *HttpStreamOutputsController) Index(response http.ResponseWriter, request *http.Request) {
 	response.Header().Set("Content-Type", "application/json")
-	jsonBytes, err := json.Marshal(controller.Status().Streams)
+
+	streams := controller.Status().Streams
+	for index := range streams {
+		controller.maskStatus(request, &streams[index])
+	}
+
+	jsonBytes, err := json.Marshal(streams)
 	if err == nil {
 		response.Write(jsonBytes)
 	} else {
@@ -84,14 +136,17 @@ func (controller *HttpStreamOutputsController) IndexEvents(response http.Respons
 	}
 }
 
-func (controller *HttpStreamOutputsController) Show(response http.ResponseWriter, identifier string) {
+func (controller *HttpStreamOutputsController) Show(response http.ResponseWriter, request *http.Request, identifier string) {
 	response.Header().Set("Content-Type", "application/json")
 
 	Log.Debugf("Retrieve stream : '%s'", identifier)
 	stream := controller.outputs.Stream(identifier)
 
 	if stream != nil {
-		jsonBytes, err := json.Marshal(stream.Status())
+		status := stream.Status()
+		controller.maskStatus(request, &status)
+
+		jsonBytes, err := json.Marshal(status)
 		if err == nil {
 			response.Write(jsonBytes)
 		} else {
@@ -113,13 +168,24 @@ func (controller *HttpStreamOutputsController) Update(response http.ResponseWrit
 
 		err := json.Unmarshal(body, &config)
 		if err != nil {
-			controller.fatal(response, err)
+			http.Error(response, fmt.Sprintf("Invalid stream: %v", err), 400)
 			return
 		}
 
-		stream.Stop()
-		stream.Setup(&config)
-		stream.Start()
+		// Validates the updated stream with the others (like Reconcile)
+		outputsConfig := controller.Config()
+		for index := range outputsConfig.Streams {
+			if outputsConfig.Streams[index].Identifier == stream.Identifier {
+				outputsConfig.Streams[index] = config
+			}
+		}
+		err = ValidateConfig(&outputsConfig)
+		if err != nil {
+			http.Error(response, err.Error(), 400)
+			return
+		}
+
+		controller.outputs.Update(stream, &config)
 
 		jsonBytes, _ := json.Marshal(stream.Config())
 		response.Write(jsonBytes)
@@ -151,7 +217,7 @@ func (controller *HttpStreamOutputsController) Create(response http.ResponseWrit
 	config := NewBufferedHttpStreamOutputConfig()
 	err := json.Unmarshal(body, &config)
 	if err != nil {
-		controller.fatal(response, err)
+		http.Error(response, fmt.Sprintf("Invalid stream: %v", err), 400)
 		return
 	}
 
@@ -167,6 +233,94 @@ func (controller *HttpStreamOutputsController) Create(response http.ResponseWrit
 	}
 }
 
+// Replaces the stream list by the given configs. Only the changed streams
+// are affected.
+func (controller *HttpStreamOutputsController) Reconcile(response http.ResponseWriter, body []byte) {
+	response.Header().Set("Content-Type", "application/json")
+
+	Log.Debugf("Reconcile streams : %s", string(body))
+
+	streamDefinitions := []json.RawMessage{}
+	err := json.Unmarshal(body, &streamDefinitions)
+	if err != nil {
+		http.Error(response, fmt.Sprintf("Invalid stream list: %v", err), 400)
+		return
+	}
+
+	config := controller.Config()
+	config.Streams = make([]BufferedHttpStreamOutputConfig, len(streamDefinitions))
+	for index, streamDefinition := range streamDefinitions {
+		config.Streams[index] = NewBufferedHttpStreamOutputConfig()
+		err := json.Unmarshal(streamDefinition, &config.Streams[index])
+		if err != nil {
+			http.Error(response, fmt.Sprintf("Invalid stream %d: %v", index, err), 400)
+			return
+		}
+	}
+
+	err = ValidateConfig(&config)
+	if err != nil {
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	changes := controller.outputs.Reconcile(&config)
+
+	jsonBytes, _ := json.Marshal(changes)
+	response.Write(jsonBytes)
+}
+
+// Performs the action ("start", "stop", "enable", "disable" or "reconnect")
+// on the stream
+func (controller *HttpStreamOutputsController) Perform(response http.ResponseWriter, request *http.Request, identifier string, action string) {
+	stream := controller.outputs.Stream(identifier)
+	if stream == nil {
+		http.Error(response, fmt.Sprintf("Stream not found: '%s'", identifier), 404)
+		return
+	}
+
+	Log.Debugf("Perform %s on stream %s", action, identifier)
+
+	err := stream.Perform(action)
+	if err == ErrStreamDisabled || err == ErrStreamNotStarted {
+		http.Error(response, err.Error(), 409)
+		return
+	}
+	if err != nil {
+		controller.fatal(response, err)
+		return
+	}
+
+	controller.Show(response, request, identifier)
+}
+
+// Performs the action on all streams
+func (controller *HttpStreamOutputsController) PerformAll(response http.ResponseWriter, request *http.Request, action string) {
+	Log.Debugf("Perform %s on all streams", action)
+
+	err := controller.outputs.Perform(action)
+	if err != nil {
+		controller.fatal(response, err)
+		return
+	}
+
+	controller.Index(response, request)
+}
+
+func validStreamAction(action string) bool {
+	for _, streamAction := range StreamActions {
+		if action == streamAction {
+			return true
+		}
+	}
+	return false
+}
+
+func (controller *HttpStreamOutputsController) methodNotAllowed(response http.ResponseWriter, allowedMethods string) {
+	response.Header().Set("Allow", allowedMethods)
+	http.Error(response, "Method not allowed", 405)
+}
+
 func (controller *HttpStreamOutputsController) fatal(response http.ResponseWriter, err error) {
 	http.Error(response, fmt.Sprintf("Unknown error: %v", err), 500)
 }
@@ -1,7 +1,13 @@
 package broadcast
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestHttpStreamOutputs_Create_Identifier(t *testing.T) {
@@ -29,3 +35,242 @@ func TestHttpStreamOutputs_Create_Identifier(t *testing.T) {
 		t.Errorf("Stream identifier should be uniq: got %s and %s", streamWithSameTarget.Identifier, streamWithDefaultIdentifier.Identifier)
 	}
 }
+
+func TestHttpStreamOutputs_CreateNew(t *testing.T) {
+	streams := HttpStreamOutputs{}
+
+	stream, err := streams.CreateNew(&BufferedHttpStreamOutputConfig{Identifier: "mp3"})
+	if err != nil || stream.Identifier != "mp3" {
+		t.Fatalf("Stream should be created :\n got: %v (%v)", stream, err)
+	}
+
+	if _, err := streams.CreateNew(&BufferedHttpStreamOutputConfig{Identifier: "mp3"}); err != ErrStreamExists {
+		t.Errorf("Existing identifier should be refused :\n got: %v\nwant: %v", err, ErrStreamExists)
+	}
+
+	target := HttpStreamOutputConfig{Target: "http://localhost/live.ogg"}
+	streams.CreateNew(&BufferedHttpStreamOutputConfig{HttpStreamOutputConfig: target})
+	if _, err := streams.CreateNew(&BufferedHttpStreamOutputConfig{HttpStreamOutputConfig: target}); err != ErrStreamExists {
+		t.Errorf("Existing default identifier should be refused :\n got: %v\nwant: %v", err, ErrStreamExists)
+	}
+
+	if len(streams.streams) != 2 {
+		t.Errorf("Wrong stream count :\n got: %v\nwant: %v", len(streams.streams), 2)
+	}
+}
+
+func TestHttpStreamOutputs_AudioOut_timeShift(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "timeshift")
+	defer os.RemoveAll(directory)
+
+	streams := NewHttpStreamOutputs()
+	streams.SetSampleRate(1000)
+	streams.Setup(&HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "http://localhost/live.mp3"}},
+			{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "http://localhost/delayed.mp3"}, TimeShift: 3 * time.Hour},
+		},
+		TimeShiftDirectory: directory,
+	})
+
+	if len(streams.timeShifts) != 1 || streams.timeShifts[3*time.Hour] == nil {
+		t.Fatalf("A time shift should be created for the delayed stream :\n got: %v", streams.timeShifts)
+	}
+	streams.AudioOut(NewAudio(1024, 2))
+	defer streams.timeShifts[3*time.Hour].Close()
+
+	if streams.timeShifts[3*time.Hour].Directory != path.Join(directory, "3h0m0s") {
+		t.Errorf("Wrong time shift directory :\n got: %v\nwant: %v", streams.timeShifts[3*time.Hour].Directory, path.Join(directory, "3h0m0s"))
+	}
+
+	streams.Destroy(streams.streams[1].Identifier)
+
+	if len(streams.timeShifts) != 0 {
+		t.Errorf("Unused time shift should be closed :\n got: %v", streams.timeShifts)
+	}
+}
+
+func TestHttpStreamOutputs_Reconcile_timeShift(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "timeshift")
+	defer os.RemoveAll(directory)
+
+	streams := NewHttpStreamOutputs()
+	streams.SetSampleRate(1000)
+	streams.Setup(&HttpStreamOutputsConfig{TimeShiftDirectory: directory})
+	defer streams.Close()
+
+	delayed := testReconcileStreamConfig("delayed", "http://localhost/delayed.mp3")
+	delayed.TimeShift = time.Hour
+	streams.Reconcile(&HttpStreamOutputsConfig{
+		Streams:            []BufferedHttpStreamOutputConfig{delayed},
+		TimeShiftDirectory: directory,
+	})
+
+	if streams.timeShifts[time.Hour] == nil {
+		t.Fatalf("A time shift should be created for the new stream :\n got: %v", streams.timeShifts)
+	}
+
+	delayed.TimeShift = 2 * time.Hour
+	streams.Reconcile(&HttpStreamOutputsConfig{
+		Streams:            []BufferedHttpStreamOutputConfig{delayed},
+		TimeShiftDirectory: directory,
+	})
+
+	if len(streams.timeShifts) != 1 || streams.timeShifts[2*time.Hour] == nil {
+		t.Errorf("The time shift should follow the stream delay :\n got: %v", streams.timeShifts)
+	}
+}
+
+func TestHttpStreamOutputsConfig_Validate_timeShiftDirectory(t *testing.T) {
+	config := HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "http://localhost/delayed.mp3"}, TimeShift: time.Hour},
+			{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "http://localhost/delayed2.mp3"}, TimeShift: 2 * time.Hour},
+		},
+	}
+
+	errors := ConfigErrors{}
+	config.Validate(&errors)
+	if len(errors) != 1 || errors[0].Field != "TimeShiftDirectory" {
+		t.Errorf("TimeShiftDirectory should be required :\n got: %v", errors)
+	}
+
+	config.TimeShiftDirectory = "/var/lib/go-broadcast/timeshift"
+	errors = ConfigErrors{}
+	config.Validate(&errors)
+	if len(errors) != 0 {
+		t.Errorf("Config should be valid :\n got: %v", errors)
+	}
+}
+
+func TestHttpStreamOutputs_Close(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "timeshift")
+	defer os.RemoveAll(directory)
+
+	streams := NewHttpStreamOutputs()
+	streams.SetSampleRate(1000)
+	streams.Setup(&HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			testReconcileStreamConfig("live", "http://localhost/live.mp3"),
+			{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "http://localhost/delayed.mp3"}, TimeShift: 3 * time.Hour},
+		},
+		TimeShiftDirectory: directory,
+	})
+	streams.AudioOut(NewAudio(1024, 2))
+
+	// Disconnected streams aren't waited for
+	start := time.Now()
+	streams.Drain(time.Second)
+	if time.Now().Sub(start) > 500*time.Millisecond {
+		t.Errorf("Disconnected streams should be drained")
+	}
+
+	streams.Close()
+	if len(streams.timeShifts) != 0 {
+		t.Errorf("Time shifts should be closed :\n got: %v", streams.timeShifts)
+	}
+}
+
+func testReconcileStreamConfig(identifier string, target string) BufferedHttpStreamOutputConfig {
+	config := NewBufferedHttpStreamOutputConfig()
+	config.Identifier = identifier
+	config.Target = target
+	// Disabled streams aren't connected
+	config.Disabled = true
+	return config
+}
+
+func TestHttpStreamOutputs_Reconcile(t *testing.T) {
+	streams := NewHttpStreamOutputs()
+	streams.Setup(&HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			testReconcileStreamConfig("mp3", "http://localhost/live.mp3"),
+			testReconcileStreamConfig("ogg", "http://localhost/live.ogg"),
+			testReconcileStreamConfig("low", "http://localhost/low.mp3"),
+			testReconcileStreamConfig("", "http://localhost/same.mp3"),
+		},
+	})
+	sameStream := streams.Stream(defaultStreamIdentifier("http://localhost/same.mp3"))
+
+	config := &HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			testReconcileStreamConfig("mp3", "http://localhost/live.mp3"),
+			testReconcileStreamConfig("aac", "http://localhost/live.aac"),
+			testReconcileStreamConfig("low", "http://localhost/low-64k.mp3"),
+			testReconcileStreamConfig("", "http://localhost/same.mp3"),
+		},
+	}
+	config.Streams[0].Description.Name = "Live"
+
+	changes := streams.Reconcile(config)
+
+	expectedChanges := HttpStreamOutputsChanges{
+		Created:   []string{"aac"},
+		Updated:   []string{"mp3"},
+		Restarted: []string{"low"},
+		Destroyed: []string{"ogg"},
+	}
+	if !reflect.DeepEqual(changes, expectedChanges) {
+		t.Errorf("Wrong changes :\n got: %v\nwant: %v", changes, expectedChanges)
+	}
+
+	if streams.Stream("mp3").output.Description.Name != "Live" {
+		t.Errorf("Description should be changed :\n got: %v\nwant: %v", streams.Stream("mp3").output.Description.Name, "Live")
+	}
+	if streams.Stream("low").output.Target != "http://localhost/low-64k.mp3" {
+		t.Errorf("Target should be changed :\n got: %v\nwant: %v", streams.Stream("low").output.Target, "http://localhost/low-64k.mp3")
+	}
+	if streams.Stream(sameStream.Identifier) != sameStream || len(streams.streams) != 4 {
+		t.Errorf("Unchanged stream should be kept :\n got: %v", streams.streams)
+	}
+
+	if changes := streams.Reconcile(config); !changes.IsEmpty() {
+		t.Errorf("Reconcile with the same config should not change streams :\n got: %v", changes)
+	}
+}
+
+func TestHttpStreamOutputs_Reconcile_concurrent(t *testing.T) {
+	streams := NewHttpStreamOutputs()
+	streams.Setup(&HttpStreamOutputsConfig{})
+	defer streams.Close()
+
+	config := HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			testReconcileStreamConfig("mp3", "http://localhost/live.mp3"),
+			testReconcileStreamConfig("ogg", "http://localhost/live.ogg"),
+		},
+	}
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			requestConfig := config
+			requestConfig.Streams = append([]BufferedHttpStreamOutputConfig{}, config.Streams...)
+			streams.Reconcile(&requestConfig)
+		}()
+	}
+	waitGroup.Wait()
+
+	if count := len(streams.streamList()); count != 2 {
+		t.Errorf("Concurrent reconciles should create each stream once :\n got: %v\nwant: %v", count, 2)
+	}
+}
+
+func TestHttpStreamOutputsConfig_Validate(t *testing.T) {
+	config := HttpStreamOutputsConfig{
+		Streams: []BufferedHttpStreamOutputConfig{
+			testReconcileStreamConfig("mp3", "http://localhost/live.mp3"),
+			testReconcileStreamConfig("mp3", "http://localhost/live.ogg"),
+			{},
+		},
+	}
+
+	errors := ConfigErrors{}
+	config.Validate(&errors)
+
+	if len(errors) != 1 || errors[0].Field != "Streams[1].Identifier" {
+		t.Errorf("Duplicate identifier should be refused :\n got: %v", errors)
+	}
+}
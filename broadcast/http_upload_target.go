@@ -0,0 +1,210 @@
+package broadcast
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// The server reports a SHA-256 digest (RFC 3230 Digest header or
+	// SHA-256 ETag) which must match the file checksum
+	HttpUploadVerifyDigest = "digest"
+	// Only the size reported by the server is compared
+	HttpUploadVerifySize = "size"
+)
+
+// HttpUploadTarget uploads files with PUT requests under URL (WebDAV
+// servers, ...). Each upload is verified with a HEAD request, as described
+// by Verify ("digest" by default). An upload which can't be verified fails.
+//
+// Files larger than PartSize (when defined) are sent by parts, with
+// PUT requests and Content-Range headers. The server must support partial
+// PUT requests. An interrupted upload is resumed from the size reported by
+// the server. Without PartSize, an upload restarts from the beginning.
+type HttpUploadTarget struct {
+	URL      string
+	Verify   string
+	PartSize int64
+
+	Client *http.Client
+}
+
+func (target *HttpUploadTarget) client() *http.Client {
+	if target.Client == nil {
+		target.Client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	return target.Client
+}
+
+func (target *HttpUploadTarget) verifyMode() string {
+	if target.Verify == "" {
+		target.Verify = HttpUploadVerifyDigest
+	}
+	return target.Verify
+}
+
+func (target *HttpUploadTarget) fileURL(key string) string {
+	return strings.TrimSuffix(target.URL, "/") + "/" + awsEscape(key, false)
+}
+
+func (target *HttpUploadTarget) Upload(job *UploadJob, progress func()) error {
+	file, err := os.Open(job.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if target.PartSize <= 0 || job.Size <= target.PartSize {
+		job.UploadedSize = 0
+		err = target.put(job, file, 0, job.Size)
+		if err != nil {
+			return err
+		}
+
+		job.UploadedSize = job.Size
+		progress()
+
+		return target.verify(job)
+	}
+
+	if job.UploadedSize > 0 {
+		target.resume(job)
+		progress()
+	}
+
+	for job.UploadedSize < job.Size {
+		partSize := job.Size - job.UploadedSize
+		if partSize > target.PartSize {
+			partSize = target.PartSize
+		}
+
+		err = target.put(job, file, job.UploadedSize, partSize)
+		if err != nil {
+			return err
+		}
+
+		job.UploadedSize += partSize
+		progress()
+	}
+
+	return target.verify(job)
+}
+
+// Uses the size of the partial file stored by the server to resume the
+// upload. The upload restarts from the beginning when the size is unknown.
+func (target *HttpUploadTarget) resume(job *UploadJob) {
+	response, err := target.client().Head(target.fileURL(job.Key))
+	if err != nil {
+		job.UploadedSize = 0
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 || response.ContentLength < 0 || response.ContentLength > job.Size {
+		job.UploadedSize = 0
+		return
+	}
+
+	Log.Debugf("Resume upload of %s at %d/%d", job.Key, response.ContentLength, job.Size)
+	job.UploadedSize = response.ContentLength
+}
+
+// Sends the file part between offset and offset+length. The complete file
+// is sent without Content-Range.
+func (target *HttpUploadTarget) put(job *UploadJob, file *os.File, offset int64, length int64) error {
+	request, err := http.NewRequest("PUT", target.fileURL(job.Key), io.NewSectionReader(file, offset, length))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = length
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	if length < job.Size {
+		request.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, job.Size))
+	} else if checksum, err := hex.DecodeString(job.Checksum); err == nil {
+		// RFC 3230 instance digest
+		request.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(checksum))
+	}
+
+	response, err := target.client().Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected status '%s'", response.Status)
+	}
+	return nil
+}
+
+func (target *HttpUploadTarget) verify(job *UploadJob) error {
+	request, err := http.NewRequest("HEAD", target.fileURL(job.Key), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Want-Digest", "SHA-256")
+
+	response, err := target.client().Do(request)
+	if err != nil {
+		return fmt.Errorf("Can't verify uploaded file %s : %v", job.Key, err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Can't verify uploaded file %s : %s", job.Key, response.Status)
+	}
+
+	if response.ContentLength >= 0 && response.ContentLength != job.Size {
+		return fmt.Errorf("Size mismatch for uploaded file %s : %d/%d", job.Key, response.ContentLength, job.Size)
+	}
+
+	if target.verifyMode() == HttpUploadVerifySize {
+		if response.ContentLength < 0 {
+			return fmt.Errorf("Can't verify uploaded file %s : no size", job.Key)
+		}
+		return nil
+	}
+
+	checksum := httpResponseChecksum(response)
+	if checksum == "" {
+		return fmt.Errorf("Can't verify uploaded file %s : no SHA-256 digest", job.Key)
+	}
+	if checksum != job.Checksum {
+		return fmt.Errorf("Checksum mismatch for uploaded file %s : %s/%s", job.Key, checksum, job.Checksum)
+	}
+	return nil
+}
+
+var sha256HexPattern = regexp.MustCompile("^[0-9a-fA-F]{64}$")
+
+// Returns the hex SHA-256 checksum reported by the server in a Digest
+// header (RFC 3230) or in a strong ETag
+func httpResponseChecksum(response *http.Response) string {
+	for _, digest := range strings.Split(response.Header.Get("Digest"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(digest), "=", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "SHA-256") {
+			checksum, err := base64.StdEncoding.DecodeString(parts[1])
+			if err == nil {
+				return hex.EncodeToString(checksum)
+			}
+		}
+	}
+
+	// A weak ETag doesn't describe the content bytes
+	etag := response.Header.Get("ETag")
+	if strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+	if etag = strings.Trim(etag, "\""); sha256HexPattern.MatchString(etag) {
+		return strings.ToLower(etag)
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package broadcast
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHttpUploadTarget_Upload(t *testing.T) {
+	files := make(map[string][]byte)
+	var digest string
+
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case "PUT":
+			files[request.URL.Path], _ = ioutil.ReadAll(request.Body)
+			digest = request.Header.Get("Digest")
+			response.WriteHeader(201)
+		case "HEAD":
+			response.Header().Set("Content-Length", strconv.Itoa(len(files[request.URL.Path])))
+			if request.Header.Get("Want-Digest") == "SHA-256" {
+				checksum, _ := hex.DecodeString(sha256Hex(files[request.URL.Path]))
+				response.Header().Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(checksum))
+			}
+		}
+	}))
+	defer server.Close()
+
+	target := &HttpUploadTarget{URL: server.URL + "/records/"}
+
+	job := testUploadJob(t, 1000)
+	defer os.Remove(job.Path)
+
+	err := target.Upload(job, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files["/records/2015/05-May/20-Wed/14h00.wav"]) != 1000 {
+		t.Errorf("Wrong uploaded files :\n got: %v", len(files))
+	}
+
+	checksum, _ := hex.DecodeString(job.Checksum)
+	if expectedDigest := "SHA-256=" + base64.StdEncoding.EncodeToString(checksum); digest != expectedDigest {
+		t.Errorf("Wrong Digest header :\n got: %v\nwant: %v", digest, expectedDigest)
+	}
+}
+
+func TestHttpUploadTarget_Upload_sizeMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Method == "HEAD" {
+			response.Header().Set("Content-Length", "10")
+		}
+	}))
+	defer server.Close()
+
+	target := &HttpUploadTarget{URL: server.URL}
+
+	job := testUploadJob(t, 1000)
+	defer os.Remove(job.Path)
+
+	if err := target.Upload(job, func() {}); err == nil {
+		t.Errorf("Should return an error when uploaded size is different")
+	}
+}
+
+func TestHttpUploadTarget_Upload_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		http.Error(response, "Forbidden", 403)
+	}))
+	defer server.Close()
+
+	target := &HttpUploadTarget{URL: server.URL}
+
+	job := testUploadJob(t, 10)
+	defer os.Remove(job.Path)
+
+	if err := target.Upload(job, func() {}); err == nil {
+		t.Errorf("Should return an error with a 403 status")
+	}
+}
+
+// Stores the files sent with PUT requests, with Content-Range support
+type testHttpUploadServer struct {
+	files    map[string][]byte
+	etag     bool
+	failPart int
+	puts     int
+}
+
+func (server *testHttpUploadServer) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	data := server.files[request.URL.Path]
+
+	switch request.Method {
+	case "PUT":
+		server.puts++
+		if server.puts == server.failPart {
+			http.Error(response, "Service unavailable", 503)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(request.Body)
+		if contentRange := request.Header.Get("Content-Range"); contentRange != "" {
+			var start, end, total int
+			fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
+			if start != len(data) {
+				http.Error(response, "Invalid range", 416)
+				return
+			}
+			server.files[request.URL.Path] = append(data, body...)
+		} else {
+			server.files[request.URL.Path] = body
+		}
+		response.WriteHeader(201)
+	case "HEAD":
+		response.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if server.etag {
+			response.Header().Set("ETag", "\""+strings.ToUpper(sha256Hex(data))+"\"")
+		}
+	}
+}
+
+func TestHttpUploadTarget_Upload_etag(t *testing.T) {
+	uploadServer := &testHttpUploadServer{files: make(map[string][]byte), etag: true}
+	server := httptest.NewServer(uploadServer)
+	defer server.Close()
+
+	target := &HttpUploadTarget{URL: server.URL}
+
+	job := testUploadJob(t, 1000)
+	defer os.Remove(job.Path)
+
+	if err := target.Upload(job, func() {}); err != nil {
+		t.Errorf("SHA-256 ETag should verify the upload :\n got: %v", err)
+	}
+}
+
+func TestHttpUploadTarget_Upload_unverified(t *testing.T) {
+	uploadServer := &testHttpUploadServer{files: make(map[string][]byte)}
+	server := httptest.NewServer(uploadServer)
+	defer server.Close()
+
+	target := &HttpUploadTarget{URL: server.URL}
+
+	job := testUploadJob(t, 1000)
+	defer os.Remove(job.Path)
+
+	if err := target.Upload(job, func() {}); err == nil || !strings.Contains(err.Error(), "no SHA-256 digest") {
+		t.Errorf("Upload without server digest should fail :\n got: %v", err)
+	}
+
+	target.Verify = HttpUploadVerifySize
+	if err := target.Upload(job, func() {}); err != nil {
+		t.Errorf("Upload should be verified by size :\n got: %v", err)
+	}
+}
+
+func TestHttpUploadTarget_Upload_checksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Method == "HEAD" {
+			response.Header().Set("Content-Length", "1000")
+			response.Header().Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(make([]byte, 32)))
+		}
+	}))
+	defer server.Close()
+
+	target := &HttpUploadTarget{URL: server.URL}
+
+	job := testUploadJob(t, 1000)
+	defer os.Remove(job.Path)
+
+	if err := target.Upload(job, func() {}); err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("Upload with another digest should fail :\n got: %v", err)
+	}
+}
+
+func TestHttpUploadTarget_Upload_resume(t *testing.T) {
+	uploadServer := &testHttpUploadServer{files: make(map[string][]byte), etag: true, failPart: 3}
+	server := httptest.NewServer(uploadServer)
+	defer server.Close()
+
+	target := &HttpUploadTarget{URL: server.URL, PartSize: 300}
+
+	job := testUploadJob(t, 1000)
+	defer os.Remove(job.Path)
+
+	var savedSizes []int64
+	progress := func() {
+		savedSizes = append(savedSizes, job.UploadedSize)
+	}
+
+	if err := target.Upload(job, progress); err == nil {
+		t.Fatal("Third part should fail")
+	}
+	if job.UploadedSize != 600 {
+		t.Errorf("Wrong uploaded size after failure :\n got: %v\nwant: %v", job.UploadedSize, 600)
+	}
+
+	if err := target.Upload(job, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	// 300, 600, (failure), 600 (resumed), 900, 1000
+	if uploadServer.puts != 5 || len(savedSizes) != 5 || savedSizes[2] != 600 {
+		t.Errorf("Upload should be resumed :\n got: %v (%d PUT requests)", savedSizes, uploadServer.puts)
+	}
+	if data := uploadServer.files["/2015/05-May/20-Wed/14h00.wav"]; sha256Hex(data) != job.Checksum {
+		t.Errorf("Wrong uploaded file (%d bytes)", len(data))
+	}
+}
@@ -0,0 +1,184 @@
+package broadcast
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+// An InfluxDBExporter sends the metrics of Registry (metrics.DefaultRegistry
+// by default) with the InfluxDB line protocol.
+//
+// With an "http://" (or "https://") URL, metrics are written into Database
+// with the /write API. With an "udp://host:port" URL, they're sent to the
+// InfluxDB UDP listener.
+//
+// Each metric is a measurement named "<prefix>.<name>" with the exporter
+// tags and the metric fields (count, value, min, max, mean, p95, ...).
+type InfluxDBExporter struct {
+	URL      string
+	Database string
+	Prefix   string
+	Tags     MetricsTags
+	Interval time.Duration
+	Registry metrics.Registry
+
+	httpClient *http.Client
+}
+
+var influxDBEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func (exporter *InfluxDBExporter) registry() metrics.Registry {
+	if exporter.Registry == nil {
+		exporter.Registry = metrics.DefaultRegistry
+	}
+	return exporter.Registry
+}
+
+func (exporter *InfluxDBExporter) interval() time.Duration {
+	if exporter.Interval == 0 {
+		exporter.Interval = 10 * time.Second
+	}
+	return exporter.Interval
+}
+
+func (exporter *InfluxDBExporter) client() *http.Client {
+	if exporter.httpClient == nil {
+		exporter.httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	return exporter.httpClient
+}
+
+func (exporter *InfluxDBExporter) Run() {
+	runMetricsExporter(fmt.Sprintf("InfluxDB %s", exporter.URL), exporter.interval(), exporter.Export)
+}
+
+// Returns the InfluxDB lines of the current metrics
+func (exporter *InfluxDBExporter) Lines(now time.Time) []string {
+	tags := ""
+	for _, key := range exporter.Tags.keys() {
+		tags += fmt.Sprintf(",%s=%s", influxDBEscaper.Replace(key), influxDBEscaper.Replace(exporter.Tags[key]))
+	}
+
+	lines := []string{}
+	for _, metric := range exportedMetrics(exporter.registry()) {
+		measurement := influxDBEscaper.Replace(exportedMetricName(exporter.Prefix, metric.Name))
+
+		fields := []string{}
+		for _, field := range metric.Fields {
+			fields = append(fields, fmt.Sprintf("%s=%s", field.Name, formatExportedValue(field.Value)))
+		}
+
+		lines = append(lines, fmt.Sprintf("%s%s %s %d", measurement, tags, strings.Join(fields, ","), now.UnixNano()))
+	}
+	return lines
+}
+
+// Sends the current metrics
+func (exporter *InfluxDBExporter) Export() error {
+	exportURL, err := url.Parse(exporter.URL)
+	if err != nil {
+		return err
+	}
+
+	lines := exporter.Lines(time.Now())
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if exportURL.Scheme == "udp" {
+		return exporter.exportUDP(exportURL.Host, lines)
+	}
+
+	exportURL.Path = strings.TrimRight(exportURL.Path, "/") + "/write"
+	exportURL.RawQuery = url.Values{"db": {exporter.Database}}.Encode()
+
+	response, err := exporter.client().Post(exportURL.String(), "text/plain", strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("InfluxDB error %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Sends lines in packets smaller than the InfluxDB UDP buffer
+func (exporter *InfluxDBExporter) exportUDP(address string, lines []string) error {
+	connection, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsDPacketSize {
+			if _, err := connection.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		packet.WriteString(line)
+		packet.WriteString("\n")
+	}
+
+	_, err = connection.Write(packet.Bytes())
+	return err
+}
+
+type MetricsInfluxDBConfig struct {
+	URL      string        `json:",omitempty"`
+	Database string        `json:",omitempty"`
+	Prefix   string        `json:",omitempty"`
+	Tags     MetricsTags   `json:",omitempty"`
+	Interval time.Duration `json:",omitempty"`
+}
+
+func (config *MetricsInfluxDBConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.StringVar(&config.URL, strings.Join([]string{prefix, "url"}, "-"), "", "The InfluxDB URL (like http://localhost:8086 or udp://localhost:8089)")
+	flags.StringVar(&config.Database, strings.Join([]string{prefix, "database"}, "-"), "gobroadcast", "The InfluxDB database (with HTTP)")
+	flags.StringVar(&config.Prefix, strings.Join([]string{prefix, "prefix"}, "-"), "gobroadcast", "The prefix of InfluxDB measurements")
+	flags.Var(&config.Tags, strings.Join([]string{prefix, "tags"}, "-"), "The InfluxDB tags (like host=studio,site=paris)")
+	flags.DurationVar(&config.Interval, strings.Join([]string{prefix, "interval"}, "-"), 10*time.Second, "The interval between two InfluxDB exports")
+}
+
+func (config *MetricsInfluxDBConfig) Apply() {
+	if config.URL != "" {
+		exporter := &InfluxDBExporter{
+			URL:      config.URL,
+			Database: config.Database,
+			Prefix:   config.Prefix,
+			Tags:     config.Tags,
+			Interval: config.Interval,
+		}
+		go exporter.Run()
+	}
+}
+
+func (config *MetricsInfluxDBConfig) Validate(errors *ConfigErrors) {
+	if config.URL != "" {
+		exportURL, err := url.Parse(config.URL)
+		switch {
+		case err != nil || exportURL.Host == "":
+			errors.Add("URL", "invalid URL '%s'", config.URL)
+		case exportURL.Scheme != "http" && exportURL.Scheme != "https" && exportURL.Scheme != "udp":
+			errors.Add("URL", "unsupported scheme '%s' (http, https or udp expected)", exportURL.Scheme)
+		case exportURL.Scheme != "udp" && config.Database == "":
+			errors.Add("Database", "can't be empty with HTTP")
+		}
+	}
+	validateMetricsExporterInterval(errors, config.Interval)
+	validateMetricsTags(errors, config.Tags)
+}
@@ -0,0 +1,108 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInfluxDBExporter_Lines(t *testing.T) {
+	exporter := &InfluxDBExporter{Prefix: "gobroadcast", Tags: MetricsTags{"host": "my studio"}, Registry: testExporterRegistry()}
+
+	expectedLines := []string{
+		`gobroadcast.http.Samples,host=my\ studio count=1024 1500000000000000000`,
+		`gobroadcast.upload.Queue,host=my\ studio value=3 1500000000000000000`,
+	}
+	if lines := exporter.Lines(time.Unix(1500000000, 0)); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("Wrong lines :\n got: %v\nwant: %v", lines, expectedLines)
+	}
+}
+
+func TestInfluxDBExporter_Export_http(t *testing.T) {
+	var path, query, body string
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		data, _ := ioutil.ReadAll(request.Body)
+		path, query, body = request.URL.Path, request.URL.RawQuery, string(data)
+		response.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	exporter := &InfluxDBExporter{URL: server.URL, Database: "broadcast", Registry: testExporterRegistry()}
+	if err := exporter.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/write" || query != "db=broadcast" {
+		t.Errorf("Wrong write request :\n got: %v?%v\nwant: %v", path, query, "/write?db=broadcast")
+	}
+	if len(body) == 0 || body[:len("http.Samples count=1024 ")] != "http.Samples count=1024 " {
+		t.Errorf("Wrong body :\n got: %v", body)
+	}
+}
+
+func TestInfluxDBExporter_Export_httpError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		http.Error(response, "database not found", 404)
+	}))
+	defer server.Close()
+
+	exporter := &InfluxDBExporter{URL: server.URL, Database: "dummy", Registry: testExporterRegistry()}
+	err := exporter.Export()
+	if err == nil || err.Error() != "InfluxDB error 404: database not found" {
+		t.Errorf("Wrong error :\n got: %v\nwant: %v", err, "InfluxDB error 404: database not found")
+	}
+}
+
+func TestInfluxDBExporter_Export_udp(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	exporter := &InfluxDBExporter{URL: "udp://" + listener.LocalAddr().String(), Registry: testExporterRegistry()}
+	if err := exporter.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := make([]byte, statsDPacketSize)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	length, _, err := listener.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(packet[:len("http.Samples count=1024 ")]) != "http.Samples count=1024 " || packet[length-1] != '\n' {
+		t.Errorf("Wrong packet :\n got: %v", string(packet[:length]))
+	}
+}
+
+func TestMetricsInfluxDBConfig_Validate(t *testing.T) {
+	conditions := []struct {
+		config        MetricsInfluxDBConfig
+		expectedField string
+	}{
+		{MetricsInfluxDBConfig{URL: "http://localhost:8086", Database: "broadcast"}, ""},
+		{MetricsInfluxDBConfig{URL: "udp://localhost:8089"}, ""},
+		{MetricsInfluxDBConfig{URL: "http://localhost:8086"}, "Database"},
+		{MetricsInfluxDBConfig{URL: "tcp://localhost:8086"}, "URL"},
+		{MetricsInfluxDBConfig{URL: "localhost"}, "URL"},
+	}
+
+	for _, condition := range conditions {
+		errors := ConfigErrors{}
+		condition.config.Validate(&errors)
+
+		field := ""
+		if len(errors) > 0 {
+			field = errors[0].Field
+		}
+		if field != condition.expectedField {
+			t.Errorf("Wrong error for %v :\n got: %v\nwant: %v", condition.config, errors, condition.expectedField)
+		}
+	}
+}
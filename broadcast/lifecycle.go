@@ -1,5 +1,134 @@
 package broadcast
 
+import (
+	"sync"
+)
+
 type Resettable interface {
 	Reset()
 }
+
+type Flushable interface {
+	Flush()
+}
+
+// A Component runs until it's stopped (inputs, outputs, ...).
+//
+// Run blocks while the component works. Stop ends the Run loop and
+// releases the component resources.
+type Component interface {
+	Run()
+	Stop() error
+}
+
+// A StatusComponent reports its own state while it's run by a Supervisor
+// (for example, a stream is "connecting" until it's connected)
+type StatusComponent interface {
+	Component
+	Status() ComponentStatus
+}
+
+// A runLoops tracks the Run loops of a Component, so that Stop can wait for
+// their end. A Run loop registers itself before working : a Run invoked
+// after Stop returns immediately.
+type runLoops struct {
+	stopping chan struct{}
+	running  sync.WaitGroup
+	mutex    sync.Mutex
+}
+
+func (loops *runLoops) stoppingChannel() chan struct{} {
+	if loops.stopping == nil {
+		loops.stopping = make(chan struct{})
+	}
+	return loops.stopping
+}
+
+// Returns a channel closed when the component is stopped
+func (loops *runLoops) Stopping() <-chan struct{} {
+	loops.mutex.Lock()
+	defer loops.mutex.Unlock()
+	return loops.stoppingChannel()
+}
+
+// Returns true if the component is stopped
+func (loops *runLoops) Stopped() bool {
+	select {
+	case <-loops.Stopping():
+		return true
+	default:
+		return false
+	}
+}
+
+// Registers a Run loop (ended with Done). Returns false if the component
+// is stopped.
+func (loops *runLoops) Start() bool {
+	loops.mutex.Lock()
+	defer loops.mutex.Unlock()
+
+	select {
+	case <-loops.stoppingChannel():
+		return false
+	default:
+	}
+
+	loops.running.Add(1)
+	return true
+}
+
+func (loops *runLoops) Done() {
+	loops.running.Done()
+}
+
+// Asks the Run loops to stop. Doesn't wait for their end (see Wait).
+func (loops *runLoops) Stop() {
+	loops.mutex.Lock()
+	defer loops.mutex.Unlock()
+
+	select {
+	case <-loops.stoppingChannel():
+	default:
+		close(loops.stopping)
+	}
+}
+
+// Waits the end of the registered Run loops
+func (loops *runLoops) Wait() {
+	loops.running.Wait()
+}
+
+// A SoundInput is the audio source of a command (alsa device, generator, ...)
+type SoundInput interface {
+	Component
+	Init() error
+	SetAudioHandler(audioHandler AudioHandler)
+}
+
+// A ComponentStatusReporter reports the status of its sub-components
+// (for example, the streams of HttpStreamOutputs)
+type ComponentStatusReporter interface {
+	ComponentStatuses() []ComponentStatus
+}
+
+const (
+	ComponentRunning    = "running"
+	ComponentRestarting = "restarting"
+	ComponentStopped    = "stopped"
+	ComponentDisabled   = "disabled"
+	ComponentConnecting = "connecting"
+)
+
+type ComponentStatus struct {
+	Name      string
+	State     string
+	Healthy   bool
+	Restarts  int64             `json:",omitempty"`
+	LastError string            `json:",omitempty"`
+	Children  []ComponentStatus `json:",omitempty"`
+}
+
+// Returns true if the given state is expected for a working component
+func healthyComponentState(state string) bool {
+	return state == ComponentRunning || state == ComponentDisabled
+}
@@ -0,0 +1,50 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunLoops_Stop(t *testing.T) {
+	loops := &runLoops{}
+
+	if !loops.Start() {
+		t.Fatal("Run loop should start")
+	}
+
+	stopped := make(chan bool)
+	go func() {
+		loops.Stop()
+		loops.Wait()
+		close(stopped)
+	}()
+
+	<-loops.Stopping()
+	select {
+	case <-stopped:
+		t.Fatal("Stop should wait the end of the Run loop")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	loops.Done()
+	<-stopped
+
+	if loops.Start() {
+		t.Errorf("Run loop shouldn't start once stopped")
+	}
+}
+
+func TestRunLoops_Stop_beforeRun(t *testing.T) {
+	loops := &runLoops{}
+
+	loops.Stop()
+	loops.Stop()
+	loops.Wait()
+
+	if !loops.Stopped() {
+		t.Errorf("Loops should be stopped")
+	}
+	if loops.Start() {
+		t.Errorf("Run loop shouldn't start once stopped")
+	}
+}
@@ -5,3 +5,7 @@ import "math"
 func dBFSToPeak(dbValue float64) float64 {
 	return math.Exp(dbValue * math.Log(10) / 10)
 }
+
+func dBFSToAmplitude(dbValue float64) float64 {
+	return math.Pow(10, dbValue/20)
+}
@@ -22,3 +22,21 @@ func TestMath_dBFSToPeak(t *testing.T) {
 		}
 	}
 }
+
+func TestMath_dBFSToAmplitude(t *testing.T) {
+	var conditions = []struct {
+		dbFSValue float64
+		amplitude float64
+	}{
+		{0, 1},
+		{-6, 0.501},
+		{-18, 0.126},
+		{-20, 0.1},
+	}
+
+	for _, condition := range conditions {
+		if math.Abs(dBFSToAmplitude(condition.dbFSValue)-condition.amplitude) > condition.amplitude/100 {
+			t.Errorf("Wrong amplitude for %f :\n got: %v\nwant: %v", condition.dbFSValue, dBFSToAmplitude(condition.dbFSValue), condition.amplitude)
+		}
+	}
+}
@@ -56,15 +56,24 @@ func (metricsReadCloser *MetricsReadCloser) Close() error {
 }
 
 type MetricsConfig struct {
-	Librato MetricsLibratoConfig `json:",omitempty"`
+	Librato  MetricsLibratoConfig  `json:",omitempty"`
+	StatsD   MetricsStatsDConfig   `json:",omitempty"`
+	InfluxDB MetricsInfluxDBConfig `json:",omitempty"`
+	Graphite MetricsGraphiteConfig `json:",omitempty"`
 }
 
 func (config *MetricsConfig) Flags(flags *flag.FlagSet, prefix string) {
 	config.Librato.Flags(flags, strings.Join([]string{prefix, "librato"}, "-"))
+	config.StatsD.Flags(flags, strings.Join([]string{prefix, "statsd"}, "-"))
+	config.InfluxDB.Flags(flags, strings.Join([]string{prefix, "influxdb"}, "-"))
+	config.Graphite.Flags(flags, strings.Join([]string{prefix, "graphite"}, "-"))
 }
 
 func (config *MetricsConfig) Apply() {
 	config.Librato.Apply()
+	config.StatsD.Apply()
+	config.InfluxDB.Apply()
+	config.Graphite.Apply()
 }
 
 type MetricsLibratoConfig struct {
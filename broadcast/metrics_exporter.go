@@ -0,0 +1,138 @@
+package broadcast
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+// MetricsTags are added to the exported metrics. As a flag, tags are
+// specified like "host=studio,site=paris".
+type MetricsTags map[string]string
+
+func (tags *MetricsTags) String() string {
+	if tags == nil {
+		return ""
+	}
+
+	pairs := []string{}
+	for _, key := range tags.keys() {
+		pairs = append(pairs, strings.Join([]string{key, (*tags)[key]}, "="))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (tags *MetricsTags) Set(definition string) error {
+	*tags = make(MetricsTags)
+	if definition == "" {
+		return nil
+	}
+
+	for _, pair := range strings.Split(definition, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("Invalid tag '%s' (key=value expected)", pair)
+		}
+		(*tags)[parts[0]] = parts[1]
+	}
+	return nil
+}
+
+// Returns the tag keys in alphabetical order
+func (tags *MetricsTags) keys() []string {
+	keys := []string{}
+	for key := range *tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateMetricsTags(errors *ConfigErrors, tags MetricsTags) {
+	for _, key := range tags.keys() {
+		if key == "" || strings.ContainsAny(key, " ,;=") {
+			errors.Add("Tags", "invalid tag '%s'", key)
+		}
+	}
+}
+
+// An exportedMetric is a snapshot of a go-metrics metric. Counters have
+// a "count" field, gauges a "value" field and histograms "count", "min",
+// "max", "mean" and percentile fields ("p50", "p95", ...).
+type exportedMetric struct {
+	Name   string
+	Type   string // "counter", "gauge" or "histogram"
+	Fields []exportedMetricField
+}
+
+type exportedMetricField struct {
+	Name  string
+	Value float64
+}
+
+// Returns the metrics of the registry (sorted by name). Unsupported types are ignored.
+func exportedMetrics(registry metrics.Registry) []exportedMetric {
+	exported := []exportedMetric{}
+
+	registry.Each(func(name string, metric interface{}) {
+		switch metric := metric.(type) {
+		case metrics.Counter:
+			exported = append(exported, exportedMetric{Name: name, Type: "counter", Fields: []exportedMetricField{
+				{"count", float64(metric.Count())},
+			}})
+		case metrics.Gauge:
+			exported = append(exported, exportedMetric{Name: name, Type: "gauge", Fields: []exportedMetricField{
+				{"value", float64(metric.Value())},
+			}})
+		case metrics.Histogram:
+			fields := []exportedMetricField{
+				{"count", float64(metric.Count())},
+				{"min", float64(metric.Min())},
+				{"max", float64(metric.Max())},
+				{"mean", metric.Mean()},
+			}
+			for index, value := range metric.Percentiles(prometheusQuantiles) {
+				fields = append(fields, exportedMetricField{fmt.Sprintf("p%d", int(prometheusQuantiles[index]*100)), value})
+			}
+			exported = append(exported, exportedMetric{Name: name, Type: "histogram", Fields: fields})
+		}
+	})
+
+	sort.Slice(exported, func(i, j int) bool {
+		return exported[i].Name < exported[j].Name
+	})
+	return exported
+}
+
+// Returns "<prefix>.<name>" (or name when prefix is empty)
+func exportedMetricName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return strings.Join([]string{prefix, name}, ".")
+}
+
+// StatsD and Graphite don't support the exponent notation
+func formatExportedValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Invokes export at each interval. Errors are logged.
+func runMetricsExporter(name string, interval time.Duration, export func() error) {
+	Log.Printf("Export metrics to %s every %v", name, interval)
+	for range time.Tick(interval) {
+		if err := export(); err != nil {
+			Log.Printf("Can't export metrics to %s: %v", name, err)
+		}
+	}
+}
+
+func validateMetricsExporterInterval(errors *ConfigErrors, interval time.Duration) {
+	if interval < 0 {
+		errors.Add("Interval", "can't be negative")
+	}
+}
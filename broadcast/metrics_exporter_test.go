@@ -0,0 +1,66 @@
+package broadcast
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+func testExporterRegistry() metrics.Registry {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("http.Samples", registry).Inc(1024)
+	metrics.GetOrRegisterGauge("upload.Queue", registry).Update(3)
+	return registry
+}
+
+func TestMetricsTags_Set(t *testing.T) {
+	var tags MetricsTags
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&tags, "tags", "")
+
+	if err := flags.Parse([]string{"-tags=site=paris,host=studio"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedTags := MetricsTags{"host": "studio", "site": "paris"}
+	if !reflect.DeepEqual(tags, expectedTags) {
+		t.Errorf("Wrong tags :\n got: %v\nwant: %v", tags, expectedTags)
+	}
+	if tags.String() != "host=studio,site=paris" {
+		t.Errorf("Wrong tags definition :\n got: %v\nwant: %v", tags.String(), "host=studio,site=paris")
+	}
+
+	if err := tags.Set("host"); err == nil {
+		t.Errorf("Tag without value should be rejected")
+	}
+}
+
+func TestExportedMetrics(t *testing.T) {
+	registry := testExporterRegistry()
+	metrics.GetOrRegisterHistogram("buffer.Size", registry, metrics.NewExpDecaySample(1028, 0.015)).Update(10)
+
+	exported := exportedMetrics(registry)
+	if len(exported) != 3 {
+		t.Fatalf("Wrong metric count :\n got: %v\nwant: %v", len(exported), 3)
+	}
+
+	if exported[0].Name != "buffer.Size" || exported[0].Type != "histogram" || len(exported[0].Fields) != 8 {
+		t.Errorf("Wrong histogram metric :\n got: %v", exported[0])
+	}
+	if exported[0].Fields[0] != (exportedMetricField{"count", 1}) || exported[0].Fields[6].Name != "p95" {
+		t.Errorf("Wrong histogram fields :\n got: %v", exported[0].Fields)
+	}
+
+	expectedCounter := exportedMetric{Name: "http.Samples", Type: "counter", Fields: []exportedMetricField{{"count", 1024}}}
+	if !reflect.DeepEqual(exported[1], expectedCounter) {
+		t.Errorf("Wrong counter metric :\n got: %v\nwant: %v", exported[1], expectedCounter)
+	}
+
+	expectedGauge := exportedMetric{Name: "upload.Queue", Type: "gauge", Fields: []exportedMetricField{{"value", 3}}}
+	if !reflect.DeepEqual(exported[2], expectedGauge) {
+		t.Errorf("Wrong gauge metric :\n got: %v\nwant: %v", exported[2], expectedGauge)
+	}
+}
@@ -0,0 +1,169 @@
+package broadcast
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NotificationController pushes the Notifier notifications with server-sent
+// events ("/notifications.sse") or a websocket ("/notifications.ws").
+//
+// The "streams" parameter selects the notified streams ("streams=mp3,ogg").
+// The "last-event-id" parameter (or the Last-Event-ID header sent by the
+// EventSource reconnections) resumes the subscription after the given event.
+type NotificationController struct {
+	notifier *Notifier
+}
+
+func NewNotificationController(notifier *Notifier) *NotificationController {
+	return &NotificationController{notifier: notifier}
+}
+
+// Comment sent to keep the idle server-sent event connections
+var notificationKeepAliveInterval = 30 * time.Second
+
+func (controller *NotificationController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+
+	switch {
+	case path != "/notifications.sse" && path != "/notifications.ws":
+		http.NotFound(response, request)
+	case request.Method != "GET":
+		response.Header().Set("Allow", "GET")
+		http.Error(response, "Method not allowed", 405)
+	case path == "/notifications.ws":
+		websocket.Handler(controller.webSocket).ServeHTTP(response, request)
+	default:
+		filter, err := notificationFilter(request)
+		if err != nil {
+			http.Error(response, err.Error(), 400)
+			return
+		}
+		if _, ok := response.(http.Flusher); !ok {
+			http.Error(response, "Streaming not supported", 500)
+			return
+		}
+
+		receiver := controller.notifier.Subscribe(filter)
+		defer receiver.Close()
+
+		serveNotificationEvents(response, request, receiver)
+	}
+}
+
+// Returns the NotificationFilter defined by the request parameters
+func notificationFilter(request *http.Request) (NotificationFilter, error) {
+	filter := NotificationFilter{}
+	query := request.URL.Query()
+
+	if streams := query.Get("streams"); streams != "" {
+		filter.Streams = strings.Split(streams, ",")
+	}
+
+	lastEventID := request.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last-event-id")
+	}
+	if lastEventID != "" {
+		var err error
+		filter.LastEventID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid last event id: '%s'", lastEventID)
+		}
+	}
+
+	return filter, nil
+}
+
+// Sends the notifications as server-sent events, until the receiver
+// or the request is closed. The response must be an http.Flusher.
+func serveNotificationEvents(response http.ResponseWriter, request *http.Request, receiver *NotificationReceiver) {
+	flusher := response.(http.Flusher)
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.WriteHeader(200)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(notificationKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case notification, ok := <-receiver.Channel:
+			if !ok {
+				return
+			}
+			if err := writeNotificationEvent(response, notification); err != nil {
+				Log.Debugf("Can't send notification: %v", err)
+				return
+			}
+		case <-keepAlive.C:
+			io.WriteString(response, ": keep-alive\n\n")
+		case <-request.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Writes the notification in the server-sent event format. The event ID is
+// used by the EventSource to resume the subscription.
+func writeNotificationEvent(writer io.Writer, notification *Notification) error {
+	jsonBytes, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	if id := notification.EventID(); id > 0 {
+		fmt.Fprintf(writer, "id: %d\n", id)
+	}
+	_, err = fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", notification.Type, jsonBytes)
+	return err
+}
+
+func (controller *NotificationController) webSocket(webSocket *websocket.Conn) {
+	filter, err := notificationFilter(webSocket.Request())
+	if err != nil {
+		Log.Debugf("Refuse notification websocket: %v", err)
+		return
+	}
+
+	Log.Debugf("New notification websocket connection")
+
+	receiver := controller.notifier.Subscribe(filter)
+	defer receiver.Close()
+
+	closed := make(chan bool)
+	go func() {
+		for {
+			var message string
+			if err := websocket.Message.Receive(webSocket, &message); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case notification, ok := <-receiver.Channel:
+			if !ok {
+				return
+			}
+			if err := websocket.JSON.Send(webSocket, notification); err != nil {
+				Log.Debugf("Can't send websocket message: %v", err)
+				return
+			}
+		case <-closed:
+			Log.Debugf("Close notification websocket connection")
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package broadcast
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNotificationFilter(t *testing.T) {
+	conditions := []struct {
+		url            string
+		lastEventID    string
+		expectedFilter NotificationFilter
+		expectedError  bool
+	}{
+		{"/notifications.sse", "", NotificationFilter{}, false},
+		{"/notifications.sse?streams=mp3,ogg", "", NotificationFilter{Streams: []string{"mp3", "ogg"}}, false},
+		{"/notifications.sse?last-event-id=42", "", NotificationFilter{LastEventID: 42}, false},
+		{"/notifications.sse?last-event-id=1", "42", NotificationFilter{LastEventID: 42}, false},
+		{"/notifications.sse?last-event-id=dummy", "", NotificationFilter{}, true},
+	}
+
+	for _, condition := range conditions {
+		request, _ := http.NewRequest("GET", "http://localhost:9000"+condition.url, nil)
+		if condition.lastEventID != "" {
+			request.Header.Set("Last-Event-ID", condition.lastEventID)
+		}
+
+		filter, err := notificationFilter(request)
+		if (err != nil) != condition.expectedError {
+			t.Errorf("Wrong error for %s :\n got: %v\nwant error: %v", condition.url, err, condition.expectedError)
+		}
+		if err == nil && !reflect.DeepEqual(filter, condition.expectedFilter) {
+			t.Errorf("Wrong filter for %s :\n got: %v\nwant: %v", condition.url, filter, condition.expectedFilter)
+		}
+	}
+}
+
+func TestWriteNotificationEvent(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeNotificationEvent(buffer, &Notification{Type: NotificationStatus, Stream: "mp3", Status: "connected"})
+
+	if expected := "event: status\ndata: {\"Type\":\"status\",\"Stream\":\"mp3\",\"Status\":\"connected\"}\n\n"; buffer.String() != expected {
+		t.Errorf("Wrong server-sent event :\n got: %q\nwant: %q", buffer.String(), expected)
+	}
+
+	buffer.Reset()
+	writeNotificationEvent(buffer, &Notification{Type: NotificationEvent, Event: &Event{ID: 42, Message: "dummy"}})
+
+	if !strings.HasPrefix(buffer.String(), "id: 42\nevent: event\ndata: ") {
+		t.Errorf("Server-sent event should contain the event ID :\n got: %q", buffer.String())
+	}
+}
+
+func TestNotificationController_ServeHTTP_serverSentEvents(t *testing.T) {
+	notifier := &Notifier{EventLog: NewMemoryEventLog(10)}
+	notifier.EventLog.NewEvent("First")
+	notifier.EventLog.NewEvent("Second")
+
+	server := httptest.NewServer(NewNotificationController(notifier))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/notifications.sse", nil)
+	request.Header.Set("Last-Event-ID", "1")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Wrong Content-Type :\n got: %v\nwant: %v", contentType, "text/event-stream")
+	}
+
+	reader := bufio.NewReader(response.Body)
+	lines := []string{}
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	if lines[0] != "id: 2" || lines[1] != "event: event" || !strings.Contains(lines[2], `"Message":"Second"`) {
+		t.Errorf("Wrong server-sent event :\n got: %v", lines)
+	}
+}
+
+func TestNotificationController_ServeHTTP_errors(t *testing.T) {
+	controller := NewNotificationController(&Notifier{EventLog: NewMemoryEventLog(10)})
+
+	conditions := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{"POST", "/notifications.sse", 405},
+		{"GET", "/notifications.sse?last-event-id=dummy", 400},
+		{"GET", "/notifications.json", 404},
+	}
+
+	for _, condition := range conditions {
+		request, _ := http.NewRequest(condition.method, "http://localhost:9000"+condition.url, nil)
+		response := httptest.NewRecorder()
+		controller.ServeHTTP(response, request)
+
+		if response.Code != condition.code {
+			t.Errorf("Wrong response code for %s %s :\n got: %v\nwant: %v", condition.method, condition.url, response.Code, condition.code)
+		}
+	}
+}
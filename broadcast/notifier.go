@@ -0,0 +1,374 @@
+package broadcast
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NotificationEvent      = "event"
+	NotificationStatus     = "status"
+	NotificationEfficiency = "efficiency"
+)
+
+// A Notification is pushed by the Notifier to its subscribers
+type Notification struct {
+	Type   string
+	Stream string `json:",omitempty"`
+
+	// The new Event (its ID can be used to resume a subscription)
+	Event *Event `json:",omitempty"`
+	// "created", "destroyed", "enabled", "disabled", "started", "stopped",
+	// "connected" or "disconnected"
+	Status string `json:",omitempty"`
+	// The efficiency of the last time window
+	Efficiency *float64 `json:",omitempty"`
+}
+
+// Returns the ID of the notified Event (or zero)
+func (notification *Notification) EventID() int64 {
+	if notification.Event == nil {
+		return 0
+	}
+	return notification.Event.ID
+}
+
+type NotificationFilter struct {
+	// Only the notifications of these streams are sent (all when empty)
+	Streams []string
+	// When defined, the events after this ID are sent at subscription
+	LastEventID int64
+}
+
+func (filter *NotificationFilter) Accepts(notification *Notification) bool {
+	if len(filter.Streams) == 0 {
+		return true
+	}
+	for _, stream := range filter.Streams {
+		if stream == notification.Stream {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier watches the EventLog and the streams. New events, stream status
+// transitions and efficiency updates are sent to the receivers.
+//
+// When the EventLog is observable, each appended event is queued and Run
+// sends its notifications without waiting the next check : the streams
+// report their transitions with events ("Connected", "Disconnected", ...).
+// The periodic checks send the efficiency updates and the changes without
+// event.
+//
+// A receiver which doesn't read its notifications is closed (the client can
+// subscribe again from its last event).
+type Notifier struct {
+	Streams  *HttpStreamOutputs
+	EventLog EventCollection
+	// The delay between two checks (500ms by default)
+	Interval time.Duration
+
+	receivers   map[*NotificationReceiver]bool
+	lastEventID int64
+	streams     map[string]*BufferedHttpStreamOutput
+	states      map[string]notifiedStreamState
+	// The appended events, queued by observe for Run
+	observed chan *Event
+	lock     sync.Mutex
+	loops    runLoops
+}
+
+// Enough to contain the events of the default EventLog
+const notificationReceiverSize = 512
+
+type notifiedStreamState struct {
+	AdminStatus       string
+	OperationalStatus string
+	ConnectionStatus  string
+	Efficiency        float64
+	HasEfficiency     bool
+}
+
+func newNotifiedStreamState(stream *BufferedHttpStreamOutput) notifiedStreamState {
+	state := notifiedStreamState{
+		AdminStatus:       stream.AdminStatus(),
+		OperationalStatus: stream.OperationalStatus(),
+		ConnectionStatus:  stream.ConnectionStatus(),
+	}
+	state.Efficiency, state.HasEfficiency = stream.LastEfficiency()
+	return state
+}
+
+func (notifier *Notifier) eventLog() EventCollection {
+	if notifier.EventLog == nil {
+		notifier.EventLog = EventLog
+	}
+	return notifier.EventLog
+}
+
+func (notifier *Notifier) interval() time.Duration {
+	if notifier.Interval == 0 {
+		notifier.Interval = 500 * time.Millisecond
+	}
+	return notifier.Interval
+}
+
+func (notifier *Notifier) Run() {
+	if !notifier.loops.Start() {
+		return
+	}
+	defer notifier.loops.Done()
+
+	notifier.Check()
+
+	notifier.lock.Lock()
+	observed := notifier.observed
+	notifier.lock.Unlock()
+
+	ticker := time.NewTicker(notifier.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-notifier.loops.Stopping():
+			return
+		case event := <-observed:
+			notifier.notifyEvent(event)
+		case <-ticker.C:
+			notifier.Check()
+		}
+	}
+}
+
+// Sends the last notifications, then closes the receivers
+func (notifier *Notifier) Stop() error {
+	notifier.loops.Stop()
+	notifier.loops.Wait()
+
+	notifier.Check()
+
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	for receiver := range notifier.receivers {
+		notifier.closeReceiver(receiver)
+	}
+	return nil
+}
+
+// Records the current events and stream states, without notification
+func (notifier *Notifier) initialize() {
+	for _, event := range notifier.eventLog().Events() {
+		notifier.lastEventID = event.ID
+	}
+
+	notifier.streams = make(map[string]*BufferedHttpStreamOutput)
+	notifier.states = make(map[string]notifiedStreamState)
+	if notifier.Streams != nil {
+		for _, stream := range notifier.Streams.streamList() {
+			notifier.streams[stream.Identifier] = stream
+			notifier.states[stream.Identifier] = newNotifiedStreamState(stream)
+		}
+	}
+
+	if observable, ok := notifier.eventLog().(ObservableEventLog); ok {
+		notifier.observed = make(chan *Event, notificationReceiverSize)
+		observable.Observe(notifier.observe)
+	}
+}
+
+// Sends the notifications of the changes since the previous check
+func (notifier *Notifier) Check() {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	if notifier.states == nil {
+		notifier.initialize()
+		return
+	}
+
+	notifier.checkEvents()
+
+	if notifier.Streams != nil {
+		notifier.checkStreams()
+	}
+}
+
+// Queues the appended event for Run. Invoked by the EventLog (in the stream
+// and audio goroutines) : doesn't block and doesn't lock the notifier. When
+// the queue is full, the event is sent by the next check.
+func (notifier *Notifier) observe(event *Event) {
+	select {
+	case notifier.observed <- event:
+	default:
+	}
+}
+
+// Sends the notifications of the observed event and of the stream it
+// describes
+func (notifier *Notifier) notifyEvent(event *Event) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	notifier.checkEvents()
+
+	if notifier.Streams == nil || !strings.HasPrefix(event.Source, "stream-") {
+		return
+	}
+
+	switch event.Message {
+	case "Created", "Destroyed":
+		notifier.checkStreams()
+	default:
+		if stream, ok := notifier.streams[strings.TrimPrefix(event.Source, "stream-")]; ok {
+			notifier.checkStream(stream)
+		}
+	}
+}
+
+func (notifier *Notifier) checkEvents() {
+	for _, event := range notifier.eventLog().Events() {
+		if event.ID > notifier.lastEventID {
+			notifier.send(newEventNotification(event))
+			notifier.lastEventID = event.ID
+		}
+	}
+}
+
+func (notifier *Notifier) checkStreams() {
+	streams := make(map[string]*BufferedHttpStreamOutput)
+
+	for _, stream := range notifier.Streams.streamList() {
+		streams[stream.Identifier] = stream
+
+		if _, known := notifier.states[stream.Identifier]; !known {
+			notifier.sendStatus(stream.Identifier, "created")
+		}
+		notifier.checkStream(stream)
+	}
+
+	destroyed := []string{}
+	for identifier := range notifier.states {
+		if _, ok := streams[identifier]; !ok {
+			destroyed = append(destroyed, identifier)
+		}
+	}
+	sort.Strings(destroyed)
+	for _, identifier := range destroyed {
+		notifier.sendStatus(identifier, "destroyed")
+		delete(notifier.states, identifier)
+	}
+
+	notifier.streams = streams
+}
+
+func (notifier *Notifier) checkStream(stream *BufferedHttpStreamOutput) {
+	state := newNotifiedStreamState(stream)
+	previousState := notifier.states[stream.Identifier]
+	notifier.states[stream.Identifier] = state
+
+	for _, status := range []struct{ previous, current string }{
+		{previousState.AdminStatus, state.AdminStatus},
+		{previousState.OperationalStatus, state.OperationalStatus},
+		{previousState.ConnectionStatus, state.ConnectionStatus},
+	} {
+		if status.current != status.previous {
+			notifier.sendStatus(stream.Identifier, status.current)
+		}
+	}
+
+	if state.HasEfficiency && (!previousState.HasEfficiency || state.Efficiency != previousState.Efficiency) {
+		efficiency := state.Efficiency
+		notifier.send(&Notification{Type: NotificationEfficiency, Stream: stream.Identifier, Efficiency: &efficiency})
+	}
+}
+
+func (notifier *Notifier) sendStatus(stream string, status string) {
+	notifier.send(&Notification{Type: NotificationStatus, Stream: stream, Status: status})
+}
+
+func (notifier *Notifier) send(notification *Notification) {
+	for receiver := range notifier.receivers {
+		if receiver.Filter.Accepts(notification) && !receiver.push(notification) {
+			Log.Debugf("Close slow notification receiver")
+			notifier.closeReceiver(receiver)
+		}
+	}
+}
+
+// Returns a NotificationReceiver for the notifications accepted by the filter.
+// The events after filter.LastEventID (still in the EventLog) are sent first.
+func (notifier *Notifier) Subscribe(filter NotificationFilter) *NotificationReceiver {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	if notifier.states == nil {
+		notifier.initialize()
+	}
+
+	receiver := &NotificationReceiver{
+		Channel:  make(chan *Notification, notificationReceiverSize),
+		Filter:   filter,
+		notifier: notifier,
+	}
+
+	if filter.LastEventID > 0 {
+		for _, event := range notifier.eventLog().Events() {
+			if event.ID <= filter.LastEventID || event.ID > notifier.lastEventID {
+				continue
+			}
+			if notification := newEventNotification(event); filter.Accepts(notification) {
+				receiver.push(notification)
+			}
+		}
+	}
+
+	if notifier.receivers == nil {
+		notifier.receivers = make(map[*NotificationReceiver]bool)
+	}
+	notifier.receivers[receiver] = true
+	return receiver
+}
+
+func (notifier *Notifier) closeReceiver(receiver *NotificationReceiver) {
+	if notifier.receivers[receiver] {
+		delete(notifier.receivers, receiver)
+		close(receiver.Channel)
+	}
+}
+
+func newEventNotification(event *Event) *Notification {
+	notification := &Notification{Type: NotificationEvent, Event: event}
+	if strings.HasPrefix(event.Source, "stream-") {
+		notification.Stream = strings.TrimPrefix(event.Source, "stream-")
+	}
+	return notification
+}
+
+// The Channel is closed when the receiver is closed
+type NotificationReceiver struct {
+	Channel chan *Notification
+	Filter  NotificationFilter
+
+	notifier *Notifier
+}
+
+// Returns false when the receiver is full
+func (receiver *NotificationReceiver) push(notification *Notification) bool {
+	select {
+	case receiver.Channel <- notification:
+		return true
+	default:
+		return false
+	}
+}
+
+func (receiver *NotificationReceiver) Close() {
+	receiver.notifier.lock.Lock()
+	defer receiver.notifier.lock.Unlock()
+
+	receiver.notifier.closeReceiver(receiver)
+}
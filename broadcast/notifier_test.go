@@ -0,0 +1,263 @@
+package broadcast
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testNotifier() *Notifier {
+	return &Notifier{
+		Streams:  testHttpStreamOutputsController().outputs,
+		EventLog: NewMemoryEventLog(10),
+	}
+}
+
+// Returns the notifications waiting in the receiver
+func testReceivedNotifications(receiver *NotificationReceiver) []Notification {
+	notifications := []Notification{}
+	for {
+		select {
+		case notification, ok := <-receiver.Channel:
+			if !ok {
+				return notifications
+			}
+			notifications = append(notifications, *notification)
+		default:
+			return notifications
+		}
+	}
+}
+
+// Sends the notifications of the queued events (like Run)
+func notifyObservedEvents(notifier *Notifier) {
+	for {
+		select {
+		case event := <-notifier.observed:
+			notifier.notifyEvent(event)
+		default:
+			return
+		}
+	}
+}
+
+func TestNotifier_Check_events(t *testing.T) {
+	notifier := testNotifier()
+	notifier.EventLog.NewEvent("Before subscription")
+
+	receiver := notifier.Subscribe(NotificationFilter{})
+	defer receiver.Close()
+
+	event := (&LocalEventLog{Parent: notifier.EventLog, Source: "stream-mp3"}).NewEvent("Started")
+	notifier.Check()
+
+	notifications := testReceivedNotifications(receiver)
+	expectedNotifications := []Notification{{Type: NotificationEvent, Stream: "mp3", Event: event}}
+	if !reflect.DeepEqual(notifications, expectedNotifications) {
+		t.Errorf("Wrong notifications :\n got: %v\nwant: %v", notifications, expectedNotifications)
+	}
+}
+
+func TestNotifier_Check_streams(t *testing.T) {
+	notifier := testNotifier()
+
+	receiver := notifier.Subscribe(NotificationFilter{})
+	defer receiver.Close()
+
+	notifier.Streams.Stream("mp3").output.disabled = true
+	notifier.Streams.Destroy("ogg")
+	notifier.Streams.Create(&BufferedHttpStreamOutputConfig{HttpStreamOutputConfig: HttpStreamOutputConfig{Target: "http://localhost:8000/new.mp3"}, Identifier: "new"})
+	notifier.Check()
+
+	notifications := testReceivedNotifications(receiver)
+	expectedNotifications := []Notification{
+		{Type: NotificationStatus, Stream: "mp3", Status: "disabled"},
+		{Type: NotificationStatus, Stream: "new", Status: "created"},
+		{Type: NotificationStatus, Stream: "new", Status: "enabled"},
+		{Type: NotificationStatus, Stream: "new", Status: "stopped"},
+		{Type: NotificationStatus, Stream: "new", Status: "disconnected"},
+		{Type: NotificationStatus, Stream: "ogg", Status: "destroyed"},
+	}
+	if !reflect.DeepEqual(notifications, expectedNotifications) {
+		t.Errorf("Wrong notifications :\n got: %v\nwant: %v", notifications, expectedNotifications)
+	}
+
+	notifier.Check()
+	if notifications := testReceivedNotifications(receiver); len(notifications) != 0 {
+		t.Errorf("Unchanged streams should not be notified :\n got: %v", notifications)
+	}
+}
+
+func TestNotifier_observe_reconnect(t *testing.T) {
+	notifier := testNotifier()
+
+	stream := notifier.Streams.Stream("mp3")
+	stream.EventLog = &LocalEventLog{Parent: notifier.EventLog, Source: "stream-mp3"}
+	stream.output.EventLog = stream.EventLog
+
+	receiver := notifier.Subscribe(NotificationFilter{})
+	defer receiver.Close()
+
+	// Disconnected and connected again without Check
+	for i := 0; i < 2; i++ {
+		connection, _ := net.Pipe()
+		stream.output.connection = connection
+		stream.eventLog().NewEvent("Connected")
+		notifyObservedEvents(notifier)
+
+		stream.output.Reset()
+		notifyObservedEvents(notifier)
+	}
+
+	statuses := []string{}
+	for _, notification := range testReceivedNotifications(receiver) {
+		if notification.Type == NotificationStatus {
+			statuses = append(statuses, notification.Status)
+		}
+	}
+	if expected := []string{"connected", "disconnected", "connected", "disconnected"}; !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Each transition should be notified :\n got: %v\nwant: %v", statuses, expected)
+	}
+}
+
+func TestNotifier_observe_repeatedEvent(t *testing.T) {
+	notifier := testNotifier()
+
+	receiver := notifier.Subscribe(NotificationFilter{})
+	defer receiver.Close()
+
+	eventLog := &LocalEventLog{Parent: notifier.EventLog, Source: "stream-mp3"}
+	for i := 0; i < 2; i++ {
+		eventLog.NewEvent("Can't connect")
+		notifyObservedEvents(notifier)
+	}
+
+	occurrences := []int{}
+	for _, notification := range testReceivedNotifications(receiver) {
+		occurrences = append(occurrences, notification.Event.Occurrence)
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(occurrences, expected) {
+		t.Errorf("Repeated event should be notified again :\n got: %v\nwant: %v", occurrences, expected)
+	}
+}
+
+func TestNotifier_observe_locked(t *testing.T) {
+	notifier := testNotifier()
+	notifier.Subscribe(NotificationFilter{})
+
+	// The EventLog callback doesn't wait for the notifier
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	appended := make(chan bool)
+	go func() {
+		for i := 0; i < 2*notificationReceiverSize; i++ {
+			notifier.EventLog.NewEvent("Connected")
+		}
+		close(appended)
+	}()
+
+	select {
+	case <-appended:
+	case <-time.After(time.Second):
+		t.Errorf("Events should be appended while the notifier is locked")
+	}
+}
+
+func TestNotifier_Check_efficiency(t *testing.T) {
+	notifier := testNotifier()
+
+	receiver := notifier.Subscribe(NotificationFilter{})
+	defer receiver.Close()
+
+	notifier.Streams.Stream("mp3").efficiencyMeter.History().Push(0.5)
+	notifier.Check()
+
+	notifications := testReceivedNotifications(receiver)
+	if len(notifications) != 1 || notifications[0].Type != NotificationEfficiency || *notifications[0].Efficiency != 0.5 {
+		t.Errorf("Wrong efficiency notification :\n got: %v", notifications)
+	}
+}
+
+func TestNotifier_Subscribe_filter(t *testing.T) {
+	notifier := testNotifier()
+
+	receiver := notifier.Subscribe(NotificationFilter{Streams: []string{"ogg"}})
+	defer receiver.Close()
+
+	notifier.EventLog.NewEvent("Global event")
+	(&LocalEventLog{Parent: notifier.EventLog, Source: "stream-mp3"}).NewEvent("Started")
+	(&LocalEventLog{Parent: notifier.EventLog, Source: "stream-ogg"}).NewEvent("Started")
+	notifier.Streams.Stream("mp3").output.disabled = true
+	notifier.Check()
+
+	notifications := testReceivedNotifications(receiver)
+	if len(notifications) != 1 || notifications[0].Stream != "ogg" {
+		t.Errorf("Only the notifications of the selected streams should be sent :\n got: %v", notifications)
+	}
+}
+
+func TestNotifier_Subscribe_lastEventID(t *testing.T) {
+	notifier := testNotifier()
+	for _, message := range []string{"First", "Second", "Third"} {
+		notifier.EventLog.NewEvent(message)
+	}
+	notifier.Check()
+
+	receiver := notifier.Subscribe(NotificationFilter{LastEventID: 1})
+	defer receiver.Close()
+
+	notifier.EventLog.NewEvent("Fourth")
+	notifier.Check()
+
+	messages := []string{}
+	for _, notification := range testReceivedNotifications(receiver) {
+		messages = append(messages, notification.Event.Message)
+	}
+	if expected := []string{"Second", "Third", "Fourth"}; !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Events after the last event ID should be sent once :\n got: %v\nwant: %v", messages, expected)
+	}
+}
+
+func TestNotifier_Stop(t *testing.T) {
+	notifier := testNotifier()
+	notifier.Interval = time.Hour
+
+	receiver := notifier.Subscribe(NotificationFilter{})
+	go notifier.Run()
+	time.Sleep(5 * time.Millisecond)
+
+	event := notifier.EventLog.NewEvent("Stopped")
+	notifier.Stop()
+
+	notifications := testReceivedNotifications(receiver)
+	expectedNotifications := []Notification{{Type: NotificationEvent, Event: event}}
+	if !reflect.DeepEqual(notifications, expectedNotifications) {
+		t.Errorf("Last notifications should be sent :\n got: %v\nwant: %v", notifications, expectedNotifications)
+	}
+	if _, ok := <-receiver.Channel; ok {
+		t.Errorf("Receivers should be closed")
+	}
+}
+
+func TestNotifier_slowReceiver(t *testing.T) {
+	notifier := testNotifier()
+	notifier.EventLog = NewMemoryEventLog(notificationReceiverSize * 2)
+
+	receiver := notifier.Subscribe(NotificationFilter{})
+	for i := 0; i <= notificationReceiverSize; i++ {
+		notifier.EventLog.NewEvent("dummy")
+	}
+	notifier.Check()
+
+	if notifications := testReceivedNotifications(receiver); len(notifications) != notificationReceiverSize {
+		t.Errorf("Wrong notification count :\n got: %v\nwant: %v", len(notifications), notificationReceiverSize)
+	}
+	if _, ok := <-receiver.Channel; ok {
+		t.Errorf("Receiver should be closed")
+	}
+
+	// Closing again is harmless
+	receiver.Close()
+}
@@ -84,3 +84,9 @@ func (config *OpusAudioEncoderConfig) Flags(flags *flag.FlagSet, prefix string)
 func (config *OpusAudioEncoderConfig) Apply(opusEncoder *OpusAudioEncoder) {
 	opusEncoder.Bitrate = config.Bitrate
 }
+
+func (config *OpusAudioEncoderConfig) Validate(errors *ConfigErrors) {
+	if config.Bitrate <= 0 {
+		errors.Add("Bitrate", "must be positive")
+	}
+}
@@ -0,0 +1,289 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A PersistentQueue stores jobs as JSON files in Directory, so that they're
+// kept across restarts until processed. Failed jobs are retried with an
+// exponential backoff, at most Concurrency at the same time.
+type PersistentQueue struct {
+	Directory string
+
+	Concurrency int
+	// 0 retries forever
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+
+	// Processes the job stored in the given file
+	Process func(file string) error
+	// Invoked when a job is abandoned after MaxAttempts
+	Failed func(file string, attempts int, err error)
+
+	jobs   map[string]*queuedJob
+	mutex  sync.Mutex
+	notify chan bool
+	loops  runLoops
+}
+
+type queuedJob struct {
+	Attempts    int
+	NextAttempt time.Time
+	InFlight    bool
+	LastError   error
+}
+
+// Describes a job waiting in the queue
+type QueuedJobStatus struct {
+	File        string
+	Attempts    int
+	NextAttempt time.Time `json:",omitempty"`
+	InFlight    bool
+	LastError   string `json:",omitempty"`
+}
+
+func (queue *PersistentQueue) concurrency() int {
+	if queue.Concurrency == 0 {
+		queue.Concurrency = 2
+	}
+	return queue.Concurrency
+}
+
+func (queue *PersistentQueue) Init() error {
+	queue.jobs = make(map[string]*queuedJob)
+	queue.notify = make(chan bool, 1)
+
+	return os.MkdirAll(queue.Directory, 0775)
+}
+
+// Saves a new job in the queue directory
+func (queue *PersistentQueue) Push(job interface{}) error {
+	// File names are sorted by creation
+	fileName := path.Join(queue.Directory, fmt.Sprintf("%020d.json", time.Now().UnixNano()))
+
+	err := queue.Save(fileName, job)
+	if err != nil {
+		return err
+	}
+
+	queue.wakeUp()
+	return nil
+}
+
+// Replaces the content of the given job file (to save a progress, ...)
+func (queue *PersistentQueue) Save(file string, job interface{}) error {
+	jsonBytes, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(file+".tmp", jsonBytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func (queue *PersistentQueue) Load(file string, job interface{}) error {
+	jsonBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, job)
+}
+
+func (queue *PersistentQueue) wakeUp() {
+	select {
+	case queue.notify <- true:
+	default:
+	}
+}
+
+// Returns the queued job files, oldest first
+func (queue *PersistentQueue) Files() ([]string, error) {
+	files, err := filepath.Glob(path.Join(queue.Directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (queue *PersistentQueue) backoff(attempts int) time.Duration {
+	minBackoff, maxBackoff := queue.MinBackoff, queue.MaxBackoff
+	if minBackoff == 0 {
+		minBackoff = 5 * time.Second
+	}
+	if maxBackoff == 0 {
+		maxBackoff = 10 * time.Minute
+	}
+
+	backoff := minBackoff
+	for attempt := 1; attempt < attempts && backoff < maxBackoff; attempt++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// Starts the jobs which are ready, within the concurrency limit.
+// Returns the queued job count.
+func (queue *PersistentQueue) Dispatch(now time.Time) (int, error) {
+	files, err := queue.Files()
+	if err != nil {
+		return 0, err
+	}
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queued := make(map[string]*queuedJob)
+	inFlightCount := 0
+
+	for _, file := range files {
+		job, ok := queue.jobs[file]
+		if !ok {
+			job = &queuedJob{}
+		}
+		queued[file] = job
+
+		if job.InFlight {
+			inFlightCount += 1
+		}
+	}
+	queue.jobs = queued
+
+	for _, file := range files {
+		if inFlightCount >= queue.concurrency() {
+			break
+		}
+
+		job := queued[file]
+		if job.InFlight || job.NextAttempt.After(now) {
+			continue
+		}
+
+		job.InFlight = true
+		inFlightCount += 1
+		go queue.process(file, job)
+	}
+
+	return len(files), nil
+}
+
+func (queue *PersistentQueue) process(file string, job *queuedJob) {
+	err := queue.Process(file)
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	job.InFlight = false
+	job.Attempts += 1
+	job.LastError = err
+
+	if err == nil {
+		os.Remove(file)
+	} else if queue.MaxAttempts > 0 && job.Attempts >= queue.MaxAttempts {
+		os.Rename(file, file+".failed")
+		if queue.Failed != nil {
+			queue.Failed(file, job.Attempts, err)
+		}
+	} else {
+		job.NextAttempt = time.Now().Add(queue.backoff(job.Attempts))
+		Log.Printf("Can't process %s (%v), retry at %v", file, err, job.NextAttempt)
+	}
+
+	queue.wakeUp()
+}
+
+// Returns the jobs known since the last Dispatch
+func (queue *PersistentQueue) Status() []QueuedJobStatus {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	status := make([]QueuedJobStatus, 0, len(queue.jobs))
+	for file, job := range queue.jobs {
+		jobStatus := QueuedJobStatus{
+			File:        file,
+			Attempts:    job.Attempts,
+			NextAttempt: job.NextAttempt,
+			InFlight:    job.InFlight,
+		}
+		if job.LastError != nil {
+			jobStatus.LastError = job.LastError.Error()
+		}
+		status = append(status, jobStatus)
+	}
+
+	sort.Sort(queuedJobStatuses(status))
+	return status
+}
+
+type queuedJobStatuses []QueuedJobStatus
+
+func (statuses queuedJobStatuses) Len() int           { return len(statuses) }
+func (statuses queuedJobStatuses) Swap(i, j int)      { statuses[i], statuses[j] = statuses[j], statuses[i] }
+func (statuses queuedJobStatuses) Less(i, j int) bool { return statuses[i].File < statuses[j].File }
+
+// Waits for new jobs (or retry times) and dispatches them. The given
+// function is invoked after each dispatch with the queued job count.
+func (queue *PersistentQueue) Run(dispatched func(count int)) {
+	if !queue.loops.Start() {
+		return
+	}
+	defer queue.loops.Done()
+
+	stopping := queue.loops.Stopping()
+	for {
+		count, err := queue.Dispatch(time.Now())
+		if err != nil {
+			Log.Printf("Can't read queue %s : %v", queue.Directory, err)
+		} else if dispatched != nil {
+			dispatched(count)
+		}
+
+		if stopping == nil && !queue.busy(time.Now()) {
+			return
+		}
+
+		select {
+		case <-queue.notify:
+		case <-stopping:
+			// The ready jobs are processed before returning
+			stopping = nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Returns true while jobs are processed or ready to be processed
+func (queue *PersistentQueue) busy(now time.Time) bool {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for _, job := range queue.jobs {
+		if job.InFlight || !job.NextAttempt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Processes the ready jobs, then stops the Run loop. The jobs waiting for a
+// retry are kept in Directory for the next start.
+func (queue *PersistentQueue) Stop() error {
+	queue.loops.Stop()
+	queue.loops.Wait()
+	return nil
+}
@@ -0,0 +1,246 @@
+package broadcast
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testPersistentQueue(t *testing.T, process func(file string) error) *PersistentQueue {
+	tempDir, err := ioutil.TempDir("", "persistentqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := &PersistentQueue{Directory: tempDir, Process: process}
+	if err := queue.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return queue
+}
+
+// Dispatches the queued jobs and waits for their end
+func dispatchQueue(queue *PersistentQueue, now time.Time) {
+	queue.Dispatch(now)
+
+	for {
+		select {
+		case <-queue.notify:
+		case <-time.After(time.Second):
+			return
+		}
+
+		inFlight := false
+		for _, status := range queue.Status() {
+			inFlight = inFlight || status.InFlight
+		}
+		if !inFlight {
+			return
+		}
+	}
+}
+
+type testQueueJob struct {
+	Name string
+}
+
+func TestPersistentQueue_Push(t *testing.T) {
+	queue := testPersistentQueue(t, nil)
+	defer os.RemoveAll(queue.Directory)
+
+	queue.Push(&testQueueJob{Name: "first"})
+	queue.Push(&testQueueJob{Name: "second"})
+
+	files, err := queue.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Wrong queued file count :\n got: %v\nwant: %v", len(files), 2)
+	}
+
+	var job testQueueJob
+	queue.Load(files[0], &job)
+	if job.Name != "first" {
+		t.Errorf("Oldest job should be first :\n got: %v\nwant: %v", job.Name, "first")
+	}
+}
+
+func TestPersistentQueue_Dispatch(t *testing.T) {
+	var processedFiles []string
+	var mutex sync.Mutex
+
+	queue := testPersistentQueue(t, func(file string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		processedFiles = append(processedFiles, file)
+		return nil
+	})
+	defer os.RemoveAll(queue.Directory)
+
+	queue.Push(&testQueueJob{Name: "first"})
+	dispatchQueue(queue, time.Now())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(processedFiles) != 1 {
+		t.Errorf("Wrong processed job count :\n got: %v\nwant: %v", len(processedFiles), 1)
+	}
+	if files, _ := queue.Files(); len(files) != 0 {
+		t.Errorf("Processed jobs should be removed from queue :\n got: %v", files)
+	}
+}
+
+func TestPersistentQueue_Dispatch_retry(t *testing.T) {
+	queue := testPersistentQueue(t, func(file string) error {
+		return errors.New("Unavailable")
+	})
+	defer os.RemoveAll(queue.Directory)
+
+	queue.Push(&testQueueJob{Name: "first"})
+
+	now := time.Now()
+	dispatchQueue(queue, now)
+
+	status := queue.Status()
+	if len(status) != 1 {
+		t.Fatalf("Failed job should stay in queue :\n got: %v", status)
+	}
+	if status[0].Attempts != 1 || status[0].LastError != "Unavailable" {
+		t.Errorf("Wrong job status :\n got: %v", status[0])
+	}
+	if !status[0].NextAttempt.After(now) {
+		t.Errorf("Next attempt should be delayed :\n got: %v", status[0].NextAttempt)
+	}
+
+	// Not retried before the backoff
+	dispatchQueue(queue, now)
+	if status := queue.Status(); status[0].Attempts != 1 {
+		t.Errorf("Job should not be retried before backoff :\n got: %v\nwant: %v", status[0].Attempts, 1)
+	}
+}
+
+func TestPersistentQueue_Dispatch_maxAttempts(t *testing.T) {
+	queue := testPersistentQueue(t, func(file string) error {
+		return errors.New("Bad request")
+	})
+	defer os.RemoveAll(queue.Directory)
+
+	var failedAttempts int
+	queue.MaxAttempts = 1
+	queue.Failed = func(file string, attempts int, err error) {
+		failedAttempts = attempts
+	}
+
+	queue.Push(&testQueueJob{Name: "first"})
+	dispatchQueue(queue, time.Now())
+
+	if files, _ := queue.Files(); len(files) != 0 {
+		t.Errorf("Job should be removed from queue after MaxAttempts :\n got: %v", files)
+	}
+	if failedFiles, _ := filepath.Glob(queue.Directory + "/*.failed"); len(failedFiles) != 1 {
+		t.Errorf("Failed job should be kept :\n got: %v", failedFiles)
+	}
+	if failedAttempts != 1 {
+		t.Errorf("Failed function should be invoked :\n got: %v\nwant: %v", failedAttempts, 1)
+	}
+}
+
+func TestPersistentQueue_Dispatch_concurrency(t *testing.T) {
+	release := make(chan bool)
+	queue := testPersistentQueue(t, func(file string) error {
+		<-release
+		return nil
+	})
+	defer os.RemoveAll(queue.Directory)
+	defer close(release)
+
+	queue.Concurrency = 2
+
+	for index := 0; index < 5; index++ {
+		queue.Push(&testQueueJob{})
+	}
+	queue.Dispatch(time.Now())
+	queue.Dispatch(time.Now())
+
+	inFlightCount := 0
+	for _, status := range queue.Status() {
+		if status.InFlight {
+			inFlightCount += 1
+		}
+	}
+	if inFlightCount != 2 {
+		t.Errorf("Wrong in flight count :\n got: %v\nwant: %v", inFlightCount, 2)
+	}
+}
+
+func TestPersistentQueue_Stop(t *testing.T) {
+	queue := testPersistentQueue(t, func(file string) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	defer os.RemoveAll(queue.Directory)
+
+	for i := 0; i < 5; i++ {
+		queue.Push(&testQueueJob{Name: "last"})
+	}
+
+	stopped := make(chan bool)
+	go func() {
+		queue.Run(nil)
+		close(stopped)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	queue.Stop()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Run should return when the queue is stopped")
+	}
+	if files, _ := queue.Files(); len(files) != 0 {
+		t.Errorf("Ready jobs should be processed before stopping :\n got: %v", files)
+	}
+}
+
+func TestPersistentQueue_Stop_retry(t *testing.T) {
+	queue := testPersistentQueue(t, func(file string) error {
+		return errors.New("unavailable")
+	})
+	defer os.RemoveAll(queue.Directory)
+
+	queue.Push(&testQueueJob{Name: "failed"})
+
+	go queue.Run(nil)
+	time.Sleep(5 * time.Millisecond)
+	queue.Stop()
+
+	if files, _ := queue.Files(); len(files) != 1 {
+		t.Errorf("Jobs waiting for a retry should be kept :\n got: %v", files)
+	}
+}
+
+func TestPersistentQueue_backoff(t *testing.T) {
+	queue := PersistentQueue{MinBackoff: time.Second, MaxBackoff: time.Minute}
+
+	conditions := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, time.Minute},
+	}
+
+	for _, condition := range conditions {
+		if backoff := queue.backoff(condition.attempts); backoff != condition.backoff {
+			t.Errorf("Wrong backoff after %d attempts :\n got: %v\nwant: %v", condition.attempts, backoff, condition.backoff)
+		}
+	}
+}
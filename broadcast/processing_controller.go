@@ -31,6 +31,9 @@ func (controller *ProcessingController) ServeHTTP(response http.ResponseWriter,
 		controller.Show(response)
 	case "PUT":
 		controller.Update(response, body)
+	default:
+		response.Header().Set("Allow", "GET, PUT")
+		http.Error(response, "Method not allowed", 405)
 	}
 }
 
@@ -56,7 +59,7 @@ func (controller *ProcessingController) Update(response http.ResponseWriter, bod
 
 	err := json.Unmarshal(body, &config)
 	if err != nil {
-		controller.fatal(response, err)
+		http.Error(response, fmt.Sprintf("Invalid processing: %v", err), 400)
 		return
 	}
 
@@ -47,3 +47,37 @@ func TestProcessingController_Update(t *testing.T) {
 		t.Errorf(" :\n got: %v\nwant: %v", processing.Config().Amplification, 0)
 	}
 }
+
+func TestProcessingController_Update_invalid(t *testing.T) {
+	processing := &Processing{}
+	processing.Setup(&ProcessingConfig{Amplification: 3})
+	controller := NewProcessingController(processing)
+
+	request, _ := http.NewRequest("PUT", "http://localhost:9000/processing.json", strings.NewReader("{\"Amplification\":"))
+
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 400 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 400)
+	}
+	if processing.Config().Amplification != 3 {
+		t.Errorf("Processing should not be changed by an invalid request")
+	}
+}
+
+func TestProcessingController_methodNotAllowed(t *testing.T) {
+	controller := NewProcessingController(&Processing{})
+
+	request, _ := http.NewRequest("DELETE", "http://localhost:9000/processing.json", nil)
+
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 405 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 405)
+	}
+	if allow := response.Header().Get("Allow"); allow != "GET, PUT" {
+		t.Errorf("Wrong Allow header :\n got: %v\nwant: %v", allow, "GET, PUT")
+	}
+}
@@ -3,9 +3,9 @@ package broadcast
 import (
 	"flag"
 	"os"
-	"os/signal"
 	"runtime/pprof"
 	"strings"
+	"sync"
 )
 
 type ProfilerConfig struct {
@@ -24,43 +24,81 @@ func (config *ProfilerConfig) Apply() {
 			FileName: config.CPU,
 			Profiler: &CPUProfiler{},
 		}
-		controller.Start()
+		if err := controller.Start(); err != nil {
+			Log.Printf("Can't start CPU profiler : %v", err)
+		}
 	}
 	if config.Memory != "" {
 		controller := ProfilerController{
 			FileName: config.Memory,
 			Profiler: &MemoryProfiler{},
 		}
-		controller.Start()
+		if err := controller.Start(); err != nil {
+			Log.Printf("Can't start memory profiler : %v", err)
+		}
 	}
 }
 
 type ProfilerController struct {
 	FileName string
 	Profiler Profiler
+
+	file *os.File
 }
 
+// Profilers are global to the process. The started ones are stopped
+// by StopProfilers.
+var (
+	startedProfilers      []*ProfilerController
+	startedProfilersMutex sync.Mutex
+)
+
 func (controller *ProfilerController) Start() error {
 	file, err := os.Create(controller.FileName)
 	if err != nil {
 		return err
 	}
 
+	controller.file = file
 	controller.Profiler.Start(file)
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for sig := range c {
-			Log.Debugf("Receive interrupt signal: %v", sig)
-			controller.Profiler.Stop(file)
-			os.Exit(0)
-		}
-	}()
+	startedProfilersMutex.Lock()
+	startedProfilers = append(startedProfilers, controller)
+	startedProfilersMutex.Unlock()
 
 	return nil
 }
 
+// Writes the profiler output
+func (controller *ProfilerController) Stop() error {
+	if controller.file == nil {
+		return nil
+	}
+
+	Log.Debugf("Write profiler output: %s", controller.FileName)
+	controller.Profiler.Stop(controller.file)
+
+	err := controller.file.Close()
+	controller.file = nil
+	return err
+}
+
+// Stops the started profilers (used in the shutdown sequence)
+func StopProfilers() error {
+	startedProfilersMutex.Lock()
+	defer startedProfilersMutex.Unlock()
+
+	var lastErr error
+	for _, controller := range startedProfilers {
+		if err := controller.Stop(); err != nil {
+			lastErr = err
+		}
+	}
+	startedProfilers = nil
+
+	return lastErr
+}
+
 type Profiler interface {
 	Start(file *os.File)
 	Stop(file *os.File)
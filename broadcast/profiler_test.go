@@ -2,6 +2,8 @@ package broadcast
 
 import (
 	"flag"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
 )
@@ -20,3 +22,29 @@ func TestProfilerConfig_Flags(t *testing.T) {
 		t.Errorf("Wrong config Memory :\n got: %v\nwant: %v", config.Memory, "memory-output")
 	}
 }
+
+func TestStopProfilers(t *testing.T) {
+	file, _ := ioutil.TempFile("", "profiler")
+	file.Close()
+	defer os.Remove(file.Name())
+
+	controller := &ProfilerController{FileName: file.Name(), Profiler: &MemoryProfiler{}}
+	if err := controller.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := StopProfilers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := os.Stat(file.Name())
+	if info.Size() == 0 {
+		t.Errorf("Profiler output should be written")
+	}
+
+	// Profilers are stopped only once
+	if err := StopProfilers(); err != nil {
+		t.Errorf("Stopped profilers should be ignored :\n got: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package broadcast
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+const prometheusNamespace = "go_broadcast"
+
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+// A PrometheusSample is a value in the Prometheus text format
+type PrometheusSample struct {
+	Name   string
+	Type   string // "counter", "gauge" or "summary"
+	Labels map[string]string
+	Value  float64
+}
+
+// A PrometheusCollector provides samples which aren't go-metrics
+// (sound meter levels, buffer fill, ...)
+type PrometheusCollector interface {
+	PrometheusSamples() []PrometheusSample
+}
+
+// A PrometheusHandler exposes the metrics of Registry (metrics.DefaultRegistry
+// by default) and Collectors in the Prometheus text format.
+//
+// The "stream-<identifier>." prefix of metric names becomes a stream label.
+// The last part of the name is the metric name, the other ones become a
+// source label. For example, "stream-mp3.http.Samples" is exposed as
+// go_broadcast_samples_total{source="http",stream="mp3"}.
+type PrometheusHandler struct {
+	Registry   metrics.Registry
+	Collectors []PrometheusCollector
+}
+
+func (handler *PrometheusHandler) registry() metrics.Registry {
+	if handler.Registry == nil {
+		handler.Registry = metrics.DefaultRegistry
+	}
+	return handler.Registry
+}
+
+func (handler *PrometheusHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		http.Error(response, "Method not allowed", 405)
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WritePrometheusSamples(response, handler.Samples())
+}
+
+func (handler *PrometheusHandler) Samples() []PrometheusSample {
+	samples := []PrometheusSample{}
+
+	handler.registry().Each(func(name string, metric interface{}) {
+		samples = append(samples, prometheusMetricSamples(name, metric)...)
+	})
+
+	for _, collector := range handler.Collectors {
+		samples = append(samples, collector.PrometheusSamples()...)
+	}
+
+	return samples
+}
+
+// Converts a go-metrics metric. Unsupported types are ignored.
+func prometheusMetricSamples(metricName string, metric interface{}) []PrometheusSample {
+	name, labels := prometheusName(metricName)
+
+	switch metric := metric.(type) {
+	case metrics.Counter:
+		return []PrometheusSample{{Name: name + "_total", Type: "counter", Labels: labels, Value: float64(metric.Count())}}
+	case metrics.Gauge:
+		return []PrometheusSample{{Name: name, Type: "gauge", Labels: labels, Value: float64(metric.Value())}}
+	case metrics.Histogram:
+		samples := []PrometheusSample{}
+		for index, value := range metric.Percentiles(prometheusQuantiles) {
+			quantileLabels := map[string]string{"quantile": strconv.FormatFloat(prometheusQuantiles[index], 'g', -1, 64)}
+			for key, value := range labels {
+				quantileLabels[key] = value
+			}
+			samples = append(samples, PrometheusSample{Name: name, Type: "summary", Labels: quantileLabels, Value: value})
+		}
+		samples = append(samples,
+			PrometheusSample{Name: name + "_sum", Type: "summary", Labels: labels, Value: float64(metric.Sum())},
+			PrometheusSample{Name: name + "_count", Type: "summary", Labels: labels, Value: float64(metric.Count())},
+		)
+		return samples
+	}
+
+	return nil
+}
+
+var (
+	prometheusCamelCasePattern    = regexp.MustCompile("([a-z0-9])([A-Z])")
+	prometheusInvalidCharsPattern = regexp.MustCompile("[^a-zA-Z0-9_]")
+)
+
+// Returns "go_broadcast_<name>" in snake case
+func prometheusMetricName(name string) string {
+	return strings.Join([]string{prometheusNamespace, prometheusSnakeCase(name)}, "_")
+}
+
+func prometheusSnakeCase(name string) string {
+	name = prometheusCamelCasePattern.ReplaceAllString(name, "${1}_${2}")
+	return strings.ToLower(prometheusInvalidCharsPattern.ReplaceAllString(name, "_"))
+}
+
+// Returns the Prometheus name and labels of a go-metrics name
+func prometheusName(metricName string) (string, map[string]string) {
+	labels := make(map[string]string)
+
+	if strings.HasPrefix(metricName, "stream-") {
+		if separator := strings.Index(metricName, "."); separator > 0 {
+			labels["stream"] = metricName[len("stream-"):separator]
+			metricName = metricName[separator+1:]
+		}
+	}
+
+	parts := strings.Split(metricName, ".")
+	if len(parts) > 1 {
+		labels["source"] = prometheusSnakeCase(strings.Join(parts[:len(parts)-1], "_"))
+	}
+
+	return prometheusMetricName(parts[len(parts)-1]), labels
+}
+
+func prometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[key])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Returns the family of a sample (the summary name for _sum and _count)
+func prometheusFamily(sample PrometheusSample) string {
+	if sample.Type == "summary" {
+		return strings.TrimSuffix(strings.TrimSuffix(sample.Name, "_sum"), "_count")
+	}
+	return sample.Name
+}
+
+// Writes the samples grouped by metric family (sorted by name)
+func WritePrometheusSamples(writer io.Writer, samples []PrometheusSample) error {
+	families := make(map[string][]PrometheusSample)
+	for _, sample := range samples {
+		family := prometheusFamily(sample)
+		families[family] = append(families[family], sample)
+	}
+
+	names := []string{}
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	for _, name := range names {
+		familySamples := families[name]
+		sort.SliceStable(familySamples, func(i, j int) bool {
+			return prometheusLabels(familySamples[i].Labels) < prometheusLabels(familySamples[j].Labels)
+		})
+
+		fmt.Fprintf(&buffer, "# TYPE %s %s\n", name, familySamples[0].Type)
+		for _, sample := range familySamples {
+			fmt.Fprintf(&buffer, "%s%s %s\n", sample.Name, prometheusLabels(sample.Labels), strconv.FormatFloat(sample.Value, 'g', -1, 64))
+		}
+	}
+
+	_, err := writer.Write(buffer.Bytes())
+	return err
+}
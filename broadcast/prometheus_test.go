@@ -0,0 +1,115 @@
+package broadcast
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+func TestPrometheusName(t *testing.T) {
+	conditions := []struct {
+		metricName string
+		name       string
+		labels     map[string]string
+	}{
+		{"Queue", "go_broadcast_queue", map[string]string{}},
+		{"alsa.input.Samples", "go_broadcast_samples", map[string]string{"source": "alsa_input"}},
+		{"stream-mp3.http.ConnectionDuration", "go_broadcast_connection_duration", map[string]string{"source": "http", "stream": "mp3"}},
+		{"stream-mp3.Efficiency", "go_broadcast_efficiency", map[string]string{"stream": "mp3"}},
+		{"alsa-input.Restarts", "go_broadcast_restarts", map[string]string{"source": "alsa_input"}},
+		{"upload.UploadedBytes", "go_broadcast_uploaded_bytes", map[string]string{"source": "upload"}},
+	}
+
+	for _, condition := range conditions {
+		name, labels := prometheusName(condition.metricName)
+		if name != condition.name || !reflect.DeepEqual(labels, condition.labels) {
+			t.Errorf("Wrong Prometheus name for %s :\n got: %v %v\nwant: %v %v", condition.metricName, name, labels, condition.name, condition.labels)
+		}
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	labels := prometheusLabels(map[string]string{"stream": `my "live"`, "source": "http"})
+	expectedLabels := `{source="http",stream="my \"live\""}`
+	if labels != expectedLabels {
+		t.Errorf("Wrong labels :\n got: %v\nwant: %v", labels, expectedLabels)
+	}
+}
+
+func TestWritePrometheusSamples(t *testing.T) {
+	samples := []PrometheusSample{
+		{Name: "go_broadcast_samples_total", Type: "counter", Labels: map[string]string{"stream": "ogg"}, Value: 2048},
+		{Name: "go_broadcast_buffer_fill", Type: "gauge", Labels: map[string]string{"stream": "mp3"}, Value: 0.5},
+		{Name: "go_broadcast_samples_total", Type: "counter", Labels: map[string]string{"stream": "mp3"}, Value: 1024},
+	}
+
+	var buffer bytes.Buffer
+	if err := WritePrometheusSamples(&buffer, samples); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedOutput := strings.Join([]string{
+		"# TYPE go_broadcast_buffer_fill gauge",
+		`go_broadcast_buffer_fill{stream="mp3"} 0.5`,
+		"# TYPE go_broadcast_samples_total counter",
+		`go_broadcast_samples_total{stream="mp3"} 1024`,
+		`go_broadcast_samples_total{stream="ogg"} 2048`,
+		"",
+	}, "\n")
+	if buffer.String() != expectedOutput {
+		t.Errorf("Wrong output :\n got: %v\nwant: %v", buffer.String(), expectedOutput)
+	}
+}
+
+func TestPrometheusHandler_ServeHTTP(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("stream-mp3.http.Samples", registry).Inc(1024)
+	metrics.GetOrRegisterGauge("upload.Queue", registry).Update(3)
+	metrics.GetOrRegisterHistogram("stream-mp3.buffer.SizeHistory", registry, metrics.NewExpDecaySample(1028, 0.015)).Update(10)
+
+	soundMeter := &SoundMeterAudioHandler{lastMetrics: &SoundMetrics{ChannelMetrics: []SoundChannelMetrics{{PeakLevel: 0.5}}}}
+	handler := &PrometheusHandler{Registry: registry, Collectors: []PrometheusCollector{soundMeter}}
+
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+	if response.Header().Get("Content-Type") != "text/plain; version=0.0.4" {
+		t.Errorf("Wrong Content-Type :\n got: %v", response.Header().Get("Content-Type"))
+	}
+
+	expectedLines := []string{
+		"# TYPE go_broadcast_samples_total counter",
+		`go_broadcast_samples_total{source="http",stream="mp3"} 1024`,
+		"# TYPE go_broadcast_queue gauge",
+		`go_broadcast_queue{source="upload"} 3`,
+		"# TYPE go_broadcast_size_history summary",
+		`go_broadcast_size_history_count{source="buffer",stream="mp3"} 1`,
+		`go_broadcast_sound_peak_level{channel="1"} 0.5`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(response.Body.String(), line+"\n") {
+			t.Errorf("Missing line in output :\n got: %v\nwant: %v", response.Body.String(), line)
+		}
+	}
+}
+
+func TestPrometheusHandler_ServeHTTP_methodNotAllowed(t *testing.T) {
+	handler := &PrometheusHandler{Registry: metrics.NewRegistry()}
+
+	request, _ := http.NewRequest("POST", "/metrics", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != 405 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 405)
+	}
+}
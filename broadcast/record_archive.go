@@ -0,0 +1,483 @@
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordArchive reads the files saved by TimedFileOutput
+// (2006/01-Jan/02-Mon/15h04.wav) under RootDirectory.
+//
+// The mp3 and ogg/vorbis recordings are decoded. Their sample rate and
+// channel count aren't read from the files : they are supposed to be the
+// SampleRate and ChannelCount of the archive (the ones of the
+// TimedFileOutput). The aac recordings can't be read.
+type RecordArchive struct {
+	RootDirectory string
+
+	SampleRate   int
+	ChannelCount int
+
+	encodedDurations map[string]encodedDuration
+	mutex            sync.Mutex
+}
+
+// The duration of an encoded recording is computed by decoding the whole
+// file. It's decoded again when the file is modified.
+type encodedDuration struct {
+	Size     int64
+	ModTime  time.Time
+	Duration time.Duration
+}
+
+type Recording struct {
+	Path     string
+	Start    time.Time
+	Duration time.Duration
+	Size     int64
+}
+
+func (recording *Recording) End() time.Time {
+	return recording.Start.Add(recording.Duration)
+}
+
+type Recordings []Recording
+
+func (recordings Recordings) Len() int { return len(recordings) }
+func (recordings Recordings) Swap(i, j int) {
+	recordings[i], recordings[j] = recordings[j], recordings[i]
+}
+func (recordings Recordings) Less(i, j int) bool {
+	return recordings[i].Start.Before(recordings[j].Start)
+}
+
+const recordDayFormat = "2006/01-Jan/02-Mon"
+
+// Returns the days (as 2006-01-02) which contain recordings
+func (archive *RecordArchive) Days() ([]string, error) {
+	directories, err := filepath.Glob(path.Join(archive.RootDirectory, "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]string, 0)
+	for _, directory := range directories {
+		relativePath, _ := filepath.Rel(archive.RootDirectory, directory)
+		day, err := time.Parse(recordDayFormat, relativePath)
+		if err == nil {
+			days = append(days, day.Format("2006-01-02"))
+		}
+	}
+
+	sort.Strings(days)
+	return days, nil
+}
+
+func parseRecordingStart(day time.Time, fileName string) (time.Time, error) {
+	name := strings.TrimSuffix(fileName, path.Ext(fileName))
+
+	for _, format := range []string{"15h04m05", "15h04"} {
+		clock, err := time.Parse(format, name)
+		if err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Not a recording file name: %s", fileName)
+}
+
+// Returns the recordings of the given day, sorted by start time
+func (archive *RecordArchive) Recordings(day time.Time) (Recordings, error) {
+	directory := path.Join(archive.RootDirectory, day.Format(recordDayFormat))
+
+	files, err := filepath.Glob(path.Join(directory, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := Recordings{}
+	for _, file := range files {
+		start, err := parseRecordingStart(day, path.Base(file))
+		if err != nil {
+			continue
+		}
+
+		fileInfo, err := os.Stat(file)
+		if err != nil || !fileInfo.Mode().IsRegular() {
+			continue
+		}
+
+		relativePath, _ := filepath.Rel(archive.RootDirectory, file)
+		recording := Recording{Path: relativePath, Start: start, Size: fileInfo.Size()}
+		recording.Duration = archive.duration(recording, fileInfo)
+
+		recordings = append(recordings, recording)
+	}
+
+	sort.Sort(recordings)
+
+	// Without readable duration, a recording is supposed to stop when the next one starts
+	for index := 0; index < len(recordings)-1; index++ {
+		if recordings[index].Duration == 0 {
+			recordings[index].Duration = recordings[index+1].Start.Sub(recordings[index].Start)
+		}
+	}
+
+	return recordings, nil
+}
+
+// Returns the recordings which overlap the given time range
+func (archive *RecordArchive) RecordingsBetween(from time.Time, to time.Time) (Recordings, error) {
+	from, to = from.UTC(), to.UTC()
+	recordings := Recordings{}
+
+	// A recording which covers the range start can begin the day before
+	firstDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	for day := firstDay; day.Before(to); day = day.AddDate(0, 0, 1) {
+		dayRecordings, err := archive.Recordings(day)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, recording := range dayRecordings {
+			if recording.Start.Before(to) && recording.End().After(from) {
+				recordings = append(recordings, recording)
+			}
+		}
+	}
+
+	return recordings, nil
+}
+
+// A RecordExport reads the audio between From and To, stitched across
+// the recordings. Missing parts are replaced by silence.
+type RecordExport struct {
+	Archive *RecordArchive
+	From    time.Time
+	To      time.Time
+
+	SampleRate   int
+	ChannelCount int
+
+	recordings Recordings
+}
+
+func (export *RecordExport) Init() error {
+	if !export.To.After(export.From) {
+		return errors.New("The export end should be after its start")
+	}
+
+	recordings, err := export.Archive.RecordingsBetween(export.From, export.To)
+	if err != nil {
+		return err
+	}
+	export.recordings = recordings
+
+	for _, recording := range recordings {
+		sampleRate, channelCount, err := export.Archive.format(recording)
+		if err == nil {
+			export.SampleRate = sampleRate
+			export.ChannelCount = channelCount
+			return nil
+		}
+	}
+
+	return errors.New("No readable recording in this time range")
+}
+
+func (archive *RecordArchive) path(recording Recording) string {
+	return path.Join(archive.RootDirectory, recording.Path)
+}
+
+// Returns the encoding of the mp3 and ogg recordings, an empty string
+// for the files read by libsndfile
+func recordingEncoding(recording Recording) string {
+	switch path.Ext(recording.Path) {
+	case ".mp3":
+		return "mp3"
+	case ".ogg":
+		return "ogg/vorbis"
+	}
+	return ""
+}
+
+// Returns the sample rate and the channel count of the recording
+func (archive *RecordArchive) format(recording Recording) (int, int, error) {
+	if recordingEncoding(recording) != "" {
+		if archive.SampleRate <= 0 || archive.ChannelCount <= 0 {
+			return 0, 0, fmt.Errorf("Unknown format of encoded recording %s", recording.Path)
+		}
+		return archive.SampleRate, archive.ChannelCount, nil
+	}
+
+	sndFile, err := SndFileOpen(archive.path(recording), O_RDONLY, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer sndFile.Close()
+
+	return sndFile.Info().SampleRate(), sndFile.Info().Channels(), nil
+}
+
+// Returns the recording duration or 0 if the recording can't be read
+func (archive *RecordArchive) duration(recording Recording, fileInfo os.FileInfo) time.Duration {
+	if recordingEncoding(recording) == "" {
+		sndFile, err := SndFileOpen(archive.path(recording), O_RDONLY, nil)
+		if err != nil {
+			return 0
+		}
+		defer sndFile.Close()
+
+		info := sndFile.Info()
+		if info.SampleRate() <= 0 {
+			return 0
+		}
+		return time.Duration(float64(info.Frames()) / float64(info.SampleRate()) * float64(time.Second))
+	}
+
+	if archive.SampleRate <= 0 {
+		return 0
+	}
+
+	archive.mutex.Lock()
+	cached, ok := archive.encodedDurations[recording.Path]
+	archive.mutex.Unlock()
+
+	if ok && cached.Size == fileInfo.Size() && cached.ModTime.Equal(fileInfo.ModTime()) {
+		return cached.Duration
+	}
+
+	counter := &recordingReader{}
+	err := archive.decode(recording, counter)
+	if err != nil {
+		Log.Printf("Can't decode recording %s : %v", recording.Path, err)
+		return 0
+	}
+	duration := time.Duration(float64(counter.position) / float64(archive.SampleRate) * float64(time.Second))
+
+	archive.mutex.Lock()
+	if archive.encodedDurations == nil {
+		archive.encodedDurations = make(map[string]encodedDuration)
+	}
+	archive.encodedDurations[recording.Path] = encodedDuration{Size: fileInfo.Size(), ModTime: fileInfo.ModTime(), Duration: duration}
+	archive.mutex.Unlock()
+
+	return duration
+}
+
+// Decodes the encoded recording until its end or until the reader is done
+func (archive *RecordArchive) decode(recording Recording, reader *recordingReader) error {
+	decoder := NewStreamDecoder(recordingEncoding(recording))
+	if decoder == nil {
+		return fmt.Errorf("Unsupported recording: %s", recording.Path)
+	}
+
+	file, err := os.Open(archive.path(recording))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder.SetAudioHandler(reader)
+	err = decoder.Init()
+	if err != nil {
+		return err
+	}
+	defer decoder.Reset()
+
+	for !reader.done() {
+		err = decoder.Read(file)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A recordingReader sends the decoded frames between From and To (frame
+// positions in the recording) to its Output. Without Output, the decoded
+// frames are only counted.
+type recordingReader struct {
+	Output       AudioHandler
+	From         int64
+	To           int64
+	ChannelCount int
+
+	position int64
+	read     int64
+	invalid  bool
+}
+
+func (reader *recordingReader) done() bool {
+	return reader.invalid || (reader.Output != nil && reader.position >= reader.To)
+}
+
+func (reader *recordingReader) AudioOut(audio *Audio) {
+	start := reader.position
+	reader.position += int64(audio.SampleCount())
+
+	if reader.Output == nil || reader.invalid {
+		return
+	}
+	if audio.ChannelCount() != reader.ChannelCount {
+		reader.invalid = true
+		return
+	}
+
+	from, to := reader.From-start, reader.To-start
+	if from < 0 {
+		from = 0
+	}
+	if to > int64(audio.SampleCount()) {
+		to = int64(audio.SampleCount())
+	}
+	if from >= to {
+		return
+	}
+
+	if from > 0 || to < int64(audio.SampleCount()) {
+		part := NewAudio(int(to-from), audio.ChannelCount())
+		for channel := 0; channel < audio.ChannelCount(); channel++ {
+			part.SetSamples(channel, audio.Samples(channel)[from:to])
+		}
+		audio = part
+	}
+
+	reader.Output.AudioOut(audio)
+	reader.read += to - from
+}
+
+func (export *RecordExport) frame(timestamp time.Time) int64 {
+	return int64(timestamp.Sub(export.From).Seconds() * float64(export.SampleRate))
+}
+
+func (export *RecordExport) SampleCount() int64 {
+	return export.frame(export.To)
+}
+
+func (export *RecordExport) Recordings() Recordings {
+	return export.recordings
+}
+
+func (export *RecordExport) silence(output AudioHandler, sampleCount int64) {
+	for sampleCount > 0 {
+		length := int64(1024)
+		if sampleCount < length {
+			length = sampleCount
+		}
+
+		output.AudioOut(NewAudio(int(length), export.ChannelCount))
+		sampleCount -= length
+	}
+}
+
+// Reads the recording frames between position and end. Returns the read frame count
+func (export *RecordExport) read(output AudioHandler, recording Recording, position int64, end int64) int64 {
+	if recordingEncoding(recording) != "" {
+		return export.decode(output, recording, position, end)
+	}
+
+	sndFile, err := SndFileOpen(export.Archive.path(recording), O_RDONLY, nil)
+	if err != nil {
+		Log.Printf("Can't read recording %s : %v", recording.Path, err)
+		return 0
+	}
+	defer sndFile.Close()
+
+	if sndFile.Info().SampleRate() != export.SampleRate || sndFile.Info().Channels() != export.ChannelCount {
+		Log.Printf("Ignore recording %s with different format", recording.Path)
+		return 0
+	}
+
+	err = sndFile.SeekFrame(position - export.frame(recording.Start))
+	if err != nil {
+		Log.Printf("Can't seek in recording %s : %v", recording.Path, err)
+		return 0
+	}
+
+	var readFrameCount int64
+	samples := make([]float32, 1024*export.ChannelCount)
+
+	for position+readFrameCount < end {
+		length := int64(1024)
+		if remaining := end - position - readFrameCount; remaining < length {
+			length = remaining
+		}
+
+		frameCount := sndFile.ReadFloat(samples[:length*int64(export.ChannelCount)]) / int64(export.ChannelCount)
+		if frameCount <= 0 {
+			break
+		}
+
+		audio := NewAudio(int(frameCount), export.ChannelCount)
+		audio.LoadInterleavedFloats(samples, int(frameCount), export.ChannelCount)
+		output.AudioOut(audio)
+
+		readFrameCount += frameCount
+	}
+
+	return readFrameCount
+}
+
+// Decodes the encoded recording frames between position and end. The
+// decoded frames before position are dropped.
+func (export *RecordExport) decode(output AudioHandler, recording Recording, position int64, end int64) int64 {
+	if export.Archive.SampleRate != export.SampleRate || export.Archive.ChannelCount != export.ChannelCount {
+		Log.Printf("Ignore recording %s with different format", recording.Path)
+		return 0
+	}
+
+	start := export.frame(recording.Start)
+	reader := &recordingReader{
+		Output:       output,
+		From:         position - start,
+		To:           end - start,
+		ChannelCount: export.ChannelCount,
+	}
+
+	err := export.Archive.decode(recording, reader)
+	if err != nil {
+		Log.Printf("Can't decode recording %s : %v", recording.Path, err)
+	}
+	if reader.invalid {
+		Log.Printf("Ignore recording %s with different channel count", recording.Path)
+	}
+
+	return reader.read
+}
+
+func (export *RecordExport) Run(output AudioHandler) {
+	var position int64
+	sampleCount := export.SampleCount()
+
+	for _, recording := range export.recordings {
+		start := export.frame(recording.Start)
+		end := export.frame(recording.End())
+		if end > sampleCount {
+			end = sampleCount
+		}
+		if end <= position {
+			continue
+		}
+
+		if start > position {
+			export.silence(output, start-position)
+			position = start
+		}
+
+		position += export.read(output, recording, position, end)
+	}
+
+	export.silence(output, sampleCount-position)
+}
@@ -0,0 +1,160 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type RecordArchiveController struct {
+	archive *RecordArchive
+
+	MaxExportDuration time.Duration
+}
+
+func NewRecordArchiveController(archive *RecordArchive) *RecordArchiveController {
+	return &RecordArchiveController{archive: archive, MaxExportDuration: 24 * time.Hour}
+}
+
+func (controller *RecordArchiveController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+	dayPathPattern := regexp.MustCompile("^/records/([0-9]{4}-[0-9]{2}-[0-9]{2}).json$")
+
+	if request.Method != "GET" {
+		http.Error(response, "Method not allowed", 405)
+		return
+	}
+
+	switch {
+	case path == "/records.json":
+		controller.Index(response)
+	case dayPathPattern.MatchString(path):
+		controller.Show(response, dayPathPattern.FindStringSubmatch(path)[1])
+	case path == "/records/export":
+		query := request.URL.Query()
+		controller.Export(response, query.Get("from"), query.Get("to"), query.Get("format"))
+	default:
+		http.NotFound(response, request)
+	}
+}
+
+func (controller *RecordArchiveController) Index(response http.ResponseWriter) {
+	response.Header().Set("Content-Type", "application/json")
+
+	days, err := controller.archive.Days()
+	if err != nil {
+		controller.fatal(response, err)
+		return
+	}
+
+	jsonBytes, _ := json.Marshal(days)
+	response.Write(jsonBytes)
+}
+
+func (controller *RecordArchiveController) Show(response http.ResponseWriter, date string) {
+	response.Header().Set("Content-Type", "application/json")
+
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		http.Error(response, fmt.Sprintf("Invalid date: '%s'", date), 400)
+		return
+	}
+
+	recordings, err := controller.archive.Recordings(day)
+	if err != nil {
+		controller.fatal(response, err)
+		return
+	}
+
+	jsonBytes, _ := json.Marshal(recordings)
+	response.Write(jsonBytes)
+}
+
+// Accepts RFC3339 times or 2006-01-02T15:04:05 (UTC) times
+func parseExportTime(value string) (time.Time, error) {
+	for _, format := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		timestamp, err := time.Parse(format, value)
+		if err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time: '%s'", value)
+}
+
+func (controller *RecordArchiveController) Export(response http.ResponseWriter, fromValue string, toValue string, formatValue string) {
+	from, err := parseExportTime(fromValue)
+	if err != nil {
+		http.Error(response, err.Error(), 400)
+		return
+	}
+	to, err := parseExportTime(toValue)
+	if err != nil {
+		http.Error(response, err.Error(), 400)
+		return
+	}
+	if controller.MaxExportDuration > 0 && to.Sub(from) > controller.MaxExportDuration {
+		http.Error(response, fmt.Sprintf("Export can't exceed %v", controller.MaxExportDuration), 400)
+		return
+	}
+
+	export := &RecordExport{Archive: controller.archive, From: from, To: to}
+	err = export.Init()
+	if err != nil {
+		http.Error(response, err.Error(), 404)
+		return
+	}
+
+	var encoder StreamEncoder
+	var extension string
+
+	if formatValue == "" || formatValue == "wav" {
+		wavWriter := &WavWriter{
+			Writer:       response,
+			SampleRate:   export.SampleRate,
+			ChannelCount: export.ChannelCount,
+			SampleCount:  export.SampleCount(),
+		}
+		encoder, extension = wavWriter, "wav"
+
+		response.Header().Set("Content-Type", "audio/wav")
+		response.Header().Set("Content-Length", strconv.FormatInt(wavWriter.Size(), 10))
+	} else {
+		format := ParseAudioFormat(formatValue)
+		format.SampleRate = export.SampleRate
+		format.ChannelCount = export.ChannelCount
+
+		timedFileFormat, err := ParseTimedFileFormat(formatValue)
+		if err != nil || !timedFileFormat.IsEncoded() {
+			http.Error(response, fmt.Sprintf("Unsupported format: '%s'", formatValue), 400)
+			return
+		}
+
+		encoder, extension = NewStreamEncoder(format, response), timedFileFormat.Extension
+		response.Header().Set("Content-Type", format.ContentType())
+	}
+
+	fileName := fmt.Sprintf("%s-%s.%s", from.UTC().Format("20060102-150405"), to.UTC().Format("150405"), extension)
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+
+	Log.Printf("Export records from %v to %v (%d recording(s))", from, to, len(export.Recordings()))
+
+	err = encoder.Init()
+	if err != nil {
+		controller.fatal(response, err)
+		return
+	}
+
+	export.Run(encoder)
+
+	if flushable, ok := encoder.(Flushable); ok {
+		flushable.Flush()
+	}
+	encoder.Close()
+}
+
+func (controller *RecordArchiveController) fatal(response http.ResponseWriter, err error) {
+	http.Error(response, fmt.Sprintf("Unknown error: %v", err), 500)
+}
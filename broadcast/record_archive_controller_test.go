@@ -0,0 +1,89 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRecordArchiveController_Index(t *testing.T) {
+	archive := testRecordArchive(t)
+	defer os.RemoveAll(archive.RootDirectory)
+	controller := NewRecordArchiveController(archive)
+
+	request, _ := http.NewRequest("GET", "http://localhost:9000/records.json", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Fatalf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+
+	days := []string{}
+	json.Unmarshal(response.Body.Bytes(), &days)
+	if len(days) != 2 {
+		t.Errorf("Wrong day count :\n got: %v\nwant: %v", len(days), 2)
+	}
+}
+
+func TestRecordArchiveController_Show(t *testing.T) {
+	archive := testRecordArchive(t)
+	defer os.RemoveAll(archive.RootDirectory)
+	controller := NewRecordArchiveController(archive)
+
+	request, _ := http.NewRequest("GET", "http://localhost:9000/records/2015-05-20.json", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Fatalf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+
+	recordings := []Recording{}
+	json.Unmarshal(response.Body.Bytes(), &recordings)
+	if len(recordings) != 3 {
+		t.Errorf("Wrong recording count :\n got: %v\nwant: %v", len(recordings), 3)
+	}
+}
+
+func TestRecordArchiveController_Export(t *testing.T) {
+	archive := testRecordArchive(t)
+	defer os.RemoveAll(archive.RootDirectory)
+	controller := NewRecordArchiveController(archive)
+
+	request, _ := http.NewRequest("GET", "http://localhost:9000/records/export?from=2015-05-20T14:01:00&to=2015-05-20T14:01:10", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Fatalf("Wrong response code (%s):\n got: %v\nwant: %v", response.Body.String(), response.Code, 200)
+	}
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "audio/wav" {
+		t.Errorf("Wrong content type :\n got: %v\nwant: %v", contentType, "audio/wav")
+	}
+	// 10 seconds, 1000Hz, 2 channels, 16 bits
+	if expectedLength := 44 + 10*1000*2*2; response.Body.Len() != expectedLength {
+		t.Errorf("Wrong body length :\n got: %v\nwant: %v", response.Body.Len(), expectedLength)
+	}
+}
+
+func TestRecordArchiveController_Export_invalid(t *testing.T) {
+	controller := NewRecordArchiveController(&RecordArchive{})
+
+	var urls = []string{
+		"http://localhost:9000/records/export?from=dummy&to=2015-05-20T14:01:10",
+		"http://localhost:9000/records/export?from=2015-05-20T14:01:00&to=2015-05-22T14:01:10",
+	}
+	for _, url := range urls {
+		request, _ := http.NewRequest("GET", url, nil)
+		response := httptest.NewRecorder()
+		controller.ServeHTTP(response, request)
+
+		if response.Code != 400 {
+			t.Errorf("Wrong response code for %s :\n got: %v\nwant: %v", url, response.Code, 400)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func writeTestRecording(t *testing.T, fileName string, sampleCount int, value float32) {
+	os.MkdirAll(path.Dir(fileName), 0775)
+
+	var fileInfo Info
+	fileInfo.SetSampleRate(1000)
+	fileInfo.SetChannels(2)
+	fileInfo.SetFormat(FORMAT_WAV | FORMAT_FLOAT)
+
+	file, err := SndFileOpen(fileName, O_WRONLY, &fileInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	audio := NewAudio(sampleCount, 2)
+	audio.Process(func(_ int, _ int, _ float32) float32 { return value })
+	file.Write(audio)
+}
+
+func testRecordArchive(t *testing.T) *RecordArchive {
+	tempDir, err := ioutil.TempDir("", "recordarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 14h00m30 -> 14h01, 14h01 -> 14h02, (missing 14h02), 14h03 -> 14h04
+	writeTestRecording(t, path.Join(tempDir, "2015/05-May/20-Wed/14h00m30.wav"), 30000, 0.1)
+	writeTestRecording(t, path.Join(tempDir, "2015/05-May/20-Wed/14h01.wav"), 60000, 0.2)
+	writeTestRecording(t, path.Join(tempDir, "2015/05-May/20-Wed/14h03.wav"), 60000, 0.3)
+	writeTestRecording(t, path.Join(tempDir, "2015/05-May/21-Thu/00h00.wav"), 1000, 0.4)
+
+	return &RecordArchive{RootDirectory: tempDir}
+}
+
+func TestRecordArchive_Days(t *testing.T) {
+	archive := testRecordArchive(t)
+	defer os.RemoveAll(archive.RootDirectory)
+
+	days, err := archive.Days()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(days) != 2 || days[0] != "2015-05-20" || days[1] != "2015-05-21" {
+		t.Errorf("Wrong days :\n got: %v\nwant: %v", days, []string{"2015-05-20", "2015-05-21"})
+	}
+}
+
+func TestRecordArchive_Recordings(t *testing.T) {
+	archive := testRecordArchive(t)
+	defer os.RemoveAll(archive.RootDirectory)
+
+	recordings, err := archive.Recordings(time.Date(2015, 5, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recordings) != 3 {
+		t.Fatalf("Wrong recording count :\n got: %v\nwant: %v", len(recordings), 3)
+	}
+
+	expectedStart := time.Date(2015, 5, 20, 14, 0, 30, 0, time.UTC)
+	if !recordings[0].Start.Equal(expectedStart) {
+		t.Errorf("Wrong recording start :\n got: %v\nwant: %v", recordings[0].Start, expectedStart)
+	}
+	if recordings[0].Duration != 30*time.Second {
+		t.Errorf("Wrong recording duration :\n got: %v\nwant: %v", recordings[0].Duration, 30*time.Second)
+	}
+	if recordings[1].Path != "2015/05-May/20-Wed/14h01.wav" {
+		t.Errorf("Wrong recording path :\n got: %v\nwant: %v", recordings[1].Path, "2015/05-May/20-Wed/14h01.wav")
+	}
+}
+
+func TestRecordArchive_Recordings_encoded(t *testing.T) {
+	archive := &RecordArchive{RootDirectory: "testdata", SampleRate: 48000, ChannelCount: 2}
+
+	recording := Recording{Path: "sine-48000.mp3"}
+	fileInfo, err := os.Stat(archive.path(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duration := archive.duration(recording, fileInfo); duration <= 0 {
+		t.Errorf("Encoded recording duration should be decoded :\n got: %v", duration)
+	}
+	if sampleRate, channelCount, err := archive.format(recording); err != nil || sampleRate != 48000 || channelCount != 2 {
+		t.Errorf("Wrong encoded recording format :\n got: %v/%v (%v)\nwant: 48000/2", sampleRate, channelCount, err)
+	}
+}
+
+func TestRecordingReader_AudioOut(t *testing.T) {
+	var output []*Audio
+	reader := &recordingReader{
+		Output:       AudioHandlerFunc(func(audio *Audio) { output = append(output, audio) }),
+		From:         100,
+		To:           2500,
+		ChannelCount: 2,
+	}
+
+	for !reader.done() {
+		reader.AudioOut(NewAudio(1024, 2))
+	}
+
+	if reader.read != 2400 {
+		t.Errorf("Wrong read frame count :\n got: %v\nwant: %v", reader.read, 2400)
+	}
+	if len(output) != 3 || output[0].SampleCount() != 924 || output[2].SampleCount() != 452 {
+		t.Errorf("Decoded audio should be trimmed :\n got: %v", output)
+	}
+
+	reader = &recordingReader{Output: AudioHandlerFunc(func(audio *Audio) {}), To: 2048, ChannelCount: 2}
+	reader.AudioOut(NewAudio(1024, 1))
+	if !reader.done() || reader.read != 0 {
+		t.Errorf("Decoded audio with different channel count should be ignored")
+	}
+}
+
+func TestRecordExport_Run(t *testing.T) {
+	archive := testRecordArchive(t)
+	defer os.RemoveAll(archive.RootDirectory)
+
+	export := &RecordExport{
+		Archive: archive,
+		From:    time.Date(2015, 5, 20, 14, 0, 50, 0, time.UTC),
+		To:      time.Date(2015, 5, 20, 14, 3, 10, 0, time.UTC),
+	}
+
+	err := export.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.SampleRate != 1000 || export.ChannelCount != 2 {
+		t.Errorf("Wrong export format :\n got: %v/%v\nwant: 1000/2", export.SampleRate, export.ChannelCount)
+	}
+	if len(export.Recordings()) != 3 {
+		t.Errorf("Wrong recording count :\n got: %v\nwant: %v", len(export.Recordings()), 3)
+	}
+
+	samples := make([]float32, 0)
+	export.Run(AudioHandlerFunc(func(audio *Audio) {
+		samples = append(samples, audio.Samples(0)...)
+	}))
+
+	if int64(len(samples)) != export.SampleCount() || len(samples) != 140000 {
+		t.Fatalf("Wrong exported sample count :\n got: %v\nwant: %v", len(samples), 140000)
+	}
+
+	var conditions = []struct {
+		position int
+		value    float32
+	}{
+		{0, 0.1},      // 14h00m50
+		{10000, 0.2},  // 14h01m00
+		{70000, 0},    // 14h02m00 (missing)
+		{130000, 0.3}, // 14h03m00
+	}
+	for _, condition := range conditions {
+		if samples[condition.position] != condition.value {
+			t.Errorf("Wrong sample at %d :\n got: %v\nwant: %v", condition.position, samples[condition.position], condition.value)
+		}
+	}
+}
+
+func TestRecordExport_Init_empty(t *testing.T) {
+	archive := testRecordArchive(t)
+	defer os.RemoveAll(archive.RootDirectory)
+
+	export := &RecordExport{
+		Archive: archive,
+		From:    time.Date(2015, 5, 22, 14, 0, 0, 0, time.UTC),
+		To:      time.Date(2015, 5, 22, 15, 0, 0, 0, time.UTC),
+	}
+	if export.Init() == nil {
+		t.Errorf("Should return an error without recording")
+	}
+}
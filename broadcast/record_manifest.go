@@ -0,0 +1,513 @@
+package broadcast
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const recordManifestName = "manifest.json"
+
+// A RecordManifest lists the checksums of the files recorded in a day
+// directory. Each entry is chained with the previous one (the first entry
+// with the last entry of the previous day) and the manifest is signed.
+type RecordManifest struct {
+	Day       string
+	Entries   []RecordManifestEntry
+	Signature string
+}
+
+type RecordManifestEntry struct {
+	Path     string
+	Start    time.Time
+	End      time.Time
+	Size     int64
+	Checksum string
+	Previous string
+	Hash     string
+}
+
+// The hash covers the timing and the size of the file, so that a reordered
+// or retimed entry breaks the chain
+func (entry *RecordManifestEntry) ComputeHash() string {
+	fields := []string{
+		entry.Previous,
+		entry.Path,
+		entry.Start.UTC().Format(time.RFC3339Nano),
+		entry.End.UTC().Format(time.RFC3339Nano),
+		strconv.FormatInt(entry.Size, 10),
+		entry.Checksum,
+	}
+	return sha256Hex([]byte(strings.Join(fields, "\n")))
+}
+
+func (manifest *RecordManifest) LastHash() string {
+	if len(manifest.Entries) == 0 {
+		return ""
+	}
+	return manifest.Entries[len(manifest.Entries)-1].Hash
+}
+
+// Returns the digest of the manifest content without signature
+func (manifest *RecordManifest) digest() []byte {
+	unsigned := *manifest
+	unsigned.Signature = ""
+
+	jsonBytes, _ := json.Marshal(unsigned)
+	hash := sha256.Sum256(jsonBytes)
+	return hash[:]
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func (manifest *RecordManifest) Sign(key *ecdsa.PrivateKey) error {
+	r, s, err := ecdsa.Sign(rand.Reader, key, manifest.digest())
+	if err != nil {
+		return err
+	}
+
+	signature, err := asn1.Marshal(ecdsaSignature{r, s})
+	if err != nil {
+		return err
+	}
+
+	manifest.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+func (manifest *RecordManifest) VerifySignature(key *ecdsa.PublicKey) bool {
+	signatureBytes, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil {
+		return false
+	}
+
+	var signature ecdsaSignature
+	if _, err := asn1.Unmarshal(signatureBytes, &signature); err != nil || signature.R == nil || signature.S == nil {
+		return false
+	}
+
+	return ecdsa.Verify(key, manifest.digest(), signature.R, signature.S)
+}
+
+func LoadRecordManifest(fileName string) (*RecordManifest, error) {
+	jsonBytes, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &RecordManifest{}
+	err = json.Unmarshal(jsonBytes, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (manifest *RecordManifest) Save(fileName string) error {
+	jsonBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(fileName+".tmp", jsonBytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
+
+// Returns the manifest files under the root directory, oldest day first
+func RecordManifestFiles(rootDirectory string) ([]string, error) {
+	files, err := filepath.Glob(path.Join(rootDirectory, "*", "*", "*", recordManifestName))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Loads an ECDSA private key (PEM encoded). When the file doesn't exist,
+// a new key is created.
+func LoadOrCreateManifestKey(fileName string) (*ecdsa.PrivateKey, error) {
+	pemBytes, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		keyBytes, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		Log.Printf("Create manifest key %s", fileName)
+		err = ioutil.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM data in %s", fileName)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// Loads an ECDSA public key from a PEM file which contains the public or the private key
+func LoadManifestPublicKey(fileName string) (*ecdsa.PublicKey, error) {
+	pemBytes, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM data in %s", fileName)
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &key.PublicKey, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey, ok := key.(*ecdsa.PublicKey); ok {
+			return publicKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No ECDSA key in %s", fileName)
+}
+
+// A RecordSigner adds the files closed by TimedFileOutput in the manifest
+// of their day directory.
+//
+// The closed records wait in memory until signed. At Init, the files closed
+// but not signed before a restart are added to the waiting records.
+type RecordSigner struct {
+	RootDirectory string
+	Key           *ecdsa.PrivateKey
+
+	EventLog *LocalEventLog
+
+	lastHash string
+	pending  []*ClosedRecord
+	notify   chan bool
+	mutex    sync.Mutex
+	loops    runLoops
+}
+
+func (signer *RecordSigner) eventLog() *LocalEventLog {
+	if signer.EventLog == nil {
+		signer.EventLog = &LocalEventLog{Source: "manifest"}
+	}
+	return signer.EventLog
+}
+
+func (signer *RecordSigner) IsEnabled() bool {
+	return signer.Key != nil
+}
+
+// Retrieves the last hash of the chain from the existing manifests and
+// queues the unsigned files
+func (signer *RecordSigner) Init() error {
+	files, err := RecordManifestFiles(signer.RootDirectory)
+	if err != nil {
+		return err
+	}
+
+	for index := len(files) - 1; index >= 0; index-- {
+		manifest, err := LoadRecordManifest(files[index])
+		if err != nil {
+			Log.Printf("Can't read manifest %s : %v", files[index], err)
+			continue
+		}
+		if manifest.LastHash() != "" {
+			signer.lastHash = manifest.LastHash()
+			break
+		}
+	}
+
+	unsignedRecords, err := signer.unsignedRecords()
+	if err != nil {
+		return err
+	}
+
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	// The records closed before Init (repaired files, ...) are already queued
+	queued := make(map[string]bool)
+	for _, record := range signer.pending {
+		queued[path.Clean(record.Path)] = true
+	}
+
+	records := []*ClosedRecord{}
+	for _, record := range unsignedRecords {
+		if !queued[record.Path] {
+			records = append(records, record)
+		}
+	}
+
+	if len(records) > 0 {
+		signer.eventLog().NewEvent(fmt.Sprintf("Sign %d file(s) closed before restart", len(records)))
+		signer.pending = append(records, signer.pending...)
+	}
+
+	return nil
+}
+
+// Returns the record files which aren't listed in the manifest of their day,
+// oldest first. The end of a record is the modification time of its file.
+func (signer *RecordSigner) unsignedRecords() ([]*ClosedRecord, error) {
+	directories, err := filepath.Glob(path.Join(signer.RootDirectory, "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(directories)
+
+	records := []*ClosedRecord{}
+	for _, directory := range directories {
+		relativePath, _ := filepath.Rel(signer.RootDirectory, directory)
+		day, err := time.Parse(recordDayFormat, relativePath)
+		if err != nil {
+			continue
+		}
+
+		signed := make(map[string]bool)
+		manifest, err := LoadRecordManifest(path.Join(directory, recordManifestName))
+		if err != nil && !os.IsNotExist(err) {
+			Log.Printf("Can't read manifest in %s : %v", directory, err)
+			continue
+		}
+		if manifest != nil {
+			for _, entry := range manifest.Entries {
+				signed[path.Base(entry.Path)] = true
+			}
+		}
+
+		files, err := filepath.Glob(path.Join(directory, "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		dayRecords := []*ClosedRecord{}
+		for _, file := range files {
+			start, err := parseRecordingStart(day, path.Base(file))
+			if err != nil || signed[path.Base(file)] {
+				continue
+			}
+
+			fileInfo, err := os.Stat(file)
+			if err != nil || !fileInfo.Mode().IsRegular() {
+				continue
+			}
+
+			dayRecords = append(dayRecords, &ClosedRecord{Path: path.Clean(file), Start: start, End: fileInfo.ModTime().UTC()})
+		}
+
+		sort.Sort(closedRecordsByStart(dayRecords))
+		records = append(records, dayRecords...)
+	}
+
+	return records, nil
+}
+
+type closedRecordsByStart []*ClosedRecord
+
+func (records closedRecordsByStart) Len() int      { return len(records) }
+func (records closedRecordsByStart) Swap(i, j int) { records[i], records[j] = records[j], records[i] }
+func (records closedRecordsByStart) Less(i, j int) bool {
+	return records[i].Start.Before(records[j].Start)
+}
+
+func (signer *RecordSigner) notifyChannel() chan bool {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	if signer.notify == nil {
+		signer.notify = make(chan bool, 1)
+	}
+	return signer.notify
+}
+
+// Checksums are computed outside the audio goroutine, in the file order.
+// The record is queued without blocking.
+func (signer *RecordSigner) FileClosed(record *ClosedRecord) {
+	signer.mutex.Lock()
+	signer.pending = append(signer.pending, record)
+	signer.mutex.Unlock()
+
+	select {
+	case signer.notifyChannel() <- true:
+	default:
+	}
+}
+
+// Returns the next record to sign (or nil)
+func (signer *RecordSigner) next() *ClosedRecord {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	if len(signer.pending) == 0 {
+		return nil
+	}
+	record := signer.pending[0]
+	signer.pending = signer.pending[1:]
+	return record
+}
+
+func (signer *RecordSigner) Run() {
+	if !signer.loops.Start() {
+		return
+	}
+	defer signer.loops.Done()
+
+	for {
+		signer.signPending()
+
+		select {
+		case <-signer.notifyChannel():
+		case <-signer.loops.Stopping():
+			// The records closed before Stop are signed
+			signer.signPending()
+			return
+		}
+	}
+}
+
+func (signer *RecordSigner) signPending() {
+	for record := signer.next(); record != nil; record = signer.next() {
+		err := signer.Add(record)
+		if err != nil {
+			signer.eventLog().NewEvent(fmt.Sprintf("Can't sign %s : %v", path.Base(record.Path), err))
+		}
+	}
+}
+
+// Signs the queued records, then stops the Run loop
+func (signer *RecordSigner) Stop() error {
+	signer.loops.Stop()
+	signer.loops.Wait()
+	return nil
+}
+
+// Adds the given file in the manifest of its directory
+func (signer *RecordSigner) Add(record *ClosedRecord) error {
+	relativePath, err := filepath.Rel(signer.RootDirectory, record.Path)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return errors.New("File outside root directory")
+	}
+
+	fileInfo, err := os.Stat(record.Path)
+	if err != nil {
+		return err
+	}
+
+	checksum, err := FileChecksum(record.Path)
+	if err != nil {
+		return err
+	}
+
+	manifestFile := path.Join(path.Dir(record.Path), recordManifestName)
+	manifest, err := LoadRecordManifest(manifestFile)
+	if os.IsNotExist(err) {
+		day, err := time.Parse(recordDayFormat, path.Dir(relativePath))
+		if err != nil {
+			day = record.Start
+		}
+		manifest = &RecordManifest{Day: day.Format("2006-01-02")}
+	} else if err != nil {
+		return err
+	}
+
+	// A record can be closed twice (repaired and found unsigned at Init)
+	for _, entry := range manifest.Entries {
+		if entry.Path == relativePath {
+			Log.Debugf("%s is already signed", relativePath)
+			return nil
+		}
+	}
+
+	entry := RecordManifestEntry{
+		Path:     relativePath,
+		Start:    record.Start,
+		End:      record.End,
+		Size:     fileInfo.Size(),
+		Checksum: checksum,
+		Previous: signer.lastHash,
+	}
+	entry.Hash = entry.ComputeHash()
+
+	manifest.Entries = append(manifest.Entries, entry)
+
+	err = manifest.Sign(signer.Key)
+	if err != nil {
+		return err
+	}
+
+	err = manifest.Save(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	signer.lastHash = entry.Hash
+	Log.Debugf("Signed %s (%s)", relativePath, checksum)
+
+	return nil
+}
+
+type RecordSignerConfig struct {
+	KeyFile string
+}
+
+func (config *RecordSignerConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.StringVar(&config.KeyFile, strings.Join([]string{prefix, "key"}, "-"), "", "The ECDSA key (PEM) used to sign daily manifests (created if missing)")
+}
+
+func (config *RecordSignerConfig) Apply(signer *RecordSigner, rootDirectory string) error {
+	signer.RootDirectory = rootDirectory
+
+	if config.KeyFile != "" {
+		key, err := LoadOrCreateManifestKey(config.KeyFile)
+		if err != nil {
+			return err
+		}
+		signer.Key = key
+	}
+
+	return nil
+}
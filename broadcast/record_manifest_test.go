@@ -0,0 +1,268 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testRecordSigner(t *testing.T) *RecordSigner {
+	tempDir, err := ioutil.TempDir("", "recordmanifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := LoadOrCreateManifestKey(path.Join(tempDir, "manifest.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := &RecordSigner{
+		RootDirectory: path.Join(tempDir, "records"),
+		Key:           key,
+		EventLog:      &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "manifest"},
+	}
+	if err := signer.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// Creates the given file under the signer root and adds it in the manifest
+func signRecord(t *testing.T, signer *RecordSigner, file string, content string) {
+	fileName := path.Join(signer.RootDirectory, file)
+	os.MkdirAll(path.Dir(fileName), 0775)
+	ioutil.WriteFile(fileName, []byte(content), 0644)
+
+	day, _ := time.Parse(recordDayFormat, path.Dir(file))
+	start, _ := parseRecordingStart(day, path.Base(file))
+
+	err := signer.Add(&ClosedRecord{Path: fileName, Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordSigner_Add(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	signRecord(t, signer, "2015/05-May/20-Wed/10h00.wav", "first")
+	signRecord(t, signer, "2015/05-May/20-Wed/11h00.wav", "second")
+
+	manifest, err := LoadRecordManifest(path.Join(signer.RootDirectory, "2015/05-May/20-Wed", recordManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Day != "2015-05-20" {
+		t.Errorf("Wrong manifest day :\n got: %v\nwant: %v", manifest.Day, "2015-05-20")
+	}
+	if len(manifest.Entries) != 2 {
+		t.Fatalf("Wrong entry count :\n got: %v\nwant: %v", len(manifest.Entries), 2)
+	}
+
+	first, second := manifest.Entries[0], manifest.Entries[1]
+	if first.Path != "2015/05-May/20-Wed/10h00.wav" {
+		t.Errorf("Wrong entry path :\n got: %v\nwant: %v", first.Path, "2015/05-May/20-Wed/10h00.wav")
+	}
+	if first.Checksum != sha256Hex([]byte("first")) {
+		t.Errorf("Wrong entry checksum :\n got: %v\nwant: %v", first.Checksum, sha256Hex([]byte("first")))
+	}
+	if first.Size != 5 {
+		t.Errorf("Wrong entry size :\n got: %v\nwant: %v", first.Size, 5)
+	}
+	if second.Previous != first.Hash {
+		t.Errorf("Entries should be chained :\n got: %v\nwant: %v", second.Previous, first.Hash)
+	}
+	if second.Hash != second.ComputeHash() {
+		t.Errorf("Wrong entry hash :\n got: %v\nwant: %v", second.Hash, second.ComputeHash())
+	}
+
+	if !manifest.VerifySignature(&signer.Key.PublicKey) {
+		t.Errorf("Manifest signature should be valid")
+	}
+}
+
+func TestRecordSigner_Add_nextDay(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	signRecord(t, signer, "2015/05-May/20-Wed/23h00.wav", "first")
+	signRecord(t, signer, "2015/05-May/21-Thu/00h00.wav", "second")
+
+	previousManifest, _ := LoadRecordManifest(path.Join(signer.RootDirectory, "2015/05-May/20-Wed", recordManifestName))
+	manifest, _ := LoadRecordManifest(path.Join(signer.RootDirectory, "2015/05-May/21-Thu", recordManifestName))
+
+	if manifest.Entries[0].Previous != previousManifest.LastHash() {
+		t.Errorf("Chain should continue in the next day manifest :\n got: %v\nwant: %v", manifest.Entries[0].Previous, previousManifest.LastHash())
+	}
+}
+
+func TestRecordSigner_Init(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	signRecord(t, signer, "2015/05-May/20-Wed/10h00.wav", "first")
+
+	restartedSigner := &RecordSigner{RootDirectory: signer.RootDirectory, Key: signer.Key}
+	if err := restartedSigner.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if restartedSigner.lastHash != signer.lastHash {
+		t.Errorf("Last hash should be loaded from manifests :\n got: %v\nwant: %v", restartedSigner.lastHash, signer.lastHash)
+	}
+}
+
+func TestRecordSigner_Init_unsigned(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	signRecord(t, signer, "2015/05-May/20-Wed/10h00.wav", "first")
+	for _, file := range []string{"2015/05-May/20-Wed/12h00.wav", "2015/05-May/20-Wed/11h00.wav"} {
+		ioutil.WriteFile(path.Join(signer.RootDirectory, file), []byte("unsigned"), 0644)
+	}
+
+	restartedSigner := &RecordSigner{RootDirectory: signer.RootDirectory, Key: signer.Key, EventLog: signer.EventLog}
+	if err := restartedSigner.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{}
+	for _, record := range restartedSigner.pending {
+		relativePath, _ := filepath.Rel(signer.RootDirectory, record.Path)
+		paths = append(paths, relativePath)
+	}
+	if expected := []string{"2015/05-May/20-Wed/11h00.wav", "2015/05-May/20-Wed/12h00.wav"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Unsigned files should be queued at Init :\n got: %v\nwant: %v", paths, expected)
+	}
+}
+
+func TestRecordSigner_Add_signed(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	signRecord(t, signer, "2015/05-May/20-Wed/10h00.wav", "first")
+	signRecord(t, signer, "2015/05-May/20-Wed/10h00.wav", "first")
+
+	manifest, _ := LoadRecordManifest(path.Join(signer.RootDirectory, "2015/05-May/20-Wed", recordManifestName))
+	if len(manifest.Entries) != 1 {
+		t.Errorf("A signed file should not be added again :\n got: %v", len(manifest.Entries))
+	}
+}
+
+func TestRecordSigner_FileClosed(t *testing.T) {
+	signer := &RecordSigner{}
+
+	// Without Run, the records are queued without blocking
+	for i := 0; i < 1000; i++ {
+		signer.FileClosed(&ClosedRecord{Path: "dummy.wav"})
+	}
+
+	if len(signer.pending) != 1000 {
+		t.Errorf("Wrong queued record count :\n got: %v\nwant: %v", len(signer.pending), 1000)
+	}
+}
+
+func TestRecordSigner_Stop(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	fileName := path.Join(signer.RootDirectory, "2015/05-May/20-Wed/10h00.wav")
+	os.MkdirAll(path.Dir(fileName), 0775)
+	ioutil.WriteFile(fileName, []byte("last"), 0644)
+
+	go signer.Run()
+	time.Sleep(5 * time.Millisecond)
+	signer.FileClosed(&ClosedRecord{Path: fileName})
+	signer.Stop()
+
+	manifest, err := LoadRecordManifest(path.Join(path.Dir(fileName), recordManifestName))
+	if err != nil || len(manifest.Entries) != 1 {
+		t.Errorf("The last record should be signed before stopping :\n got: %v (%v)", manifest, err)
+	}
+}
+
+func TestRecordSigner_Add_outsideRoot(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	if err := signer.Add(&ClosedRecord{Path: "/dummy/10h00.wav"}); err == nil {
+		t.Errorf("Should refuse a file outside root directory")
+	}
+}
+
+func TestRecordManifest_VerifySignature(t *testing.T) {
+	signer := testRecordSigner(t)
+	defer os.RemoveAll(path.Dir(signer.RootDirectory))
+
+	manifest := &RecordManifest{Day: "2015-05-20", Entries: []RecordManifestEntry{{Path: "10h00.wav", Checksum: "dummy"}}}
+	if err := manifest.Sign(signer.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest.Entries[0].Checksum = "modified"
+	if manifest.VerifySignature(&signer.Key.PublicKey) {
+		t.Errorf("Signature of a modified manifest should be invalid")
+	}
+
+	manifest.Signature = "dummy"
+	if manifest.VerifySignature(&signer.Key.PublicKey) {
+		t.Errorf("Invalid signature should be refused")
+	}
+}
+
+func TestLoadManifestPublicKey(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "recordmanifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	keyFile := path.Join(tempDir, "manifest.pem")
+	key, err := LoadOrCreateManifestKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileInfo, _ := os.Stat(keyFile); fileInfo.Mode().Perm() != 0600 {
+		t.Errorf("Wrong key file mode :\n got: %v\nwant: %v", fileInfo.Mode().Perm(), os.FileMode(0600))
+	}
+
+	loadedKey, err := LoadOrCreateManifestKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedKey.D.Cmp(key.D) != 0 {
+		t.Errorf("Existing key should be loaded")
+	}
+
+	publicKey, err := LoadManifestPublicKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicKey.X.Cmp(key.PublicKey.X) != 0 || publicKey.Y.Cmp(key.PublicKey.Y) != 0 {
+		t.Errorf("Wrong public key")
+	}
+
+	if _, err := LoadManifestPublicKey("/dummy/manifest.pem"); err == nil {
+		t.Errorf("Should return an error with a missing file")
+	}
+}
+
+func TestRecordSignerConfig_Apply(t *testing.T) {
+	signer := &RecordSigner{}
+	(&RecordSignerConfig{}).Apply(signer, "/srv/records")
+
+	if signer.IsEnabled() {
+		t.Errorf("Signer should be disabled without key file")
+	}
+	if signer.RootDirectory != "/srv/records" {
+		t.Errorf("Wrong root directory :\n got: %v\nwant: %v", signer.RootDirectory, "/srv/records")
+	}
+}
@@ -0,0 +1,77 @@
+package broadcast
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	RecordModeContinuous = "continuous"
+	RecordModeVox        = "vox"
+	RecordModeSchedule   = "schedule"
+)
+
+type RecordModeConfig struct {
+	Mode string
+
+	VoxThreshold float64
+	VoxPreRoll   time.Duration
+	VoxHangTime  time.Duration
+
+	Schedule string
+}
+
+func (config *RecordModeConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.StringVar(&config.Mode, strings.Join([]string{prefix, "mode"}, "-"), RecordModeContinuous, "The record mode (continuous, vox or schedule)")
+	flags.Float64Var(&config.VoxThreshold, strings.Join([]string{prefix, "vox-threshold"}, "-"), -40, "The signal level (in dBFS) which starts the VOX recording")
+	flags.DurationVar(&config.VoxPreRoll, strings.Join([]string{prefix, "vox-pre-roll"}, "-"), 2*time.Second, "The audio recorded before the VOX start")
+	flags.DurationVar(&config.VoxHangTime, strings.Join([]string{prefix, "vox-hang-time"}, "-"), 10*time.Second, "The duration under the threshold which stops the VOX recording")
+	flags.StringVar(&config.Schedule, strings.Join([]string{prefix, "schedule"}, "-"), "", "The weekly record windows (for example 'mon-fri 06:00-09:00, sat+sun 10:00-12:00')")
+}
+
+// Returns the AudioHandler which feeds the given output according to the record mode
+func (config *RecordModeConfig) Handler(output RecordOutput) (AudioHandler, error) {
+	switch config.Mode {
+	case RecordModeContinuous, "":
+		return output, nil
+	case RecordModeVox:
+		return &VoxRecorder{
+			Output:    output,
+			Threshold: config.VoxThreshold,
+			PreRoll:   config.VoxPreRoll,
+			HangTime:  config.VoxHangTime,
+		}, nil
+	case RecordModeSchedule:
+		schedule, err := ParseRecordSchedule(config.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		return &ScheduledRecorder{Output: output, Schedule: schedule}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown record mode: '%s'", config.Mode)
+}
+
+func (config *RecordModeConfig) Validate(errors *ConfigErrors) {
+	switch config.Mode {
+	case RecordModeContinuous, "":
+	case RecordModeVox:
+		if config.VoxThreshold > 0 {
+			errors.Add("VoxThreshold", "must be in dBFS (negative)")
+		}
+		if config.VoxPreRoll < 0 {
+			errors.Add("VoxPreRoll", "can't be negative")
+		}
+		if config.VoxHangTime < 0 {
+			errors.Add("VoxHangTime", "can't be negative")
+		}
+	case RecordModeSchedule:
+		if _, err := ParseRecordSchedule(config.Schedule); err != nil {
+			errors.Add("Schedule", "%v", err)
+		}
+	default:
+		errors.Add("Mode", "unknown record mode '%s' (continuous, vox or schedule)", config.Mode)
+	}
+}
@@ -0,0 +1,60 @@
+package broadcast
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordModeConfig_Handler(t *testing.T) {
+	output := &testRecordOutput{}
+
+	config := RecordModeConfig{Mode: RecordModeContinuous}
+	if handler, _ := config.Handler(output); handler != output {
+		t.Errorf("Continuous mode should use the output :\n got: %v", handler)
+	}
+
+	config = RecordModeConfig{Mode: RecordModeVox, VoxThreshold: -30, VoxHangTime: time.Minute}
+	handler, _ := config.Handler(output)
+	if recorder, ok := handler.(*VoxRecorder); !ok || recorder.Threshold != -30 || recorder.HangTime != time.Minute {
+		t.Errorf("Wrong VOX recorder :\n got: %v", handler)
+	}
+
+	config = RecordModeConfig{Mode: RecordModeSchedule, Schedule: "mon 06:00-09:00"}
+	handler, _ = config.Handler(output)
+	if recorder, ok := handler.(*ScheduledRecorder); !ok || len(recorder.Schedule) != 1 {
+		t.Errorf("Wrong scheduled recorder :\n got: %v", handler)
+	}
+
+	for _, invalidConfig := range []RecordModeConfig{{Mode: "dummy"}, {Mode: RecordModeSchedule, Schedule: "dummy"}} {
+		if _, err := invalidConfig.Handler(output); err == nil {
+			t.Errorf("Should refuse invalid config %v", invalidConfig)
+		}
+	}
+}
+
+func TestRecordModeConfig_Validate(t *testing.T) {
+	conditions := []struct {
+		config RecordModeConfig
+		fields []string
+	}{
+		{RecordModeConfig{Mode: RecordModeContinuous}, []string{}},
+		{RecordModeConfig{Mode: RecordModeVox, VoxThreshold: -40}, []string{}},
+		{RecordModeConfig{Mode: RecordModeVox, VoxThreshold: 6, VoxHangTime: -time.Second}, []string{"VoxThreshold", "VoxHangTime"}},
+		{RecordModeConfig{Mode: RecordModeSchedule, Schedule: "mon 25:00-26:00"}, []string{"Schedule"}},
+		{RecordModeConfig{Mode: "dummy"}, []string{"Mode"}},
+	}
+
+	for _, condition := range conditions {
+		errors := ConfigErrors{}
+		condition.config.Validate(&errors)
+
+		fields := []string{}
+		for _, err := range errors {
+			fields = append(fields, err.Field)
+		}
+		if !reflect.DeepEqual(fields, condition.fields) {
+			t.Errorf("Wrong invalid fields for %v :\n got: %v\nwant: %v", condition.config, fields, condition.fields)
+		}
+	}
+}
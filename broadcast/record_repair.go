@@ -0,0 +1,356 @@
+package broadcast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Describes how chunks are stored in RIFF/WAVE, RF64 and Sony Wave64 files
+type riffLayout struct {
+	FirstChunk int64
+	IdSize     int64
+	SizeSize   int64
+	// Wave64 chunk sizes include the chunk header
+	SizeIncludesHeader bool
+	Alignment          int64
+}
+
+// Returns the TimedFileFormat container which uses this layout
+func (layout *riffLayout) format() string {
+	switch layout {
+	case &rf64Layout:
+		return "rf64"
+	case &w64Layout:
+		return "w64"
+	}
+	return "wav"
+}
+
+func (layout *riffLayout) headerSize() int64 {
+	return layout.IdSize + layout.SizeSize
+}
+
+var (
+	wavLayout  = riffLayout{FirstChunk: 12, IdSize: 4, SizeSize: 4, Alignment: 2}
+	rf64Layout = riffLayout{FirstChunk: 12, IdSize: 4, SizeSize: 4, Alignment: 2}
+	w64Layout  = riffLayout{FirstChunk: 40, IdSize: 16, SizeSize: 8, SizeIncludesHeader: true, Alignment: 8}
+)
+
+type riffChunk struct {
+	Id         string
+	Offset     int64
+	DataOffset int64
+	Size       int64
+}
+
+func (chunk *riffChunk) end(layout *riffLayout) int64 {
+	end := chunk.DataOffset + chunk.Size
+	if padding := end % layout.Alignment; padding != 0 {
+		end += layout.Alignment - padding
+	}
+	return end
+}
+
+func readRiffChunk(file io.ReaderAt, offset int64, layout *riffLayout) (*riffChunk, error) {
+	header := make([]byte, layout.headerSize())
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+
+	chunk := &riffChunk{
+		Id:         string(header[0:4]),
+		Offset:     offset,
+		DataOffset: offset + layout.headerSize(),
+	}
+
+	for _, character := range chunk.Id {
+		if character < ' ' || character > '~' {
+			return nil, fmt.Errorf("Invalid chunk identifier at %d", offset)
+		}
+	}
+
+	if layout.SizeSize == 8 {
+		chunk.Size = int64(binary.LittleEndian.Uint64(header[layout.IdSize:]))
+	} else {
+		chunk.Size = int64(binary.LittleEndian.Uint32(header[layout.IdSize:]))
+	}
+	if layout.SizeIncludesHeader {
+		chunk.Size -= layout.headerSize()
+	}
+	if chunk.Size < 0 {
+		return nil, fmt.Errorf("Invalid chunk size at %d", offset)
+	}
+
+	return chunk, nil
+}
+
+// Returns true when valid chunks follow each other from offset to the end of the file
+func validRiffChunks(file io.ReaderAt, offset int64, fileSize int64, layout *riffLayout) bool {
+	for offset < fileSize {
+		chunk, err := readRiffChunk(file, offset, layout)
+		if err != nil {
+			return false
+		}
+		offset = chunk.end(layout)
+	}
+	return offset == fileSize
+}
+
+func readUint(file io.ReaderAt, offset int64, size int) (uint64, error) {
+	bytes := make([]byte, 8)
+	if _, err := file.ReadAt(bytes[:size], offset); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(bytes), nil
+}
+
+func writeUint(file io.WriterAt, offset int64, size int, value uint64) error {
+	bytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bytes, value)
+	_, err := file.WriteAt(bytes[:size], offset)
+	return err
+}
+
+func fileRiffLayout(file io.ReaderAt) *riffLayout {
+	header := make([]byte, 40)
+	if _, err := file.ReadAt(header, 0); err != nil && err != io.EOF {
+		return nil
+	}
+
+	switch {
+	case string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return &wavLayout
+	case string(header[0:4]) == "RF64" && string(header[8:12]) == "WAVE":
+		return &rf64Layout
+	case string(header[0:4]) == "riff" && string(header[24:28]) == "wave":
+		return &w64Layout
+	}
+	return nil
+}
+
+// RepairRecordFile fixes the header of a wav, rf64 or w64 file which wasn't
+// closed (after a crash, a power failure, ...). The data chunk is extended
+// to the end of the file. Returns the recovered duration when the file has
+// been repaired.
+func RepairRecordFile(fileName string) (bool, time.Duration, error) {
+	repaired, err := repairRecordFile(fileName)
+	if repaired == nil {
+		return false, 0, err
+	}
+	return true, repaired.duration(), err
+}
+
+// Describes the audio content of a repaired file
+type repairedRecordFile struct {
+	Format      string
+	SampleRate  int64
+	SampleCount int64
+}
+
+func (repaired *repairedRecordFile) duration() time.Duration {
+	if repaired.SampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(repaired.SampleCount) / float64(repaired.SampleRate) * float64(time.Second))
+}
+
+// Returns nil when the file doesn't need to be repaired
+func repairRecordFile(fileName string) (*repairedRecordFile, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileSize := fileInfo.Size()
+
+	layout := fileRiffLayout(file)
+	if layout == nil {
+		return nil, errors.New("Not a wav, rf64 or w64 file")
+	}
+
+	var ds64, data *riffChunk
+	var blockAlign, byteRate uint64
+
+	for offset := layout.FirstChunk; data == nil; {
+		chunk, err := readRiffChunk(file, offset, layout)
+		if err != nil {
+			return nil, errors.New("No data chunk")
+		}
+
+		switch chunk.Id {
+		case "ds64":
+			ds64 = chunk
+		case "fmt ":
+			if byteRate, err = readUint(file, chunk.DataOffset+8, 4); err != nil {
+				return nil, err
+			}
+			if blockAlign, err = readUint(file, chunk.DataOffset+12, 2); err != nil {
+				return nil, err
+			}
+		case "data":
+			data = chunk
+		}
+
+		offset = chunk.end(layout)
+	}
+
+	if layout == &rf64Layout {
+		if ds64 == nil {
+			return nil, errors.New("No ds64 chunk")
+		}
+		dataSize, err := readUint(file, ds64.DataOffset+8, 8)
+		if err != nil {
+			return nil, err
+		}
+		data.Size = int64(dataSize)
+	}
+
+	availableSize := fileSize - data.DataOffset
+	if data.Size <= availableSize && validRiffChunks(file, data.end(layout), fileSize, layout) {
+		return nil, nil
+	}
+
+	dataSize := availableSize
+	if blockAlign > 0 {
+		dataSize -= dataSize % int64(blockAlign)
+	}
+
+	repaired := &repairedRecordFile{Format: layout.format()}
+	if blockAlign > 0 {
+		repaired.SampleRate = int64(byteRate / blockAlign)
+		repaired.SampleCount = dataSize / int64(blockAlign)
+	}
+
+	if layout == &wavLayout && data.DataOffset+dataSize > 0xFFFFFFFF {
+		return nil, errors.New("Data exceeds the 4GB wav limit")
+	}
+
+	data.Size = dataSize
+	fileSize = data.end(layout)
+	if err := file.Truncate(fileSize); err != nil {
+		return nil, err
+	}
+
+	switch layout {
+	case &wavLayout:
+		err = writeUint(file, data.Offset+4, 4, uint64(dataSize))
+		if err == nil {
+			err = writeUint(file, 4, 4, uint64(fileSize-8))
+		}
+	case &rf64Layout:
+		err = writeUint(file, ds64.DataOffset, 8, uint64(fileSize-8))
+		if err == nil {
+			err = writeUint(file, ds64.DataOffset+8, 8, uint64(dataSize))
+		}
+		if err == nil && blockAlign > 0 {
+			err = writeUint(file, ds64.DataOffset+16, 8, uint64(dataSize)/blockAlign)
+		}
+	case &w64Layout:
+		err = writeUint(file, data.Offset+16, 8, uint64(dataSize+layout.headerSize()))
+		if err == nil {
+			err = writeUint(file, 16, 8, uint64(fileSize))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repaired, file.Sync()
+}
+
+// RecordRepair looks for files left unterminated by a previous run under
+// RootDirectory and repairs them. The FileHandlers are notified of each
+// repaired file, as if TimedFileOutput had closed it.
+type RecordRepair struct {
+	RootDirectory string
+	FileHandlers  []TimedFileHandler
+
+	EventLog *LocalEventLog
+}
+
+func (repair *RecordRepair) eventLog() *LocalEventLog {
+	if repair.EventLog == nil {
+		repair.EventLog = &LocalEventLog{Source: "repair"}
+	}
+	return repair.EventLog
+}
+
+func (repair *RecordRepair) repairable(fileName string) bool {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".wav", ".w64":
+		return true
+	}
+	return false
+}
+
+// Returns the count of repaired files
+func (repair *RecordRepair) Run() (int, error) {
+	var repairedCount int
+
+	if _, err := os.Stat(repair.RootDirectory); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	err := filepath.Walk(repair.RootDirectory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !repair.repairable(filePath) {
+			return nil
+		}
+
+		repaired, err := repairRecordFile(filePath)
+		if err != nil {
+			Log.Printf("Can't check file %s : %v", filePath, err)
+			return nil
+		}
+
+		if repaired != nil {
+			relativePath, _ := filepath.Rel(repair.RootDirectory, filePath)
+			repair.eventLog().NewEvent(fmt.Sprintf("Repaired unterminated file %s (%v)", relativePath, repaired.duration()))
+			repairedCount += 1
+
+			record := repair.closedRecord(filePath, info, repaired)
+			for _, handler := range repair.FileHandlers {
+				handler.FileClosed(record)
+			}
+		}
+		return nil
+	})
+
+	return repairedCount, err
+}
+
+// The start of the file is read in its path (see TimedFileOutput). When the
+// path doesn't match, the start is deduced from the modification time.
+func (repair *RecordRepair) closedRecord(filePath string, info os.FileInfo, repaired *repairedRecordFile) *ClosedRecord {
+	duration := repaired.duration()
+	start := info.ModTime().UTC().Add(-duration)
+
+	relativePath, _ := filepath.Rel(repair.RootDirectory, filePath)
+	if day, err := time.Parse(recordDayFormat, path.Dir(relativePath)); err == nil {
+		if fileStart, err := parseRecordingStart(day, path.Base(relativePath)); err == nil {
+			start = fileStart
+		}
+	}
+
+	return &ClosedRecord{
+		Path:        filePath,
+		Start:       start,
+		End:         start.Add(duration),
+		SampleCount: repaired.SampleCount,
+		Format:      repaired.Format,
+	}
+}
@@ -0,0 +1,260 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// Returns a 16 bits stereo 44.1kHz fmt chunk content
+func testFmtChunk() []byte {
+	buffer := &bytes.Buffer{}
+	binary.Write(buffer, binary.LittleEndian, []uint16{1, 2})
+	binary.Write(buffer, binary.LittleEndian, []uint32{44100, 44100 * 4})
+	binary.Write(buffer, binary.LittleEndian, []uint16{4, 16})
+	return buffer.Bytes()
+}
+
+// Writes a wav file whose header declares dataSize bytes, followed by dataLength bytes
+func writeTestWavFile(fileName string, dataSize uint32, dataLength int) error {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("RIFF")
+	binary.Write(buffer, binary.LittleEndian, uint32(4+8+16+8+dataSize))
+	buffer.WriteString("WAVE")
+	wavChunk(buffer, "fmt ", testFmtChunk())
+	buffer.WriteString("data")
+	binary.Write(buffer, binary.LittleEndian, dataSize)
+	buffer.Write(bytes.Repeat([]byte{1}, dataLength))
+	return ioutil.WriteFile(fileName, buffer.Bytes(), 0644)
+}
+
+func TestRepairRecordFile_wav(t *testing.T) {
+	conditions := []struct {
+		dataSize     uint32
+		dataLength   int
+		repaired     bool
+		repairedSize uint32
+	}{
+		{44100 * 4, 44100 * 4, false, 44100 * 4},
+		{0, 44100 * 4, true, 44100 * 4},
+		{0, 44100*4 + 3, true, 44100 * 4},
+		{44100 * 8, 44100 * 4, true, 44100 * 4},
+		{0, 0, false, 0},
+	}
+
+	tempDir, err := ioutil.TempDir("", "recordrepair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	fileName := path.Join(tempDir, "test.wav")
+
+	for _, condition := range conditions {
+		if err := writeTestWavFile(fileName, condition.dataSize, condition.dataLength); err != nil {
+			t.Fatal(err)
+		}
+
+		repaired, duration, err := RepairRecordFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if repaired != condition.repaired {
+			t.Errorf("Wrong repaired for %v :\n got: %v\nwant: %v", condition, repaired, condition.repaired)
+		}
+		if repaired && duration != time.Duration(condition.repairedSize/4)*time.Second/44100 {
+			t.Errorf("Wrong recovered duration for %v :\n got: %v", condition, duration)
+		}
+
+		content, _ := ioutil.ReadFile(fileName)
+		if dataSize := binary.LittleEndian.Uint32(content[40:44]); dataSize != condition.repairedSize {
+			t.Errorf("Wrong data size for %v :\n got: %v\nwant: %v", condition, dataSize, condition.repairedSize)
+		}
+		if riffSize := binary.LittleEndian.Uint32(content[4:8]); int(riffSize) != len(content)-8 {
+			t.Errorf("Wrong RIFF size for %v :\n got: %v\nwant: %v", condition, riffSize, len(content)-8)
+		}
+	}
+}
+
+func TestRepairRecordFile_wav_markers(t *testing.T) {
+	fileName, err := tempWavFile(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fileName)
+
+	if err := AppendWavMarkers(fileName, []WavMarker{{Position: 10, Label: "Gap"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	repaired, _, err := RepairRecordFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired {
+		t.Errorf("A file with chunks after data should not be repaired")
+	}
+}
+
+func TestRepairRecordFile_rf64(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("RF64")
+	binary.Write(buffer, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buffer.WriteString("WAVE")
+	wavChunk(buffer, "ds64", make([]byte, 28))
+	wavChunk(buffer, "fmt ", testFmtChunk())
+	buffer.WriteString("data")
+	binary.Write(buffer, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buffer.Write(make([]byte, 4000))
+
+	file, err := ioutil.TempFile("", "recordrepair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(buffer.Bytes())
+	file.Close()
+
+	repaired, _, err := RepairRecordFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !repaired {
+		t.Errorf("The rf64 file should be repaired")
+	}
+
+	content, _ := ioutil.ReadFile(file.Name())
+	ds64 := content[20:]
+	if riffSize := binary.LittleEndian.Uint64(ds64[0:8]); int(riffSize) != len(content)-8 {
+		t.Errorf("Wrong RIFF size :\n got: %v\nwant: %v", riffSize, len(content)-8)
+	}
+	if dataSize := binary.LittleEndian.Uint64(ds64[8:16]); dataSize != 4000 {
+		t.Errorf("Wrong data size :\n got: %v\nwant: %v", dataSize, 4000)
+	}
+	if sampleCount := binary.LittleEndian.Uint64(ds64[16:24]); sampleCount != 1000 {
+		t.Errorf("Wrong sample count :\n got: %v\nwant: %v", sampleCount, 1000)
+	}
+}
+
+func w64Chunk(buffer *bytes.Buffer, id string, data []byte) {
+	guid := make([]byte, 16)
+	copy(guid, id)
+	buffer.Write(guid)
+	binary.Write(buffer, binary.LittleEndian, uint64(24+len(data)))
+	buffer.Write(data)
+	for buffer.Len()%8 != 0 {
+		buffer.WriteByte(0)
+	}
+}
+
+func TestRepairRecordFile_w64(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	buffer.Write(append([]byte("riff"), make([]byte, 12)...))
+	binary.Write(buffer, binary.LittleEndian, uint64(0))
+	buffer.Write(append([]byte("wave"), make([]byte, 12)...))
+	w64Chunk(buffer, "fmt ", testFmtChunk())
+	dataOffset := buffer.Len()
+	w64Chunk(buffer, "data", nil)
+	buffer.Write(make([]byte, 4000))
+
+	file, err := ioutil.TempFile("", "recordrepair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(buffer.Bytes())
+	file.Close()
+
+	repaired, _, err := RepairRecordFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !repaired {
+		t.Errorf("The w64 file should be repaired")
+	}
+
+	content, _ := ioutil.ReadFile(file.Name())
+	if fileSize := binary.LittleEndian.Uint64(content[16:24]); int(fileSize) != len(content) {
+		t.Errorf("Wrong riff size :\n got: %v\nwant: %v", fileSize, len(content))
+	}
+	if dataSize := binary.LittleEndian.Uint64(content[dataOffset+16:]); dataSize != 24+4000 {
+		t.Errorf("Wrong data size :\n got: %v\nwant: %v", dataSize, 24+4000)
+	}
+}
+
+func TestRepairRecordFile_unsupported(t *testing.T) {
+	file, err := ioutil.TempFile("", "recordrepair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("fLaC and some other bytes")
+	file.Close()
+
+	if _, _, err := RepairRecordFile(file.Name()); err == nil {
+		t.Errorf("Should return an error with a flac file")
+	}
+}
+
+func TestRecordRepair_Run(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "recordrepair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	directory := path.Join(tempDir, "2015/05-May/20-Wed")
+	os.MkdirAll(directory, 0755)
+
+	writeTestWavFile(path.Join(directory, "14h00.wav"), 400, 400)
+	writeTestWavFile(path.Join(directory, "14h05.wav"), 0, 400)
+	ioutil.WriteFile(path.Join(directory, "14h05.mp3"), []byte("dummy"), 0644)
+
+	eventLog := NewMemoryEventLog(10)
+	handler := &testTimedFileHandler{}
+	repair := RecordRepair{
+		RootDirectory: tempDir,
+		FileHandlers:  []TimedFileHandler{handler},
+		EventLog:      &LocalEventLog{Parent: eventLog, Source: "repair"},
+	}
+
+	repairedCount, err := repair.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repairedCount != 1 {
+		t.Errorf("Wrong repaired file count :\n got: %v\nwant: %v", repairedCount, 1)
+	}
+
+	events := eventLog.Events()
+	if len(events) != 1 || events[0].Message != "Repaired unterminated file 2015/05-May/20-Wed/14h05.wav (2.267573ms)" {
+		t.Errorf("Wrong events :\n got: %v", events)
+	}
+
+	if len(handler.records) != 1 {
+		t.Fatalf("Wrong closed records :\n got: %v", handler.records)
+	}
+	record := handler.records[0]
+	expectedStart := time.Date(2015, 5, 20, 14, 5, 0, 0, time.UTC)
+	if record.Path != path.Join(directory, "14h05.wav") {
+		t.Errorf("Wrong record path :\n got: %v", record.Path)
+	}
+	if !record.Start.Equal(expectedStart) || record.End.Sub(record.Start) != 2267573*time.Nanosecond {
+		t.Errorf("Wrong record times :\n got: %v - %v", record.Start, record.End)
+	}
+	if record.SampleCount != 100 || record.Format != "wav" {
+		t.Errorf("Wrong record content :\n got: %v samples, %v", record.SampleCount, record.Format)
+	}
+}
+
+func TestRecordRepair_Run_missingRoot(t *testing.T) {
+	repair := RecordRepair{RootDirectory: "/dummy/records"}
+
+	if _, err := repair.Run(); err != nil {
+		t.Errorf("Should ignore a missing root directory :\n got: %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package broadcast
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const megabyte = 1024 * 1024
+
+// RecordRetention removes the oldest files under RootDirectory when they're
+// older than MaxAge, when the total size exceeds MaxSize or when the free
+// disk space is lower than MinFreeSpace.
+//
+// The file returned by CurrentFile (the file being recorded) is never removed.
+// The limits can be modified by RecordRetentionConfig.Apply while running.
+type RecordRetention struct {
+	RootDirectory string
+	MaxAge        time.Duration
+	MaxSize       int64
+	MinFreeSpace  int64
+	CheckInterval time.Duration
+
+	CurrentFile func() string
+
+	Metrics  *LocalMetrics
+	EventLog *LocalEventLog
+
+	diskNearlyFull bool
+	mutex          sync.Mutex
+	loops          runLoops
+}
+
+type RecordFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+type RecordFiles []RecordFile
+
+func (files RecordFiles) Len() int           { return len(files) }
+func (files RecordFiles) Swap(i, j int)      { files[i], files[j] = files[j], files[i] }
+func (files RecordFiles) Less(i, j int) bool { return files[i].ModTime.Before(files[j].ModTime) }
+
+func (files RecordFiles) Size() int64 {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return size
+}
+
+func (retention *RecordRetention) metrics() *LocalMetrics {
+	if retention.Metrics == nil {
+		retention.Metrics = &LocalMetrics{prefix: "retention"}
+	}
+	return retention.Metrics
+}
+
+func (retention *RecordRetention) eventLog() *LocalEventLog {
+	if retention.EventLog == nil {
+		retention.EventLog = &LocalEventLog{Source: "retention"}
+	}
+	return retention.EventLog
+}
+
+func (retention *RecordRetention) IsEnabled() bool {
+	retention.mutex.Lock()
+	defer retention.mutex.Unlock()
+
+	return retention.RootDirectory != "" && (retention.MaxAge > 0 || retention.MaxSize > 0 || retention.MinFreeSpace > 0)
+}
+
+// Returns the files under RootDirectory, oldest first
+func (retention *RecordRetention) Files() (RecordFiles, error) {
+	files := RecordFiles{}
+
+	err := filepath.Walk(retention.RootDirectory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Hidden directories (like the webhook queue) aren't records
+		if info.IsDir() && filePath != retention.RootDirectory && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		// Manifests are removed with the last file of their day
+		if info.Mode().IsRegular() && info.Name() != recordManifestName {
+			files = append(files, RecordFile{Path: filePath, Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(files)
+	return files, nil
+}
+
+func (retention *RecordRetention) FreeSpace() (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(retention.RootDirectory, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+func (retention *RecordRetention) expired(file RecordFile, now time.Time, totalSize int64, freeSpace int64) bool {
+	if retention.MaxAge > 0 && now.Sub(file.ModTime) > retention.MaxAge {
+		return true
+	}
+	if retention.MaxSize > 0 && totalSize > retention.MaxSize {
+		return true
+	}
+	if retention.MinFreeSpace > 0 && freeSpace < retention.MinFreeSpace {
+		return true
+	}
+	return false
+}
+
+func (retention *RecordRetention) currentFile() string {
+	if retention.CurrentFile == nil {
+		return ""
+	}
+	if currentFile := retention.CurrentFile(); currentFile != "" {
+		return path.Clean(currentFile)
+	}
+	return ""
+}
+
+func (retention *RecordRetention) Check(now time.Time) error {
+	retention.mutex.Lock()
+	defer retention.mutex.Unlock()
+
+	files, err := retention.Files()
+	if err != nil {
+		return err
+	}
+
+	freeSpace, err := retention.FreeSpace()
+	if err != nil {
+		return err
+	}
+
+	totalSize := files.Size()
+
+	var removedCount int
+	var removedSize int64
+
+	currentFile := retention.currentFile()
+	for _, file := range files {
+		if path.Clean(file.Path) == currentFile {
+			continue
+		}
+		if !retention.expired(file, now, totalSize, freeSpace) {
+			break
+		}
+
+		Log.Debugf("Remove expired file %s", file.Path)
+		err := os.Remove(file.Path)
+		if err != nil {
+			Log.Printf("Can't remove expired file %s : %v", file.Path, err)
+			continue
+		}
+		retention.removeEmptyDirectories(path.Dir(file.Path))
+
+		removedCount += 1
+		removedSize += file.Size
+		totalSize -= file.Size
+		freeSpace += file.Size
+	}
+
+	if removedCount > 0 {
+		retention.eventLog().NewEvent(fmt.Sprintf("Removed %d file(s) (%d MB)", removedCount, removedSize/megabyte))
+		retention.metrics().Counter("RemovedFiles").Inc(int64(removedCount))
+	}
+
+	if retention.MinFreeSpace > 0 && freeSpace < retention.MinFreeSpace {
+		if !retention.diskNearlyFull {
+			retention.eventLog().NewEvent(fmt.Sprintf("Disk nearly full (%d MB free)", freeSpace/megabyte))
+		}
+		retention.diskNearlyFull = true
+	} else {
+		retention.diskNearlyFull = false
+	}
+
+	retention.metrics().Gauge("FileCount").Update(int64(len(files) - removedCount))
+	retention.metrics().Gauge("Size").Update(totalSize)
+	retention.metrics().Gauge("FreeSpace").Update(freeSpace)
+
+	return nil
+}
+
+func (retention *RecordRetention) removeEmptyDirectories(directory string) {
+	root := path.Clean(retention.RootDirectory)
+
+	if files, _ := ioutil.ReadDir(directory); len(files) == 1 && files[0].Name() == recordManifestName {
+		os.Remove(path.Join(directory, recordManifestName))
+	}
+
+	for directory != root && strings.HasPrefix(directory, root) {
+		// os.Remove fails on non empty directory
+		if os.Remove(directory) != nil {
+			return
+		}
+		Log.Debugf("Remove empty directory %s", directory)
+		directory = path.Dir(directory)
+	}
+}
+
+func (retention *RecordRetention) Run() {
+	if !retention.loops.Start() {
+		return
+	}
+	defer retention.loops.Done()
+
+	if retention.CheckInterval == 0 {
+		retention.CheckInterval = time.Minute
+	}
+
+	for {
+		err := retention.Check(time.Now())
+		if err != nil {
+			Log.Printf("Can't check record retention : %v", err)
+		}
+
+		select {
+		case <-retention.loops.Stopping():
+			return
+		case <-time.After(retention.CheckInterval):
+		}
+	}
+}
+
+// Stops the Run loop and waits the end of the current check
+func (retention *RecordRetention) Stop() error {
+	retention.loops.Stop()
+	retention.loops.Wait()
+	return nil
+}
+
+type RecordRetentionConfig struct {
+	MaxAge       time.Duration
+	MaxSize      int64
+	MinFreeSpace int64
+}
+
+func (config *RecordRetentionConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.DurationVar(&config.MaxAge, strings.Join([]string{prefix, "max-age"}, "-"), 0, "The maximum age of saved files (0 to disable)")
+	flags.Int64Var(&config.MaxSize, strings.Join([]string{prefix, "max-size"}, "-"), 0, "The maximum total size of saved files in MB (0 to disable)")
+	flags.Int64Var(&config.MinFreeSpace, strings.Join([]string{prefix, "min-free-space"}, "-"), 0, "The minimum free disk space in MB (0 to disable)")
+}
+
+func (config *RecordRetentionConfig) Validate(errors *ConfigErrors) {
+	if config.MaxAge < 0 {
+		errors.Add("MaxAge", "can't be negative")
+	}
+	if config.MaxSize < 0 {
+		errors.Add("MaxSize", "can't be negative")
+	}
+	if config.MinFreeSpace < 0 {
+		errors.Add("MinFreeSpace", "can't be negative")
+	}
+}
+
+func (config *RecordRetentionConfig) Apply(retention *RecordRetention, rootDirectory string) {
+	retention.mutex.Lock()
+	defer retention.mutex.Unlock()
+
+	retention.RootDirectory = rootDirectory
+	retention.MaxAge = config.MaxAge
+	retention.MaxSize = config.MaxSize * megabyte
+	retention.MinFreeSpace = config.MinFreeSpace * megabyte
+}
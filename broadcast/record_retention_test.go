@@ -0,0 +1,209 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func testRecordRetention(t *testing.T) (*RecordRetention, time.Time) {
+	tempDir, err := ioutil.TempDir("", "recordretention")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	files := []string{
+		"2015/05-May/20-Wed/10h00.wav",
+		"2015/05-May/21-Thu/10h00.wav",
+		"2015/05-May/22-Fri/10h00.wav",
+		"2015/05-May/23-Sat/10h00.wav",
+	}
+	for index, file := range files {
+		fileName := path.Join(tempDir, file)
+		os.MkdirAll(path.Dir(fileName), 0775)
+		ioutil.WriteFile(fileName, make([]byte, megabyte), 0644)
+
+		modTime := now.Add(time.Duration(index-len(files)+1) * 24 * time.Hour)
+		os.Chtimes(fileName, modTime, modTime)
+	}
+
+	retention := &RecordRetention{
+		RootDirectory: tempDir,
+		EventLog:      &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "retention"},
+	}
+	return retention, now
+}
+
+func TestRecordRetention_Files(t *testing.T) {
+	retention, _ := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	files, err := retention.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 4 {
+		t.Fatalf("Wrong file count :\n got: %v\nwant: %v", len(files), 4)
+	}
+	if path.Base(path.Dir(files[0].Path)) != "20-Wed" {
+		t.Errorf("Oldest file should be first :\n got: %v", files[0].Path)
+	}
+	if files.Size() != 4*megabyte {
+		t.Errorf("Wrong total size :\n got: %v\nwant: %v", files.Size(), 4*megabyte)
+	}
+}
+
+func TestRecordRetention_Files_hiddenDirectory(t *testing.T) {
+	retention, _ := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	queueDirectory := path.Join(retention.RootDirectory, ".webhook")
+	os.MkdirAll(queueDirectory, 0775)
+	ioutil.WriteFile(path.Join(queueDirectory, "1.json"), []byte("{}"), 0644)
+
+	files, _ := retention.Files()
+	if len(files) != 4 {
+		t.Errorf("Files in hidden directories should be ignored :\n got: %v\nwant: %v", len(files), 4)
+	}
+}
+
+func TestRecordRetention_Check_maxAge(t *testing.T) {
+	retention, now := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	retention.MaxAge = 36 * time.Hour
+
+	err := retention.Check(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := retention.Files()
+	if len(files) != 2 {
+		t.Errorf("Files older than MaxAge should be removed :\n got: %v\nwant: %v", len(files), 2)
+	}
+
+	if _, err := os.Stat(path.Join(retention.RootDirectory, "2015/05-May/20-Wed")); !os.IsNotExist(err) {
+		t.Errorf("Empty day directory should be removed")
+	}
+	if _, err := os.Stat(path.Join(retention.RootDirectory, "2015/05-May")); err != nil {
+		t.Errorf("Not empty month directory should be kept")
+	}
+
+	events := retention.eventLog().Events()
+	if len(events) != 1 || events[0].Message != "Removed 2 file(s) (2 MB)" {
+		t.Errorf("Wrong retention events :\n got: %v", events)
+	}
+}
+
+func TestRecordRetention_Check_manifest(t *testing.T) {
+	retention, now := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	manifestFile := path.Join(retention.RootDirectory, "2015/05-May/20-Wed", recordManifestName)
+	ioutil.WriteFile(manifestFile, []byte("{}"), 0644)
+
+	files, _ := retention.Files()
+	if len(files) != 4 {
+		t.Errorf("Manifests shouldn't be record files :\n got: %v\nwant: %v", len(files), 4)
+	}
+
+	retention.MaxAge = 60 * time.Hour
+	retention.Check(now)
+
+	if _, err := os.Stat(path.Join(retention.RootDirectory, "2015/05-May/20-Wed")); !os.IsNotExist(err) {
+		t.Errorf("Day directory with only a manifest should be removed")
+	}
+}
+
+func TestRecordRetention_Check_maxSize(t *testing.T) {
+	retention, now := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	retention.MaxSize = 3 * megabyte
+
+	retention.Check(now)
+
+	files, _ := retention.Files()
+	if len(files) != 3 {
+		t.Errorf("Oldest files should be removed to respect MaxSize :\n got: %v\nwant: %v", len(files), 3)
+	}
+}
+
+func TestRecordRetention_Check_keepCurrentFile(t *testing.T) {
+	retention, now := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	currentFile := path.Join(retention.RootDirectory, "2015/05-May/22-Fri/10h00.wav")
+	retention.CurrentFile = func() string { return currentFile }
+	retention.MaxSize = 1
+
+	retention.Check(now)
+
+	files, _ := retention.Files()
+	if len(files) != 1 || files[0].Path != currentFile {
+		t.Errorf("The current file should be kept :\n got: %v\nwant: %v", files, currentFile)
+	}
+}
+
+func TestRecordRetention_Stop(t *testing.T) {
+	retention, _ := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	retention.CheckInterval = time.Hour
+
+	stopped := make(chan bool)
+	go func() {
+		retention.Run()
+		close(stopped)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	retention.Stop()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("Run should return when the retention is stopped")
+	}
+}
+
+func TestRecordRetentionConfig_Apply(t *testing.T) {
+	config := RecordRetentionConfig{MaxAge: time.Hour, MaxSize: 100, MinFreeSpace: 10}
+	retention := &RecordRetention{}
+
+	config.Apply(retention, "/srv/pige")
+
+	if retention.RootDirectory != "/srv/pige" {
+		t.Errorf("Wrong RootDirectory :\n got: %v\nwant: %v", retention.RootDirectory, "/srv/pige")
+	}
+	if retention.MaxSize != 100*megabyte {
+		t.Errorf("Wrong MaxSize :\n got: %v\nwant: %v", retention.MaxSize, 100*megabyte)
+	}
+	if retention.MinFreeSpace != 10*megabyte {
+		t.Errorf("Wrong MinFreeSpace :\n got: %v\nwant: %v", retention.MinFreeSpace, 10*megabyte)
+	}
+	if !retention.IsEnabled() {
+		t.Errorf("Retention should be enabled")
+	}
+}
+
+func TestRecordRetentionConfig_Apply_running(t *testing.T) {
+	retention, _ := testRecordRetention(t)
+	defer os.RemoveAll(retention.RootDirectory)
+
+	retention.CheckInterval = time.Millisecond
+	go retention.Run()
+	defer retention.Stop()
+
+	// Reloaded config is applied while the retention checks the files
+	for maxAge := 1; maxAge <= 10; maxAge++ {
+		config := RecordRetentionConfig{MaxAge: time.Duration(maxAge) * 24 * time.Hour}
+		config.Apply(retention, retention.RootDirectory)
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,147 @@
+package broadcast
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// A RecordVerifier checks the files under RootDirectory against the signed
+// manifests written by RecordSigner
+type RecordVerifier struct {
+	RootDirectory string
+	PublicKey     *ecdsa.PublicKey
+}
+
+type RecordProblem struct {
+	Path    string
+	Problem string
+}
+
+func (problem RecordProblem) String() string {
+	return fmt.Sprintf("%s: %s", problem.Path, problem.Problem)
+}
+
+type RecordVerification struct {
+	ManifestCount int
+	FileCount     int
+	// Files removed by the record retention
+	ExpiredCount int
+	Problems     []RecordProblem
+}
+
+func (verification *RecordVerification) IsValid() bool {
+	return len(verification.Problems) == 0
+}
+
+func (verification *RecordVerification) problem(path string, format string, arguments ...interface{}) {
+	verification.Problems = append(verification.Problems, RecordProblem{Path: path, Problem: fmt.Sprintf(format, arguments...)})
+}
+
+func (verifier *RecordVerifier) Verify() (*RecordVerification, error) {
+	verification := &RecordVerification{Problems: []RecordProblem{}}
+
+	manifestFiles, err := RecordManifestFiles(verifier.RootDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	var previousHash string
+	for index, manifestFile := range manifestFiles {
+		relativeManifestFile, _ := filepath.Rel(verifier.RootDirectory, manifestFile)
+
+		manifest, err := LoadRecordManifest(manifestFile)
+		if err != nil {
+			verification.problem(relativeManifestFile, "unreadable manifest (%v)", err)
+			previousHash = ""
+			continue
+		}
+		verification.ManifestCount += 1
+
+		if !manifest.VerifySignature(verifier.PublicKey) {
+			verification.problem(relativeManifestFile, "invalid signature")
+		}
+
+		// Older days can be removed by retention, the chain starts with the first manifest
+		if index == 0 && len(manifest.Entries) > 0 {
+			previousHash = manifest.Entries[0].Previous
+		}
+
+		signedFiles := make(map[string]bool)
+		var previousEntry *RecordManifestEntry
+
+		// The oldest files of the first manifest can be removed by the record retention
+		expiring := index == 0
+
+		for entryIndex := range manifest.Entries {
+			entry := &manifest.Entries[entryIndex]
+			signedFiles[entry.Path] = true
+
+			if expiring && verifier.missing(entry) {
+				verification.ExpiredCount += 1
+			} else {
+				expiring = false
+				verifier.verifyEntry(verification, entry, previousHash)
+			}
+			if previousEntry != nil && entry.Start.Before(previousEntry.Start) {
+				verification.problem(entry.Path, "out of order (starts before %s)", previousEntry.Path)
+			}
+
+			previousHash = entry.Hash
+			previousEntry = entry
+		}
+
+		verifier.verifyUnsignedFiles(verification, path.Dir(manifestFile), signedFiles)
+	}
+
+	return verification, nil
+}
+
+func (verifier *RecordVerifier) missing(entry *RecordManifestEntry) bool {
+	_, err := os.Stat(path.Join(verifier.RootDirectory, entry.Path))
+	return os.IsNotExist(err)
+}
+
+func (verifier *RecordVerifier) verifyEntry(verification *RecordVerification, entry *RecordManifestEntry, previousHash string) {
+	verification.FileCount += 1
+
+	if entry.Previous != previousHash {
+		verification.problem(entry.Path, "broken chain (previous hash doesn't match)")
+	}
+	if entry.ComputeHash() != entry.Hash {
+		verification.problem(entry.Path, "invalid hash in manifest")
+	}
+
+	if verifier.missing(entry) {
+		verification.problem(entry.Path, "missing")
+		return
+	}
+
+	checksum, err := FileChecksum(path.Join(verifier.RootDirectory, entry.Path))
+	if err != nil {
+		verification.problem(entry.Path, "unreadable (%v)", err)
+		return
+	}
+	if checksum != entry.Checksum {
+		verification.problem(entry.Path, "modified (checksum doesn't match)")
+	}
+}
+
+// Reports the recordings of the day directory which aren't in the manifest
+func (verifier *RecordVerifier) verifyUnsignedFiles(verification *RecordVerification, directory string, signedFiles map[string]bool) {
+	files, _ := filepath.Glob(path.Join(directory, "*"))
+
+	for _, file := range files {
+		if _, err := parseRecordingStart(time.Time{}, path.Base(file)); err != nil {
+			continue
+		}
+
+		relativePath, _ := filepath.Rel(verifier.RootDirectory, file)
+		if !signedFiles[relativePath] {
+			verification.problem(relativePath, "not in manifest")
+		}
+	}
+}
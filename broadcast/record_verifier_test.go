@@ -0,0 +1,168 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func testRecordVerifier(t *testing.T) (*RecordVerifier, *RecordSigner) {
+	signer := testRecordSigner(t)
+
+	signRecord(t, signer, "2015/05-May/20-Wed/10h00.wav", "first")
+	signRecord(t, signer, "2015/05-May/20-Wed/11h00.wav", "second")
+	signRecord(t, signer, "2015/05-May/21-Thu/10h00.wav", "third")
+
+	verifier := &RecordVerifier{RootDirectory: signer.RootDirectory, PublicKey: &signer.Key.PublicKey}
+	return verifier, signer
+}
+
+func verifyProblems(t *testing.T, verifier *RecordVerifier) []RecordProblem {
+	verification, err := verifier.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verification.Problems
+}
+
+func TestRecordVerifier_Verify(t *testing.T) {
+	verifier, _ := testRecordVerifier(t)
+	defer os.RemoveAll(path.Dir(verifier.RootDirectory))
+
+	verification, err := verifier.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !verification.IsValid() {
+		t.Errorf("Untouched files should be valid :\n got: %v", verification.Problems)
+	}
+	if verification.ManifestCount != 2 {
+		t.Errorf("Wrong manifest count :\n got: %v\nwant: %v", verification.ManifestCount, 2)
+	}
+	if verification.FileCount != 3 {
+		t.Errorf("Wrong file count :\n got: %v\nwant: %v", verification.FileCount, 3)
+	}
+}
+
+func TestRecordVerifier_Verify_problems(t *testing.T) {
+	conditions := []struct {
+		change  func(root string)
+		path    string
+		problem string
+	}{
+		{
+			func(root string) {
+				ioutil.WriteFile(path.Join(root, "2015/05-May/20-Wed/11h00.wav"), []byte("modified"), 0644)
+			},
+			"2015/05-May/20-Wed/11h00.wav",
+			"modified (checksum doesn't match)",
+		},
+		{
+			func(root string) { os.Remove(path.Join(root, "2015/05-May/20-Wed/11h00.wav")) },
+			"2015/05-May/20-Wed/11h00.wav",
+			"missing",
+		},
+		{
+			func(root string) {
+				ioutil.WriteFile(path.Join(root, "2015/05-May/21-Thu/12h00.wav"), []byte("added"), 0644)
+			},
+			"2015/05-May/21-Thu/12h00.wav",
+			"not in manifest",
+		},
+		{
+			func(root string) {
+				manifestFile := path.Join(root, "2015/05-May/21-Thu", recordManifestName)
+				manifest, _ := LoadRecordManifest(manifestFile)
+				manifest.Day = "2015-05-22"
+				manifest.Save(manifestFile)
+			},
+			"2015/05-May/21-Thu/" + recordManifestName,
+			"invalid signature",
+		},
+	}
+
+	for _, condition := range conditions {
+		verifier, _ := testRecordVerifier(t)
+		condition.change(verifier.RootDirectory)
+
+		problems := verifyProblems(t, verifier)
+		expectedProblem := RecordProblem{Path: condition.path, Problem: condition.problem}
+		if len(problems) != 1 || problems[0] != expectedProblem {
+			t.Errorf("Wrong problems :\n got: %v\nwant: %v", problems, expectedProblem)
+		}
+
+		os.RemoveAll(path.Dir(verifier.RootDirectory))
+	}
+}
+
+func TestRecordVerifier_Verify_outOfOrder(t *testing.T) {
+	verifier, signer := testRecordVerifier(t)
+	defer os.RemoveAll(path.Dir(verifier.RootDirectory))
+
+	signRecord(t, signer, "2015/05-May/21-Thu/09h00.wav", "fourth")
+
+	problems := verifyProblems(t, verifier)
+	expectedProblem := RecordProblem{Path: "2015/05-May/21-Thu/09h00.wav", Problem: "out of order (starts before 2015/05-May/21-Thu/10h00.wav)"}
+	if len(problems) != 1 || problems[0] != expectedProblem {
+		t.Errorf("Wrong problems :\n got: %v\nwant: %v", problems, expectedProblem)
+	}
+}
+
+func TestRecordVerifier_Verify_brokenChain(t *testing.T) {
+	verifier, signer := testRecordVerifier(t)
+	defer os.RemoveAll(path.Dir(verifier.RootDirectory))
+
+	// A removed entry is detected even if the manifest is signed again
+	manifestFile := path.Join(verifier.RootDirectory, "2015/05-May/20-Wed", recordManifestName)
+	manifest, _ := LoadRecordManifest(manifestFile)
+	manifest.Entries = manifest.Entries[:1]
+	manifest.Sign(signer.Key)
+	manifest.Save(manifestFile)
+	os.Remove(path.Join(verifier.RootDirectory, "2015/05-May/20-Wed/11h00.wav"))
+
+	problems := verifyProblems(t, verifier)
+	expectedProblem := RecordProblem{Path: "2015/05-May/21-Thu/10h00.wav", Problem: "broken chain (previous hash doesn't match)"}
+	if len(problems) != 1 || problems[0] != expectedProblem {
+		t.Errorf("Wrong problems :\n got: %v\nwant: %v", problems, expectedProblem)
+	}
+}
+
+func TestRecordVerifier_Verify_retimedEntry(t *testing.T) {
+	verifier, signer := testRecordVerifier(t)
+	defer os.RemoveAll(path.Dir(verifier.RootDirectory))
+
+	// A retimed entry is detected even if the manifest is signed again
+	manifestFile := path.Join(verifier.RootDirectory, "2015/05-May/20-Wed", recordManifestName)
+	manifest, _ := LoadRecordManifest(manifestFile)
+	manifest.Entries[1].Start = manifest.Entries[1].Start.Add(time.Minute)
+	manifest.Sign(signer.Key)
+	manifest.Save(manifestFile)
+
+	problems := verifyProblems(t, verifier)
+	expectedProblem := RecordProblem{Path: "2015/05-May/20-Wed/11h00.wav", Problem: "invalid hash in manifest"}
+	if len(problems) != 1 || problems[0] != expectedProblem {
+		t.Errorf("Wrong problems :\n got: %v\nwant: %v", problems, expectedProblem)
+	}
+}
+
+func TestRecordVerifier_Verify_expiredFiles(t *testing.T) {
+	verifier, _ := testRecordVerifier(t)
+	defer os.RemoveAll(path.Dir(verifier.RootDirectory))
+
+	os.Remove(path.Join(verifier.RootDirectory, "2015/05-May/20-Wed/10h00.wav"))
+
+	verification, err := verifier.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !verification.IsValid() {
+		t.Errorf("Oldest files removed by retention should be valid :\n got: %v", verification.Problems)
+	}
+	if verification.ExpiredCount != 1 {
+		t.Errorf("Wrong expired count :\n got: %v\nwant: %v", verification.ExpiredCount, 1)
+	}
+}
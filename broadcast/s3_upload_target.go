@@ -0,0 +1,317 @@
+package broadcast
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3UploadTarget uploads files into an S3 compatible bucket (AWS, MinIO,
+// ...). Large files are sent with multipart uploads, resumed part by part.
+type S3UploadTarget struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+
+	// Files larger than PartSize use multipart uploads
+	PartSize int64
+
+	Client *http.Client
+}
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (target *S3UploadTarget) client() *http.Client {
+	if target.Client == nil {
+		target.Client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	return target.Client
+}
+
+func (target *S3UploadTarget) partSize() int64 {
+	// S3 requires at least 5MB by part
+	if target.PartSize == 0 {
+		target.PartSize = 16 * megabyte
+	}
+	return target.PartSize
+}
+
+func (target *S3UploadTarget) objectURL(key string) string {
+	objectPath := path.Join(target.Bucket, target.Prefix, key)
+	return strings.TrimSuffix(target.Endpoint, "/") + "/" + awsEscape(objectPath, false)
+}
+
+// Encodes the given string as required by AWS signatures (RFC 3986)
+func awsEscape(value string, encodeSlash bool) string {
+	var escaped bytes.Buffer
+	for _, character := range []byte(value) {
+		switch {
+		case 'A' <= character && character <= 'Z', 'a' <= character && character <= 'z', '0' <= character && character <= '9',
+			character == '-', character == '_', character == '.', character == '~':
+			escaped.WriteByte(character)
+		case character == '/' && !encodeSlash:
+			escaped.WriteByte(character)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", character)
+		}
+	}
+	return escaped.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Signs the request with AWS Signature Version 4
+func (target *S3UploadTarget) sign(request *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range headerNames {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	query := request.URL.Query()
+	queryNames := make([]string, 0, len(query))
+	for name := range query {
+		queryNames = append(queryNames, name)
+	}
+	sort.Strings(queryNames)
+
+	queryParameters := make([]string, 0, len(query))
+	for _, name := range queryNames {
+		for _, value := range query[name] {
+			queryParameters = append(queryParameters, awsEscape(name, true)+"="+awsEscape(value, true))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		strings.Join(queryParameters, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, target.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+target.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, target.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", target.AccessKey, scope, signedHeaders, signature))
+}
+
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// Sends a signed request and returns the response body
+func (target *S3UploadTarget) do(method string, url string, body []byte, payloadHash string, headers map[string]string) (*http.Response, []byte, error) {
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	target.sign(request, payloadHash, time.Now())
+
+	response, err := target.client().Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		var s3Error s3Error
+		xml.Unmarshal(responseBody, &s3Error)
+		return response, responseBody, fmt.Errorf("S3 error '%s' (%s) : %s", response.Status, s3Error.Code, s3Error.Message)
+	}
+
+	return response, responseBody, nil
+}
+
+func contentMD5(data []byte) (string, string) {
+	hash := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(hash[:]), hex.EncodeToString(hash[:])
+}
+
+func (target *S3UploadTarget) Upload(job *UploadJob, progress func()) error {
+	file, err := os.Open(job.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if job.Size <= target.partSize() {
+		return target.putObject(job, file)
+	}
+	return target.multipartUpload(job, file, progress)
+}
+
+func (target *S3UploadTarget) putObject(job *UploadJob, file io.Reader) error {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	// S3 checks the signed payload hash and the Content-MD5 header
+	if sha256Hex(data) != job.Checksum {
+		return errors.New("File changed since checksum computation")
+	}
+
+	md5Base64, _ := contentMD5(data)
+	headers := map[string]string{"Content-MD5": md5Base64, "X-Amz-Meta-Sha256": job.Checksum}
+
+	_, _, err = target.do("PUT", target.objectURL(job.Key), data, job.Checksum, headers)
+	if err != nil {
+		return err
+	}
+
+	job.UploadedSize = job.Size
+	return nil
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadId string
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+func (target *S3UploadTarget) multipartUpload(job *UploadJob, file io.ReaderAt, progress func()) error {
+	objectURL := target.objectURL(job.Key)
+
+	if job.UploadId == "" {
+		_, body, err := target.do("POST", objectURL+"?uploads", nil, emptyPayloadHash, map[string]string{"X-Amz-Meta-Sha256": job.Checksum})
+		if err != nil {
+			return err
+		}
+
+		var result s3InitiateMultipartUploadResult
+		if err := xml.Unmarshal(body, &result); err != nil || result.UploadId == "" {
+			return fmt.Errorf("Invalid multipart upload response : %v", err)
+		}
+
+		job.UploadId, job.Parts, job.UploadedSize = result.UploadId, nil, 0
+		progress()
+	}
+
+	for job.UploadedSize < job.Size {
+		partSize := job.Size - job.UploadedSize
+		if partSize > target.partSize() {
+			partSize = target.partSize()
+		}
+
+		data := make([]byte, partSize)
+		if _, err := file.ReadAt(data, job.UploadedSize); err != nil {
+			return err
+		}
+
+		number := len(job.Parts) + 1
+		md5Base64, md5Hex := contentMD5(data)
+		partURL := fmt.Sprintf("%s?partNumber=%d&uploadId=%s", objectURL, number, awsEscape(job.UploadId, true))
+
+		response, _, err := target.do("PUT", partURL, data, sha256Hex(data), map[string]string{"Content-MD5": md5Base64})
+		if response != nil && response.StatusCode == 404 {
+			// The multipart upload has expired or been aborted
+			job.UploadId, job.Parts, job.UploadedSize = "", nil, 0
+			progress()
+		}
+		if err != nil {
+			return err
+		}
+
+		etag := response.Header.Get("ETag")
+		if strings.Trim(etag, "\"") != md5Hex {
+			return fmt.Errorf("Checksum mismatch for part %d (%s)", number, etag)
+		}
+
+		job.Parts = append(job.Parts, UploadPart{Number: number, Size: partSize, ETag: etag})
+		job.UploadedSize += partSize
+		progress()
+	}
+
+	complete := s3CompleteMultipartUpload{}
+	for _, part := range job.Parts {
+		complete.Parts = append(complete.Parts, s3CompletedPart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	body, _ := xml.Marshal(complete)
+
+	_, responseBody, err := target.do("POST", objectURL+"?uploadId="+awsEscape(job.UploadId, true), body, sha256Hex(body), nil)
+	if err != nil {
+		return err
+	}
+
+	// S3 can return an error after a 200 status
+	var s3Error s3Error
+	if xml.Unmarshal(responseBody, &s3Error) == nil && s3Error.Code != "" {
+		return fmt.Errorf("S3 error (%s) : %s", s3Error.Code, s3Error.Message)
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package broadcast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A RecordWindow is a weekly time range, like "mon-fri 06:00-09:00".
+// A window which ends before its start continues the next day.
+type RecordWindow struct {
+	Days  [7]bool
+	Start time.Duration
+	End   time.Duration
+}
+
+func (window *RecordWindow) Contains(timestamp time.Time) bool {
+	midnight := time.Date(timestamp.Year(), timestamp.Month(), timestamp.Day(), 0, 0, 0, 0, timestamp.Location())
+	timeOfDay := timestamp.Sub(midnight)
+	day := timestamp.Weekday()
+
+	if window.Start < window.End {
+		return window.Days[day] && timeOfDay >= window.Start && timeOfDay < window.End
+	}
+
+	previousDay := (day + 6) % 7
+	return (window.Days[day] && timeOfDay >= window.Start) || (window.Days[previousDay] && timeOfDay < window.End)
+}
+
+type RecordSchedule []RecordWindow
+
+func (schedule RecordSchedule) Contains(timestamp time.Time) bool {
+	for _, window := range schedule {
+		if window.Contains(timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+var recordWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseRecordWeekday(name string) (time.Weekday, error) {
+	for index, weekday := range recordWeekdays {
+		if strings.ToLower(name) == weekday {
+			return time.Weekday(index), nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid day: '%s'", name)
+}
+
+// Parses "hh:mm" as a duration since midnight
+func parseRecordTimeOfDay(definition string) (time.Duration, error) {
+	parts := strings.Split(definition, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("Invalid time: '%s'", definition)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, fmt.Errorf("Invalid time: '%s'", definition)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("Invalid time: '%s'", definition)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// Parses a window like "mon-fri 06:00-09:00", "sat+sun 10:00-12:00" or "* 22:00-02:00"
+func ParseRecordWindow(definition string) (RecordWindow, error) {
+	window := RecordWindow{}
+
+	fields := strings.Fields(definition)
+	if len(fields) != 2 {
+		return window, fmt.Errorf("Invalid record window: '%s'", definition)
+	}
+
+	for _, days := range strings.Split(fields[0], "+") {
+		if days == "*" {
+			for day := range window.Days {
+				window.Days[day] = true
+			}
+			continue
+		}
+
+		bounds := strings.Split(days, "-")
+		first, err := parseRecordWeekday(bounds[0])
+		if err != nil {
+			return window, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = parseRecordWeekday(bounds[1])
+			if err != nil {
+				return window, err
+			}
+		} else if len(bounds) > 2 {
+			return window, fmt.Errorf("Invalid days: '%s'", days)
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			window.Days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	times := strings.Split(fields[1], "-")
+	if len(times) != 2 {
+		return window, fmt.Errorf("Invalid time range: '%s'", fields[1])
+	}
+
+	var err error
+	if window.Start, err = parseRecordTimeOfDay(times[0]); err != nil {
+		return window, err
+	}
+	if window.End, err = parseRecordTimeOfDay(times[1]); err != nil {
+		return window, err
+	}
+	if window.Start == window.End {
+		return window, fmt.Errorf("Empty time range: '%s'", fields[1])
+	}
+
+	return window, nil
+}
+
+// Parses windows separated by commas : "mon-fri 06:00-09:00, sat+sun 10:00-12:00"
+func ParseRecordSchedule(definition string) (RecordSchedule, error) {
+	schedule := RecordSchedule{}
+
+	for _, windowDefinition := range strings.Split(definition, ",") {
+		if strings.TrimSpace(windowDefinition) == "" {
+			continue
+		}
+
+		window, err := ParseRecordWindow(windowDefinition)
+		if err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, window)
+	}
+
+	if len(schedule) == 0 {
+		return nil, fmt.Errorf("Empty record schedule")
+	}
+	return schedule, nil
+}
+
+// A ScheduledRecorder only records during the Schedule windows (evaluated
+// in Location)
+type ScheduledRecorder struct {
+	Output   RecordOutput
+	Schedule RecordSchedule
+	Location *time.Location
+
+	EventLog *LocalEventLog
+
+	active bool
+}
+
+func (recorder *ScheduledRecorder) eventLog() *LocalEventLog {
+	if recorder.EventLog == nil {
+		recorder.EventLog = &LocalEventLog{Source: "record"}
+	}
+	return recorder.EventLog
+}
+
+func (recorder *ScheduledRecorder) location() *time.Location {
+	if recorder.Location == nil {
+		recorder.Location = time.Local
+	}
+	return recorder.Location
+}
+
+func (recorder *ScheduledRecorder) IsRecording() bool {
+	return recorder.active
+}
+
+func (recorder *ScheduledRecorder) AudioOut(audio *Audio) {
+	scheduled := recorder.Schedule.Contains(audio.Timestamp().In(recorder.location()))
+
+	if scheduled && !recorder.active {
+		recorder.active = true
+		recorder.eventLog().NewEvent("Start scheduled recording")
+	}
+	if !scheduled && recorder.active {
+		recorder.active = false
+
+		err := recorder.Output.Stop()
+		if err != nil {
+			Log.Printf("Can't stop recording : %v", err)
+		}
+		recorder.eventLog().NewEvent("Stop scheduled recording")
+	}
+
+	if recorder.active {
+		recorder.Output.AudioOut(audio)
+	}
+}
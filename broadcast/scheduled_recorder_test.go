@@ -0,0 +1,95 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecordWindow(t *testing.T) {
+	conditions := []struct {
+		definition string
+		timestamp  string
+		contained  bool
+	}{
+		{"mon-fri 06:00-09:00", "2015-05-20 06:00", true},
+		{"mon-fri 06:00-09:00", "2015-05-20 09:00", false},
+		{"mon-fri 06:00-09:00", "2015-05-23 07:00", false},
+		{"sat+sun 10:00-12:00", "2015-05-24 11:59", true},
+		{"fri-mon 10:00-12:00", "2015-05-25 11:00", true},
+		{"fri-mon 10:00-12:00", "2015-05-26 11:00", false},
+		{"* 22:00-02:00", "2015-05-20 23:00", true},
+		{"* 22:00-02:00", "2015-05-20 01:59", true},
+		{"sun 22:00-02:00", "2015-05-25 01:00", true},
+		{"sun 22:00-02:00", "2015-05-24 01:00", false},
+		{"wed 20:00-24:00", "2015-05-20 23:59", true},
+	}
+
+	for _, condition := range conditions {
+		window, err := ParseRecordWindow(condition.definition)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		timestamp, _ := time.Parse("2006-01-02 15:04", condition.timestamp)
+		if window.Contains(timestamp) != condition.contained {
+			t.Errorf("Wrong window inclusion for %s in '%s' :\n got: %v\nwant: %v", condition.timestamp, condition.definition, window.Contains(timestamp), condition.contained)
+		}
+	}
+}
+
+func TestParseRecordWindow_invalid(t *testing.T) {
+	for _, definition := range []string{"", "mon", "dummy 06:00-09:00", "mon 06:00", "mon 6h-9h", "mon 06:00-25:00", "mon 06:00-06:00", "mon-tue-wed 06:00-09:00"} {
+		if _, err := ParseRecordWindow(definition); err == nil {
+			t.Errorf("Should refuse invalid window '%s'", definition)
+		}
+	}
+}
+
+func TestParseRecordSchedule(t *testing.T) {
+	schedule, err := ParseRecordSchedule("mon-fri 06:00-09:00, sat+sun 10:00-12:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 2 {
+		t.Fatalf("Wrong window count :\n got: %v\nwant: %v", len(schedule), 2)
+	}
+
+	timestamp, _ := time.Parse("2006-01-02 15:04", "2015-05-23 10:30")
+	if !schedule.Contains(timestamp) {
+		t.Errorf("Schedule should contain %v", timestamp)
+	}
+
+	if _, err := ParseRecordSchedule(""); err == nil {
+		t.Errorf("Should refuse an empty schedule")
+	}
+}
+
+func TestScheduledRecorder_AudioOut(t *testing.T) {
+	output := &testRecordOutput{}
+	window := RecordWindow{Start: 10 * time.Hour, End: 10*time.Hour + 2*time.Second}
+	window.Days[time.Wednesday] = true
+
+	recorder := &ScheduledRecorder{
+		Output:   output,
+		Schedule: RecordSchedule{window},
+		Location: time.UTC,
+		EventLog: &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "record"},
+	}
+
+	start := time.Date(2015, 5, 20, 9, 59, 59, 0, time.UTC)
+	for second := 0; second < 5; second++ {
+		recorder.AudioOut(testRecordAudio(start, second, 0))
+	}
+
+	if len(output.audios) != 2 {
+		t.Errorf("Only scheduled audio should be recorded :\n got: %v\nwant: %v", len(output.audios), 2)
+	}
+	if output.stopCount != 1 {
+		t.Errorf("Recording should be stopped at the window end :\n got: %v\nwant: %v", output.stopCount, 1)
+	}
+
+	events := recorder.eventLog().Events()
+	if len(events) != 2 || events[0].Message != "Start scheduled recording" || events[1].Message != "Stop scheduled recording" {
+		t.Errorf("Wrong record events :\n got: %v", events)
+	}
+}
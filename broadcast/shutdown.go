@@ -0,0 +1,119 @@
+package broadcast
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A Shutdown stops the command components on SIGTERM or SIGINT.
+//
+// The steps are invoked in their registration order: inputs first, then
+// buffers, encoders and files. A step which exceeds Timeout (10 seconds by
+// default) is abandoned, the next steps are still invoked.
+type Shutdown struct {
+	Timeout time.Duration
+
+	EventLog *LocalEventLog
+
+	steps []shutdownStep
+}
+
+type shutdownStep struct {
+	name string
+	stop func() error
+}
+
+func (shutdown *Shutdown) eventLog() *LocalEventLog {
+	if shutdown.EventLog == nil {
+		shutdown.EventLog = &LocalEventLog{Source: "shutdown"}
+	}
+	return shutdown.EventLog
+}
+
+func (shutdown *Shutdown) timeout() time.Duration {
+	if shutdown.Timeout == 0 {
+		shutdown.Timeout = 10 * time.Second
+	}
+	return shutdown.Timeout
+}
+
+// Registers a step of the shutdown sequence
+func (shutdown *Shutdown) Add(name string, stop func() error) {
+	shutdown.steps = append(shutdown.steps, shutdownStep{name: name, stop: stop})
+}
+
+// Invokes the steps in order. Returns an error if a step exceeds Timeout.
+func (shutdown *Shutdown) Stop() error {
+	timedOutSteps := []string{}
+
+	for _, step := range shutdown.steps {
+		Log.Debugf("Stop %s", step.name)
+
+		result := make(chan error, 1)
+		go func(step shutdownStep) {
+			result <- step.stop()
+		}(step)
+
+		select {
+		case err := <-result:
+			if err != nil {
+				shutdown.eventLog().NewEvent(fmt.Sprintf("Can't stop %s: %v", step.name, err))
+			}
+		case <-time.After(shutdown.timeout()):
+			shutdown.eventLog().NewEvent(fmt.Sprintf("Timeout while stopping %s", step.name))
+			timedOutSteps = append(timedOutSteps, step.name)
+		}
+	}
+
+	if len(timedOutSteps) > 0 {
+		return fmt.Errorf("Shutdown timeout after %v while stopping %s", shutdown.timeout(), strings.Join(timedOutSteps, ", "))
+	}
+
+	shutdown.eventLog().NewEvent("Stopped")
+	return nil
+}
+
+// Waits for SIGTERM or SIGINT and stops the command. A second signal
+// interrupts the shutdown sequence.
+func (shutdown *Shutdown) Wait() error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	sig := <-signals
+	shutdown.eventLog().NewEvent(fmt.Sprintf("Receive %v signal, stop", sig))
+
+	result := make(chan error, 1)
+	go func() {
+		result <- shutdown.Stop()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case sig := <-signals:
+		return fmt.Errorf("Shutdown interrupted by %v signal", sig)
+	}
+}
+
+type ShutdownConfig struct {
+	Timeout time.Duration
+}
+
+func (config *ShutdownConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.DurationVar(&config.Timeout, strings.Join([]string{prefix, "timeout"}, "-"), 10*time.Second, "The maximum duration of each shutdown step (on SIGTERM or SIGINT)")
+}
+
+func (config *ShutdownConfig) Apply(shutdown *Shutdown) {
+	shutdown.Timeout = config.Timeout
+}
+
+func (config *ShutdownConfig) Validate(errors *ConfigErrors) {
+	if config.Timeout < 0 {
+		errors.Add("Timeout", "can't be negative")
+	}
+}
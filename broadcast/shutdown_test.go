@@ -0,0 +1,127 @@
+package broadcast
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testShutdown() *Shutdown {
+	return &Shutdown{EventLog: &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "shutdown"}}
+}
+
+func shutdownEventMessages(shutdown *Shutdown) []string {
+	messages := []string{}
+	for _, event := range shutdown.EventLog.Parent.Events() {
+		messages = append(messages, event.Message)
+	}
+	return messages
+}
+
+func TestShutdown_Stop(t *testing.T) {
+	shutdown := testShutdown()
+
+	stoppedSteps := []string{}
+	for _, name := range []string{"input", "output", "profilers"} {
+		name := name
+		shutdown.Add(name, func() error {
+			stoppedSteps = append(stoppedSteps, name)
+			return nil
+		})
+	}
+
+	err := shutdown.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSteps := []string{"input", "output", "profilers"}
+	if !reflect.DeepEqual(stoppedSteps, expectedSteps) {
+		t.Errorf("Steps should be stopped in order :\n got: %v\nwant: %v", stoppedSteps, expectedSteps)
+	}
+}
+
+func TestShutdown_Stop_error(t *testing.T) {
+	shutdown := testShutdown()
+
+	outputStopped := false
+	shutdown.Add("input", func() error { return errors.New("device busy") })
+	shutdown.Add("output", func() error {
+		outputStopped = true
+		return nil
+	})
+
+	err := shutdown.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !outputStopped {
+		t.Errorf("Next steps should be stopped after an error")
+	}
+
+	expectedMessages := []string{"Can't stop input: device busy", "Stopped"}
+	if messages := shutdownEventMessages(shutdown); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("Wrong events :\n got: %v\nwant: %v", messages, expectedMessages)
+	}
+}
+
+func TestShutdown_Stop_timeout(t *testing.T) {
+	shutdown := testShutdown()
+	shutdown.Timeout = 50 * time.Millisecond
+
+	blocked := make(chan bool)
+	defer close(blocked)
+
+	profilersStopped := false
+	shutdown.Add("input", func() error { return nil })
+	shutdown.Add("output", func() error {
+		<-blocked
+		return nil
+	})
+	shutdown.Add("profilers", func() error {
+		profilersStopped = true
+		return nil
+	})
+
+	err := shutdown.Stop()
+	if err == nil {
+		t.Errorf("Timeout should be returned")
+	}
+	if !profilersStopped {
+		t.Errorf("Steps after the timeout should be stopped")
+	}
+
+	expectedMessages := []string{"Timeout while stopping output"}
+	if messages := shutdownEventMessages(shutdown); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("Wrong events :\n got: %v\nwant: %v", messages, expectedMessages)
+	}
+}
+
+func TestShutdownConfig_Flags(t *testing.T) {
+	config := ShutdownConfig{}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	config.Flags(flags, "shutdown")
+
+	if config.Timeout != 10*time.Second {
+		t.Errorf("Wrong default timeout :\n got: %v\nwant: %v", config.Timeout, 10*time.Second)
+	}
+
+	flags.Parse(strings.Split("-shutdown-timeout 30s", " "))
+	if config.Timeout != 30*time.Second {
+		t.Errorf("Wrong config Timeout :\n got: %v\nwant: %v", config.Timeout, 30*time.Second)
+	}
+}
+
+func TestShutdownConfig_Validate(t *testing.T) {
+	errors := ConfigErrors{}
+	config := ShutdownConfig{Timeout: -1}
+	config.Validate(&errors)
+
+	if len(errors) != 1 || errors[0].Field != "Timeout" {
+		t.Errorf("Negative timeout should be refused :\n got: %v", errors)
+	}
+}
@@ -11,6 +11,7 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"time"
 	"unsafe"
 )
 
@@ -80,14 +81,84 @@ func (file *SndFile) WriteFloat(samples []float32) int64 {
 	return int64(C.sf_write_float(file.handle, (*C.float)(unsafe.Pointer(&samples[0])), C.sf_count_t(len(samples))))
 }
 
+func (file *SndFile) Write(audio *Audio) error {
+	samples := audio.InterleavedFloats()
+	if len(samples) == 0 {
+		return nil
+	}
+
+	if file.WriteFloat(samples) != int64(len(samples)) {
+		return errors.New("Can't write all samples")
+	}
+	return nil
+}
+
 func (file *SndFile) ReadFloat(samples []float32) int64 {
 	return int64(C.sf_read_float(file.handle, (*C.float)(unsafe.Pointer(&samples[0])), C.sf_count_t(len(samples))))
 }
 
+// Moves the read position to the given frame (from the file start)
+func (file *SndFile) SeekFrame(frames int64) error {
+	if C.sf_seek(file.handle, C.sf_count_t(frames), C.SEEK_SET) < 0 {
+		return errors.New("Can't seek in file")
+	}
+	return nil
+}
+
+// Broadcast Wave Format metadata (bext chunk)
+type BroadcastInfo struct {
+	Description         string
+	Originator          string
+	OriginatorReference string
+	OriginationTime     time.Time
+	// Sample count since midnight
+	TimeReference uint64
+	CodingHistory string
+}
+
+func copyCString(destination []C.char, value string) {
+	for index := 0; index < len(value) && index < len(destination); index++ {
+		destination[index] = C.char(value[index])
+	}
+}
+
+// Must be invoked before the first write
+func (file *SndFile) SetBroadcastInfo(info *BroadcastInfo) error {
+	var cInfo C.SF_BROADCAST_INFO
+
+	copyCString(cInfo.description[:], info.Description)
+	copyCString(cInfo.originator[:], info.Originator)
+	copyCString(cInfo.originator_reference[:], info.OriginatorReference)
+	copyCString(cInfo.origination_date[:], info.OriginationTime.Format("2006-01-02"))
+	copyCString(cInfo.origination_time[:], info.OriginationTime.Format("15:04:05"))
+	cInfo.time_reference_low = C.uint(info.TimeReference & 0xffffffff)
+	cInfo.time_reference_high = C.uint(info.TimeReference >> 32)
+	cInfo.version = 1
+	copyCString(cInfo.coding_history[:], info.CodingHistory)
+	cInfo.coding_history_size = C.uint(len(info.CodingHistory))
+
+	if C.sf_command(file.handle, C.SFC_SET_BROADCAST_INFO, unsafe.Pointer(&cInfo), C.int(unsafe.Sizeof(cInfo))) != C.SF_TRUE {
+		return errors.New("Can't set broadcast info")
+	}
+	return nil
+}
+
 func (file *SndFile) WriteSync() {
 	C.sf_write_sync(file.handle)
 }
 
+// Updates the file header with the current frame count and flushes the
+// written data, so that the file stays readable if the process is killed
+func (file *SndFile) Sync() error {
+	C.sf_command(file.handle, C.SFC_UPDATE_HEADER_NOW, nil, 0)
+	file.WriteSync()
+
+	if errorCode := C.sf_error(file.handle); errorCode != C.SF_ERR_NO_ERROR {
+		return errors.New(C.GoString(C.sf_error_number(errorCode)))
+	}
+	return nil
+}
+
 const (
 	O_RDONLY int = C.SFM_READ
 	O_WRONLY int = C.SFM_WRITE
@@ -5,6 +5,7 @@ import (
 	"container/ring"
 	"encoding/json"
 	"math"
+	"strconv"
 )
 
 type SoundMeterAudioHandler struct {
@@ -13,6 +14,7 @@ type SoundMeterAudioHandler struct {
 	resizeAudio *ResizeAudio
 	receivers   *list.List
 	history     *SoundMetricsHistory
+	lastMetrics *SoundMetrics
 }
 
 type SoundChannelMetrics struct {
@@ -98,9 +100,30 @@ func (soundMeter *SoundMeterAudioHandler) computeAudio(audio *Audio) {
 	soundMetrics := NewSoundMetrics(audio)
 
 	soundMeter.metricsHistory().Update(soundMetrics)
+	soundMeter.lastMetrics = soundMetrics
 	soundMeter.sendMetrics(soundMetrics)
 }
 
+// Returns the peak level of each channel (between 0 and 1, channels are numbered from 1)
+func (soundMeter *SoundMeterAudioHandler) PrometheusSamples() []PrometheusSample {
+	samples := []PrometheusSample{}
+
+	lastMetrics := soundMeter.lastMetrics
+	if lastMetrics == nil {
+		return samples
+	}
+
+	for channel, channelMetrics := range lastMetrics.ChannelMetrics {
+		samples = append(samples, PrometheusSample{
+			Name:   prometheusMetricName("sound_peak_level"),
+			Type:   "gauge",
+			Labels: map[string]string{"channel": strconv.Itoa(channel + 1)},
+			Value:  float64(channelMetrics.PeakLevel),
+		})
+	}
+	return samples
+}
+
 func (soundMeter *SoundMeterAudioHandler) sendMetrics(metrics *SoundMetrics) {
 	if soundMeter.receivers == nil {
 		return
@@ -0,0 +1,147 @@
+package broadcast
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+// Maximum size of a StatsD packet (to avoid IP fragmentation)
+const statsDPacketSize = 1432
+
+// A StatsDExporter sends the metrics of Registry (metrics.DefaultRegistry by
+// default) to a StatsD server over UDP.
+//
+// Counters are sent as increments since the previous export. Gauges and
+// histogram values are sent as gauges. Tags use the DogStatsD format.
+type StatsDExporter struct {
+	Address  string
+	Prefix   string
+	Tags     MetricsTags
+	Interval time.Duration
+	Registry metrics.Registry
+
+	lastCounts map[string]int64
+}
+
+func (exporter *StatsDExporter) registry() metrics.Registry {
+	if exporter.Registry == nil {
+		exporter.Registry = metrics.DefaultRegistry
+	}
+	return exporter.Registry
+}
+
+func (exporter *StatsDExporter) interval() time.Duration {
+	if exporter.Interval == 0 {
+		exporter.Interval = 10 * time.Second
+	}
+	return exporter.Interval
+}
+
+func (exporter *StatsDExporter) Run() {
+	runMetricsExporter(fmt.Sprintf("StatsD %s", exporter.Address), exporter.interval(), exporter.Export)
+}
+
+// Returns the StatsD lines of the current metrics
+func (exporter *StatsDExporter) Lines() []string {
+	if exporter.lastCounts == nil {
+		exporter.lastCounts = make(map[string]int64)
+	}
+
+	tags := ""
+	if len(exporter.Tags) > 0 {
+		pairs := []string{}
+		for _, key := range exporter.Tags.keys() {
+			pairs = append(pairs, strings.Join([]string{key, exporter.Tags[key]}, ":"))
+		}
+		tags = "|#" + strings.Join(pairs, ",")
+	}
+
+	lines := []string{}
+	for _, metric := range exportedMetrics(exporter.registry()) {
+		name := exportedMetricName(exporter.Prefix, metric.Name)
+
+		switch metric.Type {
+		case "counter":
+			count := int64(metric.Fields[0].Value)
+			lines = append(lines, fmt.Sprintf("%s:%d|c%s", name, count-exporter.lastCounts[metric.Name], tags))
+			exporter.lastCounts[metric.Name] = count
+		case "gauge":
+			lines = append(lines, fmt.Sprintf("%s:%s|g%s", name, formatExportedValue(metric.Fields[0].Value), tags))
+		default:
+			for _, field := range metric.Fields {
+				lines = append(lines, fmt.Sprintf("%s.%s:%s|g%s", name, field.Name, formatExportedValue(field.Value), tags))
+			}
+		}
+	}
+	return lines
+}
+
+// Sends the current metrics
+func (exporter *StatsDExporter) Export() error {
+	connection, err := net.Dial("udp", exporter.Address)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	var packet bytes.Buffer
+	for _, line := range exporter.Lines() {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsDPacketSize {
+			if _, err := connection.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteString("\n")
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		_, err = connection.Write(packet.Bytes())
+	}
+	return err
+}
+
+type MetricsStatsDConfig struct {
+	Address  string        `json:",omitempty"`
+	Prefix   string        `json:",omitempty"`
+	Tags     MetricsTags   `json:",omitempty"`
+	Interval time.Duration `json:",omitempty"`
+}
+
+func (config *MetricsStatsDConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.StringVar(&config.Address, strings.Join([]string{prefix, "address"}, "-"), "", "The StatsD server address (host:port)")
+	flags.StringVar(&config.Prefix, strings.Join([]string{prefix, "prefix"}, "-"), "gobroadcast", "The prefix of StatsD metric names")
+	flags.Var(&config.Tags, strings.Join([]string{prefix, "tags"}, "-"), "The StatsD tags (like host=studio,site=paris)")
+	flags.DurationVar(&config.Interval, strings.Join([]string{prefix, "interval"}, "-"), 10*time.Second, "The interval between two StatsD exports")
+}
+
+func (config *MetricsStatsDConfig) Apply() {
+	if config.Address != "" {
+		exporter := &StatsDExporter{
+			Address:  config.Address,
+			Prefix:   config.Prefix,
+			Tags:     config.Tags,
+			Interval: config.Interval,
+		}
+		go exporter.Run()
+	}
+}
+
+func (config *MetricsStatsDConfig) Validate(errors *ConfigErrors) {
+	if config.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Address); err != nil {
+			errors.Add("Address", "invalid address '%s' (host:port expected)", config.Address)
+		}
+	}
+	validateMetricsExporterInterval(errors, config.Interval)
+	validateMetricsTags(errors, config.Tags)
+}
@@ -0,0 +1,71 @@
+package broadcast
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	metrics "github.com/tryphon/go-metrics"
+)
+
+func TestStatsDExporter_Lines(t *testing.T) {
+	registry := testExporterRegistry()
+	exporter := &StatsDExporter{Prefix: "gobroadcast", Tags: MetricsTags{"host": "studio"}, Registry: registry}
+
+	expectedLines := []string{
+		"gobroadcast.http.Samples:1024|c|#host:studio",
+		"gobroadcast.upload.Queue:3|g|#host:studio",
+	}
+	if lines := exporter.Lines(); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("Wrong lines :\n got: %v\nwant: %v", lines, expectedLines)
+	}
+
+	metrics.GetOrRegisterCounter("http.Samples", registry).Inc(512)
+
+	// Counters are sent as increments
+	if lines := exporter.Lines(); lines[0] != "gobroadcast.http.Samples:512|c|#host:studio" {
+		t.Errorf("Wrong counter line :\n got: %v\nwant: %v", lines[0], "gobroadcast.http.Samples:512|c|#host:studio")
+	}
+}
+
+func TestStatsDExporter_Export(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	exporter := &StatsDExporter{Address: listener.LocalAddr().String(), Registry: testExporterRegistry()}
+	if err := exporter.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := make([]byte, statsDPacketSize)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	length, _, err := listener.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedPacket := "http.Samples:1024|c\nupload.Queue:3|g"
+	if string(packet[:length]) != expectedPacket {
+		t.Errorf("Wrong packet :\n got: %v\nwant: %v", string(packet[:length]), expectedPacket)
+	}
+}
+
+func TestMetricsStatsDConfig_Validate(t *testing.T) {
+	config := MetricsStatsDConfig{Address: "localhost", Interval: -time.Second, Tags: MetricsTags{"host site": "studio"}}
+
+	errors := ConfigErrors{}
+	config.Validate(&errors)
+
+	expectedErrors := ConfigErrors{
+		{Field: "Address", Message: "invalid address 'localhost' (host:port expected)"},
+		{Field: "Interval", Message: "can't be negative"},
+		{Field: "Tags", Message: "invalid tag 'host site'"},
+	}
+	if !reflect.DeepEqual(errors, expectedErrors) {
+		t.Errorf("Wrong errors :\n got: %v\nwant: %v", errors, expectedErrors)
+	}
+}
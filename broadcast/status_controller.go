@@ -0,0 +1,34 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// A StatusController reports the component tree of a Supervisor. The
+// response code is 503 when a component isn't healthy (usable by
+// monitoring checks).
+type StatusController struct {
+	supervisor *Supervisor
+}
+
+func NewStatusController(supervisor *Supervisor) *StatusController {
+	return &StatusController{supervisor: supervisor}
+}
+
+func (controller *StatusController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		http.Error(response, "Method not allowed", 405)
+		return
+	}
+
+	status := controller.supervisor.Status()
+
+	response.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		response.WriteHeader(503)
+	}
+
+	jsonBytes, _ := json.Marshal(status)
+	response.Write(jsonBytes)
+}
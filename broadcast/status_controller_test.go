@@ -0,0 +1,63 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusController_ServeHTTP(t *testing.T) {
+	supervisor := testSupervisor()
+	supervisor.Watch("streams", testComponentStatusReporter{
+		{Name: "mp3", State: ComponentRunning, Healthy: true},
+	})
+	controller := NewStatusController(supervisor)
+
+	request, _ := http.NewRequest("GET", "/status.json", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+	if response.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Wrong Content-Type :\n got: %v\nwant: %v", response.Header().Get("Content-Type"), "application/json")
+	}
+
+	var status SupervisorStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Healthy || status.Components[0].Children[0].Name != "mp3" {
+		t.Errorf("Wrong status :\n got: %v", status)
+	}
+}
+
+func TestStatusController_ServeHTTP_unhealthy(t *testing.T) {
+	supervisor := testSupervisor()
+	supervisor.Watch("streams", testComponentStatusReporter{
+		{Name: "mp3", State: ComponentConnecting},
+	})
+	controller := NewStatusController(supervisor)
+
+	request, _ := http.NewRequest("GET", "/status.json", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 503 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 503)
+	}
+}
+
+func TestStatusController_ServeHTTP_methodNotAllowed(t *testing.T) {
+	controller := NewStatusController(testSupervisor())
+
+	request, _ := http.NewRequest("POST", "/status.json", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 405 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 405)
+	}
+}
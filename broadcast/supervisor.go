@@ -0,0 +1,256 @@
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Supervisor runs Components and restarts them when they crash (panic or
+// unexpected end of Run).
+//
+// The delay before a restart starts with MinBackoff (1 second by default)
+// and doubles after each crash, up to MaxBackoff (1 minute by default).
+// Restarts are counted in the "<name>.Restarts" metric.
+type Supervisor struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	EventLog *LocalEventLog
+
+	components []*supervisedComponent
+	mutex      sync.Mutex
+}
+
+type supervisedComponent struct {
+	name      string
+	component Component
+	reporter  ComponentStatusReporter
+	metrics   *LocalMetrics
+
+	state     string
+	lastError string
+	restarts  int64
+	stopping  chan bool
+	stopped   chan bool
+	mutex     sync.Mutex
+}
+
+type SupervisorStatus struct {
+	Healthy    bool
+	Components []ComponentStatus
+}
+
+func (supervisor *Supervisor) eventLog() *LocalEventLog {
+	if supervisor.EventLog == nil {
+		supervisor.EventLog = &LocalEventLog{Source: "supervisor"}
+	}
+	return supervisor.EventLog
+}
+
+func (supervisor *Supervisor) minBackoff() time.Duration {
+	if supervisor.MinBackoff == 0 {
+		supervisor.MinBackoff = time.Second
+	}
+	return supervisor.MinBackoff
+}
+
+func (supervisor *Supervisor) maxBackoff() time.Duration {
+	if supervisor.MaxBackoff == 0 {
+		supervisor.MaxBackoff = time.Minute
+	}
+	return supervisor.MaxBackoff
+}
+
+func (supervisor *Supervisor) add(supervised *supervisedComponent) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	supervised.metrics = &LocalMetrics{prefix: supervised.name}
+
+	// A stopped component is replaced when it's started again
+	for index, component := range supervisor.components {
+		if component.name == supervised.name {
+			supervisor.components[index] = supervised
+			return
+		}
+	}
+	supervisor.components = append(supervisor.components, supervised)
+}
+
+func (supervisor *Supervisor) find(name string) *supervisedComponent {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	for _, supervised := range supervisor.components {
+		if supervised.name == name {
+			return supervised
+		}
+	}
+	return nil
+}
+
+// Runs the given component (in a goroutine) and restarts it when it crashes.
+// A stopped component can be started again with the same name. A component
+// still running with the same name is stopped first.
+func (supervisor *Supervisor) Start(name string, component Component) {
+	if previous := supervisor.find(name); previous != nil && previous.component != nil {
+		supervisor.Stop(name)
+		<-previous.stopped
+	}
+
+	supervised := &supervisedComponent{
+		name:      name,
+		component: component,
+		state:     ComponentRunning,
+		stopping:  make(chan bool),
+		stopped:   make(chan bool),
+	}
+	if reporter, ok := component.(ComponentStatusReporter); ok {
+		supervised.reporter = reporter
+	}
+
+	supervisor.add(supervised)
+	go supervisor.run(supervised)
+}
+
+// Reports the status of a component which isn't run by the Supervisor
+func (supervisor *Supervisor) Watch(name string, reporter ComponentStatusReporter) {
+	supervisor.add(&supervisedComponent{name: name, reporter: reporter, state: ComponentRunning})
+}
+
+// Stops the given component. It isn't restarted anymore.
+func (supervisor *Supervisor) Stop(name string) error {
+	supervised := supervisor.find(name)
+	if supervised == nil || supervised.component == nil {
+		return fmt.Errorf("Unknown component: %s", name)
+	}
+
+	select {
+	case <-supervised.stopping:
+		return nil
+	default:
+		close(supervised.stopping)
+	}
+
+	err := supervised.component.Stop()
+	<-supervised.stopped
+	return err
+}
+
+func (supervisor *Supervisor) run(supervised *supervisedComponent) {
+	defer close(supervised.stopped)
+
+	backoff := supervisor.minBackoff()
+	for {
+		startedAt := time.Now()
+		supervised.setState(ComponentRunning, "")
+
+		err := supervised.runOnce()
+
+		select {
+		case <-supervised.stopping:
+			supervised.setState(ComponentStopped, "")
+			return
+		default:
+		}
+
+		// A component which worked during a while restarts quickly
+		if time.Now().Sub(startedAt) > supervisor.maxBackoff() {
+			backoff = supervisor.minBackoff()
+		}
+
+		supervised.restart(err)
+		supervisor.eventLog().NewEvent(fmt.Sprintf("Component %s crashed (%v), restart in %v", supervised.name, err, backoff))
+
+		select {
+		case <-supervised.stopping:
+			supervised.setState(ComponentStopped, err.Error())
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > supervisor.maxBackoff() {
+			backoff = supervisor.maxBackoff()
+		}
+	}
+}
+
+func (supervised *supervisedComponent) runOnce() (err error) {
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			err = fmt.Errorf("panic: %v", panicErr)
+		}
+	}()
+
+	supervised.component.Run()
+	return errors.New("unexpected end")
+}
+
+func (supervised *supervisedComponent) restart(err error) {
+	supervised.metrics.Counter("Restarts").Inc(1)
+
+	supervised.mutex.Lock()
+	supervised.restarts++
+	supervised.mutex.Unlock()
+
+	supervised.setState(ComponentRestarting, err.Error())
+}
+
+func (supervised *supervisedComponent) setState(state string, lastError string) {
+	supervised.mutex.Lock()
+	defer supervised.mutex.Unlock()
+
+	supervised.state = state
+	if lastError != "" {
+		supervised.lastError = lastError
+	}
+}
+
+func (supervised *supervisedComponent) Status() ComponentStatus {
+	supervised.mutex.Lock()
+	status := ComponentStatus{
+		Name:      supervised.name,
+		State:     supervised.state,
+		Restarts:  supervised.restarts,
+		LastError: supervised.lastError,
+	}
+	supervised.mutex.Unlock()
+
+	if component, ok := supervised.component.(StatusComponent); ok && status.State == ComponentRunning {
+		status.State = component.Status().State
+	}
+	status.Healthy = healthyComponentState(status.State)
+
+	if supervised.reporter != nil {
+		status.Children = supervised.reporter.ComponentStatuses()
+		for _, child := range status.Children {
+			status.Healthy = status.Healthy && child.Healthy
+		}
+	}
+
+	return status
+}
+
+// Returns the status of the supervised components
+func (supervisor *Supervisor) ComponentStatuses() []ComponentStatus {
+	supervisor.mutex.Lock()
+	components := supervisor.components
+	supervisor.mutex.Unlock()
+
+	statuses := []ComponentStatus{}
+	for _, supervised := range components {
+		statuses = append(statuses, supervised.Status())
+	}
+	return statuses
+}
+
+func (supervisor *Supervisor) Status() SupervisorStatus {
+	status := SupervisorStatus{Healthy: true, Components: supervisor.ComponentStatuses()}
+	for _, component := range status.Components {
+		status.Healthy = status.Healthy && component.Healthy
+	}
+	return status
+}
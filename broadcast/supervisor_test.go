@@ -0,0 +1,164 @@
+package broadcast
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testComponent struct {
+	runs      int32
+	panicRuns int32
+	stop      chan bool
+}
+
+func newTestComponent(panicRuns int32) *testComponent {
+	return &testComponent{panicRuns: panicRuns, stop: make(chan bool)}
+}
+
+func (component *testComponent) Run() {
+	if atomic.AddInt32(&component.runs, 1) <= component.panicRuns {
+		panic("test failure")
+	}
+	<-component.stop
+}
+
+func (component *testComponent) Stop() error {
+	close(component.stop)
+	return nil
+}
+
+func (component *testComponent) Runs() int32 {
+	return atomic.LoadInt32(&component.runs)
+}
+
+type testComponentStatusReporter []ComponentStatus
+
+func (reporter testComponentStatusReporter) ComponentStatuses() []ComponentStatus {
+	return reporter
+}
+
+func testSupervisor() *Supervisor {
+	return &Supervisor{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 4 * time.Millisecond,
+		EventLog:   &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "supervisor"},
+	}
+}
+
+func waitFor(condition func() bool) bool {
+	for count := 0; count < 100; count++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSupervisor_Start_restart(t *testing.T) {
+	supervisor := testSupervisor()
+	component := newTestComponent(2)
+
+	supervisor.Start("test-restart", component)
+	defer supervisor.Stop("test-restart")
+
+	if !waitFor(func() bool { return component.Runs() == 3 }) {
+		t.Fatalf("Component should be restarted after panics :\n got: %v runs\nwant: %v runs", component.Runs(), 3)
+	}
+
+	status := supervisor.Status().Components[0]
+	if status.State != ComponentRunning || !status.Healthy {
+		t.Errorf("Restarted component should be running :\n got: %v", status)
+	}
+	if status.Restarts != 2 {
+		t.Errorf("Wrong restart count :\n got: %v\nwant: %v", status.Restarts, 2)
+	}
+	if status.LastError != "panic: test failure" {
+		t.Errorf("Wrong last error :\n got: %v\nwant: %v", status.LastError, "panic: test failure")
+	}
+
+	events := supervisor.EventLog.Parent.Events()
+	if len(events) == 0 || events[0].Message != "Component test-restart crashed (panic: test failure), restart in 1ms" {
+		t.Errorf("Crash should be logged :\n got: %v", events)
+	}
+}
+
+func TestSupervisor_Stop(t *testing.T) {
+	supervisor := testSupervisor()
+	component := newTestComponent(0)
+
+	supervisor.Start("test-stop", component)
+	waitFor(func() bool { return component.Runs() == 1 })
+
+	err := supervisor.Stop("test-stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if component.Runs() != 1 {
+		t.Errorf("Stopped component should not be restarted :\n got: %v runs", component.Runs())
+	}
+
+	status := supervisor.Status()
+	if status.Components[0].State != ComponentStopped || status.Healthy {
+		t.Errorf("Component should be stopped :\n got: %v", status)
+	}
+
+	if err := supervisor.Stop("test-stop"); err != nil {
+		t.Errorf("Component can be stopped twice :\n got: %v", err)
+	}
+	if err := supervisor.Stop("dummy"); err == nil {
+		t.Errorf("Unknown component can't be stopped")
+	}
+}
+
+func TestSupervisor_Start_running(t *testing.T) {
+	supervisor := testSupervisor()
+	previous := newTestComponent(0)
+	component := newTestComponent(0)
+
+	supervisor.Start("test-replace", previous)
+	waitFor(func() bool { return previous.Runs() == 1 })
+
+	supervisor.Start("test-replace", component)
+	waitFor(func() bool { return component.Runs() == 1 })
+
+	select {
+	case <-previous.stop:
+	default:
+		t.Errorf("Previous component should be stopped")
+	}
+	if err := supervisor.Stop("test-replace"); err != nil {
+		t.Fatal(err)
+	}
+	if len(supervisor.Status().Components) != 1 {
+		t.Errorf("Component should be replaced :\n got: %v", supervisor.Status().Components)
+	}
+}
+
+func TestSupervisor_Status(t *testing.T) {
+	supervisor := testSupervisor()
+	supervisor.Watch("streams", testComponentStatusReporter{
+		{Name: "mp3", State: ComponentRunning, Healthy: true},
+		{Name: "ogg", State: ComponentDisabled, Healthy: true},
+	})
+
+	status := supervisor.Status()
+	if !status.Healthy {
+		t.Errorf("Supervisor should be healthy :\n got: %v", status)
+	}
+	if len(status.Components) != 1 || len(status.Components[0].Children) != 2 {
+		t.Fatalf("Wrong component tree :\n got: %v", status.Components)
+	}
+
+	supervisor.Watch("inputs", testComponentStatusReporter{
+		{Name: "alsa", State: ComponentConnecting},
+	})
+
+	status = supervisor.Status()
+	if status.Healthy || status.Components[1].Healthy {
+		t.Errorf("Unhealthy child should be reported :\n got: %v", status)
+	}
+}
@@ -0,0 +1,275 @@
+package broadcast
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const timeShiftSegmentFormat = "20060102-150405"
+
+// A TimeShift delays the audio by hours (rebroadcast in other time zones).
+//
+// The audio is stored in segment files under Directory (float samples,
+// each segment covers SegmentDuration of wall clock). The output is read
+// at the position of the wall clock minus Delay. After a restart, the
+// output resumes from the segments already on disk.
+//
+// The received audio is queued: the segments are written and read (and the
+// Output is invoked) in the goroutine launched by Start, not in the audio
+// goroutine.
+type TimeShift struct {
+	Output AudioHandler
+
+	Directory       string
+	Delay           time.Duration
+	SegmentDuration time.Duration
+	SampleRate      int
+
+	// The write position is realigned on the wall clock beyond this tolerance
+	AlignmentTolerance time.Duration
+
+	channelCount  int
+	writePosition int64
+	writer        *timeShiftSegment
+	reader        *timeShiftSegment
+
+	audios    chan *Audio
+	running   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// The count of audio buffers queued before being stored
+const timeShiftQueueLength = 100
+
+type timeShiftSegment struct {
+	index int64
+	file  *os.File
+}
+
+func (timeShift *TimeShift) SetAudioHandler(audioHandler AudioHandler) {
+	timeShift.Output = audioHandler
+}
+
+func (timeShift *TimeShift) Init() error {
+	if timeShift.SegmentDuration == 0 {
+		timeShift.SegmentDuration = time.Minute
+	}
+	if timeShift.AlignmentTolerance == 0 {
+		timeShift.AlignmentTolerance = time.Second
+	}
+	timeShift.audios = make(chan *Audio, timeShiftQueueLength)
+	return os.MkdirAll(timeShift.Directory, 0775)
+}
+
+// Starts the goroutine which stores the queued audio
+func (timeShift *TimeShift) Start() {
+	timeShift.running.Add(1)
+	go timeShift.run()
+}
+
+func (timeShift *TimeShift) run() {
+	defer timeShift.running.Done()
+
+	for audio := range timeShift.audios {
+		timeShift.process(audio)
+	}
+}
+
+func (timeShift *TimeShift) segmentSampleCount() int64 {
+	return int64(timeShift.SegmentDuration.Seconds() * float64(timeShift.SampleRate))
+}
+
+func (timeShift *TimeShift) durationToSamples(duration time.Duration) int64 {
+	return int64(duration.Seconds() * float64(timeShift.SampleRate))
+}
+
+// Returns the sample position (since Unix epoch) of the given time
+func (timeShift *TimeShift) position(timestamp time.Time) int64 {
+	return timestamp.Unix()*int64(timeShift.SampleRate) + int64(timestamp.Nanosecond())*int64(timeShift.SampleRate)/int64(time.Second)
+}
+
+func (timeShift *TimeShift) segmentStart(index int64) time.Time {
+	return time.Unix(0, 0).Add(time.Duration(index) * timeShift.SegmentDuration).UTC()
+}
+
+func (timeShift *TimeShift) segmentFile(index int64) string {
+	return path.Join(timeShift.Directory, timeShift.segmentStart(index).Format(timeShiftSegmentFormat)+".raw")
+}
+
+func (timeShift *TimeShift) frameSize() int64 {
+	return int64(timeShift.channelCount) * 4
+}
+
+// Queues the given audio. The audio is dropped when the queue is full (the
+// disk is too slow).
+func (timeShift *TimeShift) AudioOut(audio *Audio) {
+	select {
+	case timeShift.audios <- audio:
+	default:
+		Log.Printf("Time shift %v queue is full, audio is dropped", timeShift.Delay)
+	}
+}
+
+func (timeShift *TimeShift) process(audio *Audio) {
+	timeShift.channelCount = audio.ChannelCount()
+
+	position := timeShift.position(audio.Timestamp())
+	if timeShift.writePosition == 0 || absInt64(position-timeShift.writePosition) > timeShift.durationToSamples(timeShift.AlignmentTolerance) {
+		Log.Debugf("Align time shift on %v", audio.Timestamp())
+		timeShift.writePosition = position
+	}
+
+	err := timeShift.write(audio, timeShift.writePosition)
+	if err != nil {
+		Log.Printf("Can't write time shift segment : %v", err)
+	}
+
+	output := timeShift.read(timeShift.writePosition-timeShift.durationToSamples(timeShift.Delay), audio.SampleCount())
+	output.SetTimestamp(audio.Timestamp())
+
+	timeShift.writePosition += int64(audio.SampleCount())
+
+	if timeShift.Output != nil {
+		timeShift.Output.AudioOut(output)
+	}
+}
+
+func absInt64(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func (timeShift *TimeShift) openSegment(segment *timeShiftSegment, index int64, flag int) (*timeShiftSegment, error) {
+	if segment != nil && segment.index == index {
+		return segment, nil
+	}
+	if segment != nil {
+		segment.file.Close()
+	}
+
+	file, err := os.OpenFile(timeShift.segmentFile(index), flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &timeShiftSegment{index: index, file: file}, nil
+}
+
+func (timeShift *TimeShift) write(audio *Audio, position int64) error {
+	segmentSampleCount := timeShift.segmentSampleCount()
+
+	for written := 0; written < audio.SampleCount(); {
+		index, offset := (position+int64(written))/segmentSampleCount, (position+int64(written))%segmentSampleCount
+
+		if timeShift.writer == nil || timeShift.writer.index != index {
+			writer, err := timeShift.openSegment(timeShift.writer, index, os.O_WRONLY|os.O_CREATE)
+			timeShift.writer = writer
+			if err != nil {
+				return err
+			}
+			timeShift.removeExpiredSegments(index)
+		}
+
+		sampleCount := int(segmentSampleCount - offset)
+		if sampleCount > audio.SampleCount()-written {
+			sampleCount = audio.SampleCount() - written
+		}
+
+		buffer := make([]byte, int64(sampleCount)*timeShift.frameSize())
+		for sample := 0; sample < sampleCount; sample++ {
+			for channel := 0; channel < audio.ChannelCount(); channel++ {
+				value := math.Float32bits(audio.Sample(channel, written+sample))
+				binary.LittleEndian.PutUint32(buffer[(sample*audio.ChannelCount()+channel)*4:], value)
+			}
+		}
+
+		_, err := timeShift.writer.file.WriteAt(buffer, offset*timeShift.frameSize())
+		if err != nil {
+			return err
+		}
+
+		written += sampleCount
+	}
+
+	return nil
+}
+
+// Returns the stored audio from the given position. Missing samples
+// (not recorded yet or during a stop) are silent.
+func (timeShift *TimeShift) read(position int64, sampleCount int) *Audio {
+	audio := NewAudio(sampleCount, timeShift.channelCount)
+	segmentSampleCount := timeShift.segmentSampleCount()
+
+	for read := 0; read < sampleCount; {
+		index, offset := (position+int64(read))/segmentSampleCount, (position+int64(read))%segmentSampleCount
+
+		segmentReadCount := int(segmentSampleCount - offset)
+		if segmentReadCount > sampleCount-read {
+			segmentReadCount = sampleCount - read
+		}
+
+		reader, err := timeShift.openSegment(timeShift.reader, index, os.O_RDONLY)
+		if err == nil {
+			timeShift.reader = reader
+
+			buffer := make([]byte, int64(segmentReadCount)*timeShift.frameSize())
+			readLength, _ := timeShift.reader.file.ReadAt(buffer, offset*timeShift.frameSize())
+
+			for sample := 0; sample < readLength/int(timeShift.frameSize()); sample++ {
+				for channel := 0; channel < timeShift.channelCount; channel++ {
+					value := binary.LittleEndian.Uint32(buffer[(sample*timeShift.channelCount+channel)*4:])
+					audio.SetSample(channel, read+sample, math.Float32frombits(value))
+				}
+			}
+		} else {
+			timeShift.reader = nil
+		}
+
+		read += segmentReadCount
+	}
+
+	return audio
+}
+
+// Removes the segments which will not be read anymore
+func (timeShift *TimeShift) removeExpiredSegments(writeIndex int64) {
+	segmentCount := int64(timeShift.Delay/timeShift.SegmentDuration) + 1
+	expiredTime := timeShift.segmentStart(writeIndex - segmentCount)
+
+	files, _ := filepath.Glob(path.Join(timeShift.Directory, "*.raw"))
+	for _, file := range files {
+		start, err := time.Parse(timeShiftSegmentFormat, strings.TrimSuffix(path.Base(file), ".raw"))
+		if err != nil || !start.Before(expiredTime) {
+			continue
+		}
+
+		Log.Debugf("Remove time shift segment %s", file)
+		os.Remove(file)
+	}
+}
+
+// Stores the queued audio and closes the segment files
+func (timeShift *TimeShift) Close() {
+	timeShift.closeOnce.Do(func() {
+		if timeShift.audios != nil {
+			close(timeShift.audios)
+		}
+	})
+	timeShift.running.Wait()
+
+	if timeShift.writer != nil {
+		timeShift.writer.file.Close()
+		timeShift.writer = nil
+	}
+	if timeShift.reader != nil {
+		timeShift.reader.file.Close()
+		timeShift.reader = nil
+	}
+}
@@ -0,0 +1,131 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testTimeShift(t *testing.T, directory string) (*TimeShift, *[]float32) {
+	output := []float32{}
+
+	timeShift := &TimeShift{
+		Directory:       directory,
+		Delay:           2 * time.Second,
+		SegmentDuration: time.Second,
+		SampleRate:      1000,
+		Output: AudioHandlerFunc(func(audio *Audio) {
+			output = append(output, audio.Samples(0)...)
+		}),
+	}
+	if err := timeShift.Init(); err != nil {
+		t.Fatal(err)
+	}
+	timeShift.Start()
+
+	return timeShift, &output
+}
+
+// Sends count blocks of 250 samples from the given time, each sample is its position
+func sendTimeShiftAudio(timeShift *TimeShift, start time.Time, count int) {
+	for block := 0; block < count; block++ {
+		audio := NewAudio(250, 2)
+		audio.Process(func(_ int, samplePosition int, _ float32) float32 {
+			return float32(block*250 + samplePosition + 1)
+		})
+		audio.SetTimestamp(start.Add(time.Duration(block) * 250 * time.Millisecond))
+		timeShift.AudioOut(audio)
+	}
+}
+
+func TestTimeShift_AudioOut(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "timeshift")
+	defer os.RemoveAll(directory)
+
+	timeShift, output := testTimeShift(t, directory)
+
+	start := time.Date(2015, 5, 20, 14, 0, 0, 500000000, time.UTC)
+	sendTimeShiftAudio(timeShift, start, 16)
+
+	// The queued audio is processed before closing
+	timeShift.Close()
+
+	if len(*output) != 4000 {
+		t.Fatalf("Wrong output sample count :\n got: %v\nwant: %v", len(*output), 4000)
+	}
+	if (*output)[1999] != 0 {
+		t.Errorf("Output should be silent before the delay :\n got: %v", (*output)[1999])
+	}
+	if (*output)[2000] != 1 || (*output)[3999] != 2000 {
+		t.Errorf("Output should be delayed by 2 seconds :\n got: %v %v", (*output)[2000], (*output)[3999])
+	}
+}
+
+func TestTimeShift_AudioOut_restart(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "timeshift")
+	defer os.RemoveAll(directory)
+
+	start := time.Date(2015, 5, 20, 14, 0, 0, 0, time.UTC)
+
+	timeShift, _ := testTimeShift(t, directory)
+	sendTimeShiftAudio(timeShift, start, 4)
+	timeShift.Close()
+
+	// Restarted after one second
+	restartedTimeShift, output := testTimeShift(t, directory)
+	sendTimeShiftAudio(restartedTimeShift, start.Add(2*time.Second), 4)
+	restartedTimeShift.Close()
+
+	if (*output)[0] != 1 || (*output)[999] != 1000 {
+		t.Errorf("Output should resume from stored audio :\n got: %v %v", (*output)[0], (*output)[999])
+	}
+}
+
+func TestTimeShift_removeExpiredSegments(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "timeshift")
+	defer os.RemoveAll(directory)
+
+	timeShift, _ := testTimeShift(t, directory)
+
+	start := time.Date(2015, 5, 20, 14, 0, 0, 0, time.UTC)
+	sendTimeShiftAudio(timeShift, start, 24)
+	timeShift.Close()
+
+	files, _ := filepath.Glob(directory + "/*.raw")
+	if len(files) != 4 {
+		t.Errorf("Only segments which can be read should be kept :\n got: %v", files)
+	}
+	if filepath.Base(files[0]) != "20150520-140002.raw" {
+		t.Errorf("Wrong oldest segment :\n got: %v\nwant: %v", filepath.Base(files[0]), "20150520-140002.raw")
+	}
+}
+
+func TestTimeShift_AudioOut_queueFull(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "timeshift")
+	defer os.RemoveAll(directory)
+
+	output := []float32{}
+	timeShift := &TimeShift{
+		Directory:  directory,
+		Delay:      time.Second,
+		SampleRate: 1000,
+		Output: AudioHandlerFunc(func(audio *Audio) {
+			output = append(output, audio.Samples(0)...)
+		}),
+	}
+	timeShift.Init()
+
+	// Without the storage goroutine, the audio goroutine isn't blocked
+	for count := 0; count < timeShiftQueueLength+10; count++ {
+		timeShift.AudioOut(NewAudio(10, 1))
+	}
+
+	timeShift.Start()
+	timeShift.Close()
+
+	if len(output) != timeShiftQueueLength*10 {
+		t.Errorf("Audio beyond the queue should be dropped :\n got: %v samples\nwant: %v", len(output), timeShiftQueueLength*10)
+	}
+}
@@ -0,0 +1,145 @@
+package broadcast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// wav, wav:24, wav:float, rf64, rf64:24, w64, w64:float, flac, flac:24
+// mp3:vbr(q=5), ogg/vorbis:vbr(q=5), aac:cbr(b=128)
+type TimedFileFormat struct {
+	Definition string
+	Extension  string
+
+	// Used for wav and flac files written by libsndfile
+	SndFileFormat int
+	// Used for compressed files written by a StreamEncoder
+	AudioFormat *AudioFormat
+}
+
+func ParseTimedFileFormat(definition string) (*TimedFileFormat, error) {
+	if definition == "" {
+		definition = "wav"
+	}
+
+	format, err := parseTimedFileFormat(definition)
+	if err != nil {
+		return nil, err
+	}
+	format.Definition = definition
+	return format, nil
+}
+
+func parseTimedFileFormat(definition string) (*TimedFileFormat, error) {
+
+	parts := strings.SplitN(strings.ToLower(definition), ":", 2)
+	container := parts[0]
+
+	var subtype string
+	if len(parts) > 1 {
+		subtype = parts[1]
+	}
+
+	switch container {
+	case "wav", "rf64", "w64", "flac":
+		majors := map[string]int{"wav": FORMAT_WAV, "rf64": FORMAT_RF64, "w64": FORMAT_W64, "flac": FORMAT_FLAC}
+		major := majors[container]
+
+		// RF64 files use the wav extension (EBU Tech 3306)
+		extension := container
+		if container == "rf64" {
+			extension = "wav"
+		}
+
+		var minor int
+		switch subtype {
+		case "", "16":
+			minor = FORMAT_PCM_16
+		case "24":
+			minor = FORMAT_PCM_24
+		case "float":
+			if container == "flac" {
+				return nil, fmt.Errorf("Unsupported flac subtype: '%s'", subtype)
+			}
+			minor = FORMAT_FLOAT
+		default:
+			return nil, fmt.Errorf("Unsupported %s subtype: '%s'", container, subtype)
+		}
+
+		return &TimedFileFormat{Extension: extension, SndFileFormat: major | minor}, nil
+	}
+
+	audioFormat := ParseAudioFormat(definition)
+	switch audioFormat.Encoding {
+	case "mp3":
+		return &TimedFileFormat{Extension: "mp3", AudioFormat: &audioFormat}, nil
+	case "ogg/vorbis":
+		return &TimedFileFormat{Extension: "ogg", AudioFormat: &audioFormat}, nil
+	case "aac", "aacp":
+		return &TimedFileFormat{Extension: "aac", AudioFormat: &audioFormat}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported file format: '%s'", definition)
+}
+
+func (format *TimedFileFormat) IsEncoded() bool {
+	return format.AudioFormat != nil
+}
+
+func (format *TimedFileFormat) IsWav() bool {
+	return !format.IsEncoded() && format.SndFileFormat&FORMAT_TYPEMASK == FORMAT_WAV
+}
+
+// Broadcast Wave metadata can be stored in wav and rf64 files
+func (format *TimedFileFormat) SupportsBroadcastInfo() bool {
+	if format.IsEncoded() {
+		return false
+	}
+	major := format.SndFileFormat & FORMAT_TYPEMASK
+	return major == FORMAT_WAV || major == FORMAT_RF64
+}
+
+// Cue points can be appended to wav and rf64 files (see AppendWavMarkers)
+func (format *TimedFileFormat) SupportsMarkers() bool {
+	return format.SupportsBroadcastInfo()
+}
+
+// Returns the size of a sample in the file, 0 for encoded formats
+func (format *TimedFileFormat) SampleSize() int {
+	if format.IsEncoded() {
+		return 0
+	}
+	switch format.SndFileFormat & FORMAT_SUBMASK {
+	case FORMAT_PCM_24:
+		return 3
+	case FORMAT_FLOAT:
+		return 4
+	default:
+		return 2
+	}
+}
+
+func (format *TimedFileFormat) Open(fileName string, sampleRate int, channelCount int) (TimedFile, error) {
+	if format.IsEncoded() {
+		audioFormat := *format.AudioFormat
+		audioFormat.SampleRate = sampleRate
+		audioFormat.ChannelCount = channelCount
+
+		file, err := CreateEncodedFile(fileName, audioFormat)
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+
+	var fileInfo Info
+	fileInfo.SetSampleRate(sampleRate)
+	fileInfo.SetChannels(channelCount)
+	fileInfo.SetFormat(format.SndFileFormat)
+
+	file, err := SndFileOpen(fileName, O_WRONLY, &fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
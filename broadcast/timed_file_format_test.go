@@ -0,0 +1,94 @@
+package broadcast
+
+import (
+	"testing"
+)
+
+func TestParseTimedFileFormat(t *testing.T) {
+	var conditions = []struct {
+		definition    string
+		extension     string
+		sndFileFormat int
+		encoding      string
+	}{
+		{"", "wav", FORMAT_WAV | FORMAT_PCM_16, ""},
+		{"wav", "wav", FORMAT_WAV | FORMAT_PCM_16, ""},
+		{"wav:24", "wav", FORMAT_WAV | FORMAT_PCM_24, ""},
+		{"WAV:float", "wav", FORMAT_WAV | FORMAT_FLOAT, ""},
+		{"rf64", "wav", FORMAT_RF64 | FORMAT_PCM_16, ""},
+		{"w64:24", "w64", FORMAT_W64 | FORMAT_PCM_24, ""},
+		{"flac", "flac", FORMAT_FLAC | FORMAT_PCM_16, ""},
+		{"flac:24", "flac", FORMAT_FLAC | FORMAT_PCM_24, ""},
+		{"mp3:vbr(q=5)", "mp3", 0, "mp3"},
+		{"ogg/vorbis:vbr(q=5)", "ogg", 0, "ogg/vorbis"},
+		{"aac:cbr(b=128)", "aac", 0, "aac"},
+	}
+
+	for _, condition := range conditions {
+		format, err := ParseTimedFileFormat(condition.definition)
+		if err != nil {
+			t.Errorf("Can't parse '%s' : %v", condition.definition, err)
+			continue
+		}
+
+		if condition.definition != "" && format.Definition != condition.definition {
+			t.Errorf("Wrong definition :\n got: %v\nwant: %v", format.Definition, condition.definition)
+		}
+		if format.Extension != condition.extension {
+			t.Errorf("Wrong extension for '%s' :\n got: %v\nwant: %v", condition.definition, format.Extension, condition.extension)
+		}
+		if format.SndFileFormat != condition.sndFileFormat {
+			t.Errorf("Wrong SndFile format for '%s' :\n got: %x\nwant: %x", condition.definition, format.SndFileFormat, condition.sndFileFormat)
+		}
+		if condition.encoding != "" && (!format.IsEncoded() || format.AudioFormat.Encoding != condition.encoding) {
+			t.Errorf("Wrong encoding for '%s' :\n got: %v\nwant: %v", condition.definition, format.AudioFormat, condition.encoding)
+		}
+	}
+}
+
+func TestParseTimedFileFormat_invalid(t *testing.T) {
+	for _, definition := range []string{"dummy", "wav:12", "flac:float"} {
+		if _, err := ParseTimedFileFormat(definition); err == nil {
+			t.Errorf("Should return an error for '%s'", definition)
+		}
+	}
+}
+
+func TestTimedFileFormat_SupportsBroadcastInfo(t *testing.T) {
+	var conditions = []struct {
+		definition string
+		supported  bool
+	}{
+		{"wav", true},
+		{"rf64:24", true},
+		{"w64", false},
+		{"flac", false},
+		{"mp3:vbr(q=5)", false},
+	}
+
+	for _, condition := range conditions {
+		format, _ := ParseTimedFileFormat(condition.definition)
+		if format.SupportsBroadcastInfo() != condition.supported {
+			t.Errorf("Wrong SupportsBroadcastInfo for '%s' :\n got: %v\nwant: %v", condition.definition, format.SupportsBroadcastInfo(), condition.supported)
+		}
+	}
+}
+
+func TestTimedFileFormat_SampleSize(t *testing.T) {
+	var conditions = []struct {
+		definition string
+		sampleSize int
+	}{
+		{"wav", 2},
+		{"rf64:24", 3},
+		{"w64:float", 4},
+		{"mp3:vbr(q=5)", 0},
+	}
+
+	for _, condition := range conditions {
+		format, _ := ParseTimedFileFormat(condition.definition)
+		if format.SampleSize() != condition.sampleSize {
+			t.Errorf("Wrong SampleSize for '%s' :\n got: %v\nwant: %v", condition.definition, format.SampleSize(), condition.sampleSize)
+		}
+	}
+}
@@ -2,28 +2,63 @@ package broadcast
 
 import (
 	"flag"
+	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
 	"time"
 )
 
+type TimedFile interface {
+	Path() string
+	Write(audio *Audio) error
+	Sync() error
+	Close() error
+}
+
 type TimedFileOutput struct {
 	RootDirectory string
 	CloseHandler  string
+	Format        *TimedFileFormat
+	FileHandlers  []TimedFileHandler
 
 	fileDuration time.Duration
 	sampleRate   int
 	channelCount int
 
 	recording            bool
-	currentFile          *SndFile
+	currentFile          TimedFile
 	nextTimeBound        time.Time
 	writeQuarantineUntil time.Time
 
-	fileSampleCount         uint32
-	expectedFileSampleCount uint32
+	// Long rf64/w64 files can contain more than 2^32 samples
+	fileStart               time.Time
+	fileSampleCount         int64
+	expectedFileSampleCount int64
+
+	// Gaps shorter than AlignmentTolerance are not padded with silence
+	AlignmentTolerance time.Duration
+
+	// The file header is updated every SyncInterval, to keep the file
+	// readable if the process is killed
+	SyncInterval time.Duration
+	lastSync     time.Time
+
+	markers        []WavMarker
+	pendingMarkers []timedMarker
+	markerMutex    sync.Mutex
+
+	// The path of the current file, read by other goroutines
+	currentPath      string
+	currentPathMutex sync.Mutex
+}
+
+type timedMarker struct {
+	Timestamp time.Time
+	Label     string
 }
 
 func (output *TimedFileOutput) SampleRate() int {
@@ -59,32 +94,231 @@ func (output *TimedFileOutput) SetFileDuration(fileDuration time.Duration) {
 	output.fileDuration = fileDuration
 }
 
+// Returns the path of the file being recorded (empty when stopped).
+// Can be invoked from another goroutine.
+func (output *TimedFileOutput) CurrentPath() string {
+	output.currentPathMutex.Lock()
+	defer output.currentPathMutex.Unlock()
+
+	return output.currentPath
+}
+
+func (output *TimedFileOutput) setCurrentPath(currentPath string) {
+	output.currentPathMutex.Lock()
+	defer output.currentPathMutex.Unlock()
+
+	output.currentPath = currentPath
+}
+
+func (output *TimedFileOutput) format() *TimedFileFormat {
+	if output.Format == nil {
+		output.Format, _ = ParseTimedFileFormat("wav")
+	}
+	return output.Format
+}
+
 func (output *TimedFileOutput) fileName(now time.Time, firstFile bool) string {
 	// Reference : Mon Jan 2 15:04:05 MST 2006
-	format := "2006/01-Jan/02-Mon/15h04.wav"
+	format := "2006/01-Jan/02-Mon/15h04"
 	if firstFile {
-		format = "2006/01-Jan/02-Mon/15h04m05.wav"
+		format = "2006/01-Jan/02-Mon/15h04m05"
+	}
+	return path.Join(output.RootDirectory, now.Format(format)+"."+output.format().Extension)
+}
+
+func (output *TimedFileOutput) alignmentTolerance() time.Duration {
+	if output.AlignmentTolerance == 0 {
+		output.AlignmentTolerance = time.Second
 	}
-	return path.Join(output.RootDirectory, now.Format(format))
+	return output.AlignmentTolerance
+}
+
+func (output *TimedFileOutput) syncInterval() time.Duration {
+	if output.SyncInterval == 0 {
+		output.SyncInterval = 10 * time.Second
+	}
+	return output.SyncInterval
+}
+
+func (output *TimedFileOutput) sync(now time.Time) {
+	if now.Sub(output.lastSync) < output.syncInterval() {
+		return
+	}
+
+	err := output.currentFile.Sync()
+	if err != nil {
+		Log.Printf("Can't sync file %s : %v", output.currentFile.Path(), err)
+	}
+	output.lastSync = now
 }
 
 func (output *TimedFileOutput) checkFileSampleCount() {
 	if output.fileSampleCount != output.expectedFileSampleCount {
-		Log.Printf("Missing samples in file %s : %d", output.currentFile.Path(), int32(output.expectedFileSampleCount)-int32(output.fileSampleCount))
+		Log.Printf("Missing samples in file %s : %d", output.currentFile.Path(), output.expectedFileSampleCount-output.fileSampleCount)
+	}
+}
+
+// Returns the position in the current file which matches the given time
+func (output *TimedFileOutput) samplePosition(timestamp time.Time) int64 {
+	if timestamp.Before(output.fileStart) {
+		return 0
+	}
+
+	position := int64(timestamp.Sub(output.fileStart).Seconds() * float64(output.SampleRate()))
+	if position > output.expectedFileSampleCount {
+		position = output.expectedFileSampleCount
+	}
+	return position
+}
+
+// Pads the current file with silence when the given time is after the last
+// written sample, to keep the file aligned on the wall clock
+func (output *TimedFileOutput) align(timestamp time.Time) error {
+	if output.fileStart.IsZero() {
+		return nil
+	}
+
+	expectedPosition := output.samplePosition(timestamp)
+	if expectedPosition <= output.fileSampleCount {
+		return nil
+	}
+
+	missingSampleCount := expectedPosition - output.fileSampleCount
+	missingDuration := time.Duration(float64(missingSampleCount) / float64(output.SampleRate()) * float64(time.Second))
+	if missingDuration < output.alignmentTolerance() {
+		return nil
+	}
+
+	Log.Printf("Pad %v of silence in file %s", missingDuration, output.currentFile.Path())
+	output.addMarker(output.fileSampleCount, fmt.Sprintf("Gap of %v", missingDuration))
+
+	for missingSampleCount > 0 {
+		sampleCount := missingSampleCount
+		if sampleCount > 4096 {
+			sampleCount = 4096
+		}
+
+		err := output.currentFile.Write(NewAudio(int(sampleCount), output.ChannelCount()))
+		if err != nil {
+			return err
+		}
+
+		output.fileSampleCount += sampleCount
+		missingSampleCount -= sampleCount
+	}
+
+	return nil
+}
+
+func (output *TimedFileOutput) addMarker(position int64, label string) {
+	// Cue points are limited to 32 bits positions
+	if position > math.MaxUint32 {
+		Log.Printf("Can't mark '%s' at sample %d in %s", label, position, output.currentFile.Path())
+		return
+	}
+	output.markers = append(output.markers, WavMarker{Position: uint32(position), Label: label})
+}
+
+// Records a marker (device error, ...) at the given time in the current file.
+// Can be invoked from another goroutine.
+func (output *TimedFileOutput) Mark(timestamp time.Time, label string) {
+	output.markerMutex.Lock()
+	defer output.markerMutex.Unlock()
+
+	// Repeated errors are marked once
+	if count := len(output.pendingMarkers); count > 0 && output.pendingMarkers[count-1].Label == label {
+		return
+	}
+
+	output.pendingMarkers = append(output.pendingMarkers, timedMarker{Timestamp: timestamp, Label: label})
+}
+
+func (output *TimedFileOutput) addPendingMarkers() {
+	output.markerMutex.Lock()
+	defer output.markerMutex.Unlock()
+
+	for _, marker := range output.pendingMarkers {
+		position := output.fileSampleCount
+		if !output.fileStart.IsZero() {
+			position = output.samplePosition(marker.Timestamp)
+		}
+		output.addMarker(position, marker.Label)
+	}
+	output.pendingMarkers = nil
+}
+
+func (output *TimedFileOutput) broadcastInfo() *BroadcastInfo {
+	midnight := time.Date(output.fileStart.Year(), output.fileStart.Month(), output.fileStart.Day(), 0, 0, 0, 0, output.fileStart.Location())
+
+	return &BroadcastInfo{
+		Description:     fmt.Sprintf("Record from %v", output.fileStart),
+		Originator:      "go-broadcast",
+		OriginationTime: output.fileStart,
+		TimeReference:   uint64(output.fileStart.Sub(midnight).Seconds() * float64(output.SampleRate())),
 	}
 }
 
+func (output *TimedFileOutput) closedRecord() *ClosedRecord {
+	record := &ClosedRecord{
+		Path:        output.currentFile.Path(),
+		Start:       output.fileStart,
+		End:         output.fileStart.Add(time.Duration(float64(output.fileSampleCount) / float64(output.SampleRate()) * float64(time.Second))),
+		SampleCount: output.fileSampleCount,
+		Format:      output.format().Definition,
+	}
+	if output.expectedFileSampleCount > output.fileSampleCount {
+		record.MissingSampleCount = output.expectedFileSampleCount - output.fileSampleCount
+	}
+	return record
+}
+
 func (output *TimedFileOutput) closeFile() (err error) {
 	filename := output.currentFile.Path()
 	Log.Printf("Close current file (%s)", filename)
+
+	output.addPendingMarkers()
+	if output.expectedFileSampleCount > 0 {
+		output.checkFileSampleCount()
+	}
+	record := output.closedRecord()
+
 	output.currentFile.Close()
 	output.currentFile = nil
+	output.setCurrentPath("")
+
+	if len(output.markers) > 0 {
+		if output.format().SupportsMarkers() {
+			err := AppendWavMarkers(filename, output.markers)
+			if err != nil {
+				Log.Printf("Can't write markers in %s : %v", filename, err)
+			}
+		} else {
+			Log.Printf("Can't write %d marker(s) in %s : not supported by %s format", len(output.markers), filename, output.format().Definition)
+		}
+	}
+	output.markers = nil
 
 	output.invokeCloseHandler(filename)
+	for _, handler := range output.FileHandlers {
+		handler.FileClosed(record)
+	}
 
 	return nil
 }
 
+// Closes the current file. The next written audio starts a new recording
+// (used by VOX and scheduled recordings).
+func (output *TimedFileOutput) Stop() error {
+	output.recording = false
+	if output.currentFile == nil {
+		return nil
+	}
+
+	// The file ends with the recording, not on the time bound
+	output.expectedFileSampleCount = output.fileSampleCount
+	return output.closeFile()
+}
+
 func (output *TimedFileOutput) invokeCloseHandler(filename string) {
 	if output.CloseHandler != "" {
 		go func() {
@@ -101,14 +335,9 @@ func (output *TimedFileOutput) invokeCloseHandler(filename string) {
 func (output *TimedFileOutput) newFile(now time.Time) error {
 	fileName := output.fileName(now, !output.recording)
 
-	var fileInfo Info
-	fileInfo.SetSampleRate(output.SampleRate())
-	fileInfo.SetChannels(output.ChannelCount())
-	fileInfo.SetFormat(FORMAT_WAV | FORMAT_PCM_16)
-
 	os.MkdirAll(path.Dir(fileName), 0775)
 
-	file, err := SndFileOpen(fileName, O_WRONLY, &fileInfo)
+	file, err := output.format().Open(fileName, output.SampleRate(), output.ChannelCount())
 	if err != nil {
 		output.currentFile = nil
 		Log.Printf("Can't open new file : %s", fileName)
@@ -119,18 +348,52 @@ func (output *TimedFileOutput) newFile(now time.Time) error {
 
 	truncatedNow := now.Truncate(output.FileDuration())
 	output.nextTimeBound = truncatedNow.Add(output.FileDuration())
-	output.expectedFileSampleCount = uint32(output.nextTimeBound.Sub(truncatedNow).Seconds() * float64(output.SampleRate()))
+
+	// The first file starts with the recording, the next ones on time bounds
+	output.fileStart = truncatedNow
+	if !output.recording {
+		output.fileStart = now
+	}
+	output.expectedFileSampleCount = int64(output.nextTimeBound.Sub(output.fileStart).Seconds() * float64(output.SampleRate()))
+
+	if output.format().IsWav() {
+		fileSize := int64(output.expectedFileSampleCount) * int64(output.ChannelCount()*output.format().SampleSize())
+		if fileSize > 0xFFFFFFFF {
+			Log.Printf("File %s will exceed the 4GB wav limit, use rf64 or w64 format", fileName)
+		}
+	}
+
+	if sndFile, ok := file.(*SndFile); ok && output.format().SupportsBroadcastInfo() {
+		err := sndFile.SetBroadcastInfo(output.broadcastInfo())
+		if err != nil {
+			Log.Printf("Can't write broadcast info in %s : %v", fileName, err)
+		}
+	}
 
 	Log.Printf("Opened new file (%s) until %v", fileName, output.nextTimeBound)
 
 	output.currentFile = file
+	output.setCurrentPath(fileName)
+	output.lastSync = now
 	return nil
 }
 
 func (output *TimedFileOutput) write(audio *Audio) (err error) {
 	if output.currentFile != nil {
-		output.fileSampleCount += uint32(audio.SampleCount())
-		output.currentFile.WriteFloat(audio.InterleavedFloats())
+		output.addPendingMarkers()
+
+		err := output.align(audio.Timestamp())
+		if err != nil {
+			return err
+		}
+
+		output.fileSampleCount += int64(audio.SampleCount())
+		err = output.currentFile.Write(audio)
+		if err != nil {
+			return err
+		}
+
+		output.sync(audio.Timestamp())
 	}
 	return nil
 }
@@ -144,6 +407,11 @@ func (output *TimedFileOutput) Write(audio *Audio) (err error) {
 
 	if output.recording {
 		if now.After(output.nextTimeBound) {
+			err = output.align(output.nextTimeBound)
+			if err != nil {
+				return err
+			}
+
 			err = output.closeFile()
 			if err != nil {
 				return err
@@ -160,8 +428,7 @@ func (output *TimedFileOutput) Write(audio *Audio) (err error) {
 		}
 	}
 
-	output.write(audio)
-	return nil
+	return output.write(audio)
 }
 
 func (output *TimedFileOutput) AudioOut(audio *Audio) {
@@ -182,16 +449,41 @@ type TimedFileOutputConfig struct {
 	Root         string
 	Duration     time.Duration
 	CloseHandler string
+	Format       string
+	SyncInterval time.Duration
 }
 
 func (config *TimedFileOutputConfig) Flags(flags *flag.FlagSet, prefix string) {
 	flags.StringVar(&config.Root, strings.Join([]string{prefix, "root"}, "-"), "", "The root directory used to save files")
 	flags.StringVar(&config.CloseHandler, strings.Join([]string{prefix, "close-handler"}, "-"), "", "A executable invoked when each file is closed")
 	flags.DurationVar(&config.Duration, strings.Join([]string{prefix, "duration"}, "-"), 5*time.Minute, "The file duration")
+	flags.StringVar(&config.Format, strings.Join([]string{prefix, "format"}, "-"), "wav", "The file format (wav, wav:24, wav:float, rf64, w64, flac, flac:24, mp3:vbr(q=5), ogg/vorbis:vbr(q=5))")
+	flags.DurationVar(&config.SyncInterval, strings.Join([]string{prefix, "sync-interval"}, "-"), 10*time.Second, "The interval between file header updates")
 }
 
-func (config *TimedFileOutputConfig) Apply(output *TimedFileOutput) {
+func (config *TimedFileOutputConfig) Apply(output *TimedFileOutput) error {
+	format, err := ParseTimedFileFormat(config.Format)
+	if err != nil {
+		return err
+	}
+
 	output.RootDirectory = config.Root
 	output.SetFileDuration(config.Duration)
 	output.CloseHandler = config.CloseHandler
+	output.Format = format
+	output.SyncInterval = config.SyncInterval
+
+	return nil
+}
+
+func (config *TimedFileOutputConfig) Validate(errors *ConfigErrors) {
+	if config.Duration <= 0 {
+		errors.Add("Duration", "must be positive")
+	}
+	if config.SyncInterval < 0 {
+		errors.Add("SyncInterval", "can't be negative")
+	}
+	if _, err := ParseTimedFileFormat(config.Format); err != nil {
+		errors.Add("Format", "%v", err)
+	}
 }
@@ -98,6 +98,18 @@ func TestTimedFileOutput_fileName_rootDirectory(t *testing.T) {
 	}
 }
 
+func TestTimedFileOutput_fileName_format(t *testing.T) {
+	format, _ := ParseTimedFileFormat("flac:24")
+	output := TimedFileOutput{Format: format}
+
+	fileName := output.fileName(timeReference(), false)
+	expectedFileName := "2006/01-Jan/02-Mon/15h04.flac"
+
+	if fileName != expectedFileName {
+		t.Errorf("Wrong file name:\n got: %v\nwant: %v", fileName, expectedFileName)
+	}
+}
+
 func tempSndFile() (file *SndFile, err error) {
 	tempFile, err := ioutil.TempFile("", "timedfileoutput")
 	if err != nil {
@@ -197,6 +209,9 @@ func TestTimedFileOutput_newFile(t *testing.T) {
 	if output.currentFile.Path() != output.fileName(now, false) {
 		t.Errorf("Wrong path :\n got: %v\nwant: %v", output.currentFile.Path(), output.fileName(now, true))
 	}
+	if output.CurrentPath() != output.currentFile.Path() {
+		t.Errorf("Wrong current path :\n got: %v\nwant: %v", output.CurrentPath(), output.currentFile.Path())
+	}
 	// pending
 	// if output.currentFile.SampleRate() != outout.SampleRate() {
 	//   t.Errorf("Wrong sampleRate :\n got: %v\nwant: %v", output.currentFile.SampleRate(), outout.SampleRate())
@@ -241,7 +256,7 @@ func TestTimedFileOutput_write(t *testing.T) {
 	if err != nil {
 		t.Errorf("Should not return an error")
 	}
-	if output.fileSampleCount != uint32(audio.SampleCount()) {
+	if output.fileSampleCount != int64(audio.SampleCount()) {
 		t.Errorf("Wrong fileSampleCount :\n got: %v\nwant: %v", output.fileSampleCount, audio.SampleCount())
 	}
 
@@ -290,7 +305,7 @@ func TestTimedFileOutput_Write_new_file(t *testing.T) {
 		t.Errorf("Should not return an error")
 	}
 
-	if output.fileSampleCount != uint32(audio.SampleCount()) {
+	if output.fileSampleCount != int64(audio.SampleCount()) {
 		t.Errorf("Wrong fileSampleCount :\n got: %v\nwant: %v", output.fileSampleCount, audio.SampleCount())
 	}
 	if output.currentFile.Path() != output.fileName(audio.Timestamp(), true) {
@@ -330,3 +345,284 @@ func TestTimedFileOutput_Write_next_file(t *testing.T) {
 		t.Errorf("Wrong path :\n got: %v\nwant: %v", output.currentFile.Path(), output.fileName(audio.Timestamp(), true))
 	}
 }
+
+func TestTimedFileOutput_newFile_encoded(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "timedfileoutput")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	format, _ := ParseTimedFileFormat("ogg/vorbis:vbr(q=5)")
+	output := TimedFileOutput{RootDirectory: tempDir, Format: format}
+
+	err = output.newFile(timeReference())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.closeFile()
+
+	if _, ok := output.currentFile.(*EncodedFile); !ok {
+		t.Errorf("The currentFile should be an EncodedFile :\n got: %v", output.currentFile)
+	}
+	if output.currentFile.Path() != output.fileName(timeReference(), true) {
+		t.Errorf("Wrong path :\n got: %v\nwant: %v", output.currentFile.Path(), output.fileName(timeReference(), true))
+	}
+}
+
+func TestTimedFileOutputConfig_Apply(t *testing.T) {
+	config := TimedFileOutputConfig{Root: "/srv/pige", Duration: time.Minute, Format: "flac", SyncInterval: time.Minute}
+	output := &TimedFileOutput{}
+
+	err := config.Apply(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output.RootDirectory != config.Root {
+		t.Errorf("Wrong RootDirectory :\n got: %v\nwant: %v", output.RootDirectory, config.Root)
+	}
+	if output.Format.SndFileFormat != FORMAT_FLAC|FORMAT_PCM_16 {
+		t.Errorf("Wrong file format :\n got: %x\nwant: %x", output.Format.SndFileFormat, FORMAT_FLAC|FORMAT_PCM_16)
+	}
+	if output.SyncInterval != config.SyncInterval {
+		t.Errorf("Wrong SyncInterval :\n got: %v\nwant: %v", output.SyncInterval, config.SyncInterval)
+	}
+
+	config.Format = "dummy"
+	if config.Apply(output) == nil {
+		t.Errorf("Should return an error with invalid format")
+	}
+}
+
+func TestTimedFileOutput_samplePosition(t *testing.T) {
+	output := TimedFileOutput{}
+	output.fileStart = timeReference()
+	output.expectedFileSampleCount = 44100 * 60
+
+	conditions := []struct {
+		timestamp time.Time
+		position  int64
+	}{
+		{timeReference(), 0},
+		{timeReference().Add(-time.Second), 0},
+		{timeReference().Add(10 * time.Second), 441000},
+		{timeReference().Add(time.Hour), 44100 * 60},
+	}
+
+	for _, condition := range conditions {
+		position := output.samplePosition(condition.timestamp)
+		if position != condition.position {
+			t.Errorf("Wrong position for %v :\n got: %v\nwant: %v", condition.timestamp, position, condition.position)
+		}
+	}
+}
+
+func TestTimedFileOutput_samplePosition_longFile(t *testing.T) {
+	output := TimedFileOutput{}
+	output.SetSampleRate(48000)
+	output.fileStart = timeReference()
+	output.expectedFileSampleCount = 48000 * 48 * 3600
+
+	// After 24.8 hours, the sample count exceeds 2^32
+	timestamp := timeReference().Add(25 * time.Hour)
+	if position, expected := output.samplePosition(timestamp), int64(48000*25*3600); position != expected {
+		t.Errorf("Wrong position in a long file :\n got: %v\nwant: %v", position, expected)
+	}
+}
+
+func TestTimedFileOutput_write_gap(t *testing.T) {
+	file, err := tempSndFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Path())
+
+	output := TimedFileOutput{}
+	output.currentFile = file
+	output.fileStart = timeReference()
+	output.expectedFileSampleCount = 44100 * 60
+
+	audio := NewAudio(1024, 2)
+	audio.SetTimestamp(timeReference().Add(2 * time.Second))
+
+	err = output.write(audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSampleCount := int64(2*44100 + 1024)
+	if output.fileSampleCount != expectedSampleCount {
+		t.Errorf("Gap should be padded with silence :\n got: %v\nwant: %v", output.fileSampleCount, expectedSampleCount)
+	}
+	if len(output.markers) != 1 || output.markers[0].Position != 0 {
+		t.Errorf("Gap should be marked at the start of the file :\n got: %v", output.markers)
+	}
+}
+
+func TestTimedFileOutput_write_tolerance(t *testing.T) {
+	file, err := tempSndFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Path())
+
+	output := TimedFileOutput{}
+	output.currentFile = file
+	output.fileStart = timeReference()
+	output.expectedFileSampleCount = 44100 * 60
+
+	audio := NewAudio(1024, 2)
+	audio.SetTimestamp(timeReference().Add(500 * time.Millisecond))
+
+	err = output.write(audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output.fileSampleCount != 1024 {
+		t.Errorf("Small gap should be ignored :\n got: %v\nwant: %v", output.fileSampleCount, 1024)
+	}
+	if len(output.markers) != 0 {
+		t.Errorf("Small gap should not be marked :\n got: %v", output.markers)
+	}
+}
+
+func TestTimedFileOutput_Mark(t *testing.T) {
+	output := TimedFileOutput{}
+	output.fileStart = timeReference()
+	output.expectedFileSampleCount = 44100 * 60
+
+	output.Mark(timeReference().Add(time.Second), "Device error: dummy")
+	output.Mark(timeReference().Add(2*time.Second), "Device error: dummy")
+
+	output.addPendingMarkers()
+
+	expectedMarkers := []WavMarker{{Position: 44100, Label: "Device error: dummy"}}
+	if len(output.markers) != 1 || output.markers[0] != expectedMarkers[0] {
+		t.Errorf("Wrong markers :\n got: %v\nwant: %v", output.markers, expectedMarkers)
+	}
+	if len(output.pendingMarkers) != 0 {
+		t.Errorf("Pending markers should be cleared :\n got: %v", output.pendingMarkers)
+	}
+}
+
+func TestTimedFileOutput_broadcastInfo(t *testing.T) {
+	output := TimedFileOutput{}
+	output.fileStart = time.Date(2006, 1, 2, 1, 0, 0, 0, time.UTC)
+
+	info := output.broadcastInfo()
+
+	if info.Originator != "go-broadcast" {
+		t.Errorf("Wrong Originator :\n got: %v\nwant: %v", info.Originator, "go-broadcast")
+	}
+	if !info.OriginationTime.Equal(output.fileStart) {
+		t.Errorf("Wrong OriginationTime :\n got: %v\nwant: %v", info.OriginationTime, output.fileStart)
+	}
+	if info.TimeReference != 3600*44100 {
+		t.Errorf("TimeReference should be the sample count since midnight :\n got: %v\nwant: %v", info.TimeReference, 3600*44100)
+	}
+}
+
+func TestTimedFileOutput_write_sync(t *testing.T) {
+	file, err := tempSndFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Path())
+
+	output := TimedFileOutput{}
+	output.currentFile = file
+	output.lastSync = timeReference()
+
+	audio := NewAudio(1024, 2)
+	audio.SetTimestamp(timeReference().Add(time.Second))
+	output.write(audio)
+
+	if output.lastSync != timeReference() {
+		t.Errorf("File should not be synced before SyncInterval :\n got: %v\nwant: %v", output.lastSync, timeReference())
+	}
+
+	audio.SetTimestamp(timeReference().Add(output.syncInterval()))
+	output.write(audio)
+
+	if output.lastSync != audio.Timestamp() {
+		t.Errorf("File should be synced after SyncInterval :\n got: %v\nwant: %v", output.lastSync, audio.Timestamp())
+	}
+
+	output.closeFile()
+}
+
+type testTimedFileHandler struct {
+	records []*ClosedRecord
+}
+
+func (handler *testTimedFileHandler) FileClosed(record *ClosedRecord) {
+	handler.records = append(handler.records, record)
+}
+
+func TestTimedFileOutput_closeFile_fileHandlers(t *testing.T) {
+	file, err := tempSndFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Path())
+
+	handler := &testTimedFileHandler{}
+	output := TimedFileOutput{FileHandlers: []TimedFileHandler{handler}}
+	output.currentFile = file
+	output.fileStart = timeReference()
+	output.fileSampleCount = 44100
+	output.expectedFileSampleCount = 44100 * 2
+
+	output.closeFile()
+
+	if len(handler.records) != 1 {
+		t.Fatalf("Handler should be notified once :\n got: %v", handler.records)
+	}
+
+	record := handler.records[0]
+	expectedRecord := ClosedRecord{
+		Path:               file.Path(),
+		Start:              timeReference(),
+		End:                timeReference().Add(time.Second),
+		SampleCount:        44100,
+		MissingSampleCount: 44100,
+		Format:             "wav",
+	}
+	if *record != expectedRecord {
+		t.Errorf("Wrong closed record :\n got: %v\nwant: %v", *record, expectedRecord)
+	}
+}
+
+func TestTimedFileOutput_Stop(t *testing.T) {
+	file, err := tempSndFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Path())
+
+	handler := &testTimedFileHandler{}
+	output := TimedFileOutput{FileHandlers: []TimedFileHandler{handler}}
+	output.currentFile = file
+	output.recording = true
+	output.fileStart = timeReference()
+	output.fileSampleCount = 44100
+	output.expectedFileSampleCount = 44100 * 60
+
+	err = output.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output.recording || output.currentFile != nil {
+		t.Errorf("Recording should be stopped")
+	}
+	if len(handler.records) != 1 || handler.records[0].MissingSampleCount != 0 {
+		t.Errorf("Stopped file shouldn't have missing samples :\n got: %v", handler.records)
+	}
+
+	if err := output.Stop(); err != nil {
+		t.Errorf("Should ignore a stop without file :\n got: %v", err)
+	}
+}
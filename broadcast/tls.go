@@ -0,0 +1,60 @@
+package broadcast
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Returns a CertPool with the PEM certificates of the given file
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("No PEM certificate in %s", file)
+	}
+	return pool, nil
+}
+
+// Returns the TLS config used to connect the given server. The server
+// certificate is verified with the CA bundle of caFile (or the system
+// CAs when empty), unless insecureSkipVerify is true.
+func NewTLSClientConfig(serverName string, caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// Returns the certificate verification error in the given error (or nil)
+func CertificateError(err error) error {
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var certificateInvalidError x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &unknownAuthorityError):
+		return unknownAuthorityError
+	case errors.As(err, &hostnameError):
+		return hostnameError
+	case errors.As(err, &certificateInvalidError):
+		return certificateInvalidError
+	}
+	return nil
+}
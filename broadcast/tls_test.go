@@ -0,0 +1,137 @@
+package broadcast
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Creates a self-signed certificate for 127.0.0.1. Returns the certificate
+// and key files.
+func testCertificateFiles(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-broadcast test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(directory, "cert.pem")
+	keyFile := filepath.Join(directory, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+
+	return certFile, keyFile
+}
+
+// Returns a TLS listener on 127.0.0.1 with the given certificate
+func testTLSListener(t *testing.T, certFile string, keyFile string) net.Listener {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func TestLoadCertPool(t *testing.T) {
+	certFile, keyFile := testCertificateFiles(t)
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	if _, err := LoadCertPool(certFile); err != nil {
+		t.Errorf("Certificate file should be loaded :\n got: %v", err)
+	}
+
+	if _, err := LoadCertPool(keyFile); err == nil {
+		t.Errorf("File without certificate should be refused")
+	}
+}
+
+func TestNewTLSClientConfig(t *testing.T) {
+	certFile, keyFile := testCertificateFiles(t)
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	listener := testTLSListener(t, certFile, keyFile)
+	defer listener.Close()
+
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connection.(*tls.Conn).Handshake()
+			connection.Close()
+		}
+	}()
+
+	config, _ := NewTLSClientConfig("127.0.0.1", "", false)
+	_, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if CertificateError(err) == nil {
+		t.Errorf("Unknown authority should be reported :\n got: %v", err)
+	}
+
+	config, err = NewTLSClientConfig("127.0.0.1", certFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatalf("Certificate should be verified with the CA file :\n got: %v", err)
+	}
+	connection.Close()
+
+	config, _ = NewTLSClientConfig("localhost", "", true)
+	connection, err = tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatalf("Certificate should not be verified :\n got: %v", err)
+	}
+	connection.Close()
+}
+
+func TestCertificateError(t *testing.T) {
+	if err := CertificateError(x509.UnknownAuthorityError{}); err == nil {
+		t.Errorf("UnknownAuthorityError should be a certificate error")
+	}
+	if err := CertificateError(&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}); err != nil {
+		t.Errorf("Network error should not be a certificate error :\n got: %v", err)
+	}
+}
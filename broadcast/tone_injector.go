@@ -0,0 +1,119 @@
+package broadcast
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type ToneInjector struct {
+	Output     AudioHandler
+	SampleRate int
+
+	EventLog *LocalEventLog
+
+	generator *Generator
+	config    *ToneInjectionConfig
+	until     time.Time
+
+	mutex sync.Mutex
+}
+
+type ToneInjectionConfig struct {
+	GeneratorConfig
+	Duration time.Duration
+}
+
+type ToneInjectorStatus struct {
+	Active    bool
+	Injection *ToneInjectionConfig `json:",omitempty"`
+	Until     time.Time            `json:",omitempty"`
+}
+
+func NewToneInjectionConfig() ToneInjectionConfig {
+	return ToneInjectionConfig{
+		GeneratorConfig: NewGeneratorConfig(),
+		Duration:        30 * time.Second,
+	}
+}
+
+func (config *ToneInjectionConfig) Validate(errors *ConfigErrors) {
+	config.GeneratorConfig.Validate(errors)
+	if config.Duration <= 0 {
+		errors.Add("Duration", "must be positive")
+	}
+}
+
+func (injector *ToneInjector) SetAudioHandler(audioHandler AudioHandler) {
+	injector.Output = audioHandler
+}
+
+func (injector *ToneInjector) eventLog() *LocalEventLog {
+	if injector.EventLog == nil {
+		injector.EventLog = &LocalEventLog{Source: "generator"}
+	}
+	return injector.EventLog
+}
+
+func (injector *ToneInjector) Inject(config *ToneInjectionConfig) {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+
+	generator := &Generator{SampleRate: injector.SampleRate}
+	config.GeneratorConfig.Apply(generator)
+
+	injector.generator = generator
+	injector.config = config
+	injector.until = time.Now().Add(config.Duration)
+
+	injector.eventLog().NewEvent(fmt.Sprintf("Inject %s tone (%v Hz, %v dBFS) during %v", config.Waveform, config.Frequency, config.Level, config.Duration))
+}
+
+func (injector *ToneInjector) Cancel() {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+
+	if injector.generator != nil {
+		injector.stop("Tone injection cancelled")
+	}
+}
+
+func (injector *ToneInjector) stop(message string) {
+	injector.generator = nil
+	injector.config = nil
+	injector.until = time.Time{}
+
+	injector.eventLog().NewEvent(message)
+}
+
+func (injector *ToneInjector) Status() ToneInjectorStatus {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+
+	if injector.generator == nil {
+		return ToneInjectorStatus{}
+	}
+	return ToneInjectorStatus{Active: true, Injection: injector.config, Until: injector.until}
+}
+
+func (injector *ToneInjector) AudioOut(audio *Audio) {
+	injector.mutex.Lock()
+
+	if injector.generator != nil {
+		if audio.Timestamp().After(injector.until) {
+			injector.stop("End of tone injection")
+		} else {
+			injector.generator.ChannelCount = audio.ChannelCount()
+			tone := injector.generator.Generate(audio.SampleCount())
+			for channel := 0; channel < audio.ChannelCount(); channel++ {
+				audio.SetSamples(channel, tone.Samples(channel))
+			}
+		}
+	}
+
+	injector.mutex.Unlock()
+
+	if injector.Output != nil {
+		injector.Output.AudioOut(audio)
+	}
+}
@@ -0,0 +1,85 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+type ToneInjectorController struct {
+	injector *ToneInjector
+}
+
+func NewToneInjectorController(injector *ToneInjector) (controller *ToneInjectorController) {
+	return &ToneInjectorController{injector: injector}
+}
+
+func (controller *ToneInjectorController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		if err != nil {
+			controller.fatal(response, err)
+			return
+		}
+	}
+
+	switch request.Method {
+	case "GET":
+		controller.Show(response)
+	case "POST":
+		controller.Create(response, body)
+	case "DELETE":
+		controller.Delete(response)
+	default:
+		response.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(response, "Method not allowed", 405)
+	}
+}
+
+func (controller *ToneInjectorController) Show(response http.ResponseWriter) {
+	response.Header().Set("Content-Type", "application/json")
+
+	jsonBytes, err := json.Marshal(controller.injector.Status())
+	if err == nil {
+		response.Write(jsonBytes)
+	} else {
+		controller.fatal(response, err)
+	}
+}
+
+func (controller *ToneInjectorController) Create(response http.ResponseWriter, body []byte) {
+	response.Header().Set("Content-Type", "application/json")
+
+	Log.Debugf("Inject tone : %s", string(body))
+
+	config := NewToneInjectionConfig()
+	if len(body) > 0 {
+		err := json.Unmarshal(body, &config)
+		if err != nil {
+			http.Error(response, fmt.Sprintf("Invalid tone: %v", err), 400)
+			return
+		}
+	}
+
+	err := ValidateConfig(&config)
+	if err != nil {
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	controller.injector.Inject(&config)
+
+	controller.Show(response)
+}
+
+func (controller *ToneInjectorController) Delete(response http.ResponseWriter) {
+	controller.injector.Cancel()
+	controller.Show(response)
+}
+
+func (controller *ToneInjectorController) fatal(response http.ResponseWriter, err error) {
+	http.Error(response, fmt.Sprintf("Unknown error: %v", err), 500)
+}
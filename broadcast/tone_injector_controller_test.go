@@ -0,0 +1,64 @@
+package broadcast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestToneInjectorController_Create(t *testing.T) {
+	injector := &ToneInjector{
+		EventLog: &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "generator"},
+	}
+	controller := NewToneInjectorController(injector)
+
+	request, _ := http.NewRequest("POST", "http://localhost:9000/tone.json", strings.NewReader(`{"Waveform":"ebu-ident","Duration":10000000000}`))
+
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+
+	status := injector.Status()
+	if !status.Active {
+		t.Fatal("Tone injection should be active")
+	}
+	if status.Injection.Waveform != GeneratorEBUIdent {
+		t.Errorf("Wrong injected waveform :\n got: %v\nwant: %v", status.Injection.Waveform, GeneratorEBUIdent)
+	}
+	if status.Injection.Level != -18 {
+		t.Errorf("Default level should be used :\n got: %v\nwant: %v", status.Injection.Level, -18)
+	}
+
+	request, _ = http.NewRequest("DELETE", "http://localhost:9000/tone.json", nil)
+	controller.ServeHTTP(httptest.NewRecorder(), request)
+
+	if injector.Status().Active {
+		t.Errorf("Tone injection should be cancelled")
+	}
+}
+
+func TestToneInjectorController_Create_invalid(t *testing.T) {
+	injector := &ToneInjector{
+		EventLog: &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "generator"},
+	}
+	controller := NewToneInjectorController(injector)
+
+	for _, body := range []string{`{"Waveform":"square"}`, `{"Duration":0}`, `{"Duration":-1}`, `{"Waveform":`} {
+		request, _ := http.NewRequest("POST", "http://localhost:9000/tone.json", strings.NewReader(body))
+
+		response := httptest.NewRecorder()
+		controller.ServeHTTP(response, request)
+
+		if response.Code != 400 {
+			t.Errorf("Wrong response code for %s :\n got: %v\nwant: %v", body, response.Code, 400)
+		}
+	}
+
+	if injector.Status().Active {
+		t.Errorf("Invalid tone shouldn't be injected")
+	}
+}
@@ -0,0 +1,44 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToneInjector_AudioOut(t *testing.T) {
+	var output *Audio
+	injector := &ToneInjector{
+		Output:   AudioHandlerFunc(func(audio *Audio) { output = audio }),
+		EventLog: &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "generator"},
+	}
+
+	injector.AudioOut(NewAudio(1024, 2))
+	if peakLevel(output.Samples(0)) != 0 {
+		t.Errorf("Audio should be unchanged without injection")
+	}
+
+	config := NewToneInjectionConfig()
+	config.Duration = time.Minute
+	injector.Inject(&config)
+
+	injector.AudioOut(NewAudio(1024, 2))
+	if peakLevel(output.Samples(0)) == 0 {
+		t.Errorf("Audio should be replaced by the injected tone")
+	}
+
+	audio := NewAudio(1024, 2)
+	audio.SetTimestamp(time.Now().Add(2 * time.Minute))
+	injector.AudioOut(audio)
+	if peakLevel(output.Samples(0)) != 0 {
+		t.Errorf("Audio should be unchanged after injection")
+	}
+
+	if injector.Status().Active {
+		t.Errorf("Injection should be finished")
+	}
+
+	events := injector.eventLog().Events()
+	if len(events) != 2 || events[1].Message != "End of tone injection" {
+		t.Errorf("Wrong events :\n got: %v", events)
+	}
+}
@@ -16,6 +16,8 @@ type UDPInput struct {
 
 	bufferLength int
 	buffer       []byte
+
+	loops runLoops
 }
 
 func (input *UDPInput) Init() (err error) {
@@ -70,11 +72,25 @@ func (input *UDPInput) Read() (err error) {
 }
 
 func (input *UDPInput) Run() {
-	for {
+	if !input.loops.Start() {
+		return
+	}
+	defer input.loops.Done()
+
+	for !input.loops.Stopped() {
 		input.Read()
 	}
 }
 
+// Closes the socket and stops the Run loop
+func (input *UDPInput) Stop() error {
+	input.loops.Stop()
+
+	err := input.connection.Close()
+	input.loops.Wait()
+	return err
+}
+
 type UDPInputConfig struct {
 	Bind string
 }
@@ -86,3 +102,9 @@ func (config *UDPInputConfig) Flags(flags *flag.FlagSet, prefix string) {
 func (config *UDPInputConfig) Apply(udpInput *UDPInput) {
 	udpInput.Bind = config.Bind
 }
+
+func (config *UDPInputConfig) Validate(errors *ConfigErrors) {
+	if _, _, err := net.SplitHostPort(config.Bind); err != nil {
+		errors.Add("Bind", "invalid [address]:port '%s'", config.Bind)
+	}
+}
@@ -91,3 +91,12 @@ func (config *UDPOutputConfig) Apply(udpOutput *UDPOutput) {
 	}
 	config.Opus.Apply(udpOutput.Encoder.(*OpusAudioEncoder))
 }
+
+func (config *UDPOutputConfig) Validate(errors *ConfigErrors) {
+	if config.Target == "" {
+		return
+	}
+	if _, _, err := net.SplitHostPort(config.Target); err != nil {
+		errors.Add("Target", "invalid host:port '%s'", config.Target)
+	}
+}
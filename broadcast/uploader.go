@@ -0,0 +1,324 @@
+package broadcast
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Describes the upload of a closed file, saved in the Uploader queue
+type UploadJob struct {
+	Path         string
+	Key          string
+	Size         int64
+	Checksum     string
+	UploadedSize int64
+
+	// Used to resume S3 multipart uploads
+	UploadId string       `json:",omitempty"`
+	Parts    []UploadPart `json:",omitempty"`
+}
+
+type UploadPart struct {
+	Number int
+	Size   int64
+	ETag   string
+}
+
+type UploadTarget interface {
+	// Uploads the job file and verifies its checksum. The progress function
+	// saves the job, to resume the upload after a failure or a restart.
+	Upload(job *UploadJob, progress func()) error
+}
+
+// An Uploader sends the files closed by TimedFileOutput to a remote
+// storage (S3 bucket or HTTP server). Uploads are queued in QueueDirectory
+// and retried until success (store and forward).
+type Uploader struct {
+	RootDirectory  string
+	Target         UploadTarget
+	QueueDirectory string
+
+	Concurrency int
+	// 0 retries forever
+	MaxAttempts int
+	// Removes local files after upload
+	DeleteUploaded bool
+
+	Metrics  *LocalMetrics
+	EventLog *LocalEventLog
+
+	queue         *PersistentQueue
+	uploadedCount int64
+	failedCount   int64
+}
+
+func (uploader *Uploader) metrics() *LocalMetrics {
+	if uploader.Metrics == nil {
+		uploader.Metrics = &LocalMetrics{prefix: "upload"}
+	}
+	return uploader.Metrics
+}
+
+func (uploader *Uploader) eventLog() *LocalEventLog {
+	if uploader.EventLog == nil {
+		uploader.EventLog = &LocalEventLog{Source: "upload"}
+	}
+	return uploader.EventLog
+}
+
+func (uploader *Uploader) IsEnabled() bool {
+	return uploader.Target != nil
+}
+
+func (uploader *Uploader) Init() error {
+	uploader.queue = &PersistentQueue{
+		Directory:   uploader.QueueDirectory,
+		Concurrency: uploader.Concurrency,
+		MaxAttempts: uploader.MaxAttempts,
+		Process:     uploader.upload,
+		Failed:      uploader.failed,
+	}
+	return uploader.queue.Init()
+}
+
+func (uploader *Uploader) FileClosed(record *ClosedRecord) {
+	err := uploader.Enqueue(record.Path)
+	if err != nil {
+		Log.Printf("Can't queue upload of %s : %v", record.Path, err)
+	}
+}
+
+func (uploader *Uploader) Enqueue(fileName string) error {
+	key, err := filepath.Rel(uploader.RootDirectory, fileName)
+	if err != nil || strings.HasPrefix(key, "..") {
+		key = path.Base(fileName)
+	}
+
+	return uploader.queue.Push(&UploadJob{Path: fileName, Key: key})
+}
+
+func (uploader *Uploader) upload(file string) error {
+	var job UploadJob
+	err := uploader.queue.Load(file, &job)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(job.Path); os.IsNotExist(err) {
+		uploader.eventLog().NewEvent(fmt.Sprintf("File %s removed before upload", job.Key))
+		return nil
+	}
+
+	if job.Checksum == "" {
+		fileInfo, err := os.Stat(job.Path)
+		if err != nil {
+			return err
+		}
+		job.Size = fileInfo.Size()
+
+		job.Checksum, err = FileChecksum(job.Path)
+		if err != nil {
+			return err
+		}
+		uploader.queue.Save(file, &job)
+	}
+
+	Log.Debugf("Upload %s (%d bytes)", job.Key, job.Size)
+	err = uploader.Target.Upload(&job, func() {
+		uploader.queue.Save(file, &job)
+	})
+	if err != nil {
+		uploader.metrics().Counter("Retries").Inc(1)
+		return err
+	}
+
+	Log.Printf("Uploaded %s", job.Key)
+	atomic.AddInt64(&uploader.uploadedCount, 1)
+	uploader.metrics().Counter("Uploaded").Inc(1)
+	uploader.metrics().Counter("UploadedBytes").Inc(job.Size)
+
+	if uploader.DeleteUploaded {
+		err := os.Remove(job.Path)
+		if err != nil {
+			Log.Printf("Can't remove uploaded file %s : %v", job.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func (uploader *Uploader) failed(file string, attempts int, err error) {
+	var job UploadJob
+	uploader.queue.Load(file+".failed", &job)
+
+	uploader.eventLog().NewEvent(fmt.Sprintf("Upload of %s failed after %d attempts : %v", job.Key, attempts, err))
+	atomic.AddInt64(&uploader.failedCount, 1)
+	uploader.metrics().Counter("Failed").Inc(1)
+}
+
+type UploadStatus struct {
+	QueuedJobStatus
+
+	Key          string
+	Size         int64
+	UploadedSize int64
+}
+
+type UploaderStatus struct {
+	Queue    []UploadStatus
+	Uploaded int64
+	Failed   int64
+}
+
+func (uploader *Uploader) Status() *UploaderStatus {
+	status := &UploaderStatus{
+		Queue:    []UploadStatus{},
+		Uploaded: atomic.LoadInt64(&uploader.uploadedCount),
+		Failed:   atomic.LoadInt64(&uploader.failedCount),
+	}
+
+	for _, jobStatus := range uploader.queue.Status() {
+		var job UploadJob
+		if uploader.queue.Load(jobStatus.File, &job) != nil {
+			continue
+		}
+
+		status.Queue = append(status.Queue, UploadStatus{
+			QueuedJobStatus: jobStatus,
+			Key:             job.Key,
+			Size:            job.Size,
+			UploadedSize:    job.UploadedSize,
+		})
+	}
+
+	return status
+}
+
+// Sends the ready uploads, then stops
+func (uploader *Uploader) Stop() error {
+	if uploader.queue == nil {
+		return nil
+	}
+	return uploader.queue.Stop()
+}
+
+func (uploader *Uploader) Run() {
+	uploader.queue.Run(func(count int) {
+		uploader.metrics().Gauge("Queue").Update(int64(count))
+	})
+}
+
+type UploaderConfig struct {
+	Target         string
+	S3Endpoint     string
+	S3Region       string
+	AccessKey      string
+	SecretKey      string
+	QueueDirectory string
+	Concurrency    int
+	MaxAttempts    int
+	Delete         bool
+	HttpVerify     string
+	// In megabytes, 0 sends each file in a single request
+	HttpPartSize int64
+}
+
+func (config *UploaderConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.StringVar(&config.Target, strings.Join([]string{prefix, "target"}, "-"), "", "The upload target (s3://bucket/prefix or http://host/path)")
+	flags.StringVar(&config.S3Endpoint, strings.Join([]string{prefix, "s3-endpoint"}, "-"), "https://s3.amazonaws.com", "The S3 compatible endpoint")
+	flags.StringVar(&config.S3Region, strings.Join([]string{prefix, "s3-region"}, "-"), "us-east-1", "The S3 region")
+	flags.StringVar(&config.AccessKey, strings.Join([]string{prefix, "access-key"}, "-"), "", "The S3 access key (default $AWS_ACCESS_KEY_ID)")
+	flags.StringVar(&config.SecretKey, strings.Join([]string{prefix, "secret-key"}, "-"), "", "The S3 secret key (default $AWS_SECRET_ACCESS_KEY)")
+	flags.StringVar(&config.QueueDirectory, strings.Join([]string{prefix, "queue"}, "-"), "", "The directory used to queue uploads (default .upload in files root)")
+	flags.IntVar(&config.Concurrency, strings.Join([]string{prefix, "concurrency"}, "-"), 2, "The maximum count of simultaneous uploads")
+	flags.IntVar(&config.MaxAttempts, strings.Join([]string{prefix, "max-attempts"}, "-"), 0, "The maximum attempts for each upload (0 to retry forever)")
+	flags.BoolVar(&config.Delete, strings.Join([]string{prefix, "delete"}, "-"), false, "Remove local files after upload")
+	flags.StringVar(&config.HttpVerify, strings.Join([]string{prefix, "http-verify"}, "-"), HttpUploadVerifyDigest, "The verification of HTTP uploads (digest or size)")
+	flags.Int64Var(&config.HttpPartSize, strings.Join([]string{prefix, "http-part-size"}, "-"), 0, "The size (in MB) of the partial PUT requests used to resume HTTP uploads (0 to disable)")
+}
+
+func (config *UploaderConfig) target() (UploadTarget, error) {
+	if config.Target == "" {
+		return nil, nil
+	}
+
+	targetURL, err := url.Parse(config.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch targetURL.Scheme {
+	case "s3":
+		target := &S3UploadTarget{
+			Endpoint:  config.S3Endpoint,
+			Region:    config.S3Region,
+			Bucket:    targetURL.Host,
+			Prefix:    strings.TrimPrefix(targetURL.Path, "/"),
+			AccessKey: config.AccessKey,
+			SecretKey: config.SecretKey,
+		}
+		if target.AccessKey == "" {
+			target.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if target.SecretKey == "" {
+			target.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+		if target.Bucket == "" {
+			return nil, errors.New("No bucket in S3 upload target")
+		}
+		return target, nil
+	case "http", "https":
+		return &HttpUploadTarget{URL: config.Target, Verify: config.HttpVerify, PartSize: config.HttpPartSize * megabyte}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported upload target: '%s'", config.Target)
+}
+
+func (config *UploaderConfig) Apply(uploader *Uploader, rootDirectory string) error {
+	target, err := config.target()
+	if err != nil {
+		return err
+	}
+
+	uploader.RootDirectory = rootDirectory
+	if target != nil {
+		uploader.Target = target
+	}
+	uploader.QueueDirectory = config.QueueDirectory
+	if uploader.QueueDirectory == "" {
+		uploader.QueueDirectory = path.Join(rootDirectory, ".upload")
+	}
+	uploader.Concurrency = config.Concurrency
+	uploader.MaxAttempts = config.MaxAttempts
+	uploader.DeleteUploaded = config.Delete
+
+	return nil
+}
+
+func (config *UploaderConfig) Validate(errors *ConfigErrors) {
+	if config.Target == "" {
+		return
+	}
+	if _, err := config.target(); err != nil {
+		errors.Add("Target", "%v", err)
+	}
+	if config.Concurrency <= 0 {
+		errors.Add("Concurrency", "must be positive")
+	}
+	if config.MaxAttempts < 0 {
+		errors.Add("MaxAttempts", "can't be negative")
+	}
+	if config.HttpVerify != "" && config.HttpVerify != HttpUploadVerifyDigest && config.HttpVerify != HttpUploadVerifySize {
+		errors.Add("HttpVerify", "unknown verification '%s' (digest or size)", config.HttpVerify)
+	}
+	if config.HttpPartSize < 0 {
+		errors.Add("HttpPartSize", "can't be negative")
+	}
+}
@@ -0,0 +1,26 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type UploaderController struct {
+	uploader *Uploader
+}
+
+func NewUploaderController(uploader *Uploader) *UploaderController {
+	return &UploaderController{uploader: uploader}
+}
+
+func (controller *UploaderController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		http.Error(response, "Method not allowed", 405)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+
+	jsonBytes, _ := json.Marshal(controller.uploader.Status())
+	response.Write(jsonBytes)
+}
@@ -0,0 +1,47 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestUploaderController_ServeHTTP(t *testing.T) {
+	uploader := testUploader(t)
+	defer os.RemoveAll(uploader.RootDirectory)
+
+	controller := NewUploaderController(uploader)
+
+	request, _ := http.NewRequest("GET", "/uploads.json", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 200)
+	}
+	if response.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Wrong Content-Type :\n got: %v\nwant: %v", response.Header().Get("Content-Type"), "application/json")
+	}
+
+	var status UploaderStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Queue == nil || len(status.Queue) != 0 {
+		t.Errorf("Wrong queue :\n got: %v", status.Queue)
+	}
+}
+
+func TestUploaderController_ServeHTTP_methodNotAllowed(t *testing.T) {
+	controller := NewUploaderController(&Uploader{})
+
+	request, _ := http.NewRequest("POST", "/uploads.json", nil)
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+
+	if response.Code != 405 {
+		t.Errorf("Wrong response code :\n got: %v\nwant: %v", response.Code, 405)
+	}
+}
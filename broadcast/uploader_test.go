@@ -0,0 +1,188 @@
+package broadcast
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+type testUploadTarget struct {
+	jobs []UploadJob
+	err  error
+}
+
+func (target *testUploadTarget) Upload(job *UploadJob, progress func()) error {
+	if target.err != nil {
+		return target.err
+	}
+	job.UploadedSize = job.Size
+	target.jobs = append(target.jobs, *job)
+	return nil
+}
+
+func testUploader(t *testing.T) *Uploader {
+	tempDir, err := ioutil.TempDir("", "uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploader := &Uploader{
+		RootDirectory:  tempDir,
+		QueueDirectory: path.Join(tempDir, ".upload"),
+		Target:         &testUploadTarget{},
+		EventLog:       &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "upload"},
+	}
+	if err := uploader.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return uploader
+}
+
+func testRecordFile(uploader *Uploader) string {
+	fileName := path.Join(uploader.RootDirectory, "2015/05-May/20-Wed/14h00.wav")
+	os.MkdirAll(path.Dir(fileName), 0775)
+	ioutil.WriteFile(fileName, []byte("go-broadcast"), 0644)
+	return fileName
+}
+
+func TestUploader_FileClosed(t *testing.T) {
+	uploader := testUploader(t)
+	defer os.RemoveAll(uploader.RootDirectory)
+
+	fileName := testRecordFile(uploader)
+	uploader.FileClosed(&ClosedRecord{Path: fileName})
+
+	dispatchQueue(uploader.queue, time.Now())
+
+	target := uploader.Target.(*testUploadTarget)
+	if len(target.jobs) != 1 {
+		t.Fatalf("Wrong upload count :\n got: %v\nwant: %v", len(target.jobs), 1)
+	}
+
+	job := target.jobs[0]
+	expectedJob := UploadJob{
+		Path:         fileName,
+		Key:          "2015/05-May/20-Wed/14h00.wav",
+		Size:         12,
+		Checksum:     "150b58fa7661ddfa2cf6b3ef13afbcf196ea008f4f3f9b9a1221e089d5248eea",
+		UploadedSize: 12,
+	}
+	if job.Path != expectedJob.Path || job.Key != expectedJob.Key || job.Size != expectedJob.Size || job.Checksum != expectedJob.Checksum {
+		t.Errorf("Wrong upload job :\n got: %v\nwant: %v", job, expectedJob)
+	}
+
+	if status := uploader.Status(); status.Uploaded != 1 || len(status.Queue) != 0 {
+		t.Errorf("Wrong uploader status :\n got: %v", status)
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		t.Errorf("Uploaded file should be kept")
+	}
+}
+
+func TestUploader_DeleteUploaded(t *testing.T) {
+	uploader := testUploader(t)
+	defer os.RemoveAll(uploader.RootDirectory)
+	uploader.DeleteUploaded = true
+
+	fileName := testRecordFile(uploader)
+	uploader.Enqueue(fileName)
+
+	dispatchQueue(uploader.queue, time.Now())
+
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("Uploaded file should be removed")
+	}
+}
+
+func TestUploader_upload_error(t *testing.T) {
+	uploader := testUploader(t)
+	defer os.RemoveAll(uploader.RootDirectory)
+	uploader.Target = &testUploadTarget{err: errors.New("Network is unreachable")}
+
+	uploader.Enqueue(testRecordFile(uploader))
+	dispatchQueue(uploader.queue, time.Now())
+
+	status := uploader.Status()
+	if len(status.Queue) != 1 {
+		t.Fatalf("Failed upload should stay in queue :\n got: %v", status.Queue)
+	}
+
+	upload := status.Queue[0]
+	if upload.Key != "2015/05-May/20-Wed/14h00.wav" || upload.Size != 12 || upload.LastError != "Network is unreachable" {
+		t.Errorf("Wrong upload status :\n got: %v", upload)
+	}
+}
+
+func TestUploader_upload_removedFile(t *testing.T) {
+	uploader := testUploader(t)
+	defer os.RemoveAll(uploader.RootDirectory)
+
+	uploader.Enqueue(path.Join(uploader.RootDirectory, "2015/05-May/20-Wed/14h00.wav"))
+	dispatchQueue(uploader.queue, time.Now())
+
+	if files, _ := uploader.queue.Files(); len(files) != 0 {
+		t.Errorf("Upload of removed file should be abandoned :\n got: %v", files)
+	}
+
+	events := uploader.eventLog().Events()
+	if len(events) != 1 || events[0].Message != "File 2015/05-May/20-Wed/14h00.wav removed before upload" {
+		t.Errorf("Wrong upload events :\n got: %v", events)
+	}
+}
+
+func TestUploaderConfig_Apply(t *testing.T) {
+	conditions := []struct {
+		target string
+		valid  bool
+	}{
+		{"s3://records/site1", true},
+		{"http://localhost/records", true},
+		{"s3:///site1", false},
+		{"ftp://localhost/records", false},
+	}
+
+	for _, condition := range conditions {
+		config := UploaderConfig{Target: condition.target, S3Region: "eu-west-1"}
+		uploader := &Uploader{}
+
+		err := config.Apply(uploader, "/srv/pige")
+		if (err == nil) != condition.valid {
+			t.Errorf("Wrong error for '%s' :\n got: %v", condition.target, err)
+			continue
+		}
+		if !condition.valid {
+			continue
+		}
+
+		if uploader.QueueDirectory != "/srv/pige/.upload" {
+			t.Errorf("Wrong default QueueDirectory :\n got: %v\nwant: %v", uploader.QueueDirectory, "/srv/pige/.upload")
+		}
+		if !uploader.IsEnabled() {
+			t.Errorf("Uploader should be enabled with '%s'", condition.target)
+		}
+	}
+
+	config := UploaderConfig{Target: "s3://records/site1", S3Region: "eu-west-1"}
+	uploader := &Uploader{}
+	config.Apply(uploader, "/srv/pige")
+
+	target := uploader.Target.(*S3UploadTarget)
+	if target.Bucket != "records" || target.Prefix != "site1" || target.Region != "eu-west-1" {
+		t.Errorf("Wrong S3 target :\n got: %v", target)
+	}
+}
+
+func TestUploaderConfig_Apply_disabled(t *testing.T) {
+	config := UploaderConfig{}
+	uploader := &Uploader{}
+
+	if err := config.Apply(uploader, "/srv/pige"); err != nil {
+		t.Fatal(err)
+	}
+	if uploader.IsEnabled() {
+		t.Errorf("Uploader should be disabled without target")
+	}
+}
@@ -0,0 +1,107 @@
+package broadcast
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// A RecordOutput writes the recorded audio. Stop ends the current recording.
+type RecordOutput interface {
+	AudioHandler
+	Stop() error
+}
+
+// A VoxRecorder only records while the signal is above Threshold (VOX).
+//
+// The recording starts with the audio of the last PreRoll and stops when
+// the signal stays under Threshold during HangTime.
+type VoxRecorder struct {
+	Output RecordOutput
+
+	// In dBFS
+	Threshold float64
+	PreRoll   time.Duration
+	HangTime  time.Duration
+
+	EventLog *LocalEventLog
+
+	active       bool
+	lastActivity time.Time
+	preRoll      []*Audio
+}
+
+func (recorder *VoxRecorder) eventLog() *LocalEventLog {
+	if recorder.EventLog == nil {
+		recorder.EventLog = &LocalEventLog{Source: "record"}
+	}
+	return recorder.EventLog
+}
+
+func (recorder *VoxRecorder) IsRecording() bool {
+	return recorder.active
+}
+
+// Returns the peak level of the given audio in dBFS
+func audioPeakLevel(audio *Audio) float64 {
+	var peak float64
+	for channel := 0; channel < audio.ChannelCount(); channel++ {
+		for _, sample := range audio.Samples(channel) {
+			peak = math.Max(peak, math.Abs(float64(sample)))
+		}
+	}
+	return 20 * math.Log10(peak)
+}
+
+func (recorder *VoxRecorder) AudioOut(audio *Audio) {
+	now := audio.Timestamp()
+
+	if audioPeakLevel(audio) >= recorder.Threshold {
+		recorder.lastActivity = now
+		if !recorder.active {
+			recorder.start()
+		}
+	}
+
+	if recorder.active && now.Sub(recorder.lastActivity) > recorder.HangTime {
+		recorder.stop()
+	}
+
+	if recorder.active {
+		recorder.Output.AudioOut(audio)
+	} else {
+		recorder.bufferPreRoll(audio)
+	}
+}
+
+func (recorder *VoxRecorder) start() {
+	recorder.active = true
+	recorder.eventLog().NewEvent(fmt.Sprintf("Start recording (signal above %v dBFS)", recorder.Threshold))
+
+	for _, audio := range recorder.preRoll {
+		recorder.Output.AudioOut(audio)
+	}
+	recorder.preRoll = nil
+}
+
+func (recorder *VoxRecorder) stop() {
+	recorder.active = false
+
+	err := recorder.Output.Stop()
+	if err != nil {
+		Log.Printf("Can't stop recording : %v", err)
+	}
+	recorder.eventLog().NewEvent(fmt.Sprintf("Stop recording (signal under %v dBFS during %v)", recorder.Threshold, recorder.HangTime))
+}
+
+// Keeps the audio of the last PreRoll
+func (recorder *VoxRecorder) bufferPreRoll(audio *Audio) {
+	recorder.preRoll = append(recorder.preRoll, audio)
+
+	for len(recorder.preRoll) > 1 && audio.Timestamp().Sub(recorder.preRoll[1].Timestamp()) >= recorder.PreRoll {
+		recorder.preRoll = recorder.preRoll[1:]
+	}
+	if recorder.PreRoll == 0 {
+		recorder.preRoll = nil
+	}
+}
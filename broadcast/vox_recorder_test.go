@@ -0,0 +1,76 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+)
+
+type testRecordOutput struct {
+	audios    []*Audio
+	stopCount int
+}
+
+func (output *testRecordOutput) AudioOut(audio *Audio) {
+	output.audios = append(output.audios, audio)
+}
+
+func (output *testRecordOutput) Stop() error {
+	output.stopCount += 1
+	return nil
+}
+
+// Returns an audio of one second with the given level
+func testRecordAudio(start time.Time, second int, level float32) *Audio {
+	audio := NewAudio(100, 2)
+	audio.Process(func(_ int, _ int, _ float32) float32 {
+		return level
+	})
+	audio.SetTimestamp(start.Add(time.Duration(second) * time.Second))
+	return audio
+}
+
+func TestVoxRecorder_AudioOut(t *testing.T) {
+	output := &testRecordOutput{}
+	recorder := &VoxRecorder{
+		Output:    output,
+		Threshold: -40,
+		PreRoll:   2 * time.Second,
+		HangTime:  3 * time.Second,
+		EventLog:  &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "record"},
+	}
+
+	start := timeReference()
+	levels := []float32{0, 0.001, 0.001, 0.001, 0.5, 0.001, 0.001, 0.001, 0.001, 0.001}
+	for second, level := range levels {
+		recorder.AudioOut(testRecordAudio(start, second, level))
+	}
+
+	// Pre-roll (1s to 3s), signal (4s) and hang time (5s to 7s)
+	if len(output.audios) != 7 {
+		t.Fatalf("Wrong recorded audio count :\n got: %v\nwant: %v", len(output.audios), 7)
+	}
+	if !output.audios[0].Timestamp().Equal(start.Add(time.Second)) {
+		t.Errorf("Recording should start with the pre-roll :\n got: %v\nwant: %v", output.audios[0].Timestamp(), start.Add(time.Second))
+	}
+	if output.stopCount != 1 || recorder.IsRecording() {
+		t.Errorf("Recording should be stopped after hang time :\n got: %v", output.stopCount)
+	}
+
+	events := recorder.eventLog().Events()
+	if len(events) != 2 || events[0].Message != "Start recording (signal above -40 dBFS)" || events[1].Message != "Stop recording (signal under -40 dBFS during 3s)" {
+		t.Errorf("Wrong record events :\n got: %v", events)
+	}
+}
+
+func TestVoxRecorder_AudioOut_withoutPreRoll(t *testing.T) {
+	output := &testRecordOutput{}
+	recorder := &VoxRecorder{Output: output, Threshold: -40, HangTime: time.Second}
+
+	start := timeReference()
+	recorder.AudioOut(testRecordAudio(start, 0, 0))
+	recorder.AudioOut(testRecordAudio(start, 1, 1))
+
+	if len(output.audios) != 1 || !output.audios[0].Timestamp().Equal(start.Add(time.Second)) {
+		t.Errorf("Only the signal should be recorded :\n got: %v", output.audios)
+	}
+}
@@ -0,0 +1,102 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+type WavMarker struct {
+	Position uint32
+	Label    string
+}
+
+func wavChunk(buffer *bytes.Buffer, id string, data []byte) {
+	buffer.WriteString(id)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(data)))
+	buffer.Write(data)
+	if len(data)%2 == 1 {
+		buffer.WriteByte(0)
+	}
+}
+
+// Returns the 'cue ' and 'LIST/adtl' chunks describing the given markers
+func wavMarkerChunks(markers []WavMarker) []byte {
+	cues := &bytes.Buffer{}
+	labels := &bytes.Buffer{}
+
+	binary.Write(cues, binary.LittleEndian, uint32(len(markers)))
+	labels.WriteString("adtl")
+
+	for index, marker := range markers {
+		identifier := uint32(index + 1)
+
+		binary.Write(cues, binary.LittleEndian, identifier)
+		binary.Write(cues, binary.LittleEndian, marker.Position)
+		cues.WriteString("data")
+		binary.Write(cues, binary.LittleEndian, []uint32{0, 0, marker.Position})
+
+		label := &bytes.Buffer{}
+		binary.Write(label, binary.LittleEndian, identifier)
+		label.WriteString(marker.Label)
+		label.WriteByte(0)
+		wavChunk(labels, "labl", label.Bytes())
+	}
+
+	chunks := &bytes.Buffer{}
+	wavChunk(chunks, "cue ", cues.Bytes())
+	wavChunk(chunks, "LIST", labels.Bytes())
+	return chunks.Bytes()
+}
+
+// Appends cue points and their labels at the end of a closed RIFF/WAVE file.
+// In a RF64 file, the RIFF size is updated in the ds64 chunk (EBU Tech 3306).
+func AppendWavMarkers(fileName string, markers []WavMarker) error {
+	if len(markers) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, 16)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	rf64 := string(header[0:4]) == "RF64" && string(header[12:16]) == "ds64"
+	if (string(header[0:4]) != "RIFF" && !rf64) || string(header[8:12]) != "WAVE" {
+		return errors.New("Not a RIFF/WAVE file")
+	}
+
+	size, err := file.Seek(0, os.SEEK_END)
+	if err != nil {
+		return err
+	}
+
+	chunks := wavMarkerChunks(markers)
+	// RIFF chunks are word aligned
+	if size%2 == 1 {
+		chunks = append([]byte{0}, chunks...)
+	}
+
+	if _, err := file.Write(chunks); err != nil {
+		return err
+	}
+	size += int64(len(chunks))
+
+	if rf64 {
+		riffSize := make([]byte, 8)
+		binary.LittleEndian.PutUint64(riffSize, uint64(size-8))
+		_, err = file.WriteAt(riffSize, 20)
+		return err
+	}
+
+	riffSize := make([]byte, 4)
+	binary.LittleEndian.PutUint32(riffSize, uint32(size-8))
+	_, err = file.WriteAt(riffSize, 4)
+	return err
+}
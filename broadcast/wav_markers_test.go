@@ -0,0 +1,137 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func tempWavFile(dataLength int) (string, error) {
+	file, err := ioutil.TempFile("", "wavmarkers")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("RIFF")
+	binary.Write(buffer, binary.LittleEndian, uint32(4+8+dataLength))
+	buffer.WriteString("WAVE")
+	wavChunk(buffer, "data", make([]byte, dataLength))
+
+	_, err = file.Write(buffer.Bytes())
+	return file.Name(), err
+}
+
+func TestWavMarkerChunks(t *testing.T) {
+	chunks := wavMarkerChunks([]WavMarker{{Position: 44100, Label: "Gap"}})
+
+	if string(chunks[0:4]) != "cue " {
+		t.Errorf("Wrong first chunk :\n got: %v\nwant: %v", string(chunks[0:4]), "cue ")
+	}
+	if cueSize := binary.LittleEndian.Uint32(chunks[4:8]); cueSize != 4+24 {
+		t.Errorf("Wrong cue chunk size :\n got: %v\nwant: %v", cueSize, 4+24)
+	}
+	if position := binary.LittleEndian.Uint32(chunks[8+4+4:]); position != 44100 {
+		t.Errorf("Wrong cue position :\n got: %v\nwant: %v", position, 44100)
+	}
+
+	list := chunks[8+28:]
+	if string(list[0:4]) != "LIST" || string(list[8:12]) != "adtl" || string(list[12:16]) != "labl" {
+		t.Errorf("Wrong LIST chunk :\n got: %q", list[0:16])
+	}
+	// "Gap\0" and the cue identifier, padded to word alignment
+	if labelSize := binary.LittleEndian.Uint32(list[16:20]); labelSize != 8 {
+		t.Errorf("Wrong labl chunk size :\n got: %v\nwant: %v", labelSize, 8)
+	}
+	if len(chunks)%2 != 0 {
+		t.Errorf("Chunks should be word aligned :\n got: %v bytes", len(chunks))
+	}
+}
+
+func TestAppendWavMarkers(t *testing.T) {
+	conditions := []struct {
+		dataLength int
+		padding    int
+	}{
+		{1024, 0},
+		{1023, 1},
+	}
+
+	for _, condition := range conditions {
+		fileName, err := tempWavFile(condition.dataLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(fileName)
+
+		markers := []WavMarker{{Position: 0, Label: "Start"}, {Position: 100, Label: "Device error"}}
+		err = AppendWavMarkers(fileName, markers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, _ := ioutil.ReadFile(fileName)
+
+		if riffSize := binary.LittleEndian.Uint32(content[4:8]); int(riffSize) != len(content)-8 {
+			t.Errorf("Wrong RIFF size :\n got: %v\nwant: %v", riffSize, len(content)-8)
+		}
+
+		cueOffset := 12 + 8 + condition.dataLength + condition.padding
+		if string(content[cueOffset:cueOffset+4]) != "cue " {
+			t.Errorf("Cue chunk should follow data (%d bytes) :\n got: %q", condition.dataLength, content[cueOffset:cueOffset+4])
+		}
+		if !bytes.Equal(content[cueOffset:], wavMarkerChunks(markers)) {
+			t.Errorf("Wrong marker chunks for %d data bytes", condition.dataLength)
+		}
+	}
+}
+
+func TestAppendWavMarkers_rf64(t *testing.T) {
+	file, err := ioutil.TempFile("", "wavmarkers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("RF64")
+	binary.Write(buffer, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buffer.WriteString("WAVE")
+	wavChunk(buffer, "ds64", make([]byte, 28))
+	wavChunk(buffer, "data", make([]byte, 1024))
+	file.Write(buffer.Bytes())
+	file.Close()
+
+	err = AppendWavMarkers(file.Name(), []WavMarker{{Position: 100, Label: "Gap"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(file.Name())
+	if riffSize := binary.LittleEndian.Uint64(content[20:28]); int(riffSize) != len(content)-8 {
+		t.Errorf("Wrong ds64 RIFF size :\n got: %v\nwant: %v", riffSize, len(content)-8)
+	}
+	if riffSize := binary.LittleEndian.Uint32(content[4:8]); riffSize != 0xFFFFFFFF {
+		t.Errorf("RF64 size should not be modified :\n got: %v", riffSize)
+	}
+	if cueOffset := buffer.Len(); string(content[cueOffset:cueOffset+4]) != "cue " {
+		t.Errorf("Cue chunk should follow data :\n got: %q", content[cueOffset:cueOffset+4])
+	}
+}
+
+func TestAppendWavMarkers_notWav(t *testing.T) {
+	file, err := ioutil.TempFile("", "wavmarkers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("fLaC and some other bytes")
+	file.Close()
+
+	if AppendWavMarkers(file.Name(), []WavMarker{{Label: "dummy"}}) == nil {
+		t.Errorf("Should return an error with a non RIFF/WAVE file")
+	}
+}
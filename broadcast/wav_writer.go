@@ -0,0 +1,111 @@
+package broadcast
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// WavWriter writes a 16 bits PCM wav stream. The SampleCount must be known
+// before writing the header, the written stream can't be seeked.
+//
+// When the data can't be described by a RIFF header (4 GB), a RF64 header
+// is written (EBU Tech 3306).
+type WavWriter struct {
+	Writer       io.Writer
+	SampleRate   int
+	ChannelCount int
+	SampleCount  int64
+
+	coder *InterleavedAudioCoder
+}
+
+const (
+	wavHeaderSize  = 44
+	rf64HeaderSize = 80
+)
+
+func (writer *WavWriter) Init() error {
+	writer.coder = &InterleavedAudioCoder{SampleFormat: Sample16bLittleEndian, ChannelCount: writer.ChannelCount}
+	return writer.writeHeader()
+}
+
+func (writer *WavWriter) frameSize() int {
+	return 2 * writer.ChannelCount
+}
+
+func (writer *WavWriter) DataSize() int64 {
+	return writer.SampleCount * int64(writer.frameSize())
+}
+
+// Returns true if the RIFF sizes can't store the data size
+func (writer *WavWriter) IsRF64() bool {
+	return wavHeaderSize-8+writer.DataSize() > math.MaxUint32
+}
+
+// Returns the size of the complete stream (header and data)
+func (writer *WavWriter) Size() int64 {
+	if writer.IsRF64() {
+		return rf64HeaderSize + writer.DataSize()
+	}
+	return wavHeaderSize + writer.DataSize()
+}
+
+func (writer *WavWriter) writeHeader() error {
+	frameSize := writer.frameSize()
+
+	var header []interface{}
+	if writer.IsRF64() {
+		header = []interface{}{
+			[]byte("RF64"),
+			uint32(math.MaxUint32),
+			[]byte("WAVE"),
+			[]byte("ds64"),
+			uint32(28),
+			uint64(writer.Size() - 8),
+			uint64(writer.DataSize()),
+			uint64(writer.SampleCount),
+			uint32(0), // no table
+		}
+	} else {
+		header = []interface{}{
+			[]byte("RIFF"),
+			uint32(writer.Size() - 8),
+			[]byte("WAVE"),
+		}
+	}
+
+	header = append(header,
+		[]byte("fmt "),
+		uint32(16),
+		uint16(1), // PCM
+		uint16(writer.ChannelCount),
+		uint32(writer.SampleRate),
+		uint32(writer.SampleRate*frameSize),
+		uint16(frameSize),
+		uint16(16),
+		[]byte("data"),
+	)
+
+	if writer.IsRF64() {
+		header = append(header, uint32(math.MaxUint32))
+	} else {
+		header = append(header, uint32(writer.DataSize()))
+	}
+
+	for _, value := range header {
+		err := binary.Write(writer.Writer, binary.LittleEndian, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (writer *WavWriter) AudioOut(audio *Audio) {
+	data, _ := writer.coder.Encode(audio)
+	writer.Writer.Write(data)
+}
+
+func (writer *WavWriter) Close() {
+}
@@ -0,0 +1,65 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWavWriter_Init(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := WavWriter{Writer: buffer, SampleRate: 44100, ChannelCount: 2, SampleCount: 1024}
+
+	err := writer.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := buffer.Bytes()
+	if len(header) != 44 {
+		t.Fatalf("Wrong header length :\n got: %v\nwant: %v", len(header), 44)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		t.Errorf("Wrong RIFF/WAVE header : %v", header[0:12])
+	}
+	if dataSize := binary.LittleEndian.Uint32(header[40:44]); dataSize != 1024*4 {
+		t.Errorf("Wrong data size :\n got: %v\nwant: %v", dataSize, 1024*4)
+	}
+
+	writer.AudioOut(NewAudio(1024, 2))
+	if buffer.Len() != 44+1024*4 {
+		t.Errorf("Wrong written length :\n got: %v\nwant: %v", buffer.Len(), 44+1024*4)
+	}
+}
+
+func TestWavWriter_Init_rf64(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	// 24 hours at 48kHz stereo
+	writer := WavWriter{Writer: buffer, SampleRate: 48000, ChannelCount: 2, SampleCount: 24 * 3600 * 48000}
+
+	if !writer.IsRF64() {
+		t.Fatal("Data larger than 4 GB requires RF64")
+	}
+
+	err := writer.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := buffer.Bytes()
+	if int64(len(header)) != writer.Size()-writer.DataSize() {
+		t.Fatalf("Wrong header length :\n got: %v\nwant: %v", len(header), writer.Size()-writer.DataSize())
+	}
+	if string(header[0:4]) != "RF64" || string(header[8:12]) != "WAVE" || string(header[12:16]) != "ds64" {
+		t.Errorf("Wrong RF64/WAVE/ds64 header : %v", header[0:16])
+	}
+	if dataSize := binary.LittleEndian.Uint64(header[28:36]); int64(dataSize) != writer.DataSize() {
+		t.Errorf("Wrong ds64 data size :\n got: %v\nwant: %v", dataSize, writer.DataSize())
+	}
+	if riffSize := binary.LittleEndian.Uint64(header[20:28]); int64(riffSize) != writer.Size()-8 {
+		t.Errorf("Wrong ds64 RIFF size :\n got: %v\nwant: %v", riffSize, writer.Size()-8)
+	}
+	if string(header[72:76]) != "data" || binary.LittleEndian.Uint32(header[76:80]) != 0xFFFFFFFF {
+		t.Errorf("Wrong data chunk header : %v", header[72:80])
+	}
+}
@@ -0,0 +1,194 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// A Webhook POSTs a JSON description of each closed file to URL.
+//
+// Notifications are queued as files in QueueDirectory and kept across
+// restarts until delivered. Failed deliveries are retried with an
+// exponential backoff, at most Concurrency at the same time.
+type Webhook struct {
+	URL            string
+	QueueDirectory string
+
+	Concurrency int
+	// 0 retries forever
+	MaxAttempts int
+
+	Client   *http.Client
+	Metrics  *LocalMetrics
+	EventLog *LocalEventLog
+
+	queue *PersistentQueue
+}
+
+func (webhook *Webhook) metrics() *LocalMetrics {
+	if webhook.Metrics == nil {
+		webhook.Metrics = &LocalMetrics{prefix: "webhook"}
+	}
+	return webhook.Metrics
+}
+
+func (webhook *Webhook) eventLog() *LocalEventLog {
+	if webhook.EventLog == nil {
+		webhook.EventLog = &LocalEventLog{Source: "webhook"}
+	}
+	return webhook.EventLog
+}
+
+func (webhook *Webhook) client() *http.Client {
+	if webhook.Client == nil {
+		webhook.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return webhook.Client
+}
+
+func (webhook *Webhook) IsEnabled() bool {
+	return webhook.URL != ""
+}
+
+func (webhook *Webhook) Init() error {
+	webhook.queue = &PersistentQueue{
+		Directory:   webhook.QueueDirectory,
+		Concurrency: webhook.Concurrency,
+		MaxAttempts: webhook.MaxAttempts,
+		Process:     webhook.deliver,
+		Failed:      webhook.failed,
+	}
+	return webhook.queue.Init()
+}
+
+func (webhook *Webhook) FileClosed(record *ClosedRecord) {
+	err := webhook.Enqueue(record)
+	if err != nil {
+		Log.Printf("Can't queue webhook for %s : %v", record.Path, err)
+	}
+}
+
+// Saves the notification in the queue directory
+func (webhook *Webhook) Enqueue(record *ClosedRecord) error {
+	return webhook.queue.Push(record)
+}
+
+// Returns the queued notification files, oldest first
+func (webhook *Webhook) QueuedFiles() ([]string, error) {
+	return webhook.queue.Files()
+}
+
+func (webhook *Webhook) deliver(file string) error {
+	err := webhook.Post(file)
+	if err != nil {
+		webhook.metrics().Counter("Retries").Inc(1)
+		return err
+	}
+
+	Log.Debugf("Webhook delivered (%s)", file)
+	webhook.metrics().Counter("Delivered").Inc(1)
+	return nil
+}
+
+func (webhook *Webhook) failed(file string, attempts int, err error) {
+	webhook.eventLog().NewEvent(fmt.Sprintf("Webhook failed after %d attempts : %v", attempts, err))
+	webhook.metrics().Counter("Failed").Inc(1)
+}
+
+// Sends the notification saved in the given file
+func (webhook *Webhook) Post(file string) error {
+	var record ClosedRecord
+	err := webhook.queue.Load(file, &record)
+	if err != nil {
+		return err
+	}
+
+	// The checksum is computed outside the audio goroutine, once : it's
+	// saved in the queued notification for the next attempts
+	if record.Checksum == "" {
+		record.Checksum, err = FileChecksum(record.Path)
+		if err != nil {
+			return fmt.Errorf("Can't compute checksum of %s : %v", record.Path, err)
+		}
+		err = webhook.queue.Save(file, &record)
+		if err != nil {
+			return err
+		}
+	}
+
+	jsonBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	response, err := webhook.client().Post(webhook.URL, "application/json", bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected status '%s'", response.Status)
+	}
+	return nil
+}
+
+// Sends the ready notifications, then stops
+func (webhook *Webhook) Stop() error {
+	if webhook.queue == nil {
+		return nil
+	}
+	return webhook.queue.Stop()
+}
+
+func (webhook *Webhook) Run() {
+	webhook.queue.Run(func(count int) {
+		webhook.metrics().Gauge("Queue").Update(int64(count))
+	})
+}
+
+type WebhookConfig struct {
+	URL            string
+	QueueDirectory string
+	Concurrency    int
+	MaxAttempts    int
+}
+
+func (config *WebhookConfig) Flags(flags *flag.FlagSet, prefix string) {
+	flags.StringVar(&config.URL, strings.Join([]string{prefix, "url"}, "-"), "", "The URL notified when each file is closed")
+	flags.StringVar(&config.QueueDirectory, strings.Join([]string{prefix, "queue"}, "-"), "", "The directory used to queue notifications (default .webhook in files root)")
+	flags.IntVar(&config.Concurrency, strings.Join([]string{prefix, "concurrency"}, "-"), 2, "The maximum count of simultaneous notifications")
+	flags.IntVar(&config.MaxAttempts, strings.Join([]string{prefix, "max-attempts"}, "-"), 0, "The maximum attempts for each notification (0 to retry forever)")
+}
+
+func (config *WebhookConfig) Apply(webhook *Webhook, rootDirectory string) {
+	webhook.URL = config.URL
+	webhook.QueueDirectory = config.QueueDirectory
+	if webhook.QueueDirectory == "" {
+		webhook.QueueDirectory = path.Join(rootDirectory, ".webhook")
+	}
+	webhook.Concurrency = config.Concurrency
+	webhook.MaxAttempts = config.MaxAttempts
+}
+
+func (config *WebhookConfig) Validate(errors *ConfigErrors) {
+	if config.URL == "" {
+		return
+	}
+	if webhookURL, err := url.Parse(config.URL); err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") {
+		errors.Add("URL", "invalid http URL '%s'", config.URL)
+	}
+	if config.Concurrency <= 0 {
+		errors.Add("Concurrency", "must be positive")
+	}
+	if config.MaxAttempts < 0 {
+		errors.Add("MaxAttempts", "can't be negative")
+	}
+}
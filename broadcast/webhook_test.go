@@ -0,0 +1,186 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testWebhook(t *testing.T, url string) *Webhook {
+	tempDir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := &Webhook{
+		URL:            url,
+		QueueDirectory: tempDir,
+		EventLog:       &LocalEventLog{Parent: NewMemoryEventLog(10), Source: "webhook"},
+	}
+	if err := webhook.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+func TestWebhook_Enqueue(t *testing.T) {
+	webhook := testWebhook(t, "http://localhost/")
+	defer os.RemoveAll(webhook.QueueDirectory)
+
+	record := &ClosedRecord{Path: "/srv/pige/2015/05-May/20-Wed/14h00.wav", SampleCount: 44100}
+	webhook.Enqueue(record)
+	webhook.Enqueue(record)
+
+	files, err := webhook.QueuedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Wrong queued file count :\n got: %v\nwant: %v", len(files), 2)
+	}
+
+	var queuedRecord ClosedRecord
+	jsonBytes, _ := ioutil.ReadFile(files[0])
+	json.Unmarshal(jsonBytes, &queuedRecord)
+
+	if queuedRecord != *record {
+		t.Errorf("Wrong queued record :\n got: %v\nwant: %v", queuedRecord, *record)
+	}
+}
+
+func TestWebhook_Dispatch(t *testing.T) {
+	file, err := ioutil.TempFile("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("go-broadcast")
+	file.Close()
+
+	var records []ClosedRecord
+	var mutex sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var record ClosedRecord
+		json.NewDecoder(request.Body).Decode(&record)
+
+		mutex.Lock()
+		records = append(records, record)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	webhook := testWebhook(t, server.URL)
+	defer os.RemoveAll(webhook.QueueDirectory)
+
+	webhook.Enqueue(&ClosedRecord{Path: file.Name()})
+	dispatchQueue(webhook.queue, time.Now())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(records) != 1 {
+		t.Fatalf("Wrong notification count :\n got: %v\nwant: %v", len(records), 1)
+	}
+	if records[0].Checksum != "150b58fa7661ddfa2cf6b3ef13afbcf196ea008f4f3f9b9a1221e089d5248eea" {
+		t.Errorf("Notification should contain the file checksum :\n got: %v", records[0].Checksum)
+	}
+
+	if files, _ := webhook.QueuedFiles(); len(files) != 0 {
+		t.Errorf("Delivered notifications should be removed from queue :\n got: %v", files)
+	}
+}
+
+func testWebhookRecordFile(t *testing.T) string {
+	file, err := ioutil.TempFile("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("go-broadcast")
+	file.Close()
+	return file.Name()
+}
+
+func TestWebhook_Dispatch_maxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		http.Error(response, "Bad request", 400)
+	}))
+	defer server.Close()
+
+	webhook := testWebhook(t, server.URL)
+	defer os.RemoveAll(webhook.QueueDirectory)
+
+	webhook.MaxAttempts = 1
+	webhook.Init()
+
+	recordFile := testWebhookRecordFile(t)
+	defer os.Remove(recordFile)
+
+	webhook.Enqueue(&ClosedRecord{Path: recordFile})
+	dispatchQueue(webhook.queue, time.Now())
+
+	if files, _ := webhook.QueuedFiles(); len(files) != 0 {
+		t.Errorf("Notification should be removed from queue after MaxAttempts :\n got: %v", files)
+	}
+
+	events := webhook.eventLog().Events()
+	if len(events) != 1 || events[0].Message != "Webhook failed after 1 attempts : Unexpected status '400 Bad Request'" {
+		t.Errorf("Wrong webhook events :\n got: %v", events)
+	}
+}
+
+func TestWebhook_Post_checksum(t *testing.T) {
+	var posted int
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		posted++
+		http.Error(response, "Service unavailable", 503)
+	}))
+	defer server.Close()
+
+	webhook := testWebhook(t, server.URL)
+	defer os.RemoveAll(webhook.QueueDirectory)
+
+	webhook.Enqueue(&ClosedRecord{Path: "/dummy/file.wav"})
+	files, _ := webhook.QueuedFiles()
+
+	if err := webhook.Post(files[0]); err == nil || posted != 0 {
+		t.Errorf("Notification without checksum should not be posted :\n got: %v (%d posts)", err, posted)
+	}
+
+	recordFile := testWebhookRecordFile(t)
+	defer os.Remove(recordFile)
+
+	webhook.queue.Save(files[0], &ClosedRecord{Path: recordFile})
+	webhook.Post(files[0])
+
+	var queuedRecord ClosedRecord
+	webhook.queue.Load(files[0], &queuedRecord)
+	if queuedRecord.Checksum != "150b58fa7661ddfa2cf6b3ef13afbcf196ea008f4f3f9b9a1221e089d5248eea" {
+		t.Errorf("Checksum should be saved in queued notification for retries :\n got: %v", queuedRecord.Checksum)
+	}
+}
+
+func TestWebhookConfig_Apply(t *testing.T) {
+	config := WebhookConfig{URL: "http://localhost/records", Concurrency: 4, MaxAttempts: 10}
+	webhook := &Webhook{}
+
+	config.Apply(webhook, "/srv/pige")
+
+	if webhook.URL != config.URL {
+		t.Errorf("Wrong URL :\n got: %v\nwant: %v", webhook.URL, config.URL)
+	}
+	if webhook.QueueDirectory != "/srv/pige/.webhook" {
+		t.Errorf("Wrong default QueueDirectory :\n got: %v\nwant: %v", webhook.QueueDirectory, "/srv/pige/.webhook")
+	}
+	if webhook.Concurrency != 4 || webhook.MaxAttempts != 10 {
+		t.Errorf("Wrong limits :\n got: %v/%v\nwant: %v/%v", webhook.Concurrency, webhook.MaxAttempts, 4, 10)
+	}
+	if !webhook.IsEnabled() {
+		t.Errorf("Webhook should be enabled")
+	}
+}
@@ -1,21 +1,19 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/signal"
-	"runtime/pprof"
+	"strings"
 	"time"
 
 	"projects.tryphon.eu/go-broadcast/broadcast"
 	"projects.tryphon.eu/go-broadcast/broadcast/command"
 
-	"code.google.com/p/go.net/websocket"
 	metrics "github.com/tryphon/go-metrics"
-	"net/http"
 )
 
 func main() {
@@ -41,8 +39,14 @@ func main() {
 		backup(os.Args[2:])
 	case "loopback":
 		loopback(os.Args[2:])
+	case "verify":
+		verify(os.Args[2:])
+	case "password":
+		password(os.Args[2:])
+	case "token":
+		token(os.Args[2:])
 	default:
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] httpclient|httpSource|backup|udpclient|udpserver|looppback\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] httpclient|httpSource|backup|verify|udpclient|udpserver|looppback|password|token\n", os.Args[0])
 		os.Exit(1)
 	}
 }
@@ -60,6 +64,9 @@ func backup(arguments []string) {
 
 	flags.Parse(arguments)
 
+	err := broadcast.LoadConfig(config.File, &config)
+	checkError(err)
+
 	if config.Files.Root == "" {
 		flag.Usage()
 		os.Exit(1)
@@ -70,6 +77,10 @@ func backup(arguments []string) {
 	alsaInput := &broadcast.AlsaInput{}
 
 	timedFileOutput := &broadcast.TimedFileOutput{}
+	retention := &broadcast.RecordRetention{}
+	webhook := &broadcast.Webhook{}
+	uploader := &broadcast.Uploader{}
+	signer := &broadcast.RecordSigner{}
 
 	channel := make(chan *broadcast.Audio, 100)
 	audioHandler := broadcast.AudioHandlerFunc(func(audio *broadcast.Audio) {
@@ -80,22 +91,188 @@ func backup(arguments []string) {
 		Output: audioHandler,
 	}
 	alsaInput.SetAudioHandler(soundMeterAudioHandler)
+	alsaInput.ErrorHandler = func(err error) {
+		timedFileOutput.Mark(time.Now().UTC(), fmt.Sprintf("Device error: %v", err))
+	}
 
 	httpServer := &broadcast.HttpServer{SoundMeterAudioHandler: soundMeterAudioHandler}
 
-	config.Apply(alsaInput, timedFileOutput, httpServer)
+	supervisor := &broadcast.Supervisor{}
+	httpServer.Register("/status.json", broadcast.NewStatusController(supervisor))
+
+	err = config.Apply(alsaInput, timedFileOutput, retention, webhook, uploader, signer, httpServer)
+	checkError(err)
+
+	recordHandler, err := config.Record.Handler(timedFileOutput)
+	checkError(err)
+
+	// The encoded recordings use the format of the TimedFileOutput
+	recordArchive := &broadcast.RecordArchive{
+		RootDirectory: config.Files.Root,
+		SampleRate:    alsaInput.SampleRate,
+		ChannelCount:  alsaInput.ChannelCount(),
+	}
+	recordArchiveController := broadcast.NewRecordArchiveController(recordArchive)
+	httpServer.Register("/records.json", recordArchiveController)
+	httpServer.Register("/records/", recordArchiveController)
 
-	err := alsaInput.Init()
+	err = alsaInput.Init()
 	checkError(err)
 
 	err = httpServer.Init()
 	checkError(err)
 
-	go alsaInput.Run()
+	if retention.IsEnabled() {
+		go retention.Run()
+	}
+
+	if webhook.IsEnabled() {
+		err = webhook.Init()
+		checkError(err)
+	}
+
+	if uploader.IsEnabled() {
+		err = uploader.Init()
+		checkError(err)
+
+		httpServer.Register("/uploads.json", broadcast.NewUploaderController(uploader))
+	}
+
+	// Repaired files are signed, notified and uploaded like closed files
+	repair := &broadcast.RecordRepair{
+		RootDirectory: config.Files.Root,
+		FileHandlers:  timedFileOutput.FileHandlers,
+	}
+	if repairedCount, err := repair.Run(); err != nil {
+		broadcast.Log.Printf("Can't repair files : %v", err)
+	} else if repairedCount > 0 {
+		broadcast.Log.Printf("Repaired %d unterminated file(s)", repairedCount)
+	}
+
+	// The signer finds the other unsigned files once the files are repaired
+	if signer.IsEnabled() {
+		err = signer.Init()
+		checkError(err)
+
+		go signer.Run()
+	}
+	if webhook.IsEnabled() {
+		go webhook.Run()
+	}
+	if uploader.IsEnabled() {
+		go uploader.Run()
+	}
+
+	// Record changes are applied between two audio buffers
+	recordHandlers := make(chan broadcast.AudioHandler, 1)
 
-	for {
-		audio := <-channel
-		timedFileOutput.AudioOut(audio)
+	reloader := &broadcast.ConfigReloader{File: config.File, Config: &config}
+	config.BaseHandle(reloader)
+	reloader.Handle("Record", func() error {
+		handler, err := config.Record.Handler(timedFileOutput)
+		if err != nil {
+			return err
+		}
+		// Replace the handler which isn't used yet (several quick reloads)
+		select {
+		case <-recordHandlers:
+		default:
+		}
+		recordHandlers <- handler
+		return nil
+	})
+	retentionRunning := retention.IsEnabled()
+	reloader.Handle("Retention", func() error {
+		config.Retention.Apply(retention, config.Files.Root)
+		if retention.IsEnabled() && !retentionRunning {
+			retentionRunning = true
+			go retention.Run()
+		}
+		return nil
+	})
+	if config.File != "" {
+		go reloader.Run()
+	}
+
+	supervisor.Start("alsa-input", alsaInput)
+
+	recordStopped := make(chan bool)
+	go func() {
+		for {
+			select {
+			case audio, ok := <-channel:
+				if !ok {
+					close(recordStopped)
+					return
+				}
+				recordHandler.AudioOut(audio)
+			case recordHandler = <-recordHandlers:
+				timedFileOutput.Stop()
+			}
+		}
+	}()
+
+	shutdown := &broadcast.Shutdown{}
+	config.Shutdown.Apply(shutdown)
+	shutdown.Add("alsa input", func() error {
+		err := supervisor.Stop("alsa-input")
+		close(channel)
+		return err
+	})
+	// The buffered audio is recorded before closing the current file
+	shutdown.Add("record", func() error {
+		<-recordStopped
+		return timedFileOutput.Stop()
+	})
+	// The closed files are kept until they're signed, notified and uploaded
+	shutdown.Add("retention", retention.Stop)
+	if signer.IsEnabled() {
+		shutdown.Add("signer", signer.Stop)
+	}
+	if webhook.IsEnabled() {
+		shutdown.Add("webhook", webhook.Stop)
+	}
+	if uploader.IsEnabled() {
+		shutdown.Add("uploader", uploader.Stop)
+	}
+	shutdown.Add("profilers", broadcast.StopProfilers)
+
+	checkError(shutdown.Wait())
+}
+
+func verify(arguments []string) {
+	var rootDirectory, keyFile string
+
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.StringVar(&rootDirectory, "files-root", "", "The root directory of recorded files")
+	flags.StringVar(&keyFile, "manifest-key", "", "The key (PEM, public or private) used to sign daily manifests")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify [options]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(arguments)
+
+	if rootDirectory == "" || keyFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	publicKey, err := broadcast.LoadManifestPublicKey(keyFile)
+	checkError(err)
+
+	verifier := &broadcast.RecordVerifier{RootDirectory: rootDirectory, PublicKey: publicKey}
+	verification, err := verifier.Verify()
+	checkError(err)
+
+	for _, problem := range verification.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("%d manifest(s), %d file(s) verified, %d expired, %d problem(s)\n", verification.ManifestCount, verification.FileCount, verification.ExpiredCount, len(verification.Problems))
+
+	if !verification.IsValid() {
+		os.Exit(1)
 	}
 }
 
@@ -112,6 +289,9 @@ func udpClient(arguments []string) {
 
 	flags.Parse(arguments)
 
+	err := broadcast.LoadConfig(config.File, &config)
+	checkError(err)
+
 	if config.Udp.Target == "" {
 		flag.Usage()
 		os.Exit(1)
@@ -126,13 +306,23 @@ func udpClient(arguments []string) {
 	soundMeterAudioHandler := &broadcast.SoundMeterAudioHandler{
 		Output: udpOutput,
 	}
-	alsaInput.SetAudioHandler(soundMeterAudioHandler)
+	toneInjector := &broadcast.ToneInjector{
+		Output: soundMeterAudioHandler,
+	}
 
 	httpServer := &broadcast.HttpServer{SoundMeterAudioHandler: soundMeterAudioHandler}
+	httpServer.Register("/tone.json", broadcast.NewToneInjectorController(toneInjector))
+
+	supervisor := &broadcast.Supervisor{}
+	httpServer.Register("/status.json", broadcast.NewStatusController(supervisor))
 
 	config.Apply(alsaInput, udpOutput, httpServer)
+	toneInjector.SampleRate = alsaInput.SampleRate
+
+	inputName, input := config.Generator.Input(alsaInput)
+	input.SetAudioHandler(toneInjector)
 
-	err := alsaInput.Init()
+	err = input.Init()
 	checkError(err)
 
 	err = udpOutput.Init()
@@ -141,11 +331,22 @@ func udpClient(arguments []string) {
 	err = httpServer.Init()
 	checkError(err)
 
-	go alsaInput.Run()
-
-	for {
-		time.Sleep(2 * time.Second)
+	reloader := &broadcast.ConfigReloader{File: config.File, Config: &config}
+	config.BaseHandle(reloader)
+	if config.File != "" {
+		go reloader.Run()
 	}
+
+	supervisor.Start(inputName, input)
+
+	shutdown := &broadcast.Shutdown{}
+	config.Shutdown.Apply(shutdown)
+	shutdown.Add("input", func() error {
+		return supervisor.Stop(inputName)
+	})
+	shutdown.Add("profilers", broadcast.StopProfilers)
+
+	checkError(shutdown.Wait())
 }
 
 func udpServer(arguments []string) {
@@ -161,6 +362,9 @@ func udpServer(arguments []string) {
 
 	flags.Parse(arguments)
 
+	err := broadcast.LoadConfig(config.File, &config)
+	checkError(err)
+
 	config.Alsa.SampleRate = 48000
 	broadcast.Log.Printf("Config: %v", config)
 
@@ -172,9 +376,12 @@ func udpServer(arguments []string) {
 	}
 	httpServer := &broadcast.HttpServer{SoundMeterAudioHandler: soundMeterAudioHandler}
 
+	supervisor := &broadcast.Supervisor{}
+	httpServer.Register("/status.json", broadcast.NewStatusController(supervisor))
+
 	config.Apply(alsaOutput, udpInput, httpServer)
 
-	err := alsaOutput.Init()
+	err = alsaOutput.Init()
 	checkError(err)
 
 	err = udpInput.Init()
@@ -183,69 +390,61 @@ func udpServer(arguments []string) {
 	err = httpServer.Init()
 	checkError(err)
 
+	reloader := &broadcast.ConfigReloader{File: config.File, Config: &config}
+	config.BaseHandle(reloader)
+	if config.File != "" {
+		go reloader.Run()
+	}
+
 	channel := make(chan *broadcast.Audio, 100)
 	audioHandler := broadcast.AudioHandlerFunc(func(audio *broadcast.Audio) {
 		channel <- audio
 	})
 	udpInput.SetAudioHandler(audioHandler)
 
-	go udpInput.Run()
-
-	for {
-		select {
-		case audio := <-channel:
-			soundMeterAudioHandler.AudioOut(audio)
-		default:
-			soundMeterAudioHandler.AudioOut(broadcast.NewAudio(1024, 2))
+	supervisor.Start("udp-input", udpInput)
+
+	stopOutput := make(chan bool)
+	outputStopped := make(chan bool)
+	go func() {
+		for {
+			select {
+			case audio := <-channel:
+				soundMeterAudioHandler.AudioOut(audio)
+			case <-stopOutput:
+				close(outputStopped)
+				return
+			default:
+				soundMeterAudioHandler.AudioOut(broadcast.NewAudio(1024, 2))
+			}
 		}
-	}
+	}()
+
+	shutdown := &broadcast.Shutdown{}
+	config.Shutdown.Apply(shutdown)
+	shutdown.Add("udp input", func() error {
+		return supervisor.Stop("udp-input")
+	})
+	shutdown.Add("alsa output", func() error {
+		close(stopOutput)
+		<-outputStopped
+		return nil
+	})
+	shutdown.Add("profilers", broadcast.StopProfilers)
+
+	checkError(shutdown.Wait())
 }
 
 func httpClient(arguments []string) {
-	var sampleRate int = 44100
+	config := broadcast.HttpClientConfig{}
 
 	flags := flag.NewFlagSet("httpclient", flag.ExitOnError)
-
-	var lowAdjustLimit, lowAdjustThreshold, lowRefillMin, highAdjustLimit, highAdjustThreshold, highUnfillMax, highUnfill float64
-	var statusLoop, httpReadTimeout, httpWaitOnError time.Duration
-	var httpUsername, httpPassword string
-	var alsaDevice /*, alsaSampleFormat */ string
-	var alsaChannels int
-
-	flags.Float64Var(&lowAdjustLimit, "low-adjust-limit", 0, "Limit of low adjust buffer (in seconds)")
-	flags.Float64Var(&lowAdjustThreshold, "low-adjust-threshold", 3, "Limit of low adjust buffer (in seconds)")
-	flags.Float64Var(&lowRefillMin, "low-refill", 3, "Duration to refill when buffer is empty (in seconds)")
-
-	flags.Float64Var(&highAdjustThreshold, "high-adjust-threshold", 7, "Limit of high adjust buffer (in seconds)")
-	flags.Float64Var(&highAdjustLimit, "high-adjust-limit", 10, "Limit of high adjust buffer (in seconds)")
-	flags.Float64Var(&highUnfillMax, "high-max", 10, "Max duration of buffer (in seconds)")
-	flags.Float64Var(&highUnfill, "high-unfill", 3, "Duration to unfill when buffer is full (in seconds)")
-
-	flags.DurationVar(&statusLoop, "status-loop", 0, "Duration between two status dump (0 to disable)")
-
-	flags.DurationVar(&httpReadTimeout, "http-read-timeout", 10*time.Second, "Read timeout before creating a new http connection")
-	flags.DurationVar(&httpWaitOnError, "http-wait-on-error", 5*time.Second, "Delay after http error")
-
-	flags.StringVar(&httpUsername, "http-username", "", "Username used for http authentification")
-	flags.StringVar(&httpPassword, "http-password", "", "Password used for http authentification")
-
-	flags.StringVar(&alsaDevice, "alsa-device", "default", "The alsa device used to play sound")
-	flags.IntVar(&alsaChannels, "alsa-channels", 2, "The channel count used with alsa device")
-	// flags.StringVar(&alsaSampleFormat, "alsa-sample-format", "auto", "The sample format used to record sound (s16le, s32le, s32be)")
-
-	var fixedRateTolerance float64
-	flags.Float64Var(&fixedRateTolerance, "sample-rate-tolerance", 1, "Tolerance on sample format (0 is no tolerance, 1 is no fixed sample format)")
+	config.Flags(flags)
 
 	var cpuProfile, memProfile string
 	flags.StringVar(&cpuProfile, "cpuprofile", "", "Write cpu profile to file")
 	flags.StringVar(&memProfile, "memprofile", "", "Write memory profile to this file")
 
-	flags.BoolVar(&broadcast.Log.Debug, "debug", false, "Enable debug messages")
-	flags.BoolVar(&broadcast.Log.Syslog, "syslog", false, "Redirect messages to syslog")
-
-	var httpServer string
-	flags.StringVar(&httpServer, "http-server", "", "Http server binding")
-
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] httpclient <url>\n", os.Args[0])
 		flags.PrintDefaults()
@@ -253,79 +452,63 @@ func httpClient(arguments []string) {
 
 	flags.Parse(arguments)
 
-	if flags.NArg() != 1 {
+	if flags.NArg() > 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
-
-	if cpuProfile != "" {
-		f, err := os.Create(cpuProfile)
-		if err != nil {
-			log.Fatal(err)
-		}
-		pprof.StartCPUProfile(f)
-		defer pprof.StopCPUProfile()
-
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		go func() {
-			for sig := range c {
-				broadcast.Log.Debugf("Receive interrupt signal: %v", sig)
-				pprof.StopCPUProfile()
-				os.Exit(0)
-			}
-		}()
+	if flags.NArg() == 1 {
+		config.Input.Url = flags.Arg(0)
 	}
 
-	if memProfile != "" {
-		f, err := os.Create(memProfile)
-		if err != nil {
-			log.Fatal(err)
-		}
+	err := broadcast.LoadConfig(config.File, &config)
+	checkError(err)
 
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		go func() {
-			for sig := range c {
-				broadcast.Log.Debugf("Receive interrupt signal: %v", sig)
-				pprof.WriteHeapProfile(f)
-				f.Close()
-				os.Exit(0)
-			}
-		}()
+	if config.Input.Url == "" {
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	httpInput := broadcast.HttpInput{Url: flags.Arg(0), ReadTimeout: httpReadTimeout, WaitOnError: httpWaitOnError, Username: httpUsername, Password: httpPassword}
-	err := httpInput.Init()
+	config.Log.Apply()
+	sampleRate := config.Alsa.SampleRate
+
+	profilerConfig := broadcast.ProfilerConfig{CPU: cpuProfile, Memory: memProfile}
+	profilerConfig.Apply()
+
+	supervisor := &broadcast.Supervisor{}
+
+	httpInput := broadcast.HttpInput{}
+	config.Input.Apply(&httpInput)
+	err = httpInput.Init()
 	checkError(err)
 
-	alsaOutput := broadcast.AlsaOutput{Device: alsaDevice, SampleRate: sampleRate, Channels: alsaChannels}
+	alsaOutput := broadcast.AlsaOutput{}
+	config.Alsa.Apply(&alsaOutput)
 	var outputHandler broadcast.AudioHandler = &alsaOutput
 
 	soundMeterAudioHandler := &broadcast.SoundMeterAudioHandler{Output: outputHandler}
 	outputHandler = soundMeterAudioHandler
 
-	if fixedRateTolerance > 0 && fixedRateTolerance < 1 {
+	if config.SampleRateTolerance > 0 && config.SampleRateTolerance < 1 {
 		fixedRateOutput := broadcast.FixedRateAudioHandler{
 			Output:     &alsaOutput,
 			SampleRate: uint(sampleRate),
-			Tolerance:  fixedRateTolerance,
+			Tolerance:  config.SampleRateTolerance,
 		}
 
-		broadcast.Log.Debugf("Fixed Rate Output with %d%% tolerance", int(fixedRateTolerance*100))
+		broadcast.Log.Debugf("Fixed Rate Output with %d%% tolerance", int(config.SampleRateTolerance*100))
 		outputHandler = &fixedRateOutput
 	}
 
 	err = alsaOutput.Init()
 	checkError(err)
 
-	lowAdjustLimitSampleCount := uint32(lowAdjustLimit * float64(sampleRate))
-	lowAdjustThresholdSampleCount := uint32(lowAdjustThreshold * float64(sampleRate))
-	lowRefillMinSampleCount := uint32(lowRefillMin * float64(sampleRate))
-	highAdjustLimitSampleCount := uint32(highAdjustLimit * float64(sampleRate))
-	highAdjustThresholdSampleCount := uint32(highAdjustThreshold * float64(sampleRate))
-	highUnfillMaxSampleCount := uint32(highUnfillMax * float64(sampleRate))
-	highUnfillSampleCount := uint32(highUnfill * float64(sampleRate))
+	lowAdjustLimitSampleCount := uint32(config.Buffer.LowAdjustLimit * float64(sampleRate))
+	lowAdjustThresholdSampleCount := uint32(config.Buffer.LowAdjustThreshold * float64(sampleRate))
+	lowRefillMinSampleCount := uint32(config.Buffer.LowRefill * float64(sampleRate))
+	highAdjustLimitSampleCount := uint32(config.Buffer.HighAdjustLimit * float64(sampleRate))
+	highAdjustThresholdSampleCount := uint32(config.Buffer.HighAdjustThreshold * float64(sampleRate))
+	highUnfillMaxSampleCount := uint32(config.Buffer.HighMax * float64(sampleRate))
+	highUnfillSampleCount := uint32(config.Buffer.HighUnfill * float64(sampleRate))
 
 	lowAdjustBuffer := &broadcast.AdjustAudioBuffer{
 		Buffer:               &broadcast.MemoryAudioBuffer{},
@@ -360,101 +543,77 @@ func httpClient(arguments []string) {
 		},
 	)
 
-	if httpServer != "" {
-		metricsJSON := func(response http.ResponseWriter, request *http.Request) {
-			response.Header().Set("Content-Type", "application/json")
-			response.Header().Set("Access-Control-Allow-Origin", "*")
-
-			jsonBytes, _ := json.Marshal(metrics.DefaultRegistry)
-			response.Write(jsonBytes)
-		}
-		http.HandleFunc("/metrics", metricsJSON)
-
-		soundMeterJSON := func(response http.ResponseWriter, request *http.Request) {
-			response.Header().Set("Content-Type", "application/json")
-			response.Header().Set("Access-Control-Allow-Origin", "*")
-
-			jsonBytes, _ := json.Marshal(soundMeterAudioHandler)
-			response.Write(jsonBytes)
-		}
-		http.HandleFunc("/soundmeter.json", soundMeterJSON)
-
-		soundMeterWebSocket := func(webSocket *websocket.Conn) {
-			broadcast.Log.Debugf("New SoundMeter websocket connection")
-
-			receiver := soundMeterAudioHandler.NewReceiver()
-			defer receiver.Close()
-
-			go func() {
-				for metrics := range receiver.Channel {
-					jsonBytes, _ := json.Marshal(metrics)
-					err := websocket.Message.Send(webSocket, string(jsonBytes))
-					if err != nil {
-						broadcast.Log.Debugf("Can't send websocket message: %v", err)
-						break
-					}
-				}
-			}()
-
-			for {
-				var message string
-				err := websocket.Message.Receive(webSocket, &message)
-				if err != nil {
-					break
-				}
-			}
+	// The HTTP server applies the authentication and TLS configs
+	httpServer := &broadcast.HttpServer{SoundMeterAudioHandler: soundMeterAudioHandler}
+	config.HttpServer.Apply(httpServer)
+	httpServer.Register("/status.json", broadcast.NewStatusController(supervisor))
 
-			broadcast.Log.Debugf("Close SoundMeter websocket connection")
-		}
-		http.Handle("/soundmeter.ws", websocket.Handler(soundMeterWebSocket))
+	err = httpServer.Init()
+	checkError(err)
 
-		go http.ListenAndServe(httpServer, nil)
+	if config.StatusLoop > 0 {
+		go metrics.Log(metrics.DefaultRegistry, config.StatusLoop, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
 	}
 
-	if statusLoop > 0 {
-		go metrics.Log(metrics.DefaultRegistry, statusLoop, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
+	reloader := &broadcast.ConfigReloader{File: config.File, Config: &config}
+	reloader.Handle("Log", func() error {
+		config.Log.Apply()
+		return nil
+	})
+	if config.File != "" {
+		go reloader.Run()
 	}
 
-	go httpInput.Run()
+	supervisor.Start("http-input", &httpInput)
 
-	var blankDuration uint32
+	stopOutput := make(chan bool)
+	outputStopped := make(chan bool)
+	go func() {
+		defer close(outputStopped)
 
-	for {
-		audio := audioBuffer.Read()
-		if audio == nil {
-			audio = broadcast.NewAudio(1024, alsaChannels)
-			blankDuration += uint32(audio.SampleCount())
-		} else {
-			if blankDuration > 0 {
-				broadcast.Log.Printf("Blank duration : %d samples", blankDuration)
-				blankDuration = 0
+		var blankDuration uint32
+		for {
+			select {
+			case <-stopOutput:
+				return
+			default:
 			}
-		}
-
-		outputHandler.AudioOut(audio)
-	}
-}
-
-func loopback(arguments []string) {
-	flags := flag.NewFlagSet("httpclient", flag.ExitOnError)
 
-	var bufferDuration time.Duration
-	var inputDevice, outputDevice string
-	var inputSampleFormat, outputSampleFormat string
-	var sampleRate int
+			audio := audioBuffer.Read()
+			if audio == nil {
+				audio = broadcast.NewAudio(1024, config.Alsa.ChannelCount)
+				blankDuration += uint32(audio.SampleCount())
+			} else {
+				if blankDuration > 0 {
+					broadcast.Log.Printf("Blank duration : %d samples", blankDuration)
+					blankDuration = 0
+				}
+			}
 
-	flags.BoolVar(&broadcast.Log.Debug, "debug", false, "Enable debug messages")
-	flags.BoolVar(&broadcast.Log.Syslog, "syslog", false, "Redirect messages to syslog")
+			outputHandler.AudioOut(audio)
+		}
+	}()
 
-	flags.StringVar(&inputDevice, "input-device", "default", "The alsa device used to capture sound")
-	flags.StringVar(&inputSampleFormat, "input-sample-format", "auto", "The sample format used to capture sound (s16le, s32le, s32be)")
+	shutdown := &broadcast.Shutdown{}
+	config.Shutdown.Apply(shutdown)
+	shutdown.Add("http input", func() error {
+		return supervisor.Stop("http-input")
+	})
+	shutdown.Add("alsa output", func() error {
+		close(stopOutput)
+		<-outputStopped
+		return nil
+	})
+	shutdown.Add("profilers", broadcast.StopProfilers)
 
-	flags.StringVar(&outputDevice, "output-device", "default", "The alsa device used to play sound")
-	flags.StringVar(&outputSampleFormat, "output-sample-format", "auto", "The sample format used to play sound (s16le, s32le, s32be)")
+	checkError(shutdown.Wait())
+}
 
-	flags.DurationVar(&bufferDuration, "buffer-duration", 250*time.Millisecond, "Buffer duration")
+func loopback(arguments []string) {
+	config := broadcast.LoopbackConfig{}
 
-	flags.IntVar(&sampleRate, "sample-rate", 44100, "Sample rate")
+	flags := flag.NewFlagSet("loopback", flag.ExitOnError)
+	config.Flags(flags)
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] loopback\n", os.Args[0])
@@ -463,31 +622,110 @@ func loopback(arguments []string) {
 
 	flags.Parse(arguments)
 
-	bufferSampleCount := int(float64(sampleRate) * bufferDuration.Seconds())
+	err := broadcast.LoadConfig(config.File, &config)
+	checkError(err)
+
+	config.Log.Apply()
+
+	bufferDuration := config.BufferDuration
+	bufferSampleCount := int(float64(config.SampleRate) * bufferDuration.Seconds())
 	broadcast.Log.Debugf("Alsa bufferSampleCount: %d", bufferSampleCount)
 
-	alsaInput := broadcast.AlsaInput{Device: inputDevice, SampleRate: sampleRate, BufferSampleCount: bufferSampleCount, SampleFormat: broadcast.ParseSampleFormat(inputSampleFormat)}
-	err := alsaInput.Init()
+	alsaInput := broadcast.AlsaInput{Device: config.Input.Device, SampleRate: config.SampleRate, BufferSampleCount: bufferSampleCount, SampleFormat: broadcast.ParseSampleFormat(config.Input.SampleFormat)}
+	err = alsaInput.Init()
 	checkError(err)
 
-	alsaOutput := broadcast.AlsaOutput{Device: outputDevice, SampleRate: sampleRate, SampleFormat: broadcast.ParseSampleFormat(outputSampleFormat)}
+	alsaOutput := broadcast.AlsaOutput{Device: config.Output.Device, SampleRate: config.SampleRate, SampleFormat: broadcast.ParseSampleFormat(config.Output.SampleFormat)}
 	err = alsaOutput.Init()
 	checkError(err)
 
+	reloader := &broadcast.ConfigReloader{File: config.File, Config: &config}
+	reloader.Handle("Log", func() error {
+		config.Log.Apply()
+		return nil
+	})
+	if config.File != "" {
+		go reloader.Run()
+	}
+
 	channel := make(chan *broadcast.Audio, 100)
 	audioHandler := broadcast.AudioHandlerFunc(func(audio *broadcast.Audio) {
 		channel <- audio
 	})
 	alsaInput.SetAudioHandler(audioHandler)
 
-	go alsaInput.Run()
+	supervisor := &broadcast.Supervisor{}
+	supervisor.Start("alsa-input", &alsaInput)
 
 	time.Sleep(bufferDuration * 2)
 
-	for {
-		audio := <-channel
-		alsaOutput.AudioOut(audio)
+	outputStopped := make(chan bool)
+	go func() {
+		for audio := range channel {
+			alsaOutput.AudioOut(audio)
+		}
+		close(outputStopped)
+	}()
+
+	shutdown := &broadcast.Shutdown{}
+	config.Shutdown.Apply(shutdown)
+	shutdown.Add("alsa input", func() error {
+		err := supervisor.Stop("alsa-input")
+		close(channel)
+		return err
+	})
+	shutdown.Add("alsa output", func() error {
+		<-outputStopped
+		return nil
+	})
+	shutdown.Add("profilers", broadcast.StopProfilers)
+
+	checkError(shutdown.Wait())
+}
+
+// Prints the hash of the password read on stdin (for HttpServer.Auth.Users)
+func password(arguments []string) {
+	flags := flag.NewFlagSet("password", flag.ExitOnError)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s password < password-file\n", os.Args[0])
+		flags.PrintDefaults()
 	}
+
+	flags.Parse(arguments)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		checkError(err)
+	}
+
+	clearPassword := strings.TrimRight(line, "\r\n")
+	if clearPassword == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	hash, err := broadcast.HashHttpPassword(clearPassword)
+	checkError(err)
+
+	fmt.Println(hash)
+}
+
+// Prints a new API token and its hash (for HttpServer.Auth.Tokens)
+func token(arguments []string) {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s token\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(arguments)
+
+	newToken, err := broadcast.NewHttpToken()
+	checkError(err)
+
+	fmt.Printf("Token: %s\nHash: %s\n", newToken, broadcast.HashHttpToken(newToken))
 }
 
 func checkError(err error) {